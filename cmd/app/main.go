@@ -18,6 +18,14 @@ func main() {
 		panic(fmt.Errorf("config load error: %w", err))
 	}
 
+	if len(os.Args) > 1 {
+		if err := app.RunCommand(cfg, os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	application, err := app.New(cfg)
 	if err != nil {
 		panic(fmt.Errorf("app initialization error: %w", err))
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// createAPIKey returns a new key of the signed-in user and its ID.
+func (c *testClient) createAPIKey(scopes ...string) (string, string) {
+	c.t.Helper()
+	var out struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	if status := c.json(http.MethodPost, "/auth/api-keys", map[string]any{"name": "test", "scopes": scopes}, &out); status != http.StatusCreated {
+		c.t.Fatalf("create api key: status %d", status)
+	}
+	return out.Key, out.ID
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signIn(t, srv, "alice@example.com")
+	bob := signIn(t, srv, "bob@example.com")
+	fileID, _ := alice.uploadAs()
+	bobFileID, _ := bob.uploadAs()
+
+	readKey, readKeyID := alice.createAPIKey("files:read")
+	writeKey, _ := alice.createAPIKey("files:write")
+	reader := &testClient{t: t, base: srv.URL, token: readKey}
+	writer := &testClient{t: t, base: srv.URL, token: writeKey}
+
+	// A read-only key lists and downloads but cannot change anything.
+	if ids := reader.listFiles(); len(ids) != 1 || ids[0] != fileID {
+		t.Fatalf("files listed with a read key = %v, want [%s]", ids, fileID)
+	}
+	if resp := reader.do(http.MethodGet, "/image/"+fileID, nil, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /image with a read key: status %d, want 200", resp.StatusCode)
+	}
+	for name, resp := range map[string]*http.Response{
+		"upload":        reader.postFile([]byte("\x89PNG\r\n\x1a\n")),
+		"delete":        reader.do(http.MethodDelete, "/file/"+fileID, nil, nil),
+		"json to excel": reader.do(http.MethodPost, "/json-to-excel", strings.NewReader(`[{"a":1}]`), http.Header{"Content-Type": {"application/json"}}),
+	} {
+		if body := string(readBody(t, resp)); resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "api key lacks the") {
+			t.Errorf("%s with a read key: status %d %s, want 403", name, resp.StatusCode, body)
+		}
+	}
+
+	// A write key uploads, but may not read.
+	if resp := writer.postFile([]byte("\x89PNG\r\n\x1a\nmore")); resp.StatusCode != http.StatusCreated {
+		t.Errorf("upload with a write key: status %d, want 201", resp.StatusCode)
+	}
+	if resp := writer.do(http.MethodGet, "/files", nil, nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /files with a write key: status %d, want 403", resp.StatusCode)
+	}
+
+	// Keys act only for their user and cannot manage credentials.
+	if resp := reader.do(http.MethodGet, "/image/"+bobFileID, nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /image of another user's file: status %d, want 404", resp.StatusCode)
+	}
+	resp := reader.do(http.MethodGet, "/auth/api-keys", nil, nil)
+	if body := string(readBody(t, resp)); resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "a user token is required") {
+		t.Errorf("list api keys with a key: status %d %s, want 403", resp.StatusCode, body)
+	}
+
+	// A revoked key stops working at once.
+	if status := alice.json(http.MethodDelete, "/auth/api-keys/"+readKeyID, nil, nil); status != http.StatusOK {
+		t.Fatalf("revoke api key: status %d", status)
+	}
+	if resp := reader.do(http.MethodGet, "/files", nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /files with a revoked key: status %d, want 401", resp.StatusCode)
+	}
+}
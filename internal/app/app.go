@@ -2,14 +2,17 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/filehash/internal/config"
+	"github.com/filehash/internal/domain/service"
 	"github.com/filehash/internal/infrastructure/database"
 	infrahttp "github.com/filehash/internal/infrastructure/http"
 	infrarepo "github.com/filehash/internal/infrastructure/repository"
@@ -20,12 +23,21 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	uploadCleanupInterval  = time.Hour
+	sessionCleanupInterval = 6 * time.Hour
+)
+
 type App struct {
 	cfg     config.Config
 	log     *zap.Logger
 	db      *gorm.DB
 	router  http.Handler
 	server  *http.Server
+	auth    *usecase.AuthUseCase
+	oidc    *usecase.OIDCUseCase // nil unless OIDC login is configured
+	keys    *usecase.KeyUseCase
+	uploads *usecase.UploadUseCase
 }
 
 func New(cfg config.Config) (*App, error) {
@@ -44,29 +56,114 @@ func New(cfg config.Config) (*App, error) {
 	userRepo := infrarepo.NewUserRepository(db)
 	fileRepo := infrarepo.NewFileRepository(db)
 	excelRepo := infrarepo.NewExcelRepository(db)
+	blobRepo := infrarepo.NewBlobRepository(db)
+	rotationRepo := infrarepo.NewKeyRotationRepository(db)
+	uploadRepo := infrarepo.NewUploadSessionRepository(db)
+	sessionRepo := infrarepo.NewSessionRepository(db)
+	revokedRepo := infrarepo.NewRevokedTokenRepository(db)
+	apiKeyRepo := infrarepo.NewAPIKeyRepository(db)
+	totpRepo := infrarepo.NewTOTPRepository(db)
+	throttleRepo := infrarepo.NewLoginThrottleRepository(db)
+	oidcRepo := infrarepo.NewOIDCRepository(db)
+	shareRepo := infrarepo.NewShareRepository(db)
+	permRepo := infrarepo.NewFilePermissionRepository(db)
+	folderRepo := infrarepo.NewFolderRepository(db)
+	attrRepo := infrarepo.NewFileAttributeRepository(db)
 
-	storageSvc, err := infraservice.NewStorageService(cfg.UploadsDir)
+	storage, err := infraservice.NewStorageResolver(cfg.StorageBackend, storageOptions(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("new storage service: %w", err)
 	}
 
-	tokenSvc, err := infraservice.NewTokenService(cfg.JWTSecret, cfg.TokenTTL)
+	userKeys, err := loadSigningKeyring("user", cfg.JWTUserKeyFiles, cfg.Env, log)
+	if err != nil {
+		return nil, fmt.Errorf("load user token keys: %w", err)
+	}
+	fileKeys, err := loadSigningKeyring("file", cfg.JWTFileKeyFiles, cfg.Env, log)
+	if err != nil {
+		return nil, fmt.Errorf("load file token keys: %w", err)
+	}
+	if userKeys.SharesKeys(fileKeys) {
+		return nil, errors.New("user and file tokens must use different signing keys")
+	}
+
+	tokenSvc, err := infraservice.NewTokenService(fileKeys, cfg.TokenTTL)
 	if err != nil {
 		return nil, fmt.Errorf("new token service: %w", err)
 	}
 
-	authSvc, err := infraservice.NewAuthService(cfg.JWTSecret, cfg.TokenTTL)
+	hasher, err := infraservice.NewPasswordHasher(passwordHashOptions(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("new password hasher: %w", err)
+	}
+
+	authSvc, err := infraservice.NewAuthService(userKeys, cfg.TokenTTL, hasher)
 	if err != nil {
 		return nil, fmt.Errorf("new auth service: %w", err)
 	}
 
 	cryptoSvc := infraservice.NewCryptoService()
+	totpSvc := infraservice.NewTOTPService(cfg.TOTPIssuer)
+
+	mailer, err := infraservice.NewMailer(cfg.Mail.Backend, mailOptions(cfg), log)
+	if err != nil {
+		return nil, fmt.Errorf("new mailer: %w", err)
+	}
+	if cfg.Mail.Backend == infraservice.MailBackendLog && cfg.Env == "production" {
+		log.Warn("account emails are written to the log, not sent; set MAIL_BACKEND=smtp")
+	}
+
+	keySvc, err := infraservice.NewKeyService(cfg.KEKID, cfg.KEKs, cfg.KEKFile)
+	if err != nil {
+		return nil, fmt.Errorf("new key service: %w", err)
+	}
 
-	authUseCase := usecase.NewAuthUseCase(userRepo, authSvc, log)
-	fileUseCase := usecase.NewFileUseCase(fileRepo, storageSvc, cryptoSvc, tokenSvc, log)
-	excelUseCase := usecase.NewExcelUseCase(excelRepo, storageSvc, log)
+	var dedupSvc service.DedupService
+	if cfg.DedupEnabled {
+		dedupSvc, err = infraservice.NewDedupService(cfg.DedupSecret)
+		if err != nil {
+			return nil, fmt.Errorf("new dedup service: %w", err)
+		}
+	}
 
-	handlers := infrahttp.NewHandlers(cfg, log, authUseCase, fileUseCase, excelUseCase)
+	mfaUseCase := usecase.NewMFAUseCase(userRepo, totpRepo, authSvc, totpSvc, keySvc, log)
+	accountUseCase := usecase.NewAccountUseCase(userRepo, sessionRepo, revokedRepo, authSvc, mailer, cfg.PublicURL, log)
+	loginGuard := usecase.NewLoginGuard(throttleRepo, loginPolicy(cfg), log)
+	authUseCase := usecase.NewAuthUseCase(userRepo, sessionRepo, revokedRepo, authSvc, tokenSvc, mfaUseCase, accountUseCase, loginGuard, cfg.RefreshTokenTTL, log)
+	var oidcUseCase *usecase.OIDCUseCase
+	if cfg.OIDC.Issuer != "" {
+		provider, err := infraservice.NewOIDCProvider(oidcOptions(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("new oidc provider: %w", err)
+		}
+		oidcUseCase = usecase.NewOIDCUseCase(oidcRepo, userRepo, provider, authUseCase, log)
+		log.Info("oidc login enabled", zap.String("issuer", cfg.OIDC.Issuer))
+	}
+	apiKeyUseCase := usecase.NewAPIKeyUseCase(apiKeyRepo, userRepo, log)
+	fileUseCase := usecase.NewFileUseCase(fileRepo, permRepo, attrRepo, shareRepo, blobRepo, storage, cryptoSvc, tokenSvc, revokedRepo, keySvc, dedupSvc, cfg.HashAlgorithms, log)
+	// Link passwords are always argon2id: unlike account passwords they
+	// have no older hashes to stay compatible with.
+	shareHashOptions := passwordHashOptions(cfg)
+	shareHashOptions.Algorithm = infraservice.PasswordHashArgon2id
+	shareHasher, err := infraservice.NewPasswordHasher(shareHashOptions)
+	if err != nil {
+		return nil, fmt.Errorf("new share password hasher: %w", err)
+	}
+	folderUseCase := usecase.NewFolderUseCase(folderRepo, fileRepo, fileUseCase, log)
+	permUseCase := usecase.NewFilePermissionUseCase(permRepo, userRepo, fileUseCase, log)
+	shareUseCase := usecase.NewShareUseCase(shareRepo, userRepo, fileUseCase, shareHasher, loginGuard, log)
+	uploadUseCase := usecase.NewUploadUseCase(uploadRepo, fileUseCase, storage, cryptoSvc, keySvc, tokenSvc, cfg.MaxUpload, cfg.UploadExpiry, log)
+	excelUseCase := usecase.NewExcelUseCase(excelRepo, storage, log)
+	keyUseCase := usecase.NewKeyUseCase(fileRepo, blobRepo, rotationRepo, uploadRepo, totpRepo, keySvc, log)
+	storageUseCase := usecase.NewStorageUseCase(fileRepo, blobRepo, excelRepo, storage, log)
+	policy := usecase.NewPolicy(userRepo)
+	adminUseCase := usecase.NewAdminUseCase(userRepo, fileRepo, blobRepo, sessionRepo, policy, fileUseCase, uploadUseCase, loginGuard, log)
+
+	if err := storageUseCase.Backfill(context.Background()); err != nil {
+		return nil, fmt.Errorf("backfill storage backends: %w", err)
+	}
+
+	handlers := infrahttp.NewHandlers(cfg, log, authUseCase, accountUseCase, oidcUseCase, apiKeyUseCase, adminUseCase, mfaUseCase, fileUseCase, folderUseCase, permUseCase, shareUseCase, uploadUseCase, excelUseCase)
 
 	router := infrahttp.NewRouter(cfg, log, handlers)
 
@@ -80,11 +177,15 @@ func New(cfg config.Config) (*App, error) {
 	}
 
 	return &App{
-		cfg:    cfg,
-		log:    log,
-		db:     db,
-		router: router,
-		server: server,
+		cfg:     cfg,
+		log:     log,
+		db:      db,
+		router:  router,
+		server:  server,
+		auth:    authUseCase,
+		oidc:    oidcUseCase,
+		keys:    keyUseCase,
+		uploads: uploadUseCase,
 	}, nil
 }
 
@@ -96,11 +197,20 @@ func (a *App) Run() error {
 		}
 	}()
 
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if a.cfg.KEKRewrapOnStart {
+		go a.rewrapStaleKeys(jobCtx)
+	}
+	go a.cleanupUploads(jobCtx)
+	go a.cleanupSessions(jobCtx)
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
 	a.log.Info("shutting down server...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -118,6 +228,152 @@ func (a *App) Run() error {
 	return nil
 }
 
+func storageOptions(cfg config.Config) infraservice.StorageOptions {
+	return infraservice.StorageOptions{
+		BaseDir: cfg.UploadsDir,
+		S3: infraservice.S3Options{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			SessionToken:    cfg.S3.SessionToken,
+			Prefix:          cfg.S3.Prefix,
+			ForcePathStyle:  cfg.S3.ForcePathStyle,
+		},
+	}
+}
+
+func loginPolicy(cfg config.Config) usecase.LoginPolicy {
+	return usecase.LoginPolicy{
+		FreeAttempts: cfg.LoginFreeAttempts,
+		MaxLockout:   cfg.LoginMaxLockout,
+	}
+}
+
+func mailOptions(cfg config.Config) infraservice.MailOptions {
+	return infraservice.MailOptions{
+		From:      cfg.Mail.From,
+		OutboxDir: cfg.Mail.OutboxDir,
+		SMTP: infraservice.SMTPOptions{
+			Host:       cfg.Mail.SMTPHost,
+			Port:       cfg.Mail.SMTPPort,
+			Username:   cfg.Mail.SMTPUsername,
+			Password:   cfg.Mail.SMTPPassword,
+			RequireTLS: cfg.Mail.SMTPRequireTLS,
+		},
+	}
+}
+
+func oidcOptions(cfg config.Config) infraservice.OIDCOptions {
+	return infraservice.OIDCOptions{
+		Issuer:       cfg.OIDC.Issuer,
+		ClientID:     cfg.OIDC.ClientID,
+		ClientSecret: cfg.OIDC.ClientSecret,
+		RedirectURL:  cfg.OIDC.RedirectURL,
+		Scopes:       cfg.OIDC.Scopes,
+	}
+}
+
+func passwordHashOptions(cfg config.Config) infraservice.PasswordHashOptions {
+	return infraservice.PasswordHashOptions{
+		Algorithm: cfg.Password.Algorithm,
+		Argon2: infraservice.Argon2Params{
+			Memory:      cfg.Password.Argon2Memory,
+			Iterations:  cfg.Password.Argon2Iterations,
+			Parallelism: cfg.Password.Argon2Parallelism,
+		},
+		BcryptCost: cfg.Password.BcryptCost,
+	}
+}
+
+// loadSigningKeyring loads the token signing keys of kind from files.
+// Outside production, when none are configured, it generates a key that
+// lives only as long as the process; production refuses to start without
+// keys.
+func loadSigningKeyring(kind string, files []string, env string, log *zap.Logger) (*infraservice.SigningKeyring, error) {
+	if len(files) > 0 {
+		keys, err := infraservice.LoadSigningKeyring(files)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("token signing keys loaded", zap.String("tokens", kind), zap.Strings("kids", keys.KeyIDs()))
+		return keys, nil
+	}
+	if env == "production" {
+		return nil, fmt.Errorf("no %s token signing keys configured; set JWT_%s_KEY_FILES", kind, strings.ToUpper(kind))
+	}
+	log.Warn("no token signing keys configured; tokens will not survive a restart or verify on other replicas",
+		zap.String("tokens", kind))
+	return infraservice.NewEphemeralSigningKeyring()
+}
+
+// rewrapStaleKeys moves data keys still wrapped under a retired-to-be KEK
+// onto the active one. It only starts a run when there is work to do.
+func (a *App) rewrapStaleKeys(ctx context.Context) {
+	status, err := a.keys.Status(ctx)
+	if err != nil {
+		a.log.Warn("key status failed", zap.Error(err))
+		return
+	}
+	if status.Unkeyed > 0 {
+		a.log.Warn("files without a stored data key cannot be decrypted; import their upload tokens with keys import-legacy", zap.Int64("count", status.Unkeyed))
+	}
+	if status.Stale == 0 {
+		return
+	}
+	if _, err := a.keys.Rewrap(ctx, "startup"); err != nil && !errors.Is(err, context.Canceled) {
+		a.log.Warn("key rotation failed", zap.Error(err))
+	}
+}
+
+// cleanupUploads removes expired resumable uploads and their staged parts
+// now and then every uploadCleanupInterval.
+func (a *App) cleanupUploads(ctx context.Context) {
+	ticker := time.NewTicker(uploadCleanupInterval)
+	defer ticker.Stop()
+	for {
+		n, err := a.uploads.CleanupExpired(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			a.log.Warn("upload cleanup failed", zap.Error(err))
+		} else if n > 0 {
+			a.log.Info("expired uploads removed", zap.Int("count", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanupSessions drops expired refresh sessions, token revocations and
+// unfinished OIDC logins now and then every sessionCleanupInterval.
+func (a *App) cleanupSessions(ctx context.Context) {
+	ticker := time.NewTicker(sessionCleanupInterval)
+	defer ticker.Stop()
+	for {
+		n, err := a.auth.PurgeExpired(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			a.log.Warn("session cleanup failed", zap.Error(err))
+		} else if n > 0 {
+			a.log.Info("expired sessions removed", zap.Int64("count", n))
+		}
+		if a.oidc != nil {
+			if n, err := a.oidc.PurgeExpired(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				a.log.Warn("oidc state cleanup failed", zap.Error(err))
+			} else if n > 0 {
+				a.log.Info("expired oidc logins removed", zap.Int64("count", n))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (a *App) Close() error {
 	sqlDB, err := a.db.DB()
 	if err == nil {
@@ -125,4 +381,3 @@ func (a *App) Close() error {
 	}
 	return nil
 }
-
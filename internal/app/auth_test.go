@@ -0,0 +1,120 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// uploadAs uploads a small PNG and returns its ID and file token.
+func (c *testClient) uploadAs() (string, string) {
+	c.t.Helper()
+	resp := c.postFile([]byte("\x89PNG\r\n\x1a\nimage bytes"))
+	var out struct {
+		FileID string `json:"file_id"`
+		Token  string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || resp.StatusCode != http.StatusCreated {
+		c.t.Fatalf("upload: status %d, %v", resp.StatusCode, err)
+	}
+	return out.FileID, out.Token
+}
+
+// listFiles returns the IDs on the first page of GET /files.
+func (c *testClient) listFiles() []string {
+	c.t.Helper()
+	var out struct {
+		Files []struct {
+			FileID string `json:"file_id"`
+		} `json:"files"`
+	}
+	if status := c.json(http.MethodGet, "/files", nil, &out); status != http.StatusOK {
+		c.t.Fatalf("GET /files: status %d", status)
+	}
+	ids := make([]string, len(out.Files))
+	for i, f := range out.Files {
+		ids[i] = f.FileID
+	}
+	return ids
+}
+
+func TestUserTokenAuthentication(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signIn(t, srv, "alice@example.com")
+	bob := signIn(t, srv, "bob@example.com")
+	anon := &testClient{t: t, base: srv.URL}
+
+	fileID, fileToken := alice.uploadAs()
+	otherID, otherToken := bob.uploadAs()
+
+	// Routes that need a user reject missing, malformed and foreign tokens;
+	// a file token is not a user token.
+	for name, header := range map[string]string{
+		"no header":  "",
+		"not bearer": "Basic YWxpY2U6c2VjcmV0",
+		"garbage":    "Bearer not-a-token",
+		"file token": "Bearer " + fileToken,
+	} {
+		h := http.Header{}
+		if header != "" {
+			h.Set("Authorization", header)
+		}
+		if resp := anon.do(http.MethodGet, "/files", nil, h); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET /files with %s: status %d, want 401", name, resp.StatusCode)
+		}
+	}
+	// A bad token on an upload is refused, not taken as anonymous.
+	bad := &testClient{t: t, base: srv.URL, token: "not-a-token"}
+	if resp := bad.postFile([]byte("\x89PNG\r\n\x1a\n")); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("upload with a bad token: status %d, want 401", resp.StatusCode)
+	}
+
+	if ids := alice.listFiles(); len(ids) != 1 || ids[0] != fileID {
+		t.Fatalf("alice's files = %v, want [%s]", ids, fileID)
+	}
+	if ids := bob.listFiles(); len(ids) != 1 || ids[0] != otherID {
+		t.Fatalf("bob's files = %v, want [%s]", ids, otherID)
+	}
+
+	// Downloads accept the owner's user token or the file's own token.
+	for name, tt := range map[string]struct {
+		token string
+		want  int
+	}{
+		"owner":                 {alice.token, http.StatusOK},
+		"file token":            {fileToken, http.StatusOK},
+		"another user":          {bob.token, http.StatusNotFound},
+		"token of another file": {otherToken, http.StatusForbidden},
+	} {
+		c := &testClient{t: t, base: srv.URL, token: tt.token}
+		if resp := c.do(http.MethodGet, "/image/"+fileID, nil, nil); resp.StatusCode != tt.want {
+			t.Errorf("GET /image as %s: status %d, want %d", name, resp.StatusCode, tt.want)
+		}
+	}
+
+	// Logging out ends the access token at once.
+	if status := alice.json(http.MethodPost, "/auth/logout", map[string]any{}, nil); status != http.StatusOK {
+		t.Fatalf("logout: status %d", status)
+	}
+	if resp := alice.do(http.MethodGet, "/files", nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("GET /files after logout: status %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestRequireMFA(t *testing.T) {
+	t.Setenv("REQUIRE_MFA", "true")
+	srv := newTestServer(t)
+	alice := signIn(t, srv, "alice@example.com")
+
+	// A session without a second factor may set one up but not use files
+	// or mint credentials that reach them.
+	if resp := alice.do(http.MethodGet, "/files", nil, nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /files: status %d, want 403", resp.StatusCode)
+	}
+	if status := alice.json(http.MethodPost, "/auth/api-keys", map[string]any{"scopes": []string{"files:read"}}, nil); status != http.StatusForbidden {
+		t.Errorf("create api key: status %d, want 403", status)
+	}
+	if status := alice.json(http.MethodPost, "/auth/2fa/enroll", nil, nil); status != http.StatusOK {
+		t.Errorf("enroll: status %d, want 200", status)
+	}
+}
@@ -0,0 +1,395 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/filehash/internal/config"
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/infrastructure/database"
+	infrarepo "github.com/filehash/internal/infrastructure/repository"
+	infraservice "github.com/filehash/internal/infrastructure/service"
+	"github.com/filehash/internal/usecase"
+	"github.com/filehash/pkg/logger"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const commandUsage = `usage:
+  migrate                 apply database migrations and exit
+  migrate-storage [-delete-source] <backend>
+                          copy every stored blob to <backend>, verify it and
+                          switch the record over; safe to rerun after a crash
+  keys status             show KEKs and how many data keys each one wraps
+  keys rotate [new-id]    add a KEK to the keyfile (if new-id is given), make
+                          it active and re-wrap every data key under it
+  keys retire <id>        remove an unreferenced KEK from the keyfile
+  keys import-legacy      read file tokens issued before data keys were
+                          stored server-side from stdin, one per line, and
+                          store the keys they carry
+  users unlock <email>    lift a login lockout and forget failed attempts
+  users role <email> <role>
+                          give a user the role user or admin, e.g. to set
+                          up the first administrator
+  jwt keygen [-alg EdDSA|ES256] <file>
+                          write a new token signing key to <file> (PEM) and
+                          print its key ID`
+
+// RunCommand executes a one-off maintenance command instead of the server.
+func RunCommand(cfg config.Config, args []string, out io.Writer) error {
+	switch {
+	case len(args) == 1 && args[0] == "migrate":
+		return withDatabase(cfg, func(*gorm.DB, *zap.Logger) error {
+			fmt.Fprintln(out, "migrations applied")
+			return nil
+		})
+	case len(args) >= 2 && args[0] == "migrate-storage":
+		return runMigrateStorage(cfg, args[1:], out)
+	case len(args) >= 2 && args[0] == "keys":
+		return runKeysCommand(cfg, args[1:], out)
+	case len(args) == 3 && args[0] == "users" && args[1] == "unlock":
+		return runUnlock(cfg, args[2], out)
+	case len(args) == 4 && args[0] == "users" && args[1] == "role":
+		return runSetRole(cfg, args[2], args[3], out)
+	case len(args) >= 2 && args[0] == "jwt" && args[1] == "keygen":
+		return runJWTKeygen(args[2:], out)
+	}
+	return errors.New(commandUsage)
+}
+
+func runMigrateStorage(cfg config.Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate-storage", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	deleteSource := flags.Bool("delete-source", false, "remove source copies after switching")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errors.New(commandUsage)
+	}
+	target := flags.Arg(0)
+	if target == infraservice.StorageBackendMemory {
+		return errors.New("cannot migrate to the memory backend")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	return withDatabase(cfg, func(db *gorm.DB, log *zap.Logger) error {
+		storage, err := infraservice.NewStorageResolver(cfg.StorageBackend, storageOptions(cfg))
+		if err != nil {
+			return fmt.Errorf("new storage: %w", err)
+		}
+		storageUseCase := usecase.NewStorageUseCase(
+			infrarepo.NewFileRepository(db),
+			infrarepo.NewBlobRepository(db),
+			infrarepo.NewExcelRepository(db),
+			storage,
+			log,
+		)
+		if err := storageUseCase.Backfill(ctx); err != nil {
+			return fmt.Errorf("backfill storage backends: %w", err)
+		}
+
+		report, err := storageUseCase.MigrateStorage(ctx, usecase.MigrateStorageRequest{
+			Target:       target,
+			DeleteSource: *deleteSource,
+			Progress: func(p usecase.MigrateStorageProgress) {
+				fmt.Fprintf(out, "%s: %d copied (%d bytes), %d failed\n", p.Kind, p.Copied, p.Bytes, p.Failed)
+			},
+		})
+		if err != nil {
+			return err
+		}
+		var failed int64
+		for _, p := range report {
+			failed += p.Failed
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d items failed to migrate; rerun to retry", failed)
+		}
+		fmt.Fprintf(out, "all blobs are on %s\n", target)
+		return nil
+	})
+}
+
+func runKeysCommand(cfg config.Config, args []string, out io.Writer) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	switch args[0] {
+	case "status":
+		return withKeys(cfg, func(keys *usecase.KeyUseCase) error {
+			return printKeyStatus(ctx, keys, out)
+		})
+	case "rotate":
+		if len(args) > 1 {
+			if len(cfg.KEKs) > 0 {
+				return errors.New("KEKs are configured through KEK/KEKS; add the new key there and set KEK_ID instead")
+			}
+			if err := infraservice.AddKeyringKey(cfg.KEKFile, args[1]); err != nil {
+				return fmt.Errorf("add kek: %w", err)
+			}
+			fmt.Fprintf(out, "added kek %s to %s\n", args[1], cfg.KEKFile)
+		}
+		return withKeys(cfg, func(keys *usecase.KeyUseCase) error {
+			rotation, err := keys.Rewrap(ctx, "cli")
+			if rotation != nil {
+				fmt.Fprintf(out, "rotation %s: %s, %d/%d re-wrapped, %d failed\n",
+					rotation.ID, rotation.Status, rotation.Rewrapped, rotation.Total, rotation.Failed)
+			}
+			return err
+		})
+	case "retire":
+		if len(args) != 2 {
+			return errors.New(commandUsage)
+		}
+		id := args[1]
+		return withKeys(cfg, func(keys *usecase.KeyUseCase) error {
+			if err := keys.CheckRetire(ctx, id); err != nil {
+				return err
+			}
+			if len(cfg.KEKs) > 0 {
+				fmt.Fprintf(out, "kek %s is unreferenced; remove it from KEK/KEKS\n", id)
+				return nil
+			}
+			if err := infraservice.RemoveKeyringKey(cfg.KEKFile, id); err != nil {
+				return fmt.Errorf("remove kek: %w", err)
+			}
+			fmt.Fprintf(out, "retired kek %s\n", id)
+			return nil
+		})
+	case "import-legacy":
+		if len(args) != 1 {
+			return errors.New(commandUsage)
+		}
+		return withFiles(cfg, func(files *usecase.FileUseCase) error {
+			return importLegacyKeys(ctx, files, os.Stdin, out)
+		})
+	}
+	return errors.New(commandUsage)
+}
+
+// importLegacyKeys stores the data keys carried by the file tokens read
+// from in, one per line. Files that already have a key are skipped, so the
+// same tokens can be fed again.
+func importLegacyKeys(ctx context.Context, files *usecase.FileUseCase, in io.Reader, out io.Writer) error {
+	var imported, skipped, failed int
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		token := strings.TrimSpace(scanner.Text())
+		if token == "" {
+			continue
+		}
+		fileID, key, err := infraservice.ParseLegacyFileToken(token)
+		if err == nil {
+			err = files.ImportLegacyKey(ctx, fileID, key)
+		}
+		switch {
+		case err == nil:
+			imported++
+			fmt.Fprintf(out, "%s: imported\n", fileID)
+		case strings.Contains(err.Error(), "already has a data key"):
+			skipped++
+			fmt.Fprintf(out, "%s: already has a data key\n", fileID)
+		default:
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			failed++
+			fmt.Fprintf(out, "line %d: %v\n", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read tokens: %w", err)
+	}
+	fmt.Fprintf(out, "%d imported, %d skipped, %d failed\n", imported, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d tokens failed to import", failed)
+	}
+	return nil
+}
+
+func runUnlock(cfg config.Config, email string, out io.Writer) error {
+	return withDatabase(cfg, func(db *gorm.DB, log *zap.Logger) error {
+		guard := usecase.NewLoginGuard(infrarepo.NewLoginThrottleRepository(db), loginPolicy(cfg), log)
+		cleared, err := guard.Unlock(context.Background(), email)
+		if err != nil {
+			return err
+		}
+		if !cleared {
+			fmt.Fprintf(out, "no failed logins recorded for %s\n", email)
+			return nil
+		}
+		fmt.Fprintf(out, "unlocked %s\n", email)
+		return nil
+	})
+}
+
+// runSetRole changes a role without the admin API's checks: it is how the
+// first administrator is made, and how access is regained when none is
+// left.
+func runSetRole(cfg config.Config, email, role string, out io.Writer) error {
+	if !entity.ValidRole(role) {
+		return fmt.Errorf("invalid role %q; use one of %s", role, strings.Join(entity.Roles, ", "))
+	}
+	return withDatabase(cfg, func(db *gorm.DB, log *zap.Logger) error {
+		ctx := context.Background()
+		userRepo := infrarepo.NewUserRepository(db)
+		user, err := userRepo.FindByEmail(ctx, strings.TrimSpace(strings.ToLower(email)))
+		if err != nil {
+			if err == utils.ErrRecordNotFound {
+				return fmt.Errorf("no user with email %s", email)
+			}
+			return fmt.Errorf("find user: %w", err)
+		}
+		if err := userRepo.UpdateRole(ctx, user.ID, role); err != nil {
+			return fmt.Errorf("update role: %w", err)
+		}
+		fmt.Fprintf(out, "%s is now %s\n", user.Email, role)
+		return nil
+	})
+}
+
+func runJWTKeygen(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("jwt keygen", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	alg := flags.String("alg", infraservice.SigningAlgEdDSA, "signing algorithm")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errors.New(commandUsage)
+	}
+	kid, err := infraservice.GenerateSigningKey(*alg, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "wrote %s key %s to %s\n", *alg, kid, flags.Arg(0))
+	return nil
+}
+
+// withDatabase opens and migrates the database for the duration of fn.
+func withDatabase(cfg config.Config, fn func(*gorm.DB, *zap.Logger) error) error {
+	log := logger.New(cfg.Env).WithOptions(zap.IncreaseLevel(zap.WarnLevel))
+	defer func() { _ = log.Sync() }()
+
+	db, err := database.Open(cfg, log)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	}()
+	if err := database.Migrate(db, log); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return fn(db, log)
+}
+
+func withKeys(cfg config.Config, fn func(*usecase.KeyUseCase) error) error {
+	return withDatabase(cfg, func(db *gorm.DB, log *zap.Logger) error {
+		keySvc, err := infraservice.NewKeyService(cfg.KEKID, cfg.KEKs, cfg.KEKFile)
+		if err != nil {
+			return fmt.Errorf("new key service: %w", err)
+		}
+		return fn(usecase.NewKeyUseCase(
+			infrarepo.NewFileRepository(db),
+			infrarepo.NewBlobRepository(db),
+			infrarepo.NewKeyRotationRepository(db),
+			infrarepo.NewUploadSessionRepository(db),
+			infrarepo.NewTOTPRepository(db),
+			keySvc,
+			log,
+		))
+	})
+}
+
+// withFiles builds the file use case for commands that work on stored
+// files. They issue no tokens, so it gets no token service.
+func withFiles(cfg config.Config, fn func(*usecase.FileUseCase) error) error {
+	return withDatabase(cfg, func(db *gorm.DB, log *zap.Logger) error {
+		keySvc, err := infraservice.NewKeyService(cfg.KEKID, cfg.KEKs, cfg.KEKFile)
+		if err != nil {
+			return fmt.Errorf("new key service: %w", err)
+		}
+		storage, err := infraservice.NewStorageResolver(cfg.StorageBackend, storageOptions(cfg))
+		if err != nil {
+			return fmt.Errorf("new storage: %w", err)
+		}
+		return fn(usecase.NewFileUseCase(
+			infrarepo.NewFileRepository(db),
+			infrarepo.NewFilePermissionRepository(db),
+			infrarepo.NewFileAttributeRepository(db),
+			infrarepo.NewShareRepository(db),
+			infrarepo.NewBlobRepository(db),
+			storage,
+			infraservice.NewCryptoService(),
+			nil,
+			infrarepo.NewRevokedTokenRepository(db),
+			keySvc,
+			nil,
+			cfg.HashAlgorithms,
+			log,
+		))
+	})
+}
+
+func printKeyStatus(ctx context.Context, keys *usecase.KeyUseCase, out io.Writer) error {
+	status, err := keys.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	ids := map[string]struct{}{}
+	for _, id := range status.KeyIDs {
+		ids[id] = struct{}{}
+	}
+	for id := range status.FileKeys {
+		ids[id] = struct{}{}
+	}
+	for id := range status.BlobKeys {
+		ids[id] = struct{}{}
+	}
+	for id := range status.TOTPKeys {
+		ids[id] = struct{}{}
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	fmt.Fprintf(out, "%-20s %-8s %10s %10s %10s\n", "KEK", "STATE", "FILES", "BLOBS", "TOTP")
+	known := map[string]bool{}
+	for _, id := range status.KeyIDs {
+		known[id] = true
+	}
+	for _, id := range sorted {
+		state := "inactive"
+		switch {
+		case id == status.ActiveKeyID:
+			state = "active"
+		case !known[id]:
+			state = "missing"
+		}
+		fmt.Fprintf(out, "%-20s %-8s %10d %10d %10d\n", id, state, status.FileKeys[id], status.BlobKeys[id], status.TOTPKeys[id])
+	}
+
+	fmt.Fprintf(out, "stale data keys: %d\n", status.Stale)
+	if status.Unkeyed > 0 {
+		fmt.Fprintf(out, "files without a data key (not decryptable until imported with keys import-legacy): %d\n", status.Unkeyed)
+	}
+	if last := status.LastRotation; last != nil {
+		fmt.Fprintf(out, "last rotation: %s %s to %s at %s (%d/%d re-wrapped, %d failed)\n",
+			last.ID, last.Status, last.TargetKeyID, last.StartedAt.Format("2006-01-02T15:04:05Z"),
+			last.Rewrapped, last.Total, last.Failed)
+	}
+	return nil
+}
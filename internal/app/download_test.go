@@ -0,0 +1,251 @@
+package app
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/filehash/internal/config"
+)
+
+// newTestServer runs the full application on SQLite and local storage in
+// a temporary directory.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("APP_ENV", "test")
+	t.Setenv("DATABASE_PATH", filepath.Join(dir, "test.db"))
+	t.Setenv("UPLOADS_DIR", filepath.Join(dir, "uploads"))
+	t.Setenv("KEK_FILE", filepath.Join(dir, "kek.json"))
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "bcrypt")
+	t.Setenv("BCRYPT_COST", "4")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatalf("new app: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := a.db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	srv := httptest.NewServer(a.router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type testClient struct {
+	t     *testing.T
+	base  string
+	token string
+}
+
+func (c *testClient) do(method, path string, body io.Reader, header http.Header) *http.Response {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.token != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (c *testClient) json(method, path string, in any, out any) int {
+	c.t.Helper()
+	data, _ := json.Marshal(in)
+	resp := c.do(method, path, bytes.NewReader(data), http.Header{"Content-Type": {"application/json"}})
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			c.t.Fatalf("%s %s: decode: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// signIn registers email and returns a client authenticated as the user.
+func signIn(t *testing.T, srv *httptest.Server, email string) *testClient {
+	t.Helper()
+	c := &testClient{t: t, base: srv.URL}
+	creds := map[string]string{"email": email, "password": "correct horse battery"}
+	if status := c.json(http.MethodPost, "/auth/register", creds, nil); status != http.StatusAccepted {
+		t.Fatalf("register: status %d", status)
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	if status := c.json(http.MethodPost, "/auth/login", creds, &login); status != http.StatusOK || login.Token == "" {
+		t.Fatalf("login: status %d", status)
+	}
+	c.token = login.Token
+	return c
+}
+
+// upload stores a PNG of size bytes and returns its ID and content.
+func (c *testClient) upload(size int) (string, []byte) {
+	c.t.Helper()
+	content := make([]byte, size)
+	rand.Read(content)
+	copy(content, "\x89PNG\r\n\x1a\n")
+	resp := c.postFile(content)
+	var out struct {
+		FileID string `json:"file_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || out.FileID == "" {
+		c.t.Fatalf("upload: status %d, %v", resp.StatusCode, err)
+	}
+	return out.FileID, content
+}
+
+// postFile sends content to /upload as a multipart form.
+func (c *testClient) postFile(content []byte) *http.Response {
+	c.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "photo.png")
+	fw.Write(content)
+	mw.Close()
+	return c.do(http.MethodPost, "/upload", &body, http.Header{"Content-Type": {mw.FormDataContentType()}})
+}
+
+func readBody(t *testing.T, resp *http.Response) []byte {
+	t.Helper()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return data
+}
+
+func TestDownloadRanges(t *testing.T) {
+	srv := newTestServer(t)
+	c := signIn(t, srv, "alice@example.com")
+	// Several encryption chunks, so ranges cross chunk boundaries.
+	id, content := c.upload(200_000)
+	size := len(content)
+	path := "/image/" + id
+
+	full := c.do(http.MethodGet, path, nil, nil)
+	if full.StatusCode != http.StatusOK || full.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("GET: status %d, Accept-Ranges %q", full.StatusCode, full.Header.Get("Accept-Ranges"))
+	}
+	if !bytes.Equal(readBody(t, full), content) {
+		t.Fatal("GET: content differs")
+	}
+	etag, modified := full.Header.Get("ETag"), full.Header.Get("Last-Modified")
+	if etag != `"`+id+`"` || modified == "" {
+		t.Fatalf("ETag = %q, Last-Modified = %q", etag, modified)
+	}
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		status    int
+		from, to  int // expected body content[from:to] for 200 and 206
+		wantRange string
+	}{
+		{"range", http.Header{"Range": {"bytes=100-199"}}, http.StatusPartialContent, 100, 200, fmt.Sprintf("bytes 100-199/%d", size)},
+		{"across chunks", http.Header{"Range": {"bytes=65530-131080"}}, http.StatusPartialContent, 65530, 131081, fmt.Sprintf("bytes 65530-131080/%d", size)},
+		{"open-ended", http.Header{"Range": {fmt.Sprintf("bytes=%d-", size-5)}}, http.StatusPartialContent, size - 5, size, ""},
+		{"suffix", http.Header{"Range": {"bytes=-10"}}, http.StatusPartialContent, size - 10, size, ""},
+		{"unsatisfiable", http.Header{"Range": {fmt.Sprintf("bytes=%d-", size)}}, http.StatusRequestedRangeNotSatisfiable, 0, 0, fmt.Sprintf("bytes */%d", size)},
+		{"If-Range with current ETag", http.Header{"Range": {"bytes=0-9"}, "If-Range": {etag}}, http.StatusPartialContent, 0, 10, ""},
+		{"If-Range with stale ETag", http.Header{"Range": {"bytes=0-9"}, "If-Range": {`"other"`}}, http.StatusOK, 0, size, ""},
+		{"If-Range with weak ETag", http.Header{"Range": {"bytes=0-9"}, "If-Range": {"W/" + etag}}, http.StatusOK, 0, size, ""},
+		{"If-Range with Last-Modified", http.Header{"Range": {"bytes=0-9"}, "If-Range": {modified}}, http.StatusPartialContent, 0, 10, ""},
+		{"If-None-Match", http.Header{"If-None-Match": {etag}}, http.StatusNotModified, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := c.do(http.MethodGet, path, nil, tt.header)
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.wantRange != "" && resp.Header.Get("Content-Range") != tt.wantRange {
+				t.Errorf("Content-Range = %q, want %q", resp.Header.Get("Content-Range"), tt.wantRange)
+			}
+			if tt.status == http.StatusOK || tt.status == http.StatusPartialContent {
+				if !bytes.Equal(body, content[tt.from:tt.to]) {
+					t.Fatalf("body is %d bytes, want content[%d:%d]", len(body), tt.from, tt.to)
+				}
+				if got := resp.Header.Get("Content-Length"); got != strconv.Itoa(tt.to-tt.from) {
+					t.Errorf("Content-Length = %s, want %d", got, tt.to-tt.from)
+				}
+			}
+		})
+	}
+
+	t.Run("multiple ranges", func(t *testing.T) {
+		resp := c.do(http.MethodGet, path, nil, http.Header{"Range": {"bytes=0-9,70000-70009"}})
+		if resp.StatusCode != http.StatusPartialContent {
+			t.Fatalf("status %d", resp.StatusCode)
+		}
+		mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if err != nil || mediaType != "multipart/byteranges" {
+			t.Fatalf("Content-Type = %q", resp.Header.Get("Content-Type"))
+		}
+		mr := multipart.NewReader(resp.Body, params["boundary"])
+		for _, from := range []int{0, 70000} {
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Fatalf("part at %d: %v", from, err)
+			}
+			got, _ := io.ReadAll(part)
+			if !bytes.Equal(got, content[from:from+10]) {
+				t.Fatalf("part at %d differs", from)
+			}
+		}
+	})
+}
+
+func TestShareDownloadLimitIgnoresRange(t *testing.T) {
+	srv := newTestServer(t)
+	c := signIn(t, srv, "alice@example.com")
+	id, content := c.upload(10_000)
+
+	var share struct {
+		URL string `json:"url"`
+	}
+	if status := c.json(http.MethodPost, "/file/"+id+"/shares", map[string]any{"max_downloads": 2}, &share); status != http.StatusCreated {
+		t.Fatalf("create share: status %d", status)
+	}
+	path := share.URL[strings.LastIndex(share.URL, "/s/"):]
+	anon := &testClient{t: t, base: srv.URL}
+
+	resp := anon.do(http.MethodGet, path, nil, http.Header{"Range": {"bytes=100-199"}, "If-None-Match": {`"` + id + `"`}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Accept-Ranges") != "" || resp.Header.Get("ETag") != "" {
+		t.Fatalf("status %d, Accept-Ranges %q, ETag %q", resp.StatusCode, resp.Header.Get("Accept-Ranges"), resp.Header.Get("ETag"))
+	}
+	if !bytes.Equal(readBody(t, resp), content) {
+		t.Fatal("limited link did not serve the whole file")
+	}
+	if resp := anon.do(http.MethodGet, path, nil, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("second download: status %d", resp.StatusCode)
+	}
+	if resp := anon.do(http.MethodGet, path, nil, nil); resp.StatusCode != http.StatusGone {
+		t.Fatalf("third download: status %d, want 410", resp.StatusCode)
+	}
+}
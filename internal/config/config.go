@@ -1,8 +1,6 @@
 package config
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
@@ -19,15 +17,36 @@ const (
 	defaultUploadsDir   = "uploads"
 	defaultDatabasePath = "data/filehash.db"
 	defaultTokenTTL     = 15 * time.Minute
+	defaultRefreshTTL   = 30 * 24 * time.Hour
 	defaultMaxUploadMB  = 10
+	defaultTransferTTL  = 30 * time.Minute
+	defaultUploadExpiry = 24 * time.Hour
 	defaultDBType       = "sqlite"
+	defaultKEKID        = "kek-1"
+	defaultKEKFile      = "data/kek.json"
+	defaultStorage      = "local"
+	defaultS3Region     = "us-east-1"
+	defaultTOTPIssuer   = "FileHash"
+	defaultOIDCScopes   = "openid email profile"
+	defaultMailBackend  = "log"
+	defaultMailFrom     = "FileHash <no-reply@localhost>"
+	defaultOutboxDir    = "data/outbox"
+	defaultSMTPPort     = "587"
+	defaultLoginFree    = 5
+	defaultMaxLockout   = 15 * time.Minute
+	defaultPasswordHash = "argon2id"
+	// Argon2id defaults follow the second recommended option of RFC 9106.
+	defaultArgon2Memory = 64 * 1024 // KiB
+	defaultArgon2Time   = 3
+	defaultArgon2Lanes  = 4
+	defaultBcryptCost   = 12
 )
 
 type DBType string
 
 const (
-	DBTypeSQLite    DBType = "sqlite"
-	DBTypePostgres  DBType = "postgres"
+	DBTypeSQLite   DBType = "sqlite"
+	DBTypePostgres DBType = "postgres"
 )
 
 type Config struct {
@@ -38,10 +57,114 @@ type Config struct {
 	DatabaseType DBType
 	DatabasePath string
 	DatabaseDSN  string // Full DSN for PostgreSQL
-	JWTSecret    string
 	TokenTTL     time.Duration
 	MaxUpload    int64
-	CORSOrigins  []string
+	// JWTUserKeyFiles and JWTFileKeyFiles list PEM keys for user and file
+	// tokens. The first key of each list signs; the rest only verify, which
+	// lets a replaced key keep verifying the tokens it signed. Without keys
+	// a per-process key is generated.
+	JWTUserKeyFiles []string
+	JWTFileKeyFiles []string
+	// RefreshTokenTTL is how long a refresh token stays usable; every
+	// refresh starts the period anew.
+	RefreshTokenTTL time.Duration
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer string
+	// RequireMFA denies user tokens from logins without a second factor
+	// access to files; such users can still enroll.
+	RequireMFA bool
+	// LoginFreeAttempts failed logins per account are allowed before
+	// further attempts are delayed; the delay doubles with each failure up
+	// to LoginMaxLockout.
+	LoginFreeAttempts int
+	LoginMaxLockout   time.Duration
+	// Password selects how new password hashes are made; hashes made under
+	// other settings keep verifying and are replaced at the next login.
+	Password PasswordConfig
+	// OIDC enables login through an external OpenID Connect provider when
+	// its Issuer is set.
+	OIDC OIDCConfig
+	// PublicURL is where clients reach the service; links in emails start
+	// with it.
+	PublicURL string
+	// RequireEmailVerification refuses uploads from users who have not
+	// confirmed their address.
+	RequireEmailVerification bool
+	Mail                     MailConfig
+	// TransferTimeout bounds a single streaming upload or download.
+	TransferTimeout time.Duration
+	// UploadExpiry is how long an unfinished resumable upload is kept.
+	UploadExpiry time.Duration
+	// AnonymousUploads accepts uploads without a user token; such files
+	// have no owner and are only reachable with their file token.
+	AnonymousUploads bool
+	// HashAlgorithms lists the digests computed over every upload; sha256
+	// is always included.
+	HashAlgorithms []string
+	// DedupEnabled stores identical uploads once, addressed by an HMAC of
+	// the plaintext keyed with DedupSecret.
+	DedupEnabled bool
+	DedupSecret  string
+	// KEKs holds base64-encoded key-encryption keys by ID; KEKID selects
+	// the active one. When empty the keyring at KEKFile is used (and
+	// created if missing).
+	KEKs    map[string]string
+	KEKID   string
+	KEKFile string
+	// KEKRewrapOnStart re-wraps data keys held under inactive KEKs in the
+	// background after startup.
+	KEKRewrapOnStart bool
+	// StorageBackend selects where blobs are kept: local, s3 or memory.
+	StorageBackend string
+	S3             S3Config
+	CORSOrigins    []string
+}
+
+// PasswordConfig configures password hashing.
+type PasswordConfig struct {
+	// Algorithm is argon2id or bcrypt.
+	Algorithm         string
+	Argon2Memory      uint32 // KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	BcryptCost        int
+}
+
+// OIDCConfig registers the service as a client of an OpenID Connect
+// provider.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for a public client
+	// RedirectURL is the callback registered at the provider.
+	RedirectURL string
+	Scopes      []string
+}
+
+// MailConfig configures how account emails are delivered.
+type MailConfig struct {
+	// Backend is log, file (an .eml outbox in OutboxDir) or smtp.
+	Backend      string
+	From         string
+	OutboxDir    string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	// SMTPRequireTLS refuses relays that do not offer STARTTLS.
+	SMTPRequireTLS bool
+}
+
+// S3Config configures the S3-compatible storage backend.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Prefix          string
+	ForcePathStyle  bool
 }
 
 func (c Config) HTTPAddr() string {
@@ -78,9 +201,58 @@ func Load() (Config, error) {
 		DatabaseType: DBType(valueOrDefault("DB_TYPE", defaultDBType)),
 		DatabasePath: valueOrDefault("DATABASE_PATH", defaultDatabasePath),
 		DatabaseDSN:  os.Getenv("DATABASE_URL"), // Full DSN for PostgreSQL
-		JWTSecret:    os.Getenv("JWT_SECRET"),
 		TokenTTL:     defaultTokenTTL,
 		MaxUpload:    defaultMaxUploadMB * 1024 * 1024,
+
+		JWTUserKeyFiles:   listValue("JWT_USER_KEY_FILES"),
+		JWTFileKeyFiles:   listValue("JWT_FILE_KEY_FILES"),
+		RefreshTokenTTL:   defaultRefreshTTL,
+		TOTPIssuer:        valueOrDefault("TOTP_ISSUER", defaultTOTPIssuer),
+		LoginFreeAttempts: defaultLoginFree,
+		LoginMaxLockout:   defaultMaxLockout,
+		TransferTimeout:   defaultTransferTTL,
+		UploadExpiry:      defaultUploadExpiry,
+		HashAlgorithms:    []string{"sha256"},
+		DedupSecret:       os.Getenv("DEDUP_SECRET"),
+		KEKID:             valueOrDefault("KEK_ID", defaultKEKID),
+		KEKFile:           valueOrDefault("KEK_FILE", defaultKEKFile),
+		KEKRewrapOnStart:  true,
+		StorageBackend:    strings.ToLower(valueOrDefault("STORAGE_BACKEND", defaultStorage)),
+		S3: S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          valueOrDefault("S3_REGION", defaultS3Region),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("S3_SESSION_TOKEN"),
+			Prefix:          os.Getenv("S3_PREFIX"),
+			// Custom endpoints (MinIO and friends) rarely have wildcard DNS.
+			ForcePathStyle: os.Getenv("S3_ENDPOINT") != "",
+		},
+		Password: PasswordConfig{
+			Algorithm:         strings.ToLower(valueOrDefault("PASSWORD_HASH_ALGORITHM", defaultPasswordHash)),
+			Argon2Memory:      defaultArgon2Memory,
+			Argon2Iterations:  defaultArgon2Time,
+			Argon2Parallelism: defaultArgon2Lanes,
+			BcryptCost:        defaultBcryptCost,
+		},
+		OIDC: OIDCConfig{
+			Issuer:       strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"),
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Scopes:       strings.Fields(strings.ReplaceAll(valueOrDefault("OIDC_SCOPES", defaultOIDCScopes), ",", " ")),
+		},
+		Mail: MailConfig{
+			Backend:        strings.ToLower(valueOrDefault("MAIL_BACKEND", defaultMailBackend)),
+			From:           valueOrDefault("MAIL_FROM", defaultMailFrom),
+			OutboxDir:      valueOrDefault("MAIL_OUTBOX_DIR", defaultOutboxDir),
+			SMTPHost:       os.Getenv("SMTP_HOST"),
+			SMTPPort:       valueOrDefault("SMTP_PORT", defaultSMTPPort),
+			SMTPUsername:   os.Getenv("SMTP_USERNAME"),
+			SMTPPassword:   os.Getenv("SMTP_PASSWORD"),
+			SMTPRequireTLS: true,
+		},
 	}
 
 	if cfg.DatabaseType != DBTypeSQLite && cfg.DatabaseType != DBTypePostgres {
@@ -95,6 +267,108 @@ func Load() (Config, error) {
 		cfg.TokenTTL = time.Duration(ttlMinutes) * time.Minute
 	}
 
+	if refreshStr := os.Getenv("REFRESH_TOKEN_TTL_HOURS"); refreshStr != "" {
+		refreshHours, err := strconv.Atoi(refreshStr)
+		if err != nil || refreshHours <= 0 {
+			return Config{}, fmt.Errorf("invalid REFRESH_TOKEN_TTL_HOURS value: %q", refreshStr)
+		}
+		cfg.RefreshTokenTTL = time.Duration(refreshHours) * time.Hour
+	}
+
+	if mfaStr := os.Getenv("REQUIRE_MFA"); mfaStr != "" {
+		requireMFA, err := strconv.ParseBool(mfaStr)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid REQUIRE_MFA value: %q", mfaStr)
+		}
+		cfg.RequireMFA = requireMFA
+	}
+
+	if freeStr := os.Getenv("LOGIN_FREE_ATTEMPTS"); freeStr != "" {
+		free, err := strconv.Atoi(freeStr)
+		if err != nil || free < 0 {
+			return Config{}, fmt.Errorf("invalid LOGIN_FREE_ATTEMPTS value: %q", freeStr)
+		}
+		cfg.LoginFreeAttempts = free
+	}
+
+	if lockoutStr := os.Getenv("LOGIN_MAX_LOCKOUT_MINUTES"); lockoutStr != "" {
+		lockoutMinutes, err := strconv.Atoi(lockoutStr)
+		if err != nil || lockoutMinutes <= 0 {
+			return Config{}, fmt.Errorf("invalid LOGIN_MAX_LOCKOUT_MINUTES value: %q", lockoutStr)
+		}
+		cfg.LoginMaxLockout = time.Duration(lockoutMinutes) * time.Minute
+	}
+
+	switch cfg.Password.Algorithm {
+	case "argon2id", "bcrypt":
+	default:
+		return Config{}, fmt.Errorf("invalid PASSWORD_HASH_ALGORITHM: %s (must be 'argon2id' or 'bcrypt')", cfg.Password.Algorithm)
+	}
+	if memStr := os.Getenv("ARGON2_MEMORY_KIB"); memStr != "" {
+		mem, err := strconv.ParseUint(memStr, 10, 32)
+		if err != nil || mem == 0 {
+			return Config{}, fmt.Errorf("invalid ARGON2_MEMORY_KIB value: %q", memStr)
+		}
+		cfg.Password.Argon2Memory = uint32(mem)
+	}
+	if iterStr := os.Getenv("ARGON2_ITERATIONS"); iterStr != "" {
+		iterations, err := strconv.ParseUint(iterStr, 10, 32)
+		if err != nil || iterations == 0 {
+			return Config{}, fmt.Errorf("invalid ARGON2_ITERATIONS value: %q", iterStr)
+		}
+		cfg.Password.Argon2Iterations = uint32(iterations)
+	}
+	if parStr := os.Getenv("ARGON2_PARALLELISM"); parStr != "" {
+		parallelism, err := strconv.ParseUint(parStr, 10, 8)
+		if err != nil || parallelism == 0 {
+			return Config{}, fmt.Errorf("invalid ARGON2_PARALLELISM value: %q", parStr)
+		}
+		cfg.Password.Argon2Parallelism = uint8(parallelism)
+	}
+	if costStr := os.Getenv("BCRYPT_COST"); costStr != "" {
+		cost, err := strconv.Atoi(costStr)
+		if err != nil || cost <= 0 {
+			return Config{}, fmt.Errorf("invalid BCRYPT_COST value: %q", costStr)
+		}
+		cfg.Password.BcryptCost = cost
+	}
+
+	cfg.PublicURL = strings.TrimRight(valueOrDefault("PUBLIC_URL", "http://localhost:"+cfg.Port), "/")
+
+	if cfg.OIDC.Issuer != "" {
+		if cfg.OIDC.ClientID == "" {
+			return Config{}, errors.New("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+		}
+		if cfg.OIDC.RedirectURL == "" {
+			cfg.OIDC.RedirectURL = cfg.PublicURL + "/auth/oidc/callback"
+		}
+	}
+
+	if verifyStr := os.Getenv("REQUIRE_EMAIL_VERIFICATION"); verifyStr != "" {
+		requireVerification, err := strconv.ParseBool(verifyStr)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid REQUIRE_EMAIL_VERIFICATION value: %q", verifyStr)
+		}
+		cfg.RequireEmailVerification = requireVerification
+	}
+
+	switch cfg.Mail.Backend {
+	case "log", "file":
+	case "smtp":
+		if cfg.Mail.SMTPHost == "" {
+			return Config{}, errors.New("SMTP_HOST is required for MAIL_BACKEND=smtp")
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid MAIL_BACKEND: %s (must be 'log', 'file' or 'smtp')", cfg.Mail.Backend)
+	}
+	if tlsStr := os.Getenv("SMTP_REQUIRE_TLS"); tlsStr != "" {
+		requireTLS, err := strconv.ParseBool(tlsStr)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid SMTP_REQUIRE_TLS value: %q", tlsStr)
+		}
+		cfg.Mail.SMTPRequireTLS = requireTLS
+	}
+
 	if maxStr := os.Getenv("MAX_UPLOAD_MB"); maxStr != "" {
 		maxMB, err := strconv.Atoi(maxStr)
 		if err != nil || maxMB <= 0 {
@@ -103,12 +377,87 @@ func Load() (Config, error) {
 		cfg.MaxUpload = int64(maxMB) * 1024 * 1024
 	}
 
-	if cfg.JWTSecret == "" {
-		secret, err := randomSecret(32)
+	if ttStr := os.Getenv("TRANSFER_TIMEOUT_MINUTES"); ttStr != "" {
+		ttMinutes, err := strconv.Atoi(ttStr)
+		if err != nil || ttMinutes <= 0 {
+			return Config{}, fmt.Errorf("invalid TRANSFER_TIMEOUT_MINUTES value: %q", ttStr)
+		}
+		cfg.TransferTimeout = time.Duration(ttMinutes) * time.Minute
+	}
+
+	if expiryStr := os.Getenv("UPLOAD_EXPIRY_HOURS"); expiryStr != "" {
+		expiryHours, err := strconv.Atoi(expiryStr)
+		if err != nil || expiryHours <= 0 {
+			return Config{}, fmt.Errorf("invalid UPLOAD_EXPIRY_HOURS value: %q", expiryStr)
+		}
+		cfg.UploadExpiry = time.Duration(expiryHours) * time.Hour
+	}
+
+	if anonStr := os.Getenv("ANONYMOUS_UPLOADS"); anonStr != "" {
+		anon, err := strconv.ParseBool(anonStr)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid ANONYMOUS_UPLOADS value: %q", anonStr)
+		}
+		cfg.AnonymousUploads = anon
+	}
+
+	if algsEnv := os.Getenv("HASH_ALGORITHMS"); algsEnv != "" {
+		for _, alg := range strings.Split(algsEnv, ",") {
+			alg = strings.ToLower(strings.TrimSpace(alg))
+			switch alg {
+			case "":
+				continue
+			case "sha256":
+			case "sha512", "blake3":
+				cfg.HashAlgorithms = append(cfg.HashAlgorithms, alg)
+			default:
+				return Config{}, fmt.Errorf("invalid HASH_ALGORITHMS entry: %q (must be sha256, sha512 or blake3)", alg)
+			}
+		}
+	}
+
+	if dedupStr := os.Getenv("DEDUP_ENABLED"); dedupStr != "" {
+		enabled, err := strconv.ParseBool(dedupStr)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid DEDUP_ENABLED value: %q", dedupStr)
+		}
+		cfg.DedupEnabled = enabled
+	}
+	// A generated secret would change on restart and orphan every stored
+	// blob key, so deduplication requires an explicit one.
+	if cfg.DedupEnabled && len(cfg.DedupSecret) < 32 {
+		return Config{}, errors.New("DEDUP_SECRET of at least 32 characters is required when DEDUP_ENABLED is set")
+	}
+
+	keks, err := parseKEKs(cfg.KEKID)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.KEKs = keks
+
+	if rewrapStr := os.Getenv("KEK_REWRAP_ON_START"); rewrapStr != "" {
+		rewrap, err := strconv.ParseBool(rewrapStr)
 		if err != nil {
-			return Config{}, fmt.Errorf("generate jwt secret: %w", err)
+			return Config{}, fmt.Errorf("invalid KEK_REWRAP_ON_START value: %q", rewrapStr)
 		}
-		cfg.JWTSecret = secret
+		cfg.KEKRewrapOnStart = rewrap
+	}
+
+	switch cfg.StorageBackend {
+	case "local", "memory":
+	case "s3":
+		if cfg.S3.Bucket == "" || cfg.S3.AccessKeyID == "" || cfg.S3.SecretAccessKey == "" {
+			return Config{}, errors.New("S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for STORAGE_BACKEND=s3")
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid STORAGE_BACKEND: %s (must be 'local', 's3' or 'memory')", cfg.StorageBackend)
+	}
+	if pathStyle := os.Getenv("S3_FORCE_PATH_STYLE"); pathStyle != "" {
+		force, err := strconv.ParseBool(pathStyle)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid S3_FORCE_PATH_STYLE value: %q", pathStyle)
+		}
+		cfg.S3.ForcePathStyle = force
 	}
 
 	// For SQLite, ensure parent directory exists
@@ -132,6 +481,30 @@ func Load() (Config, error) {
 	return cfg, nil
 }
 
+// parseKEKs reads KEKS ("id:base64,id:base64") and the single-key KEK
+// shorthand, which is registered under activeID.
+func parseKEKs(activeID string) (map[string]string, error) {
+	keks := make(map[string]string)
+	if kek := os.Getenv("KEK"); kek != "" {
+		keks[activeID] = kek
+	}
+	if keksEnv := os.Getenv("KEKS"); keksEnv != "" {
+		for _, entry := range strings.Split(keksEnv, ",") {
+			id, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			if !ok || id == "" || key == "" {
+				return nil, fmt.Errorf("invalid KEKS entry: %q (expected id:base64)", entry)
+			}
+			keks[id] = key
+		}
+	}
+	if len(keks) > 0 {
+		if _, ok := keks[activeID]; !ok {
+			return nil, fmt.Errorf("KEK_ID %q not found in KEKS", activeID)
+		}
+	}
+	return keks, nil
+}
+
 func valueOrDefault(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -139,15 +512,15 @@ func valueOrDefault(key, def string) string {
 	return def
 }
 
-func randomSecret(size int) (string, error) {
-	if size <= 0 {
-		return "", errors.New("size must be positive")
-	}
-	buff := make([]byte, size)
-	if _, err := rand.Read(buff); err != nil {
-		return "", err
+// listValue splits a comma-separated variable, dropping empty entries.
+func listValue(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
 	}
-	return base64.StdEncoding.EncodeToString(buff), nil
+	return values
 }
 
 func ensureParentDir(path string) error {
@@ -0,0 +1,59 @@
+package entity
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// API key scopes. A user token implies all of them.
+const (
+	ScopeFilesRead  = "files:read"
+	ScopeFilesWrite = "files:write"
+	ScopeExcelWrite = "excel:write"
+)
+
+// APIKeyScopes lists every scope an API key can be granted.
+var APIKeyScopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeExcelWrite}
+
+// APIKey is a long-lived credential of a user for machine clients. The key
+// itself is shown once at creation; only its prefix, which identifies it,
+// and a hash of the whole key are stored.
+type APIKey struct {
+	ID         string     `gorm:"primaryKey;size:36"`
+	UserID     string     `gorm:"size:36;not null;index"`
+	Name       string     `gorm:"size:100"`
+	Prefix     string     `gorm:"size:16;not null;uniqueIndex"`
+	SecretHash string     `gorm:"size:64;not null"`
+	Scopes     string     `gorm:"size:255;not null"` // comma-separated
+	ExpiresAt  *time.Time `gorm:"index"`
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime;not null"`
+}
+
+func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == "" {
+		k.ID = uuid.NewString()
+	}
+	return nil
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList returns the granted scopes.
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// Active reports whether the key may be used at now.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// Blob is a deduplicated encrypted object shared by every FileAsset with the
+// same plaintext. Its ID is a keyed hash of the plaintext, so identical
+// uploads map to the same row without exposing a plain content hash.
+type Blob struct {
+	ID             string    `gorm:"primaryKey;size:64"`
+	StoredPath     string    `gorm:"size:512;uniqueIndex;not null"`
+	StorageBackend string    `gorm:"size:16;index"`
+	SizeBytes      int64     `gorm:"not null"`
+	WrappedKey     []byte    `gorm:"not null"`
+	KeyID          string    `gorm:"size:64;index;not null"`
+	RefCount       int64     `gorm:"not null;default:0"`
+	CreatedAt      time.Time `gorm:"autoCreateTime;not null"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime;not null"`
+}
+
+func (Blob) TableName() string {
+	return "blobs"
+}
@@ -8,10 +8,11 @@ import (
 )
 
 type ExcelExport struct {
-	ID         string         `gorm:"primaryKey;size:36"`
-	StoredPath string         `gorm:"size:512;uniqueIndex;not null"`
-	CreatedAt  time.Time      `gorm:"autoCreateTime;not null"`
-	DeletedAt  gorm.DeletedAt `gorm:"index"`
+	ID             string         `gorm:"primaryKey;size:36"`
+	StoredPath     string         `gorm:"size:512;uniqueIndex;not null"`
+	StorageBackend string         `gorm:"size:16;index"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime;not null"`
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
 }
 
 func (e *ExcelExport) BeforeCreate(tx *gorm.DB) error {
@@ -24,4 +25,3 @@ func (e *ExcelExport) BeforeCreate(tx *gorm.DB) error {
 func (ExcelExport) TableName() string {
 	return "excel_exports"
 }
-
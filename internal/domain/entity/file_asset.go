@@ -3,22 +3,38 @@ package entity
 import (
 	"time"
 
+	"github.com/filehash/pkg/crypto"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// FileAsset is a stored file. The idx_file_assets_user_* indexes back the
+// keyset pagination of file listings, one per sort key.
 type FileAsset struct {
-	ID               string    `gorm:"primaryKey;size:36"`
-	OriginalName     string    `gorm:"size:255;not null"`
-	StoredPath       string    `gorm:"size:512;uniqueIndex;not null"`
-	UserID           *string   `gorm:"size:64;index"`
-	ContentType      string    `gorm:"size:128;not null"`
-	SizeBytes        int64     `gorm:"not null"`
-	EncryptionAlg    string    `gorm:"size:32;not null;default:'AES-256'"`
-	AuthenticationAlg string   `gorm:"size:32;not null;default:'GCM'"`
-	CreatedAt        time.Time `gorm:"autoCreateTime;not null"`
-	UpdatedAt        time.Time `gorm:"autoUpdateTime;not null"`
-	DeletedAt        gorm.DeletedAt `gorm:"index"`
+	ID                string  `gorm:"primaryKey;size:36;index:idx_file_assets_user_created,priority:3;index:idx_file_assets_user_name,priority:3;index:idx_file_assets_user_size,priority:3"`
+	OriginalName      string  `gorm:"size:255;not null;index:idx_file_assets_user_name,priority:2"`
+	StoredPath        string  `gorm:"size:512;index:idx_file_assets_stored_path_ref;not null"`
+	BlobID            *string `gorm:"size:64;index"`
+	StorageBackend    string  `gorm:"size:16;index"` // deduplicated assets use their blob's backend
+	UserID            *string `gorm:"size:64;index;index:idx_file_assets_user_created,priority:1;index:idx_file_assets_user_name,priority:1;index:idx_file_assets_user_size,priority:1"`
+	FolderID          *string `gorm:"size:36;index"` // nil at the top level
+	ContentType       string  `gorm:"size:128;not null"`
+	SizeBytes         int64   `gorm:"not null;index:idx_file_assets_user_size,priority:2"`
+	EncryptionAlg     string  `gorm:"size:32;not null;default:'AES-256'"`
+	AuthenticationAlg string  `gorm:"size:32;not null;default:'GCM'"`
+	SHA256            *string `gorm:"column:sha256;size:64;index"`
+	SHA512            *string `gorm:"column:sha512;size:128"`
+	BLAKE3            *string `gorm:"column:blake3;size:64"`
+	WrappedKey        []byte
+	KeyID             string         `gorm:"size:64;index"`
+	CreatedAt         time.Time      `gorm:"autoCreateTime;not null;index:idx_file_assets_user_created,priority:2"`
+	UpdatedAt         time.Time      `gorm:"autoUpdateTime;not null"`
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
+
+	// Tags and Metadata live in file_tags and file_metadata and are only
+	// loaded where they are shown.
+	Tags     []string          `gorm:"-"`
+	Metadata map[string]string `gorm:"-"`
 }
 
 func (f *FileAsset) BeforeCreate(tx *gorm.DB) error {
@@ -32,3 +48,32 @@ func (FileAsset) TableName() string {
 	return "file_assets"
 }
 
+// Hashes returns the stored plaintext digests keyed by algorithm name.
+func (f *FileAsset) Hashes() map[string]string {
+	hashes := make(map[string]string, 3)
+	if f.SHA256 != nil {
+		hashes[crypto.HashSHA256] = *f.SHA256
+	}
+	if f.SHA512 != nil {
+		hashes[crypto.HashSHA512] = *f.SHA512
+	}
+	if f.BLAKE3 != nil {
+		hashes[crypto.HashBLAKE3] = *f.BLAKE3
+	}
+	return hashes
+}
+
+// SetHashes stores the digests produced for the given algorithms.
+func (f *FileAsset) SetHashes(hashes map[string]string) {
+	for alg, sum := range hashes {
+		sum := sum
+		switch alg {
+		case crypto.HashSHA256:
+			f.SHA256 = &sum
+		case crypto.HashSHA512:
+			f.SHA512 = &sum
+		case crypto.HashBLAKE3:
+			f.BLAKE3 = &sum
+		}
+	}
+}
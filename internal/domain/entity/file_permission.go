@@ -0,0 +1,56 @@
+package entity
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// File roles, from least to most access. The uploader of a file is its
+// owner without a grant.
+const (
+	// FileRoleViewer may download, verify and read the metadata of a file.
+	FileRoleViewer = "viewer"
+	// FileRoleEditor may also change the file's details.
+	FileRoleEditor = "editor"
+	// FileRoleOwner may also delete the file, share it and manage grants.
+	FileRoleOwner = "owner"
+)
+
+// FileRoles lists the roles in order of increasing access.
+var FileRoles = []string{FileRoleViewer, FileRoleEditor, FileRoleOwner}
+
+// ValidFileRole reports whether role is one of FileRoles.
+func ValidFileRole(role string) bool {
+	return slices.Contains(FileRoles, role)
+}
+
+// FileRoleAllows reports whether role grants at least the access of need.
+func FileRoleAllows(role, need string) bool {
+	have := slices.Index(FileRoles, role)
+	return have >= 0 && have >= slices.Index(FileRoles, need)
+}
+
+// FilePermission grants a user a role on a file they did not upload.
+type FilePermission struct {
+	ID        string    `gorm:"primaryKey;size:36"`
+	FileID    string    `gorm:"size:36;not null;uniqueIndex:idx_file_permissions_file_user"`
+	UserID    string    `gorm:"size:36;not null;uniqueIndex:idx_file_permissions_file_user;index"`
+	Role      string    `gorm:"size:16;not null"`
+	GrantedBy string    `gorm:"size:36;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime;not null"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null"`
+}
+
+func (p *FilePermission) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.NewString()
+	}
+	return nil
+}
+
+func (FilePermission) TableName() string {
+	return "file_permissions"
+}
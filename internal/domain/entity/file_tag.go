@@ -0,0 +1,23 @@
+package entity
+
+// FileTag labels a file. Tags are stored lower-cased, so filtering by tag
+// ignores case.
+type FileTag struct {
+	FileID string `gorm:"primaryKey;size:36"`
+	Tag    string `gorm:"primaryKey;size:64;index"`
+}
+
+func (FileTag) TableName() string {
+	return "file_tags"
+}
+
+// FileMetadata is one user-defined key/value pair of a file.
+type FileMetadata struct {
+	FileID string `gorm:"primaryKey;size:36"`
+	Key    string `gorm:"primaryKey;size:64;index:idx_file_metadata_key_value"`
+	Value  string `gorm:"size:1024;not null;index:idx_file_metadata_key_value"`
+}
+
+func (FileMetadata) TableName() string {
+	return "file_metadata"
+}
@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	KeyRotationRunning   = "running"
+	KeyRotationCompleted = "completed"
+	KeyRotationFailed    = "failed"
+)
+
+// KeyRotation records a run of the job that re-wraps stored data keys under
+// the active key-encryption key. Rows are kept as evidence of rotations.
+type KeyRotation struct {
+	ID          string    `gorm:"primaryKey;size:36"`
+	TargetKeyID string    `gorm:"size:64;not null"`
+	Trigger     string    `gorm:"size:32;not null"`
+	Status      string    `gorm:"size:16;not null;index"`
+	Total       int64     `gorm:"not null"`
+	Rewrapped   int64     `gorm:"not null"`
+	Failed      int64     `gorm:"not null"`
+	Error       string    `gorm:"size:1024"`
+	StartedAt   time.Time `gorm:"not null;index"`
+	FinishedAt  *time.Time
+}
+
+func (k *KeyRotation) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == "" {
+		k.ID = uuid.NewString()
+	}
+	return nil
+}
+
+func (KeyRotation) TableName() string {
+	return "key_rotations"
+}
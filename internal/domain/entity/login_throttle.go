@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// LoginThrottle counts recent failed logins for an email address, whether
+// or not an account uses it, and holds the time until which further
+// attempts are refused.
+type LoginThrottle struct {
+	Email         string    `gorm:"primaryKey;size:255"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"not null;index"`
+	LockedUntil   *time.Time
+}
+
+// Locked reports whether attempts are refused at now.
+func (t *LoginThrottle) Locked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
+
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
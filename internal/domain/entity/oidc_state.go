@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// OIDCState is a started OpenID Connect login waiting for the provider to
+// redirect back. ID is the state parameter sent through the browser; the
+// PKCE code verifier and the nonce never leave the server.
+type OIDCState struct {
+	ID           string    `gorm:"primaryKey;size:64"`
+	Nonce        string    `gorm:"size:64;not null"`
+	CodeVerifier string    `gorm:"size:128;not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime;not null"`
+}
+
+func (OIDCState) TableName() string {
+	return "oidc_states"
+}
@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// RevokedToken denies a token by its JWT ID until the token would have
+// expired anyway.
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;primaryKey;size:64"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time `gorm:"autoCreateTime;not null"`
+}
+
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
@@ -0,0 +1,40 @@
+package entity
+
+import "slices"
+
+// Roles. Every user has exactly one; RoleUser is the default.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Roles lists every role a user can be given.
+var Roles = []string{RoleUser, RoleAdmin}
+
+// Permission is an operation beyond a user's own files and account.
+type Permission string
+
+const (
+	// PermManageUsers covers listing, disabling, deleting and changing the
+	// role of users.
+	PermManageUsers Permission = "users:manage"
+	// PermReadAllFiles allows listing the files of any user.
+	PermReadAllFiles Permission = "files:read-all"
+	// PermViewStats allows reading system-wide statistics.
+	PermViewStats Permission = "system:stats"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleUser:  nil,
+	RoleAdmin: {PermManageUsers, PermReadAllFiles, PermViewStats},
+}
+
+// ValidRole reports whether role is one of Roles.
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// RoleHas reports whether role grants perm.
+func RoleHas(role string, perm Permission) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session is one refresh token of a login. Refreshing rotates the token:
+// the used row is marked rotated and a new row joins the same family.
+// Presenting a rotated token again means it leaked, and the whole family is
+// revoked. Access tokens name their family, so revoking it ends them too.
+// MFA records that the login passed a second factor, so tokens refreshed
+// from it keep that standing.
+type Session struct {
+	ID        string    `gorm:"primaryKey;size:36"`
+	UserID    string    `gorm:"size:36;not null;index"`
+	FamilyID  string    `gorm:"size:36;not null;index"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	RotatedAt *time.Time
+	RevokedAt *time.Time
+	MFA       bool      `gorm:"not null;default:false"`
+	CreatedAt time.Time `gorm:"autoCreateTime;not null"`
+}
+
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.NewString()
+	}
+	if s.FamilyID == "" {
+		s.FamilyID = s.ID
+	}
+	return nil
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Share is a public download link to a file, created by its owner. The
+// link works until it expires, is revoked or has been used MaxDownloads
+// times.
+type Share struct {
+	ID     string `gorm:"primaryKey;size:36"`
+	Slug   string `gorm:"size:32;not null;uniqueIndex"`
+	FileID string `gorm:"size:36;not null;index"`
+	UserID string `gorm:"size:36;not null;index"`
+	// PasswordHash is empty for links that need no password.
+	PasswordHash   string    `gorm:"size:255"`
+	MaxDownloads   *int64    // nil for no limit
+	Downloads      int64     `gorm:"not null;default:0"`
+	ExpiresAt      time.Time `gorm:"not null;index"`
+	LastDownloadAt *time.Time
+	RevokedAt      *time.Time
+	CreatedAt      time.Time `gorm:"autoCreateTime;not null"`
+}
+
+func (s *Share) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.NewString()
+	}
+	return nil
+}
+
+func (Share) TableName() string {
+	return "shares"
+}
+
+// Active reports whether the link may be used at now.
+func (s *Share) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt) &&
+		(s.MaxDownloads == nil || s.Downloads < *s.MaxDownloads)
+}
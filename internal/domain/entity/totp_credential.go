@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// TOTPCredential holds the RFC 6238 shared secret of a user, wrapped under a
+// KEK like file data keys. It stays pending until a first code proves that
+// the authenticator was set up, and only then guards logins.
+type TOTPCredential struct {
+	UserID        string `gorm:"primaryKey;size:36"`
+	WrappedSecret []byte `gorm:"not null"`
+	KeyID         string `gorm:"size:64;not null;index"`
+	LastStep      int64  `gorm:"not null;default:0"` // last accepted time step; older codes are replays
+	EnabledAt     *time.Time
+	CreatedAt     time.Time `gorm:"autoCreateTime;not null"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime;not null"`
+}
+
+func (TOTPCredential) TableName() string {
+	return "totp_credentials"
+}
+
+// Enabled reports whether the credential completed enrollment.
+func (c *TOTPCredential) Enabled() bool {
+	return c.EnabledAt != nil
+}
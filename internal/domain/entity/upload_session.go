@@ -0,0 +1,63 @@
+package entity
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UploadSession tracks a resumable upload. Received chunks are staged as
+// encrypted parts under a per-session data key until the upload is
+// complete and handed over as a regular FileAsset.
+type UploadSession struct {
+	ID             string    `gorm:"primaryKey;size:36"`
+	UserID         *string   `gorm:"size:36;index"`
+	Filename       string    `gorm:"size:255;not null"`
+	Metadata       string    `gorm:"size:4096"`
+	Length         int64     `gorm:"not null"`
+	Offset         int64     `gorm:"column:upload_offset;not null;default:0"`
+	Parts          string    `gorm:"type:text"` // comma-separated start offsets of the staged parts
+	StorageBackend string    `gorm:"size:16;not null"`
+	WrappedKey     []byte    `gorm:"not null"`
+	KeyID          string    `gorm:"size:64;not null"`
+	FileID         *string   `gorm:"size:36"`
+	ExpiresAt      time.Time `gorm:"not null;index"`
+	CreatedAt      time.Time `gorm:"autoCreateTime;not null"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime;not null"`
+}
+
+func (s *UploadSession) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.NewString()
+	}
+	return nil
+}
+
+func (UploadSession) TableName() string {
+	return "upload_sessions"
+}
+
+// PartOffsets returns the start offsets of the staged parts in upload order.
+func (s *UploadSession) PartOffsets() []int64 {
+	if s.Parts == "" {
+		return nil
+	}
+	fields := strings.Split(s.Parts, ",")
+	offsets := make([]int64, 0, len(fields))
+	for _, f := range fields {
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			continue
+		}
+		offsets = append(offsets, n)
+	}
+	return offsets
+}
+
+// Completed reports whether the upload was handed over as a file.
+func (s *UploadSession) Completed() bool {
+	return s.FileID != nil
+}
@@ -11,6 +11,13 @@ type User struct {
 	ID        string    `gorm:"primaryKey;size:36"`
 	Email     string    `gorm:"size:255;uniqueIndex;not null"`
 	Password  string    `gorm:"size:255;not null"`
+	// EmailVerifiedAt is set once the user proved they receive mail at
+	// Email.
+	EmailVerifiedAt *time.Time
+	// Role decides what the user may do beyond their own files; see Can.
+	Role string `gorm:"size:32;not null;default:user;index"`
+	// DisabledAt is set while an administrator has locked the user out.
+	DisabledAt *time.Time
 	CreatedAt time.Time `gorm:"autoCreateTime;not null"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime;not null"`
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -27,3 +34,11 @@ func (User) TableName() string {
 	return "users"
 }
 
+// Can reports whether the user holds perm. Disabled users hold none.
+func (u *User) Can(perm Permission) bool {
+	if u.DisabledAt != nil {
+		return false
+	}
+	return RoleHas(u.Role, perm)
+}
+
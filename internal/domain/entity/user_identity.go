@@ -0,0 +1,32 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider. The issuer and subject identify that account for good; the
+// email it had is only kept for reference.
+type UserIdentity struct {
+	ID          string `gorm:"primaryKey;size:36"`
+	UserID      string `gorm:"size:36;not null;index"`
+	Issuer      string `gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Subject     string `gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Email       string `gorm:"size:255"`
+	LastLoginAt *time.Time
+	CreatedAt   time.Time `gorm:"autoCreateTime;not null"`
+}
+
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == "" {
+		i.ID = uuid.NewString()
+	}
+	return nil
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *entity.APIKey) error
+	FindByPrefix(ctx context.Context, prefix string) (*entity.APIKey, error)
+	// ListByUser returns the keys of userID, newest first, optionally only
+	// those whose prefix starts with prefix.
+	ListByUser(ctx context.Context, userID, prefix string) ([]entity.APIKey, error)
+	// Revoke revokes the key id of userID and reports whether it was found
+	// unrevoked.
+	Revoke(ctx context.Context, id, userID string) (bool, error)
+	TouchLastUsed(ctx context.Context, id string, at time.Time) error
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type BlobRepository interface {
+	// Acquire takes a reference on the blob with blob.ID, inserting blob
+	// when no such row exists. It returns the stored row and whether it was
+	// created by this call.
+	Acquire(ctx context.Context, blob *entity.Blob) (*entity.Blob, bool, error)
+	// Release drops a reference and deletes the row once none remain. It
+	// returns the deleted row, or nil while the blob is still referenced.
+	Release(ctx context.Context, id string) (*entity.Blob, error)
+	FindByID(ctx context.Context, id string) (*entity.Blob, error)
+	UpdateWrappedKey(ctx context.Context, id string, wrappedKey []byte, keyID string) error
+	ListByStaleKey(ctx context.Context, activeKeyID, afterID string, limit int) ([]entity.Blob, error)
+	CountByKeyID(ctx context.Context) (map[string]int64, error)
+	ListOutsideBackend(ctx context.Context, backend, afterID string, limit int) ([]entity.Blob, error)
+	UpdateStorageBackend(ctx context.Context, id, from, to string) (bool, error)
+	BackfillStorageBackend(ctx context.Context, backend string) (int64, error)
+	UsageByBackend(ctx context.Context) (map[string]StorageUsage, error)
+}
@@ -10,5 +10,8 @@ type ExcelRepository interface {
 	Create(ctx context.Context, export *entity.ExcelExport) error
 	FindByID(ctx context.Context, id string) (*entity.ExcelExport, error)
 	Delete(ctx context.Context, id string) error
+	ListOutsideBackend(ctx context.Context, backend, afterID string, limit int) ([]entity.ExcelExport, error)
+	UpdateStorageBackend(ctx context.Context, id, from, to string) (bool, error)
+	BackfillStorageBackend(ctx context.Context, backend string) (int64, error)
 }
 
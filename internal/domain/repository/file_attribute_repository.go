@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+)
+
+// FileAttributeRepository stores the tags and metadata of files.
+type FileAttributeRepository interface {
+	// Find returns the attributes of those of fileIDs that have any.
+	Find(ctx context.Context, fileIDs []string) (map[string]FileAttributes, error)
+	// Update changes the attributes of fileID in one transaction: tags,
+	// unless nil, replace the existing ones; set adds or overwrites
+	// metadata and the keys in unset are removed.
+	Update(ctx context.Context, fileID string, tags []string, set map[string]string, unset []string) error
+	DeleteByFileID(ctx context.Context, fileID string) error
+}
+
+type FileAttributes struct {
+	Tags     []string
+	Metadata map[string]string
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type FilePermissionRepository interface {
+	// Upsert grants perm.Role to perm.UserID on perm.FileID, replacing an
+	// earlier grant.
+	Upsert(ctx context.Context, perm *entity.FilePermission) error
+	Find(ctx context.Context, fileID, userID string) (*entity.FilePermission, error)
+	// ListByFile returns the grants on fileID with the grantees' emails,
+	// oldest first.
+	ListByFile(ctx context.Context, fileID string) ([]FileGrant, error)
+	// ListByUser returns the files shared with userID along with the role
+	// granted, newest grant first. Deleted files are left out.
+	ListByUser(ctx context.Context, userID string) ([]SharedFile, error)
+	// Delete removes the grant of userID on fileID and reports whether there
+	// was one.
+	Delete(ctx context.Context, fileID, userID string) (bool, error)
+	DeleteByFileID(ctx context.Context, fileID string) error
+}
+
+type FileGrant struct {
+	entity.FilePermission
+	Email string
+}
+
+type SharedFile struct {
+	File entity.FileAsset
+	Role string
+}
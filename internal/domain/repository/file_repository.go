@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/filehash/internal/domain/entity"
 )
@@ -10,6 +11,86 @@ type FileRepository interface {
 	Create(ctx context.Context, asset *entity.FileAsset) error
 	FindByID(ctx context.Context, id string) (*entity.FileAsset, error)
 	FindByUserID(ctx context.Context, userID string) ([]entity.FileAsset, error)
+	// List returns one page of the files selected by filter.
+	List(ctx context.Context, filter FileFilter, page FilePage) ([]entity.FileAsset, error)
+	Count(ctx context.Context, filter FileFilter) (int64, error)
+	FindByFolderIDs(ctx context.Context, folderIDs []string) ([]entity.FileAsset, error)
+	CountInFolder(ctx context.Context, folderID string) (int64, error)
+	UpdateFolder(ctx context.Context, id string, folderID *string) error
+	UpdateWrappedKey(ctx context.Context, id string, wrappedKey []byte, keyID string) error
+	// ListByStaleKey returns up to limit assets with a wrapped key under a
+	// KEK other than activeKeyID, ordered by ID and starting after afterID.
+	ListByStaleKey(ctx context.Context, activeKeyID, afterID string, limit int) ([]entity.FileAsset, error)
+	CountByKeyID(ctx context.Context) (map[string]int64, error)
+	// CountWithoutKey counts assets that have no wrapped data key.
+	CountWithoutKey(ctx context.Context) (int64, error)
+	// ListOutsideBackend returns up to limit non-deduplicated assets stored
+	// on a backend other than backend, ordered by ID and starting after
+	// afterID.
+	ListOutsideBackend(ctx context.Context, backend, afterID string, limit int) ([]entity.FileAsset, error)
+	// UpdateStorageBackend moves the asset from one backend to another and
+	// reports false when it no longer exists on from.
+	UpdateStorageBackend(ctx context.Context, id, from, to string) (bool, error)
+	// BackfillStorageBackend records backend on assets that have none.
+	BackfillStorageBackend(ctx context.Context, backend string) (int64, error)
 	Delete(ctx context.Context, id string) error
+	Stats(ctx context.Context) (*FileStats, error)
+}
+
+// FileFilter selects the files of a user; each set field narrows the
+// selection further.
+type FileFilter struct {
+	UserID string
+	// ByFolder keeps the files directly inside FolderID, or at the top
+	// level when FolderID is nil.
+	ByFolder bool
+	FolderID *string
+	Tags     []string          // files with all of these tags
+	Metadata map[string]string // files with all of these metadata values
+
+	ContentType   string
+	CreatedAfter  *time.Time // inclusive
+	CreatedBefore *time.Time // exclusive
+	MinSize       *int64     // inclusive
+	MaxSize       *int64     // inclusive
+	NamePrefix    string
+}
+
+// Sort keys of file listings. Files with equal keys are ordered by ID.
+const (
+	FileSortDate = "date"
+	FileSortName = "name"
+	FileSortSize = "size"
+)
+
+// FilePage is a page of a file listing in keyset order: the files that sort
+// after After, which stays valid however many files are added before it.
+type FilePage struct {
+	Sort  string
+	Desc  bool
+	After *FileCursor // nil for the first page
+	Limit int
+}
+
+// FileCursor is the position of a file in a listing. Value is its sort key:
+// a time.Time, string or int64 for FileSortDate, FileSortName and
+// FileSortSize.
+type FileCursor struct {
+	Value any
+	ID    string
+}
+
+// StorageUsage is a number of objects and the bytes they hold.
+type StorageUsage struct {
+	Count int64
+	Bytes int64
+}
+
+type FileStats struct {
+	Total     StorageUsage
+	Anonymous int64 // files without an owner
+	// ByBackend covers the files stored on their own, not as a shared
+	// deduplicated blob.
+	ByBackend map[string]StorageUsage
 }
 
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type FolderRepository interface {
+	Create(ctx context.Context, folder *entity.Folder) error
+	FindByID(ctx context.Context, id string) (*entity.Folder, error)
+	// ListChildren returns the folders of userID directly inside parentID,
+	// or at the top level when parentID is nil, ordered by name.
+	ListChildren(ctx context.Context, userID string, parentID *string) ([]entity.Folder, error)
+	// ListChildrenOf returns the folders directly inside any of parentIDs.
+	ListChildrenOf(ctx context.Context, parentIDs []string) ([]entity.Folder, error)
+	// NameTaken reports whether userID has a folder other than excludeID
+	// named name inside parentID.
+	NameTaken(ctx context.Context, userID string, parentID *string, name, excludeID string) (bool, error)
+	// Update saves the name and parent of folder.
+	Update(ctx context.Context, folder *entity.Folder) error
+	Delete(ctx context.Context, ids []string) error
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type KeyRotationRepository interface {
+	Create(ctx context.Context, rotation *entity.KeyRotation) error
+	Update(ctx context.Context, rotation *entity.KeyRotation) error
+	FindLatest(ctx context.Context) (*entity.KeyRotation, error)
+}
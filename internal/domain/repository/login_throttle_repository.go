@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type LoginThrottleRepository interface {
+	Find(ctx context.Context, email string) (*entity.LoginThrottle, error)
+	// RecordFailure counts a failed login at now and returns the new count.
+	// Failures before resetBefore are forgotten first.
+	RecordFailure(ctx context.Context, email string, now, resetBefore time.Time) (int, error)
+	Lock(ctx context.Context, email string, until time.Time) error
+	// Clear forgets the failures of email and reports whether there were
+	// any.
+	Clear(ctx context.Context, email string) (bool, error)
+	// DeleteStale removes entries without a failure since before that are
+	// no longer locked.
+	DeleteStale(ctx context.Context, before, now time.Time) (int64, error)
+}
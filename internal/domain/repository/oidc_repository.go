@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type OIDCRepository interface {
+	CreateState(ctx context.Context, state *entity.OIDCState) error
+	// ConsumeState deletes the state with id and returns it, so that each
+	// state is redeemed once; utils.ErrRecordNotFound when there is none.
+	ConsumeState(ctx context.Context, id string) (*entity.OIDCState, error)
+	DeleteExpiredStates(ctx context.Context, now time.Time) (int64, error)
+
+	FindIdentity(ctx context.Context, issuer, subject string) (*entity.UserIdentity, error)
+	CreateIdentity(ctx context.Context, identity *entity.UserIdentity) error
+	// CreateUserWithIdentity creates user and links identity to it in one
+	// transaction.
+	CreateUserWithIdentity(ctx context.Context, user *entity.User, identity *entity.UserIdentity) error
+	TouchIdentity(ctx context.Context, id, email string, at time.Time) error
+}
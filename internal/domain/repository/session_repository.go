@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *entity.Session) error
+	FindByTokenHash(ctx context.Context, tokenHash string) (*entity.Session, error)
+	// Rotate marks the session id as rotated and creates next in its place,
+	// but only while id is neither rotated nor revoked. It reports whether
+	// the rotation happened.
+	Rotate(ctx context.Context, id string, next *entity.Session) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUser(ctx context.Context, userID string) error
+	// FamilyActive reports whether the family still has an unrevoked session.
+	FamilyActive(ctx context.Context, familyID string) (bool, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type ShareRepository interface {
+	Create(ctx context.Context, share *entity.Share) error
+	FindBySlug(ctx context.Context, slug string) (*entity.Share, error)
+	// ListByUser returns the links of userID, newest first, optionally only
+	// those of fileID.
+	ListByUser(ctx context.Context, userID, fileID string) ([]entity.Share, error)
+	// Revoke revokes the link id of userID and reports whether it was found
+	// unrevoked.
+	Revoke(ctx context.Context, id, userID string) (bool, error)
+	// CountDownload records one use of the link id at now, in a single
+	// conditional update. It reports false when the link was no longer
+	// active, so concurrent downloads can never exceed the limit.
+	CountDownload(ctx context.Context, id string, now time.Time) (bool, error)
+	DeleteByFileID(ctx context.Context, fileID string) error
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type TOTPRepository interface {
+	// Save stores cred, replacing any earlier credential of the user.
+	Save(ctx context.Context, cred *entity.TOTPCredential) error
+	FindByUserID(ctx context.Context, userID string) (*entity.TOTPCredential, error)
+	// Enable completes enrollment at step and replaces the recovery codes.
+	Enable(ctx context.Context, userID string, step int64, codeHashes []string) error
+	// AdvanceStep records step as used unless it is not newer than the last
+	// accepted one, and reports whether it was recorded.
+	AdvanceStep(ctx context.Context, userID string, step int64) (bool, error)
+	// Delete removes the credential and the recovery codes of the user.
+	Delete(ctx context.Context, userID string) error
+
+	ListUnusedRecoveryCodes(ctx context.Context, userID string) ([]entity.RecoveryCode, error)
+	// UseRecoveryCode marks the code used and reports whether it was unused.
+	UseRecoveryCode(ctx context.Context, id string) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+
+	// ListByStaleKey returns credentials whose secret is wrapped under a KEK
+	// other than activeKeyID, ordered by user ID and starting after
+	// afterUserID.
+	ListByStaleKey(ctx context.Context, activeKeyID, afterUserID string, limit int) ([]entity.TOTPCredential, error)
+	UpdateWrappedSecret(ctx context.Context, userID string, wrapped []byte, keyID string) error
+	CountByKeyID(ctx context.Context) (map[string]int64, error)
+}
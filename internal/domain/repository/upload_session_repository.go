@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+type UploadSessionRepository interface {
+	Create(ctx context.Context, session *entity.UploadSession) error
+	FindByID(ctx context.Context, id string) (*entity.UploadSession, error)
+	// Advance moves the offset of an unfinished upload from one value to
+	// another, records the staged part starting at partOffset (if any) and
+	// pushes back the expiry, but only while the offset still equals from.
+	// It reports whether the row was updated.
+	Advance(ctx context.Context, id string, from, to int64, partOffset *int64, expiresAt time.Time) (bool, error)
+	// CountByKeyID counts unfinished uploads by the KEK wrapping their key.
+	CountByKeyID(ctx context.Context) (map[string]int64, error)
+	MarkCompleted(ctx context.Context, id, fileID string) error
+	Delete(ctx context.Context, id string) error
+	// ListExpired returns up to limit uploads that expired before now,
+	// ordered by ID and starting after afterID.
+	ListExpired(ctx context.Context, now time.Time, afterID string, limit int) ([]*entity.UploadSession, error)
+	ListByUserID(ctx context.Context, userID string) ([]*entity.UploadSession, error)
+}
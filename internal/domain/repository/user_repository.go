@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/filehash/internal/domain/entity"
 )
@@ -10,5 +11,32 @@ type UserRepository interface {
 	Create(ctx context.Context, user *entity.User) error
 	FindByEmail(ctx context.Context, email string) (*entity.User, error)
 	FindByID(ctx context.Context, id string) (*entity.User, error)
+	UpdatePassword(ctx context.Context, id, hashedPassword string) error
+	// ReplacePasswordHash swaps the hash only while it still equals
+	// oldHash, reporting whether it did.
+	ReplacePasswordHash(ctx context.Context, id, oldHash, newHash string) (bool, error)
+	MarkEmailVerified(ctx context.Context, id string, at time.Time) error
+
+	// List returns users whose email starts with emailPrefix, oldest
+	// first, along with how many there are in total.
+	List(ctx context.Context, emailPrefix string, offset, limit int) ([]entity.User, int64, error)
+	UpdateRole(ctx context.Context, id, role string) error
+	// SetDisabled disables the user at at, or enables them when at is nil.
+	SetDisabled(ctx context.Context, id string, at *time.Time) error
+	// CountEnabled counts the users with role who are not disabled.
+	CountEnabled(ctx context.Context, role string) (int64, error)
+	Stats(ctx context.Context) (*UserStats, error)
+	// Delete removes the user for good along with their sessions, API
+	// keys, two-factor credentials, provider identities, share links,
+	// folders and grants on other users' files. Files and uploads are left
+	// to the caller.
+	Delete(ctx context.Context, id string) error
+}
+
+type UserStats struct {
+	Total    int64
+	Verified int64
+	Disabled int64
+	ByRole   map[string]int64
 }
 
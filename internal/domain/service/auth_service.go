@@ -1,9 +1,57 @@
 package service
 
+import "time"
+
+// AuthTokenClaims describe a validated user access token.
+type AuthTokenClaims struct {
+	UserID    string
+	SessionID string // family of the refresh session the token belongs to
+	TokenID   string
+	ExpiresAt time.Time
+	MFA       bool // the login passed a second factor
+}
+
+// MFATokenClaims describe a validated MFA challenge token: proof that the
+// password was checked, awaiting the second factor.
+type MFATokenClaims struct {
+	UserID    string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// Purposes of action tokens. Tokens of one purpose are not accepted for
+// another.
+const (
+	ActionPasswordReset = "password-reset"
+	ActionVerifyEmail   = "verify-email"
+)
+
+// ActionTokenClaims describe a validated action token, the kind sent by
+// email. Binding is a value the issuer ties the token to, such as the
+// address being verified; the token should be refused once it changes.
+type ActionTokenClaims struct {
+	UserID    string
+	Binding   string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
 type AuthService interface {
 	HashPassword(password string) (string, error)
 	ComparePassword(hashedPassword, password string) error
-	GenerateAuthToken(userID string) (string, error)
-	ValidateAuthToken(tokenStr string) (string, error)
+	// PasswordNeedsRehash reports whether a hash that verified should be
+	// replaced by one under the current algorithm and parameters.
+	PasswordNeedsRehash(hashedPassword string) bool
+	GenerateAuthToken(userID, sessionID string, mfa bool) (string, error)
+	ValidateAuthToken(tokenStr string) (*AuthTokenClaims, error)
+	GenerateMFAToken(userID string, ttl time.Duration) (string, error)
+	ValidateMFAToken(tokenStr string) (*MFATokenClaims, error)
+	GenerateActionToken(purpose, userID, binding string, ttl time.Duration) (string, error)
+	ValidateActionToken(purpose, tokenStr string) (*ActionTokenClaims, error)
+	// NewRefreshToken returns an opaque refresh token and the hash under
+	// which it is stored.
+	NewRefreshToken() (token, hash string, err error)
+	HashRefreshToken(token string) string
+	// PublicKeys returns the keys that verify user tokens.
+	PublicKeys() []JWK
 }
-
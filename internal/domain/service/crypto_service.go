@@ -1,8 +1,12 @@
 package service
 
+import "io"
+
 type CryptoService interface {
 	GenerateAESKey() ([]byte, error)
 	EncryptAESGCM(key, plaintext []byte) ([]byte, []byte, error)
 	DecryptAESGCM(key, nonce, ciphertext []byte) ([]byte, error)
+	NewEncryptWriter(key []byte, dst io.Writer) (io.WriteCloser, error)
+	NewDecryptReader(key []byte, src io.Reader) (io.Reader, error)
+	NewDecryptSeeker(key []byte, src io.ReadSeeker) (io.ReadSeeker, int64, error)
 }
-
@@ -0,0 +1,10 @@
+package service
+
+import "hash"
+
+// DedupService provides the server-keyed hash behind the content-addressed
+// blob store.
+type DedupService interface {
+	// NewMAC returns a keyed hash used to address blobs by their plaintext.
+	NewMAC() hash.Hash
+}
@@ -0,0 +1,13 @@
+package service
+
+// JWK is the public half of a token signing key as published in a JSON Web
+// Key Set (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
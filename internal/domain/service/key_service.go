@@ -0,0 +1,12 @@
+package service
+
+// KeyService wraps per-file data keys with a key-encryption key (KEK) so
+// that data keys can be stored next to the files they protect.
+type KeyService interface {
+	// ActiveKeyID returns the ID of the KEK used for new wraps.
+	ActiveKeyID() string
+	// KeyIDs returns the IDs of every KEK available for unwrapping.
+	KeyIDs() []string
+	WrapKey(dataKey []byte) (wrapped []byte, kekID string, err error)
+	UnwrapKey(wrapped []byte, kekID string) ([]byte, error)
+}
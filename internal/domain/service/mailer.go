@@ -0,0 +1,16 @@
+package service
+
+import "context"
+
+// MailMessage is a plain-text email to a single recipient.
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers account emails such as password resets and address
+// verification.
+type Mailer interface {
+	Send(ctx context.Context, msg MailMessage) error
+}
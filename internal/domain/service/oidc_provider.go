@@ -0,0 +1,25 @@
+package service
+
+import "context"
+
+// OIDCIdentity is what a verified ID token says about the user.
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// MFA is set when the provider reports that the login used more than
+	// one factor.
+	MFA bool
+}
+
+// OIDCProvider runs the OpenID Connect authorization code flow with PKCE
+// against an external identity provider.
+type OIDCProvider interface {
+	// AuthCodeURL returns the URL of the provider's authorization endpoint
+	// that starts a login; codeChallenge is the S256 PKCE challenge.
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	// Exchange redeems an authorization code with its PKCE verifier and
+	// returns the identity from the ID token, which must carry nonce.
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error)
+}
@@ -0,0 +1,13 @@
+package service
+
+// PasswordHasher turns passwords into self-describing hash strings that
+// record the algorithm and parameters used, so hashes made under older
+// settings keep verifying after the settings change.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns an error unless password matches hash.
+	Verify(hash, password string) error
+	// NeedsRehash reports whether hash was made with another algorithm or
+	// other parameters than Hash uses now.
+	NeedsRehash(hash string) bool
+}
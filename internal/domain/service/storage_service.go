@@ -6,9 +6,18 @@ import (
 )
 
 type StorageService interface {
-	SaveEncrypted(ctx context.Context, originalName string, nonce, data []byte) (string, error)
-	LoadEncrypted(ctx context.Context, relativePath string) (nonce, data []byte, err error)
+	SaveEncrypted(ctx context.Context, originalName string, reader io.Reader) (string, error)
+	LoadEncrypted(ctx context.Context, relativePath string) (io.ReadSeekCloser, error)
 	SaveExcel(ctx context.Context, reader io.Reader) (string, error)
 	Delete(ctx context.Context, relativePath string) error
+	// Import stores reader under relativePath as-is. It copies blobs
+	// between backends while keeping their path layout.
+	Import(ctx context.Context, relativePath string, reader io.Reader) error
 }
 
+// StorageResolver gives access to every configured storage backend by name.
+type StorageResolver interface {
+	// Primary returns the backend new blobs are written to and its name.
+	Primary() (string, StorageService)
+	Backend(name string) (StorageService, error)
+}
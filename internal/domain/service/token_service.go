@@ -1,13 +1,19 @@
 package service
 
+import "time"
+
+// FileTokenClaims describe a file access grant. Tokens carry no key material.
 type FileTokenClaims struct {
 	FileID string  `json:"file_id"`
-	Key    string  `json:"key"`
 	UserID *string `json:"user_id,omitempty"`
+	// TokenID and ExpiresAt mirror the registered jti and exp claims.
+	TokenID   string    `json:"-"`
+	ExpiresAt time.Time `json:"-"`
 }
 
 type TokenService interface {
-	Generate(fileID string, aesKey []byte, userID *string) (string, error)
+	Generate(fileID string, userID *string) (string, error)
 	Validate(tokenStr string) (*FileTokenClaims, error)
+	// PublicKeys returns the keys that verify file tokens.
+	PublicKeys() []JWK
 }
-
@@ -0,0 +1,18 @@
+package service
+
+import "time"
+
+// TOTPService implements RFC 6238 time-based one-time passwords.
+type TOTPService interface {
+	// GenerateSecret returns a new random shared secret.
+	GenerateSecret() ([]byte, error)
+	// EncodeSecret returns secret in the base32 form authenticator apps
+	// accept for manual entry.
+	EncodeSecret(secret []byte) string
+	// ProvisioningURI returns the otpauth:// URI that authenticator apps
+	// import, usually rendered as a QR code.
+	ProvisioningURI(secret []byte, account string) string
+	// Verify checks code against secret at now, allowing one time step of
+	// clock skew either way, and returns the time step it matched.
+	Verify(secret []byte, code string, now time.Time) (int64, bool)
+}
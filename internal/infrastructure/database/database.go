@@ -15,7 +15,7 @@ import (
 func Open(cfg config.Config, log *zap.Logger) (*gorm.DB, error) {
 	gormCfg := &gorm.Config{
 		FullSaveAssociations: false,
-		NowFunc:              time.Now().UTC,
+		NowFunc:              func() time.Time { return time.Now().UTC() },
 	}
 
 	if cfg.Env == "production" {
@@ -9,10 +9,34 @@ import (
 )
 
 func Migrate(db *gorm.DB, log *zap.Logger) error {
+	// Deduplicated assets share their blob path, so the original unique
+	// index on stored_path is replaced by a plain one.
+	if db.Migrator().HasIndex(&entity.FileAsset{}, "idx_file_assets_stored_path") {
+		if err := db.Migrator().DropIndex(&entity.FileAsset{}, "idx_file_assets_stored_path"); err != nil {
+			return fmt.Errorf("drop stored_path index: %w", err)
+		}
+	}
+
 	if err := db.AutoMigrate(
 		&entity.User{},
 		&entity.FileAsset{},
 		&entity.ExcelExport{},
+		&entity.Blob{},
+		&entity.KeyRotation{},
+		&entity.UploadSession{},
+		&entity.Session{},
+		&entity.RevokedToken{},
+		&entity.APIKey{},
+		&entity.TOTPCredential{},
+		&entity.RecoveryCode{},
+		&entity.LoginThrottle{},
+		&entity.UserIdentity{},
+		&entity.OIDCState{},
+		&entity.Share{},
+		&entity.FilePermission{},
+		&entity.Folder{},
+		&entity.FileTag{},
+		&entity.FileMetadata{},
 	); err != nil {
 		return fmt.Errorf("auto migrate: %w", err)
 	}
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/filehash/internal/usecase"
+	"go.uber.org/zap"
+)
+
+// ForgotPassword always answers 202 for a well-formed request, so it cannot
+// be used to find out which addresses have accounts.
+func (h *Handlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	if err := h.accountUseCase.RequestPasswordReset(ctx, req.Email); err != nil {
+		if strings.Contains(err.Error(), "is required") {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.log.Error("password reset request failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "password reset failed")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
+
+func (h *Handlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	err := h.accountUseCase.ResetPassword(ctx, usecase.ResetPasswordRequest{
+		Token:    req.Token,
+		Password: req.Password,
+	})
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "invalid token"):
+			writeError(w, http.StatusBadRequest, "invalid or expired token")
+		case strings.Contains(err.Error(), "is required"),
+			strings.Contains(err.Error(), "password must"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Error("password reset failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "password reset failed")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// VerifyEmail takes the token from the query string, so that the link in
+// the email works as is, or from a JSON body.
+func (h *Handlers) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		limited := io.LimitReader(r.Body, 1<<20)
+		defer r.Body.Close()
+
+		var req struct {
+			Token string `json:"token"`
+		}
+
+		decoder := json.NewDecoder(limited)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			h.log.Warn("json decode failed", zap.Error(err))
+			writeError(w, http.StatusBadRequest, "invalid JSON payload")
+			return
+		}
+		token = req.Token
+	}
+
+	if err := h.accountUseCase.VerifyEmail(ctx, token); err != nil {
+		switch {
+		case strings.Contains(err.Error(), "invalid token"):
+			writeError(w, http.StatusBadRequest, "invalid or expired token")
+		case strings.Contains(err.Error(), "is required"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Error("email verification failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "email verification failed")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (h *Handlers) SendVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := h.accountUseCase.SendVerification(ctx, userIDFromContext(ctx)); err != nil {
+		if strings.Contains(err.Error(), "already verified") {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		h.log.Error("send verification failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "send verification failed")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
@@ -0,0 +1,228 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/internal/usecase"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+func (h *Handlers) AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	req := usecase.ListUsersRequest{EmailPrefix: strings.TrimSpace(strings.ToLower(query.Get("email")))}
+	for name, dst := range map[string]*int{"offset": &req.Offset, "limit": &req.Limit} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid "+name)
+			return
+		}
+		*dst = n
+	}
+
+	resp, err := h.adminUseCase.ListUsers(ctx, userIDFromContext(ctx), req)
+	if err != nil {
+		h.writeAdminError(w, "list users failed", err)
+		return
+	}
+
+	items := make([]map[string]any, len(resp.Users))
+	for i := range resp.Users {
+		items[i] = userJSON(&resp.Users[i])
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"users": items,
+		"total": resp.Total,
+	})
+}
+
+func (h *Handlers) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := h.adminUseCase.GetUser(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeAdminError(w, "get user failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, userJSON(user))
+}
+
+// AdminUpdateUser changes the role of a user.
+func (h *Handlers) AdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		Role string `json:"role"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	user, err := h.adminUseCase.SetRole(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"), req.Role)
+	if err != nil {
+		h.writeAdminError(w, "update user failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, userJSON(user))
+}
+
+func (h *Handlers) AdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := h.adminUseCase.DisableUser(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeAdminError(w, "disable user failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, userJSON(user))
+}
+
+func (h *Handlers) AdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := h.adminUseCase.EnableUser(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeAdminError(w, "enable user failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, userJSON(user))
+}
+
+func (h *Handlers) AdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	unlocked, err := h.adminUseCase.UnlockUser(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeAdminError(w, "unlock user failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":   "success",
+		"unlocked": unlocked,
+	})
+}
+
+func (h *Handlers) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	resp, err := h.adminUseCase.DeleteUser(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeAdminError(w, "delete user failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":            "success",
+		"files_deleted":     resp.Files,
+		"uploads_discarded": resp.Uploads,
+	})
+}
+
+func (h *Handlers) AdminListUserFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	assets, err := h.adminUseCase.ListUserFiles(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeAdminError(w, "list user files failed", err)
+		return
+	}
+
+	results := make([]map[string]any, 0, len(assets))
+	for _, asset := range assets {
+		results = append(results, map[string]any{
+			"file_id":       asset.ID,
+			"original_name": asset.OriginalName,
+			"content_type":  asset.ContentType,
+			"size_bytes":    asset.SizeBytes,
+			"hashes":        asset.Hashes(),
+			"created_at":    asset.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status": "success",
+		"files":  results,
+		"count":  len(results),
+	})
+}
+
+func (h *Handlers) AdminStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats, err := h.adminUseCase.Stats(ctx, userIDFromContext(ctx))
+	if err != nil {
+		h.writeAdminError(w, "stats failed", err)
+		return
+	}
+
+	byBackend := func(usage map[string]repository.StorageUsage) map[string]any {
+		out := make(map[string]any, len(usage))
+		for backend, u := range usage {
+			out[backend] = usageJSON(u)
+		}
+		return out
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"users": map[string]any{
+			"total":    stats.Users.Total,
+			"verified": stats.Users.Verified,
+			"disabled": stats.Users.Disabled,
+			"by_role":  stats.Users.ByRole,
+		},
+		"files": map[string]any{
+			"count":     stats.Files.Total.Count,
+			"bytes":     stats.Files.Total.Bytes,
+			"anonymous": stats.Files.Anonymous,
+		},
+		"dedup_blobs": usageJSON(stats.Dedup),
+		"storage":     byBackend(stats.Storage),
+	})
+}
+
+func (h *Handlers) writeAdminError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "permission denied"):
+		writeError(w, http.StatusForbidden, err.Error())
+	case strings.Contains(err.Error(), "user not found"):
+		writeError(w, http.StatusNotFound, "user not found")
+	case strings.Contains(err.Error(), "invalid role"),
+		strings.Contains(err.Error(), "must not be negative"):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case strings.Contains(err.Error(), "yourself"),
+		strings.Contains(err.Error(), "last admin"):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		h.log.Error(msg, zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func userJSON(user *entity.User) map[string]any {
+	return map[string]any{
+		"id":                user.ID,
+		"email":             user.Email,
+		"role":              user.Role,
+		"email_verified_at": formatOptionalTime(user.EmailVerifiedAt),
+		"disabled_at":       formatOptionalTime(user.DisabledAt),
+		"has_password":      user.Password != "",
+		"created_at":        user.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func usageJSON(usage repository.StorageUsage) map[string]int64 {
+	return map[string]int64{
+		"count": usage.Count,
+		"bytes": usage.Bytes,
+	}
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/usecase"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+func (h *Handlers) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	resp, err := h.apiKeyUseCase.CreateAPIKey(ctx, usecase.CreateAPIKeyRequest{
+		UserID:    userIDFromContext(ctx),
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "create api key") || strings.Contains(err.Error(), "generate api key") {
+			h.log.Error("create api key failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "api key creation failed")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	payload := apiKeyJSON(resp.APIKey)
+	payload["key"] = resp.Key
+	writeJSON(w, http.StatusCreated, payload)
+}
+
+func (h *Handlers) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keys, err := h.apiKeyUseCase.ListAPIKeys(ctx, userIDFromContext(ctx), r.URL.Query().Get("prefix"))
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid prefix") {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.log.Error("list api keys failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "list failed")
+		return
+	}
+
+	items := make([]map[string]any, len(keys))
+	for i := range keys {
+		items[i] = apiKeyJSON(&keys[i])
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"api_keys": items,
+	})
+}
+
+func (h *Handlers) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := h.apiKeyUseCase.RevokeAPIKey(ctx, userIDFromContext(ctx), chi.URLParam(r, "id")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "api key not found")
+			return
+		}
+		h.log.Error("revoke api key failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "revoke failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func apiKeyJSON(key *entity.APIKey) map[string]any {
+	return map[string]any{
+		"id":           key.ID,
+		"name":         key.Name,
+		"prefix":       "fh_" + key.Prefix,
+		"scopes":       key.ScopeList(),
+		"expires_at":   formatOptionalTime(key.ExpiresAt),
+		"last_used_at": formatOptionalTime(key.LastUsedAt),
+		"revoked_at":   formatOptionalTime(key.RevokedAt),
+		"created_at":   key.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func formatOptionalTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
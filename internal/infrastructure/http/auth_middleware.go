@@ -0,0 +1,209 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/filehash/internal/usecase"
+	"go.uber.org/zap"
+)
+
+type contextKey string
+
+const principalContextKey contextKey = "principal"
+
+// principal is the user a request was authenticated as, either by a user
+// token or by an API key.
+type principal struct {
+	userID    string
+	sessionID string   // session family of a user token
+	mfa       bool     // the user token comes from a login with a second factor
+	apiKeyID  string   // set for API keys
+	scopes    []string // granted to an API key; user tokens hold every scope
+}
+
+func (p *principal) hasScope(scope string) bool {
+	return p.apiKeyID == "" || slices.Contains(p.scopes, scope)
+}
+
+func principalFromContext(ctx context.Context) *principal {
+	p, _ := ctx.Value(principalContextKey).(*principal)
+	return p
+}
+
+// userIDFromContext returns the ID of the user authenticated by one of the
+// middlewares below, or "" for an anonymous request.
+func userIDFromContext(ctx context.Context) string {
+	if p := principalFromContext(ctx); p != nil {
+		return p.userID
+	}
+	return ""
+}
+
+// sessionIDFromContext returns the session family of the user token, or ""
+// when the request was not authenticated with one.
+func sessionIDFromContext(ctx context.Context) string {
+	if p := principalFromContext(ctx); p != nil {
+		return p.sessionID
+	}
+	return ""
+}
+
+// requireUser rejects requests without a valid user token or API key.
+func (h *Handlers) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := bearerToken(r.Header.Get("Authorization"))
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		h.serveAuthenticated(w, r, next, token)
+	})
+}
+
+// optionalUser authenticates requests that carry a token and lets anonymous
+// ones through. A token that fails validation is rejected rather than
+// ignored, so an expired session never silently turns anonymous.
+func (h *Handlers) optionalUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, err := bearerToken(header)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		h.serveAuthenticated(w, r, next, token)
+	})
+}
+
+// identifyUser authenticates requests that bear a user token or API key.
+// Any other bearer token is left to the handler, which accepts file tokens.
+func (h *Handlers) identifyUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := bearerToken(r.Header.Get("Authorization"))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, err := h.authenticate(r.Context(), token)
+		if err != nil {
+			if strings.Contains(err.Error(), "invalid token") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h.log.Error("authenticate failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "authentication failed")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey, p)))
+	})
+}
+
+// requireScope rejects API keys that were not granted scope and, when MFA
+// is required, user tokens from logins without a second factor. Requests
+// left to file tokens pass.
+func (h *Handlers) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := principalFromContext(r.Context())
+			if p != nil && !p.hasScope(scope) {
+				writeError(w, http.StatusForbidden, "api key lacks the "+scope+" scope")
+				return
+			}
+			if p != nil && !h.mfaSatisfied(p) {
+				writeError(w, http.StatusForbidden, "two-factor authentication required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireMFA rejects user tokens from logins without a second factor when
+// MFA is required. It guards routes that would otherwise let such a session
+// obtain a credential that reaches files.
+func (h *Handlers) requireMFA(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p := principalFromContext(r.Context()); p != nil && !h.mfaSatisfied(p) {
+			writeError(w, http.StatusForbidden, "two-factor authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireVerifiedEmail rejects users who have not verified their address
+// when verification is required. Anonymous requests pass.
+func (h *Handlers) requireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := principalFromContext(r.Context())
+		if !h.cfg.RequireEmailVerification || p == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		verified, err := h.accountUseCase.EmailVerified(r.Context(), p.userID)
+		if err != nil {
+			h.log.Error("check email verification failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "authentication failed")
+			return
+		}
+		if !verified {
+			writeError(w, http.StatusForbidden, "email verification required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mfaSatisfied reports whether p meets the MFA policy. API keys can only be
+// created from sessions that meet it, so they pass.
+func (h *Handlers) mfaSatisfied(p *principal) bool {
+	return !h.cfg.RequireMFA || p.apiKeyID != "" || p.mfa
+}
+
+// requireSession rejects requests not authenticated with a user token, so
+// that API keys cannot manage credentials.
+func (h *Handlers) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sessionIDFromContext(r.Context()) == "" {
+			writeError(w, http.StatusForbidden, "a user token is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handlers) serveAuthenticated(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	p, err := h.authenticate(r.Context(), token)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid token") {
+			writeError(w, http.StatusUnauthorized, "invalid or expired token")
+			return
+		}
+		h.log.Error("authenticate failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "authentication failed")
+		return
+	}
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey, p)))
+}
+
+func (h *Handlers) authenticate(ctx context.Context, token string) (*principal, error) {
+	if usecase.IsAPIKey(token) {
+		apiKey, err := h.apiKeyUseCase.Authenticate(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		return &principal{userID: apiKey.UserID, apiKeyID: apiKey.ID, scopes: apiKey.ScopeList()}, nil
+	}
+	claims, err := h.authUseCase.Authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return &principal{userID: claims.UserID, sessionID: claims.SessionID, mfa: claims.MFA}, nil
+}
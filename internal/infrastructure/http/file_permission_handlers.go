@@ -0,0 +1,138 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/internal/usecase"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// GrantFilePermission gives another user a role on a file, or changes the
+// role they have.
+func (h *Handlers) GrantFilePermission(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		UserID string `json:"user_id"`
+		Email  string `json:"email"`
+		Role   string `json:"role"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	grant, err := h.permUseCase.Grant(ctx, usecase.GrantFileRequest{
+		ActorID: userIDFromContext(ctx),
+		FileID:  chi.URLParam(r, "id"),
+		UserID:  req.UserID,
+		Email:   req.Email,
+		Role:    req.Role,
+	})
+	if err != nil {
+		h.writePermissionError(w, "grant file permission failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, fileGrantJSON(grant))
+}
+
+func (h *Handlers) RevokeFilePermission(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.permUseCase.Revoke(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"), chi.URLParam(r, "userID"))
+	if err != nil {
+		h.writePermissionError(w, "revoke file permission failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (h *Handlers) ListFilePermissions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	grants, err := h.permUseCase.List(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writePermissionError(w, "list file permissions failed", err)
+		return
+	}
+
+	items := make([]map[string]any, len(grants))
+	for i := range grants {
+		items[i] = fileGrantJSON(&grants[i])
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"permissions": items,
+	})
+}
+
+// SharedWithMe lists the files other users have granted the caller access
+// to.
+func (h *Handlers) SharedWithMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	shared, err := h.permUseCase.SharedWith(ctx, userIDFromContext(ctx))
+	if err != nil {
+		h.log.Error("list shared files failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "list failed")
+		return
+	}
+
+	results := make([]map[string]any, 0, len(shared))
+	for _, item := range shared {
+		results = append(results, map[string]any{
+			"file_id":       item.File.ID,
+			"original_name": item.File.OriginalName,
+			"content_type":  item.File.ContentType,
+			"size_bytes":    item.File.SizeBytes,
+			"hashes":        item.File.Hashes(),
+			"owner_id":      item.File.UserID,
+			"role":          item.Role,
+			"created_at":    item.File.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status": "success",
+		"files":  results,
+		"count":  len(results),
+	})
+}
+
+func (h *Handlers) writePermissionError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "file not found"):
+		writeError(w, http.StatusNotFound, "file not found")
+	case strings.Contains(err.Error(), "user not found"),
+		strings.Contains(err.Error(), "permission not found"):
+		writeError(w, http.StatusNotFound, err.Error())
+	case strings.Contains(err.Error(), "permission denied"):
+		writeError(w, http.StatusForbidden, err.Error())
+	case strings.Contains(err.Error(), "invalid role"),
+		strings.Contains(err.Error(), "is required"):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case strings.Contains(err.Error(), "cannot change"):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		h.log.Error(msg, zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func fileGrantJSON(grant *repository.FileGrant) map[string]any {
+	return map[string]any{
+		"user_id":    grant.UserID,
+		"email":      grant.Email,
+		"role":       grant.Role,
+		"granted_by": grant.GrantedBy,
+		"created_at": grant.CreatedAt.UTC().Format(time.RFC3339),
+		"updated_at": grant.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,175 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/usecase"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+func (h *Handlers) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		Name     string `json:"name"`
+		ParentID string `json:"parent_id"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	folder, err := h.folderUseCase.CreateFolder(ctx, userIDFromContext(ctx), req.Name, req.ParentID)
+	if err != nil {
+		h.writeFolderError(w, "create folder failed", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, folderJSON(folder))
+}
+
+// ListFolders lists the folders inside parent_id, or at the top level.
+func (h *Handlers) ListFolders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	folders, err := h.folderUseCase.ListFolders(ctx, userIDFromContext(ctx), r.URL.Query().Get("parent_id"))
+	if err != nil {
+		h.writeFolderError(w, "list folders failed", err)
+		return
+	}
+
+	items := make([]map[string]any, len(folders))
+	for i := range folders {
+		items[i] = folderJSON(&folders[i])
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"folders": items,
+	})
+}
+
+func (h *Handlers) GetFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	folder, err := h.folderUseCase.GetFolder(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeFolderError(w, "get folder failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, folderJSON(folder))
+}
+
+// FolderPath returns the breadcrumbs of a folder, from the top level down.
+func (h *Handlers) FolderPath(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	path, err := h.folderUseCase.Path(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeFolderError(w, "folder path failed", err)
+		return
+	}
+
+	items := make([]map[string]any, len(path))
+	for i, folder := range path {
+		items[i] = map[string]any{
+			"id":   folder.ID,
+			"name": folder.Name,
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"path": items,
+	})
+}
+
+// UpdateFolder renames and/or moves a folder. A parent_id of "" moves it to
+// the top level; leaving a field out keeps it.
+func (h *Handlers) UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		Name     *string `json:"name"`
+		ParentID *string `json:"parent_id"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	folder, err := h.folderUseCase.UpdateFolder(ctx, usecase.UpdateFolderRequest{
+		UserID:   userIDFromContext(ctx),
+		FolderID: chi.URLParam(r, "id"),
+		Name:     req.Name,
+		ParentID: req.ParentID,
+	})
+	if err != nil {
+		h.writeFolderError(w, "update folder failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, folderJSON(folder))
+}
+
+func (h *Handlers) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	recursive := false
+	if raw := r.URL.Query().Get("recursive"); raw != "" {
+		var err error
+		if recursive, err = strconv.ParseBool(raw); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid recursive")
+			return
+		}
+	}
+
+	resp, err := h.folderUseCase.DeleteFolder(ctx, userIDFromContext(ctx), chi.URLParam(r, "id"), recursive)
+	if err != nil {
+		h.writeFolderError(w, "delete folder failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":          "success",
+		"folders_deleted": resp.Folders,
+		"files_deleted":   resp.Files,
+	})
+}
+
+func (h *Handlers) writeFolderError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "folder not found"):
+		writeError(w, http.StatusNotFound, "folder not found")
+	case strings.Contains(err.Error(), "permission denied"):
+		writeError(w, http.StatusForbidden, err.Error())
+	case strings.Contains(err.Error(), "already exists"),
+		strings.Contains(err.Error(), "not empty"),
+		strings.Contains(err.Error(), "cannot move"),
+		strings.Contains(err.Error(), "nest at most"):
+		writeError(w, http.StatusConflict, err.Error())
+	case strings.Contains(err.Error(), "folder name"):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		h.log.Error(msg, zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func folderJSON(folder *entity.Folder) map[string]any {
+	return map[string]any{
+		"id":         folder.ID,
+		"name":       folder.Name,
+		"parent_id":  folder.ParentID,
+		"created_at": folder.CreatedAt.UTC().Format(time.RFC3339),
+		"updated_at": folder.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
@@ -1,18 +1,21 @@
 package http
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/filehash/internal/config"
+	"github.com/filehash/internal/domain/entity"
 	"github.com/filehash/internal/usecase"
 	"github.com/filehash/pkg/validator"
 	"github.com/go-chi/chi/v5"
@@ -21,26 +24,53 @@ import (
 )
 
 type Handlers struct {
-	cfg         config.Config
-	log         *zap.Logger
-	authUseCase *usecase.AuthUseCase
-	fileUseCase *usecase.FileUseCase
-	excelUseCase *usecase.ExcelUseCase
+	cfg            config.Config
+	log            *zap.Logger
+	authUseCase    *usecase.AuthUseCase
+	accountUseCase *usecase.AccountUseCase
+	oidcUseCase    *usecase.OIDCUseCase // nil when OIDC login is off
+	apiKeyUseCase  *usecase.APIKeyUseCase
+	adminUseCase   *usecase.AdminUseCase
+	mfaUseCase     *usecase.MFAUseCase
+	fileUseCase    *usecase.FileUseCase
+	folderUseCase  *usecase.FolderUseCase
+	permUseCase    *usecase.FilePermissionUseCase
+	shareUseCase   *usecase.ShareUseCase
+	uploadUseCase  *usecase.UploadUseCase
+	excelUseCase   *usecase.ExcelUseCase
 }
 
 func NewHandlers(
 	cfg config.Config,
 	log *zap.Logger,
 	authUseCase *usecase.AuthUseCase,
+	accountUseCase *usecase.AccountUseCase,
+	oidcUseCase *usecase.OIDCUseCase,
+	apiKeyUseCase *usecase.APIKeyUseCase,
+	adminUseCase *usecase.AdminUseCase,
+	mfaUseCase *usecase.MFAUseCase,
 	fileUseCase *usecase.FileUseCase,
+	folderUseCase *usecase.FolderUseCase,
+	permUseCase *usecase.FilePermissionUseCase,
+	shareUseCase *usecase.ShareUseCase,
+	uploadUseCase *usecase.UploadUseCase,
 	excelUseCase *usecase.ExcelUseCase,
 ) *Handlers {
 	return &Handlers{
-		cfg:         cfg,
-		log:         log,
-		authUseCase: authUseCase,
-		fileUseCase: fileUseCase,
-		excelUseCase: excelUseCase,
+		cfg:            cfg,
+		log:            log,
+		authUseCase:    authUseCase,
+		accountUseCase: accountUseCase,
+		oidcUseCase:    oidcUseCase,
+		apiKeyUseCase:  apiKeyUseCase,
+		adminUseCase:   adminUseCase,
+		mfaUseCase:     mfaUseCase,
+		fileUseCase:    fileUseCase,
+		folderUseCase:  folderUseCase,
+		permUseCase:    permUseCase,
+		shareUseCase:   shareUseCase,
+		uploadUseCase:  uploadUseCase,
+		excelUseCase:   excelUseCase,
 	}
 }
 
@@ -67,21 +97,21 @@ func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 		Password: req.Password,
 	}
 
-	resp, err := h.authUseCase.Register(ctx, registerReq)
-	if err != nil {
-		if strings.Contains(err.Error(), "already exists") {
-			writeError(w, http.StatusConflict, err.Error())
+	// The answer is the same for new and taken addresses; see Register.
+	if err := h.authUseCase.Register(ctx, registerReq); err != nil {
+		if strings.Contains(err.Error(), "check email") || strings.Contains(err.Error(), "create user") ||
+			strings.Contains(err.Error(), "hash password") {
+			h.log.Error("register failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "registration failed")
 			return
 		}
-		h.log.Error("register failed", zap.Error(err))
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]any{
-		"status":  "success",
-		"user_id": resp.UserID,
-		"token":   resp.Token,
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"status":  "accepted",
+		"message": "check your email, then sign in",
 	})
 }
 
@@ -110,22 +140,162 @@ func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := h.authUseCase.Login(ctx, loginReq)
 	if err != nil {
+		if writeLoginLocked(w, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "invalid credentials") {
 			writeError(w, http.StatusUnauthorized, "invalid credentials")
 			return
 		}
+		if strings.Contains(err.Error(), "account disabled") {
+			writeError(w, http.StatusForbidden, "account disabled")
+			return
+		}
 		h.log.Error("login failed", zap.Error(err))
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	writeLoginResponse(w, resp)
+}
+
+// writeLoginResponse writes the tokens of a finished login, or the MFA
+// challenge when a second step follows.
+func writeLoginResponse(w http.ResponseWriter, resp *usecase.LoginResponse) {
+	if resp.MFARequired {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":     "mfa_required",
+			"user_id":    resp.UserID,
+			"mfa_token":  resp.MFAToken,
+			"expires_in": int(resp.MFAExpiresIn.Seconds()),
+		})
+		return
+	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"status":  "success",
-		"user_id": resp.UserID,
-		"token":   resp.Token,
+		"status":        "success",
+		"user_id":       resp.UserID,
+		"token":         resp.Token,
+		"refresh_token": resp.RefreshToken,
+	})
+}
+
+func (h *Handlers) Refresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	resp, err := h.authUseCase.Refresh(ctx, req.RefreshToken)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "invalid refresh token"):
+			writeError(w, http.StatusUnauthorized, "invalid refresh token")
+		case strings.Contains(err.Error(), "is required"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Error("refresh failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "refresh failed")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":        "success",
+		"user_id":       resp.UserID,
+		"token":         resp.Token,
+		"refresh_token": resp.RefreshToken,
 	})
 }
 
+// Logout ends the session of the refresh token in the body or, without
+// one, of the bearer user token. "all" ends every session of the user.
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+		All          bool   `json:"all"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	logoutReq := usecase.LogoutRequest{
+		RefreshToken: req.RefreshToken,
+		All:          req.All,
+	}
+	// API keys have no session to end.
+	if sessionID := sessionIDFromContext(ctx); sessionID != "" {
+		logoutReq.UserID = userIDFromContext(ctx)
+		logoutReq.SessionID = sessionID
+	}
+	err := h.authUseCase.Logout(ctx, logoutReq)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "invalid refresh token"):
+			writeError(w, http.StatusUnauthorized, "invalid refresh token")
+		case strings.Contains(err.Error(), "is required"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Error("logout failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "logout failed")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// Revoke invalidates any token issued by the service. Like RFC 7009 it
+// reports success for tokens that are unknown or already invalid.
+func (h *Handlers) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	if err := h.authUseCase.Revoke(ctx, req.Token); err != nil {
+		if strings.Contains(err.Error(), "is required") {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.log.Error("revoke failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "revoke failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
 func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{
 		"status": "ok",
@@ -133,59 +303,131 @@ func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// JWKS publishes the public keys of user and file tokens so that other
+// services can verify them offline.
+func (h *Handlers) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": h.authUseCase.PublicKeys(),
+	})
+}
+
 func (h *Handlers) Upload(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	userID := userIDFromContext(r.Context())
+	if userID == "" && !h.cfg.AnonymousUploads {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
 	maxBody := h.cfg.MaxUpload + (1 << 20)
 	r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+	extendDeadlines(w, h.cfg.TransferTimeout)
 
-	if err := r.ParseMultipartForm(maxBody); err != nil {
+	reader, err := r.MultipartReader()
+	if err != nil {
 		h.log.Warn("multipart parse failed", zap.Error(err))
 		writeError(w, http.StatusBadRequest, "invalid multipart form")
 		return
 	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
+	// Files belong to the authenticated user; anonymous uploads have no
+	// owner.
+	var userPtr *string
+	if userID != "" {
+		userPtr = &userID
+	}
+
+	// Parts are consumed in order and the file is streamed as soon as it is
+	// reached, so form fields must precede the file part.
+	var tags []string
+	metadata := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			writeError(w, http.StatusBadRequest, "file field is required")
+			return
+		}
+		if err != nil {
+			h.log.Warn("multipart parse failed", zap.Error(err))
+			writeError(w, http.StatusBadRequest, "invalid multipart form")
+			return
+		}
+
+		switch part.FormName() {
+		case "user_id":
+			value, err := readFormValue(part)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			// Still accepted from older clients, but it can no longer
+			// claim ownership for anyone else.
+			if uid := strings.TrimSpace(value); uid != "" && uid != userID {
+				writeError(w, http.StatusForbidden, "user_id does not match the authenticated user")
+				return
+			}
+		case "tags":
+			value, err := readFormValue(part)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			tags = append(tags, splitTags(value)...)
+		case "file":
+			h.uploadPart(w, r, part, userPtr, tags, metadata)
+			return
+		default:
+			if key, ok := strings.CutPrefix(part.FormName(), "metadata."); ok {
+				value, err := readFormValue(part)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+				metadata[key] = value
+			}
+		}
+		_ = part.Close()
+	}
+}
+
+func (h *Handlers) uploadPart(w http.ResponseWriter, r *http.Request, part *multipart.Part, userPtr *string, tags []string, metadata map[string]string) {
+	ctx := r.Context()
+	defer part.Close()
+
+	if part.FileName() == "" {
 		writeError(w, http.StatusBadRequest, "file field is required")
 		return
 	}
-	defer file.Close()
 
-	payload, err := readFilePayload(file, h.cfg.MaxUpload)
-	if err != nil {
-		h.log.Warn("file read failed", zap.Error(err))
-		writeError(w, http.StatusBadRequest, err.Error())
+	content := bufio.NewReaderSize(&maxSizeReader{r: part, remaining: h.cfg.MaxUpload}, 512)
+	peek, err := content.Peek(512)
+	if err != nil && err != io.EOF {
+		h.writeUploadError(w, err)
+		return
+	}
+	if len(peek) == 0 {
+		writeError(w, http.StatusBadRequest, "file is empty")
 		return
 	}
 
-	contentType := http.DetectContentType(payload.peek)
+	contentType := http.DetectContentType(peek)
 	if !validator.ValidateContentType(contentType) {
 		writeError(w, http.StatusUnsupportedMediaType, "unsupported content type")
 		return
 	}
 
-	userID := r.FormValue("user_id")
-	var userPtr *string
-	if strings.TrimSpace(userID) != "" {
-		uid := strings.TrimSpace(userID)
-		if err := validator.ValidateUserID(uid); err != nil {
-			writeError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		userPtr = &uid
-	}
-
 	req := usecase.UploadFileRequest{
-		Filename:    header.Filename,
-		Content:     payload.data,
+		Filename:    part.FileName(),
+		Content:     content,
 		ContentType: contentType,
 		UserID:      userPtr,
+		Tags:        tags,
+		Metadata:    metadata,
 	}
 
 	resp, err := h.fileUseCase.UploadFile(ctx, req)
 	if err != nil {
-		h.log.Error("upload file failed", zap.Error(err))
-		writeError(w, http.StatusInternalServerError, "upload failed")
+		h.writeUploadError(w, err)
 		return
 	}
 
@@ -195,15 +437,30 @@ func (h *Handlers) Upload(w http.ResponseWriter, r *http.Request) {
 	)
 
 	writeJSON(w, http.StatusCreated, map[string]any{
-		"status":      "success",
-		"file_id":     resp.FileID,
-		"token":       resp.Token,
-		"expires_in":  resp.ExpiresIn,
+		"status":       "success",
+		"file_id":      resp.FileID,
+		"token":        resp.Token,
+		"expires_in":   resp.ExpiresIn,
 		"content_type": contentType,
-		"size_bytes":  len(payload.data),
+		"size_bytes":   resp.SizeBytes,
+		"hashes":       resp.Hashes,
 	})
 }
 
+func (h *Handlers) writeUploadError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, errFileTooLarge) || errors.As(err, &maxBytesErr) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds limit of %d bytes", h.cfg.MaxUpload))
+		return
+	}
+	if strings.Contains(err.Error(), "invalid tags") || strings.Contains(err.Error(), "invalid metadata") {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.log.Error("upload file failed", zap.Error(err))
+	writeError(w, http.StatusInternalServerError, "upload failed")
+}
+
 func (h *Handlers) GetImage(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	fileID := chi.URLParam(r, "id")
@@ -221,6 +478,7 @@ func (h *Handlers) GetImage(w http.ResponseWriter, r *http.Request) {
 	req := usecase.GetFileRequest{
 		FileID: fileID,
 		Token:  tokenStr,
+		UserID: userIDFromContext(ctx),
 	}
 
 	resp, err := h.fileUseCase.GetFile(ctx, req)
@@ -238,13 +496,18 @@ func (h *Handlers) GetImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	defer resp.Content.Close()
+	extendDeadlines(w, h.cfg.TransferTimeout)
+
+	// Stored content never changes, so the file ID is a strong validator
+	// for If-Range. ServeContent takes care of Range, If-Range, 206 and
+	// multipart/byteranges responses, seeking only into the requested
+	// chunks.
 	w.Header().Set("Content-Type", resp.ContentType)
 	w.Header().Set("Cache-Control", "no-store")
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, validator.SanitizeFilename(resp.Filename)))
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(resp.Content); err != nil {
-		h.log.Warn("write response failed", zap.Error(err))
-	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, resp.FileID))
+	http.ServeContent(w, r, "", resp.ModTime, resp.Content)
 }
 
 func (h *Handlers) GetFileMetadata(w http.ResponseWriter, r *http.Request) {
@@ -264,6 +527,7 @@ func (h *Handlers) GetFileMetadata(w http.ResponseWriter, r *http.Request) {
 	req := usecase.GetFileMetadataRequest{
 		FileID: fileID,
 		Token:  tokenStr,
+		UserID: userIDFromContext(ctx),
 	}
 
 	asset, err := h.fileUseCase.GetFileMetadata(ctx, req)
@@ -282,16 +546,84 @@ func (h *Handlers) GetFileMetadata(w http.ResponseWriter, r *http.Request) {
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"file_id":         asset.ID,
-		"original_name":   asset.OriginalName,
-		"content_type":    asset.ContentType,
-		"size_bytes":      asset.SizeBytes,
-		"encryption_alg":  asset.EncryptionAlg,
-		"created_at":      asset.CreatedAt.UTC().Format(time.RFC3339),
-		"updated_at":      asset.UpdatedAt.UTC().Format(time.RFC3339),
+		"file_id":        asset.ID,
+		"original_name":  asset.OriginalName,
+		"content_type":   asset.ContentType,
+		"size_bytes":     asset.SizeBytes,
+		"encryption_alg": asset.EncryptionAlg,
+		"hashes":         asset.Hashes(),
+		"folder_id":      asset.FolderID,
+		"tags":           tagsJSON(asset.Tags),
+		"metadata":       metadataJSON(asset.Metadata),
+		"created_at":     asset.CreatedAt.UTC().Format(time.RFC3339),
+		"updated_at":     asset.UpdatedAt.UTC().Format(time.RFC3339),
 	})
 }
 
+func (h *Handlers) VerifyFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	fileID := chi.URLParam(r, "id")
+	if strings.TrimSpace(fileID) == "" {
+		writeError(w, http.StatusBadRequest, "file id required")
+		return
+	}
+
+	tokenStr, err := bearerToken(r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	extendDeadlines(w, h.cfg.TransferTimeout)
+
+	req := usecase.VerifyFileRequest{
+		FileID: fileID,
+		Token:  tokenStr,
+		UserID: userIDFromContext(ctx),
+	}
+
+	resp, err := h.fileUseCase.VerifyFile(ctx, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "file not found")
+			return
+		}
+		if strings.Contains(err.Error(), "token") || strings.Contains(err.Error(), "mismatch") {
+			writeError(w, http.StatusForbidden, "invalid token")
+			return
+		}
+		if strings.Contains(err.Error(), "no stored digest") {
+			writeError(w, http.StatusConflict, "file has no stored digest")
+			return
+		}
+		h.log.Error("verify file failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "verification failed")
+		return
+	}
+
+	if !resp.Valid {
+		h.log.Warn("file integrity check failed",
+			zap.String("file_id", fileID),
+			zap.String("reason", resp.Reason),
+			zap.String("request_id", getRequestID(ctx)),
+		)
+	}
+
+	payload := map[string]any{
+		"status":   "success",
+		"file_id":  fileID,
+		"valid":    resp.Valid,
+		"expected": resp.Expected,
+	}
+	if resp.Actual != nil {
+		payload["actual"] = resp.Actual
+	}
+	if resp.Reason != "" {
+		payload["reason"] = resp.Reason
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
 func (h *Handlers) DeleteFile(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	fileID := chi.URLParam(r, "id")
@@ -309,6 +641,7 @@ func (h *Handlers) DeleteFile(w http.ResponseWriter, r *http.Request) {
 	req := usecase.DeleteFileRequest{
 		FileID: fileID,
 		Token:  tokenStr,
+		UserID: userIDFromContext(ctx),
 	}
 
 	if err := h.fileUseCase.DeleteFile(ctx, req); err != nil {
@@ -316,6 +649,10 @@ func (h *Handlers) DeleteFile(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "file not found")
 			return
 		}
+		if strings.Contains(err.Error(), "permission denied") {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
 		if strings.Contains(err.Error(), "token") || strings.Contains(err.Error(), "mismatch") {
 			writeError(w, http.StatusForbidden, "invalid token")
 			return
@@ -336,46 +673,179 @@ func (h *Handlers) DeleteFile(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *Handlers) ListFiles(w http.ResponseWriter, r *http.Request) {
+// UpdateFile changes the details of a file: its tags, its metadata and the
+// folder it is in. Fields left out are kept.
+func (h *Handlers) UpdateFile(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	userID := r.URL.Query().Get("user_id")
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		FolderID *string            `json:"folder_id"`
+		Tags     *[]string          `json:"tags"`
+		Metadata map[string]*string `json:"metadata"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	if req.FolderID == nil && req.Tags == nil && req.Metadata == nil {
+		writeError(w, http.StatusBadRequest, "nothing to update")
+		return
+	}
 
-	if userID == "" {
-		writeError(w, http.StatusBadRequest, "user_id query parameter required")
+	userID := userIDFromContext(ctx)
+	fileID := chi.URLParam(r, "id")
+	var err error
+	if req.Tags != nil || req.Metadata != nil {
+		_, err = h.fileUseCase.UpdateAttributes(ctx, usecase.UpdateAttributesRequest{
+			UserID:   userID,
+			FileID:   fileID,
+			Tags:     req.Tags,
+			Metadata: req.Metadata,
+		})
+	}
+	if err == nil && req.FolderID != nil {
+		_, err = h.folderUseCase.MoveFile(ctx, userID, fileID, *req.FolderID)
+	}
+	var asset *entity.FileAsset
+	if err == nil {
+		asset, err = h.fileUseCase.GetFileMetadata(ctx, usecase.GetFileMetadataRequest{FileID: fileID, UserID: userID})
+	}
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "file not found"):
+			writeError(w, http.StatusNotFound, "file not found")
+		case strings.Contains(err.Error(), "invalid tags"),
+			strings.Contains(err.Error(), "invalid metadata"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.writeFolderError(w, "update file failed", err)
+		}
 		return
 	}
 
-	if err := validator.ValidateUserID(userID); err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+	writeJSON(w, http.StatusOK, map[string]any{
+		"file_id":       asset.ID,
+		"original_name": asset.OriginalName,
+		"folder_id":     asset.FolderID,
+		"tags":          tagsJSON(asset.Tags),
+		"metadata":      metadataJSON(asset.Metadata),
+		"updated_at":    asset.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (h *Handlers) ListFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := userIDFromContext(ctx)
+
+	if claimed := r.URL.Query().Get("user_id"); claimed != "" && claimed != userID {
+		writeError(w, http.StatusForbidden, "user_id does not match the authenticated user")
 		return
 	}
 
+	query := r.URL.Query()
 	req := usecase.ListFilesRequest{
-		UserID: userID,
+		UserID:      userID,
+		Tags:        splitTags(query["tags"]...),
+		ContentType: query.Get("content_type"),
+		NamePrefix:  query.Get("name_prefix"),
+		Sort:        query.Get("sort"),
+		Order:       query.Get("order"),
+		Cursor:      query.Get("cursor"),
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		req.Limit = limit
+	}
+	for name, dst := range map[string]**time.Time{"created_after": &req.CreatedAfter, "created_before": &req.CreatedBefore} {
+		if raw := query.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid "+name+" (must be RFC 3339)")
+				return
+			}
+			*dst = &t
+		}
+	}
+	for name, dst := range map[string]**int64{"min_size": &req.MinSize, "max_size": &req.MaxSize} {
+		if raw := query.Get(name); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, "invalid "+name)
+				return
+			}
+			*dst = &n
+		}
+	}
+	for name, values := range query {
+		if key, ok := strings.CutPrefix(name, "metadata."); ok {
+			if req.Metadata == nil {
+				req.Metadata = make(map[string]string)
+			}
+			req.Metadata[key] = values[0]
+		}
 	}
 
-	assets, err := h.fileUseCase.ListFiles(ctx, req)
+	var resp *usecase.ListFilesResponse
+	var err error
+	if query.Has("folder_id") {
+		// An empty folder_id lists the files at the top level.
+		folderID := query.Get("folder_id")
+		req.FolderID = &folderID
+		resp, err = h.folderUseCase.ListFiles(ctx, req)
+	} else {
+		resp, err = h.fileUseCase.ListFiles(ctx, req)
+	}
 	if err != nil {
+		if strings.Contains(err.Error(), "folder not found") {
+			writeError(w, http.StatusNotFound, "folder not found")
+			return
+		}
+		if strings.Contains(err.Error(), "invalid sort") ||
+			strings.Contains(err.Error(), "invalid order") ||
+			strings.Contains(err.Error(), "invalid cursor") {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		h.log.Error("list files failed", zap.Error(err))
 		writeError(w, http.StatusInternalServerError, "list failed")
 		return
 	}
 
-	results := make([]map[string]any, 0, len(assets))
-	for _, asset := range assets {
+	results := make([]map[string]any, 0, len(resp.Files))
+	for _, asset := range resp.Files {
 		results = append(results, map[string]any{
 			"file_id":       asset.ID,
 			"original_name": asset.OriginalName,
 			"content_type":  asset.ContentType,
 			"size_bytes":    asset.SizeBytes,
+			"hashes":        asset.Hashes(),
+			"folder_id":     asset.FolderID,
+			"tags":          tagsJSON(asset.Tags),
+			"metadata":      metadataJSON(asset.Metadata),
 			"created_at":    asset.CreatedAt.UTC().Format(time.RFC3339),
 		})
 	}
 
+	var nextCursor any
+	if resp.NextCursor != "" {
+		nextCursor = resp.NextCursor
+	}
 	writeJSON(w, http.StatusOK, map[string]any{
-		"status": "success",
-		"files":  results,
-		"count":  len(results),
+		"status":      "success",
+		"files":       results,
+		"count":       len(results),
+		"total":       resp.Total,
+		"next_cursor": nextCursor,
 	})
 }
 
@@ -413,30 +883,86 @@ func (h *Handlers) JSONToExcel(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func readFilePayload(file multipart.File, maxSize int64) (*filePayload, error) {
-	var buf bytes.Buffer
-	limited := io.LimitReader(file, maxSize+1)
-	n, err := buf.ReadFrom(limited)
-	if err != nil {
-		return nil, fmt.Errorf("read file: %w", err)
+var errFileTooLarge = errors.New("file exceeds upload limit")
+
+// maxSizeReader fails with errFileTooLarge once more than remaining bytes
+// have been read from r.
+type maxSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	if m.remaining < 0 {
+		return 0, errFileTooLarge
+	}
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	if m.remaining < 0 {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
+
+// splitTags splits comma-separated lists of tags, dropping empty entries.
+func splitTags(values ...string) []string {
+	var tags []string
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
 	}
-	if n > maxSize {
-		return nil, fmt.Errorf("file exceeds limit of %d bytes", maxSize)
+	return tags
+}
+
+// tagsJSON and metadataJSON render missing attributes as empty rather than
+// null.
+func tagsJSON(tags []string) []string {
+	if tags == nil {
+		return []string{}
 	}
-	data := buf.Bytes()
-	peekLen := len(data)
-	if peekLen > 512 {
-		peekLen = 512
+	return tags
+}
+
+func metadataJSON(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return map[string]string{}
 	}
-	return &filePayload{
-		data: data,
-		peek: data[:peekLen],
-	}, nil
+	return metadata
 }
 
-type filePayload struct {
-	data []byte
-	peek []byte
+func readFormValue(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, 4<<10))
+	if err != nil {
+		return "", fmt.Errorf("read form field %q: %w", part.FormName(), err)
+	}
+	return string(value), nil
+}
+
+// extendDeadlines lifts the server-wide read and write timeouts for
+// handlers that stream large bodies.
+func extendDeadlines(w http.ResponseWriter, timeout time.Duration) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(timeout)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+}
+
+// writeLoginLocked answers 429 with Retry-After when err reports a login
+// lockout.
+func writeLoginLocked(w http.ResponseWriter, err error) bool {
+	var locked *usecase.LoginLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, locked.Error())
+	return true
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload any) {
@@ -471,4 +997,3 @@ func getRequestID(ctx context.Context) string {
 	}
 	return middleware.GetReqID(ctx)
 }
-
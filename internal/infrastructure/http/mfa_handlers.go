@@ -0,0 +1,179 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/filehash/internal/usecase"
+	"go.uber.org/zap"
+)
+
+func (h *Handlers) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	resp, err := h.mfaUseCase.EnrollTOTP(ctx, userIDFromContext(ctx))
+	if err != nil {
+		h.writeMFAError(w, "enroll totp failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"secret":      resp.Secret,
+		"otpauth_uri": resp.URI,
+	})
+}
+
+func (h *Handlers) EnableTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	codes, err := h.mfaUseCase.EnableTOTP(ctx, userIDFromContext(ctx), req.Code)
+	if err != nil {
+		h.writeMFAError(w, "enable totp failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":         "success",
+		"recovery_codes": codes,
+	})
+}
+
+func (h *Handlers) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	err := h.mfaUseCase.DisableTOTP(ctx, usecase.DisableTOTPRequest{
+		UserID:   userIDFromContext(ctx),
+		Password: req.Password,
+		Code:     req.Code,
+	})
+	if err != nil {
+		h.writeMFAError(w, "disable totp failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (h *Handlers) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	codes, err := h.mfaUseCase.RegenerateRecoveryCodes(ctx, userIDFromContext(ctx), req.Code)
+	if err != nil {
+		h.writeMFAError(w, "regenerate recovery codes failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":         "success",
+		"recovery_codes": codes,
+	})
+}
+
+// LoginMFA is the second login step for users with two-factor
+// authentication: it exchanges the challenge token from /auth/login and a
+// TOTP or recovery code for the session tokens.
+func (h *Handlers) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	resp, err := h.authUseCase.LoginMFA(ctx, usecase.LoginMFARequest{
+		MFAToken: req.MFAToken,
+		Code:     req.Code,
+	})
+	if err != nil {
+		if writeLoginLocked(w, err) {
+			return
+		}
+		switch {
+		case strings.Contains(err.Error(), "is required"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case strings.Contains(err.Error(), "invalid mfa token"),
+			strings.Contains(err.Error(), "invalid code"),
+			strings.Contains(err.Error(), "not enabled"):
+			writeError(w, http.StatusUnauthorized, "invalid mfa token or code")
+		case strings.Contains(err.Error(), "account disabled"):
+			writeError(w, http.StatusForbidden, "account disabled")
+		default:
+			h.log.Error("mfa login failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "login failed")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":        "success",
+		"user_id":       resp.UserID,
+		"token":         resp.Token,
+		"refresh_token": resp.RefreshToken,
+	})
+}
+
+// writeMFAError maps errors of the 2FA management endpoints.
+func (h *Handlers) writeMFAError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "invalid code"),
+		strings.Contains(err.Error(), "invalid credentials"):
+		writeError(w, http.StatusForbidden, err.Error())
+	case strings.Contains(err.Error(), "already enabled"),
+		strings.Contains(err.Error(), "not enabled"),
+		strings.Contains(err.Error(), "no pending"):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		h.log.Error(msg, zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "two-factor authentication update failed")
+	}
+}
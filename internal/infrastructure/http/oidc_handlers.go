@@ -0,0 +1,98 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/filehash/internal/usecase"
+	"go.uber.org/zap"
+)
+
+// oidcStateCookie ties a login to the browser that started it, so a
+// callback URL made for someone else's login is refused (login CSRF).
+const oidcStateCookie = "fh_oidc_state"
+
+// OIDCLogin redirects the browser to the identity provider.
+func (h *Handlers) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.oidcUseCase.Start(r.Context())
+	if err != nil {
+		h.log.Error("oidc login start failed", zap.Error(err))
+		writeError(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    resp.State,
+		Path:     "/auth/oidc",
+		MaxAge:   int(resp.ExpiresIn.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.cfg.PublicURL, "https://"),
+		// Lax still sends the cookie on the provider's top-level redirect
+		// back to the callback.
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, resp.AuthURL, http.StatusFound)
+}
+
+// OIDCCallback is where the provider sends the browser back. It answers
+// like Login.
+func (h *Handlers) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		writeError(w, http.StatusBadRequest, "invalid state")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.cfg.PublicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		h.log.Info("oidc login refused by provider",
+			zap.String("error", providerErr),
+			zap.String("description", query.Get("error_description")))
+		writeError(w, http.StatusUnauthorized, "login refused by identity provider: "+providerErr)
+		return
+	}
+
+	resp, err := h.oidcUseCase.Callback(ctx, usecase.OIDCCallbackRequest{
+		State: state,
+		Code:  query.Get("code"),
+	})
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "is required"),
+			strings.Contains(err.Error(), "invalid state"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case strings.Contains(err.Error(), "authorization failed"),
+			strings.Contains(err.Error(), "invalid id token"),
+			strings.Contains(err.Error(), "no email address"):
+			h.log.Warn("oidc login rejected", zap.Error(err))
+			writeError(w, http.StatusUnauthorized, "identity provider login failed")
+		case strings.Contains(err.Error(), "already registered"):
+			writeError(w, http.StatusConflict, "email already registered; sign in with your password")
+		case strings.Contains(err.Error(), "account disabled"):
+			writeError(w, http.StatusForbidden, "account disabled")
+		case strings.Contains(err.Error(), "oidc discovery"),
+			strings.Contains(err.Error(), "token request"),
+			strings.Contains(err.Error(), "fetch jwks"):
+			h.log.Error("oidc provider request failed", zap.Error(err))
+			writeError(w, http.StatusBadGateway, "identity provider unavailable")
+		default:
+			h.log.Error("oidc login failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "login failed")
+		}
+		return
+	}
+	writeLoginResponse(w, resp)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/filehash/internal/config"
+	"github.com/filehash/internal/domain/entity"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -23,7 +24,6 @@ func NewRouter(
 	r.Use(middleware.RealIP)
 	r.Use(zapRequestLogger(log))
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
 	r.Use(httprate.LimitByIP(100, time.Minute))
 	r.Use(securityHeaders())
 
@@ -34,23 +34,121 @@ func NewRouter(
 		}
 	}
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   corsOrigins,
-		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodOptions},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		ExposedHeaders:   []string{"Content-Disposition"},
+		AllowedOrigins: corsOrigins,
+		AllowedMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+		AllowedHeaders: []string{
+			"Accept", "Authorization", "Content-Type", "Range", "If-Range", "X-Share-Password",
+			"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata",
+		},
+		ExposedHeaders: []string{
+			"Content-Disposition", "Content-Length", "Content-Range", "Accept-Ranges", "ETag",
+			"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+			"Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires",
+			"Upload-File-Id", "Upload-File-Token", "Upload-File-Token-Expires-In",
+		},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
-	r.Post("/auth/register", handlers.Register)
-	r.Post("/auth/login", handlers.Login)
-	r.Get("/healthz", handlers.Health)
-	r.Post("/upload", handlers.Upload)
-	r.Get("/image/{id}", handlers.GetImage)
-	r.Get("/file/{id}/metadata", handlers.GetFileMetadata)
-	r.Delete("/file/{id}", handlers.DeleteFile)
-	r.Get("/files", handlers.ListFiles)
-	r.Post("/json-to-excel", handlers.JSONToExcel)
+	readFiles := handlers.requireScope(entity.ScopeFilesRead)
+	writeFiles := handlers.requireScope(entity.ScopeFilesWrite)
+	// Endpoints that send mail get a tighter limit so they cannot be used
+	// to flood an inbox.
+	mailLimit := httprate.LimitByIP(5, time.Minute)
+	shareLimit := httprate.LimitByIP(30, time.Minute)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(60 * time.Second))
+
+		r.Post("/auth/register", handlers.Register)
+		r.Post("/auth/login", handlers.Login)
+		r.Post("/auth/login/mfa", handlers.LoginMFA)
+		r.Post("/auth/refresh", handlers.Refresh)
+		r.With(handlers.optionalUser).Post("/auth/logout", handlers.Logout)
+		r.Post("/auth/revoke", handlers.Revoke)
+		r.With(mailLimit).Post("/auth/password/forgot", handlers.ForgotPassword)
+		r.Post("/auth/password/reset", handlers.ResetPassword)
+		r.Get("/auth/verify-email", handlers.VerifyEmail)
+		r.Post("/auth/verify-email", handlers.VerifyEmail)
+		r.With(mailLimit, handlers.requireUser, handlers.requireSession).Post("/auth/verify-email/send", handlers.SendVerification)
+		if handlers.oidcUseCase != nil {
+			r.Get("/auth/oidc/login", handlers.OIDCLogin)
+			r.Get("/auth/oidc/callback", handlers.OIDCCallback)
+		}
+		r.Get("/healthz", handlers.Health)
+		r.Get("/.well-known/jwks.json", handlers.JWKS)
+		r.With(handlers.identifyUser, readFiles).Get("/file/{id}/metadata", handlers.GetFileMetadata)
+		r.With(handlers.identifyUser, writeFiles).Delete("/file/{id}", handlers.DeleteFile)
+		r.With(handlers.requireUser, readFiles).Get("/files", handlers.ListFiles)
+		r.With(handlers.requireUser, readFiles).Get("/files/shared-with-me", handlers.SharedWithMe)
+		r.With(handlers.requireUser, writeFiles).Patch("/file/{id}", handlers.UpdateFile)
+		r.With(handlers.requireUser, readFiles).Get("/folders", handlers.ListFolders)
+		r.With(handlers.requireUser, writeFiles).Post("/folders", handlers.CreateFolder)
+		r.With(handlers.requireUser, readFiles).Get("/folders/{id}", handlers.GetFolder)
+		r.With(handlers.requireUser, readFiles).Get("/folders/{id}/path", handlers.FolderPath)
+		r.With(handlers.requireUser, writeFiles).Patch("/folders/{id}", handlers.UpdateFolder)
+		r.With(handlers.requireUser, writeFiles).Delete("/folders/{id}", handlers.DeleteFolder)
+		r.With(handlers.requireUser, readFiles).Get("/file/{id}/permissions", handlers.ListFilePermissions)
+		r.With(handlers.requireUser, writeFiles).Post("/file/{id}/permissions", handlers.GrantFilePermission)
+		r.With(handlers.requireUser, writeFiles).Delete("/file/{id}/permissions/{userID}", handlers.RevokeFilePermission)
+		r.With(handlers.requireUser, writeFiles).Post("/file/{id}/shares", handlers.CreateShare)
+		r.With(handlers.requireUser, readFiles).Get("/shares", handlers.ListShares)
+		r.With(handlers.requireUser, writeFiles).Delete("/shares/{id}", handlers.RevokeShare)
+		r.With(handlers.optionalUser, handlers.requireScope(entity.ScopeExcelWrite)).Post("/json-to-excel", handlers.JSONToExcel)
+
+		r.Route("/auth/api-keys", func(r chi.Router) {
+			r.Use(handlers.requireUser, handlers.requireSession, handlers.requireMFA)
+			r.Post("/", handlers.CreateAPIKey)
+			r.Get("/", handlers.ListAPIKeys)
+			r.Delete("/{id}", handlers.RevokeAPIKey)
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(handlers.requireUser, handlers.requireSession, handlers.requireMFA)
+			r.Get("/users", handlers.AdminListUsers)
+			r.Get("/users/{id}", handlers.AdminGetUser)
+			r.Patch("/users/{id}", handlers.AdminUpdateUser)
+			r.Delete("/users/{id}", handlers.AdminDeleteUser)
+			r.Post("/users/{id}/disable", handlers.AdminDisableUser)
+			r.Post("/users/{id}/enable", handlers.AdminEnableUser)
+			r.Post("/users/{id}/unlock", handlers.AdminUnlockUser)
+			r.Get("/users/{id}/files", handlers.AdminListUserFiles)
+			r.Get("/stats", handlers.AdminStats)
+		})
+
+		r.Route("/auth/2fa", func(r chi.Router) {
+			r.Use(handlers.requireUser, handlers.requireSession)
+			r.Post("/enroll", handlers.EnrollTOTP)
+			r.Post("/verify", handlers.EnableTOTP)
+			r.Post("/disable", handlers.DisableTOTP)
+			r.Post("/recovery-codes", handlers.RegenerateRecoveryCodes)
+		})
+	})
+
+	// Streaming transfers may legitimately run far longer than regular
+	// API calls.
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(cfg.TransferTimeout))
+
+		r.With(handlers.optionalUser, writeFiles, handlers.requireVerifiedEmail).Post("/upload", handlers.Upload)
+		r.With(handlers.identifyUser, readFiles).Get("/image/{id}", handlers.GetImage)
+		r.With(handlers.identifyUser, readFiles).Head("/image/{id}", handlers.GetImage)
+		r.With(handlers.identifyUser, readFiles).Post("/file/{id}/verify", handlers.VerifyFile)
+		// Public link downloads need no credentials; the limit slows down
+		// guessing of link passwords across links.
+		r.With(shareLimit).Get("/s/{slug}", handlers.DownloadShare)
+		r.With(shareLimit).Post("/s/{slug}", handlers.DownloadShare)
+
+		r.Route("/uploads", func(r chi.Router) {
+			r.Use(tusProtocol)
+			r.Use(handlers.optionalUser, writeFiles, handlers.requireVerifiedEmail)
+			r.Options("/", handlers.UploadOptions)
+			r.Post("/", handlers.CreateUpload)
+			r.Head("/{id}", handlers.UploadStatus)
+			r.Patch("/{id}", handlers.PatchUpload)
+			r.Delete("/{id}", handlers.TerminateUpload)
+		})
+	})
 
 	return r
 }
@@ -86,4 +184,3 @@ func securityHeaders() func(http.Handler) http.Handler {
 		})
 	}
 }
-
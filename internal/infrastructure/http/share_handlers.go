@@ -0,0 +1,174 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/usecase"
+	"github.com/filehash/pkg/validator"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// sharePasswordHeader carries the password of a protected link on GET, so
+// it stays out of URLs and access logs.
+const sharePasswordHeader = "X-Share-Password"
+
+func (h *Handlers) CreateShare(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limited := io.LimitReader(r.Body, 1<<20)
+	defer r.Body.Close()
+
+	var req struct {
+		ExpiresAt    *time.Time `json:"expires_at"`
+		MaxDownloads *int64     `json:"max_downloads"`
+		Password     string     `json:"password"`
+	}
+
+	decoder := json.NewDecoder(limited)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && err != io.EOF {
+		h.log.Warn("json decode failed", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	share, err := h.shareUseCase.CreateShare(ctx, usecase.CreateShareRequest{
+		UserID:       userIDFromContext(ctx),
+		FileID:       chi.URLParam(r, "id"),
+		ExpiresAt:    req.ExpiresAt,
+		MaxDownloads: req.MaxDownloads,
+		Password:     req.Password,
+	})
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "file not found"):
+			writeError(w, http.StatusNotFound, "file not found")
+		case strings.Contains(err.Error(), "permission denied"):
+			writeError(w, http.StatusForbidden, err.Error())
+		case strings.Contains(err.Error(), "must be"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Error("create share failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "share creation failed")
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, h.shareJSON(share))
+}
+
+func (h *Handlers) ListShares(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	shares, err := h.shareUseCase.ListShares(ctx, userIDFromContext(ctx), r.URL.Query().Get("file_id"))
+	if err != nil {
+		h.log.Error("list shares failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "list failed")
+		return
+	}
+
+	items := make([]map[string]any, len(shares))
+	for i := range shares {
+		items[i] = h.shareJSON(&shares[i])
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"shares": items,
+	})
+}
+
+func (h *Handlers) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := h.shareUseCase.RevokeShare(ctx, userIDFromContext(ctx), chi.URLParam(r, "id")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "share not found")
+			return
+		}
+		h.log.Error("revoke share failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "revoke failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// DownloadShare serves the file behind a link to anyone holding it. The
+// password of a protected link comes in the X-Share-Password header, or as
+// the password form field when posted from a browser form.
+//
+// Every request counts as a download before anything is sent, so a link
+// with a download limit is always served whole: no Accept-Ranges, and
+// Range and conditional headers are ignored. Otherwise each part of a
+// resumed transfer, or a 304, would use up a download.
+func (h *Handlers) DownloadShare(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	password := r.Header.Get(sharePasswordHeader)
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+		if err := r.ParseForm(); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid form")
+			return
+		}
+		if form := r.PostForm.Get("password"); form != "" {
+			password = form
+		}
+	}
+
+	resp, err := h.shareUseCase.OpenShare(ctx, usecase.OpenShareRequest{
+		Slug:     chi.URLParam(r, "slug"),
+		Password: password,
+	})
+	if err != nil {
+		if writeLoginLocked(w, err) {
+			return
+		}
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			writeError(w, http.StatusNotFound, "share not found")
+		case strings.Contains(err.Error(), "share unavailable"):
+			writeError(w, http.StatusGone, "share expired, revoked or used up")
+		case strings.Contains(err.Error(), "share password"):
+			writeError(w, http.StatusUnauthorized, err.Error())
+		default:
+			h.log.Error("share download failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "retrieval failed")
+		}
+		return
+	}
+
+	defer resp.Content.Close()
+	extendDeadlines(w, h.cfg.TransferTimeout)
+
+	w.Header().Set("Content-Type", resp.ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, validator.SanitizeFilename(resp.Filename)))
+	if resp.Limited {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.SizeBytes, 10))
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(w, resp.Content); err != nil {
+			h.log.Warn("share download interrupted", zap.Error(err))
+		}
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, resp.FileID))
+	http.ServeContent(w, r, "", resp.ModTime, resp.Content)
+}
+
+func (h *Handlers) shareJSON(share *entity.Share) map[string]any {
+	return map[string]any{
+		"id":               share.ID,
+		"url":              h.cfg.PublicURL + "/s/" + share.Slug,
+		"file_id":          share.FileID,
+		"expires_at":       share.ExpiresAt.UTC().Format(time.RFC3339),
+		"max_downloads":    share.MaxDownloads,
+		"downloads":        share.Downloads,
+		"has_password":     share.PasswordHash != "",
+		"last_download_at": formatOptionalTime(share.LastDownloadAt),
+		"revoked_at":       formatOptionalTime(share.RevokedAt),
+		"created_at":       share.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,234 @@
+package http
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/filehash/internal/usecase"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Resumable uploads follow the tus 1.0 protocol (https://tus.io) with the
+// creation, expiration and termination extensions.
+const (
+	tusVersion         = "1.0.0"
+	tusExtensions      = "creation,expiration,termination"
+	tusOffsetMediaType = "application/offset+octet-stream"
+	maxUploadMetadata  = 4096
+)
+
+// tusProtocol sets Tus-Resumable on every response and rejects requests
+// speaking another protocol version. OPTIONS is exempt, as the spec asks.
+func tusProtocol(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			writeError(w, http.StatusPreconditionFailed, "unsupported tus version")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handlers) UploadOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.uploadUseCase.MaxSize(), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := userIDFromContext(ctx)
+	if userID == "" && !h.cfg.AnonymousUploads {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		writeError(w, http.StatusBadRequest, "deferred upload length is not supported")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeError(w, http.StatusBadRequest, "invalid Upload-Length header")
+		return
+	}
+
+	rawMetadata := r.Header.Get("Upload-Metadata")
+	if len(rawMetadata) > maxUploadMetadata {
+		writeError(w, http.StatusBadRequest, "Upload-Metadata header too large")
+		return
+	}
+	metadata, err := parseUploadMetadata(rawMetadata)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = metadata["name"]
+	}
+	if filename == "" {
+		writeError(w, http.StatusBadRequest, "filename metadata is required")
+		return
+	}
+
+	if uid := strings.TrimSpace(metadata["user_id"]); uid != "" && uid != userID {
+		writeError(w, http.StatusForbidden, "user_id does not match the authenticated user")
+		return
+	}
+	var userPtr *string
+	if userID != "" {
+		userPtr = &userID
+	}
+
+	session, err := h.uploadUseCase.CreateUpload(ctx, usecase.CreateUploadRequest{
+		Length:   length,
+		Filename: filename,
+		Metadata: rawMetadata,
+		UserID:   userPtr,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid filename") || strings.Contains(err.Error(), "must be positive") {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.writeTusError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/uploads/"+session.ID)
+	w.Header().Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handlers) UploadStatus(w http.ResponseWriter, r *http.Request) {
+	session, err := h.uploadUseCase.GetUpload(r.Context(), chi.URLParam(r, "id"), userIDFromContext(r.Context()))
+	if err != nil {
+		h.writeTusError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.Length, 10))
+	w.Header().Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	if session.Metadata != "" {
+		w.Header().Set("Upload-Metadata", session.Metadata)
+	}
+	if session.FileID != nil {
+		w.Header().Set("Upload-File-Id", *session.FileID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) PatchUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	if r.Header.Get("Content-Type") != tusOffsetMediaType {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+tusOffsetMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "invalid Upload-Offset header")
+		return
+	}
+	extendDeadlines(w, h.cfg.TransferTimeout)
+
+	resp, err := h.uploadUseCase.AppendUpload(ctx, usecase.AppendUploadRequest{
+		ID:     chi.URLParam(r, "id"),
+		UserID: userIDFromContext(ctx),
+		Offset: offset,
+		Body:   r.Body,
+	})
+	if err != nil {
+		h.writeTusError(w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(resp.Upload.Offset, 10))
+	w.Header().Set("Upload-Expires", resp.Upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if resp.File != nil {
+		// tus has no notion of a result, so the registered file travels in
+		// extra headers of the final PATCH response.
+		w.Header().Set("Upload-File-Id", resp.File.FileID)
+		w.Header().Set("Upload-File-Token", resp.File.Token)
+		w.Header().Set("Upload-File-Token-Expires-In", strconv.Itoa(resp.File.ExpiresIn))
+		// Retries of a finished upload only reissue the token.
+		if resp.ContentType != "" {
+			h.log.Info("file uploaded",
+				zap.String("file_id", resp.File.FileID),
+				zap.String("upload_id", resp.Upload.ID),
+				zap.String("request_id", getRequestID(ctx)),
+			)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) TerminateUpload(w http.ResponseWriter, r *http.Request) {
+	if err := h.uploadUseCase.TerminateUpload(r.Context(), chi.URLParam(r, "id"), userIDFromContext(r.Context())); err != nil {
+		h.writeTusError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) writeTusError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrUploadNotFound):
+		writeError(w, http.StatusNotFound, "upload not found")
+	case errors.Is(err, usecase.ErrUploadExpired):
+		writeError(w, http.StatusGone, "upload expired")
+	case errors.Is(err, usecase.ErrUploadOffsetMismatch):
+		writeError(w, http.StatusConflict, "Upload-Offset does not match the upload")
+	case errors.Is(err, usecase.ErrUploadLocked):
+		writeError(w, http.StatusLocked, "upload is busy with another request")
+	case errors.Is(err, usecase.ErrUploadTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds its length or the limit of %d bytes", h.cfg.MaxUpload))
+	case errors.Is(err, usecase.ErrUploadUnsupportedType):
+		writeError(w, http.StatusUnsupportedMediaType, "unsupported content type")
+	default:
+		h.log.Error("resumable upload failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "upload failed")
+	}
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma-separated
+// pairs of a key and an optional base64-encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, errors.New("invalid Upload-Metadata header")
+		}
+		key := fields[0]
+		if _, dup := metadata[key]; dup {
+			return nil, fmt.Errorf("duplicate Upload-Metadata key %q", key)
+		}
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid Upload-Metadata value for %q", key)
+			}
+			value = string(decoded)
+		}
+		metadata[key] = value
+	}
+	return metadata, nil
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type blobRepository struct {
+	db *gorm.DB
+}
+
+func NewBlobRepository(db *gorm.DB) repository.BlobRepository {
+	return &blobRepository{db: db}
+}
+
+func (r *blobRepository) Acquire(ctx context.Context, blob *entity.Blob) (*entity.Blob, bool, error) {
+	var stored entity.Blob
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		blob.RefCount = 1
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(blob)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			created = true
+			stored = *blob
+			return nil
+		}
+
+		res = tx.Model(&entity.Blob{}).
+			Where("id = ?", blob.ID).
+			UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("blob released concurrently")
+		}
+		return tx.First(&stored, "id = ?", blob.ID).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &stored, created, nil
+}
+
+func (r *blobRepository) Release(ctx context.Context, id string) (*entity.Blob, error) {
+	var released *entity.Blob
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&entity.Blob{}).
+			Where("id = ?", id).
+			UpdateColumn("ref_count", gorm.Expr("ref_count - 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return utils.ErrRecordNotFound
+		}
+
+		var blob entity.Blob
+		if err := tx.First(&blob, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if blob.RefCount > 0 {
+			return nil
+		}
+		if err := tx.Delete(&entity.Blob{}, "id = ? AND ref_count <= 0", id).Error; err != nil {
+			return err
+		}
+		released = &blob
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return released, nil
+}
+
+func (r *blobRepository) FindByID(ctx context.Context, id string) (*entity.Blob, error) {
+	var blob entity.Blob
+	if err := r.db.WithContext(ctx).First(&blob, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &blob, nil
+}
+
+func (r *blobRepository) UpdateWrappedKey(ctx context.Context, id string, wrappedKey []byte, keyID string) error {
+	return r.db.WithContext(ctx).Model(&entity.Blob{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"wrapped_key": wrappedKey, "key_id": keyID}).Error
+}
+
+func (r *blobRepository) ListByStaleKey(ctx context.Context, activeKeyID, afterID string, limit int) ([]entity.Blob, error) {
+	var blobs []entity.Blob
+	err := r.db.WithContext(ctx).
+		Where("key_id <> ? AND id > ?", activeKeyID, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&blobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+func (r *blobRepository) CountByKeyID(ctx context.Context) (map[string]int64, error) {
+	return countByKeyID(r.db.WithContext(ctx).Model(&entity.Blob{}))
+}
+
+func (r *blobRepository) ListOutsideBackend(ctx context.Context, backend, afterID string, limit int) ([]entity.Blob, error) {
+	var blobs []entity.Blob
+	err := r.db.WithContext(ctx).
+		Where("storage_backend <> ? AND id > ?", backend, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&blobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+func (r *blobRepository) UpdateStorageBackend(ctx context.Context, id, from, to string) (bool, error) {
+	return updateStorageBackend(r.db.WithContext(ctx).Model(&entity.Blob{}), id, from, to)
+}
+
+func (r *blobRepository) BackfillStorageBackend(ctx context.Context, backend string) (int64, error) {
+	return backfillStorageBackend(r.db.WithContext(ctx).Model(&entity.Blob{}), backend)
+}
+
+func countByKeyID(query *gorm.DB) (map[string]int64, error) {
+	var rows []struct {
+		KeyID string
+		Count int64
+	}
+	if err := query.Select("key_id, COUNT(*) AS count").Group("key_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.KeyID] = row.Count
+	}
+	return counts, nil
+}
+
+// updateStorageBackend flips a row to another backend only while it still
+// records the expected one, so a concurrent delete or move is not undone.
+func updateStorageBackend(query *gorm.DB, id, from, to string) (bool, error) {
+	result := query.Where("id = ? AND storage_backend = ?", id, from).Update("storage_backend", to)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func backfillStorageBackend(query *gorm.DB, backend string) (int64, error) {
+	result := query.Where("storage_backend IS NULL OR storage_backend = ''").Update("storage_backend", backend)
+	return result.RowsAffected, result.Error
+}
+
+func (r *blobRepository) UsageByBackend(ctx context.Context) (map[string]repository.StorageUsage, error) {
+	return usageByBackend(r.db.WithContext(ctx).Model(&entity.Blob{}))
+}
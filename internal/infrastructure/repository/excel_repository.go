@@ -37,3 +37,24 @@ func (r *excelRepository) Delete(ctx context.Context, id string) error {
 	return r.db.WithContext(ctx).Delete(&entity.ExcelExport{}, "id = ?", id).Error
 }
 
+func (r *excelRepository) ListOutsideBackend(ctx context.Context, backend, afterID string, limit int) ([]entity.ExcelExport, error) {
+	var exports []entity.ExcelExport
+	err := r.db.WithContext(ctx).
+		Where("storage_backend <> ? AND id > ?", backend, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&exports).Error
+	if err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (r *excelRepository) UpdateStorageBackend(ctx context.Context, id, from, to string) (bool, error) {
+	return updateStorageBackend(r.db.WithContext(ctx).Model(&entity.ExcelExport{}), id, from, to)
+}
+
+func (r *excelRepository) BackfillStorageBackend(ctx context.Context, backend string) (int64, error) {
+	return backfillStorageBackend(r.db.WithContext(ctx).Model(&entity.ExcelExport{}), backend)
+}
+
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type fileAttributeRepository struct {
+	db *gorm.DB
+}
+
+func NewFileAttributeRepository(db *gorm.DB) repository.FileAttributeRepository {
+	return &fileAttributeRepository{db: db}
+}
+
+func (r *fileAttributeRepository) Find(ctx context.Context, fileIDs []string) (map[string]repository.FileAttributes, error) {
+	attrs := make(map[string]repository.FileAttributes)
+	if len(fileIDs) == 0 {
+		return attrs, nil
+	}
+
+	var tags []entity.FileTag
+	if err := r.db.WithContext(ctx).Where("file_id IN ?", fileIDs).Order("tag").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		a := attrs[tag.FileID]
+		a.Tags = append(a.Tags, tag.Tag)
+		attrs[tag.FileID] = a
+	}
+
+	var metadata []entity.FileMetadata
+	if err := r.db.WithContext(ctx).Where("file_id IN ?", fileIDs).Find(&metadata).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range metadata {
+		a := attrs[m.FileID]
+		if a.Metadata == nil {
+			a.Metadata = make(map[string]string)
+		}
+		a.Metadata[m.Key] = m.Value
+		attrs[m.FileID] = a
+	}
+	return attrs, nil
+}
+
+func (r *fileAttributeRepository) Update(ctx context.Context, fileID string, tags []string, set map[string]string, unset []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if tags != nil {
+			if err := tx.Delete(&entity.FileTag{}, "file_id = ?", fileID).Error; err != nil {
+				return err
+			}
+			if len(tags) > 0 {
+				rows := make([]entity.FileTag, len(tags))
+				for i, tag := range tags {
+					rows[i] = entity.FileTag{FileID: fileID, Tag: tag}
+				}
+				if err := tx.Create(&rows).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if len(unset) > 0 {
+			if err := tx.Delete(&entity.FileMetadata{}, "file_id = ? AND key IN ?", fileID, unset).Error; err != nil {
+				return err
+			}
+		}
+		if len(set) > 0 {
+			rows := make([]entity.FileMetadata, 0, len(set))
+			for key, value := range set {
+				rows = append(rows, entity.FileMetadata{FileID: fileID, Key: key, Value: value})
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "file_id"}, {Name: "key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value"}),
+			}).Create(&rows).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *fileAttributeRepository) DeleteByFileID(ctx context.Context, fileID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&entity.FileTag{}, "file_id = ?", fileID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entity.FileMetadata{}, "file_id = ?", fileID).Error
+	})
+}
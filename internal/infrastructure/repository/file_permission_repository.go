@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type filePermissionRepository struct {
+	db *gorm.DB
+}
+
+func NewFilePermissionRepository(db *gorm.DB) repository.FilePermissionRepository {
+	return &filePermissionRepository{db: db}
+}
+
+func (r *filePermissionRepository) Upsert(ctx context.Context, perm *entity.FilePermission) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "granted_by", "updated_at"}),
+	}).Create(perm).Error
+}
+
+func (r *filePermissionRepository) Find(ctx context.Context, fileID, userID string) (*entity.FilePermission, error) {
+	var perm entity.FilePermission
+	if err := r.db.WithContext(ctx).First(&perm, "file_id = ? AND user_id = ?", fileID, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &perm, nil
+}
+
+func (r *filePermissionRepository) ListByFile(ctx context.Context, fileID string) ([]repository.FileGrant, error) {
+	var perms []entity.FilePermission
+	if err := r.db.WithContext(ctx).
+		Where("file_id = ?", fileID).
+		Order("created_at ASC").
+		Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	if len(perms) == 0 {
+		return nil, nil
+	}
+
+	userIDs := make([]string, len(perms))
+	for i, perm := range perms {
+		userIDs[i] = perm.UserID
+	}
+	var users []entity.User
+	if err := r.db.WithContext(ctx).Select("id", "email").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	emails := make(map[string]string, len(users))
+	for _, user := range users {
+		emails[user.ID] = user.Email
+	}
+
+	grants := make([]repository.FileGrant, len(perms))
+	for i, perm := range perms {
+		grants[i] = repository.FileGrant{FilePermission: perm, Email: emails[perm.UserID]}
+	}
+	return grants, nil
+}
+
+func (r *filePermissionRepository) ListByUser(ctx context.Context, userID string) ([]repository.SharedFile, error) {
+	var perms []entity.FilePermission
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	if len(perms) == 0 {
+		return nil, nil
+	}
+
+	fileIDs := make([]string, len(perms))
+	for i, perm := range perms {
+		fileIDs[i] = perm.FileID
+	}
+	var assets []entity.FileAsset
+	if err := r.db.WithContext(ctx).Where("id IN ?", fileIDs).Find(&assets).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]entity.FileAsset, len(assets))
+	for _, asset := range assets {
+		byID[asset.ID] = asset
+	}
+
+	shared := make([]repository.SharedFile, 0, len(perms))
+	for _, perm := range perms {
+		if asset, ok := byID[perm.FileID]; ok {
+			shared = append(shared, repository.SharedFile{File: asset, Role: perm.Role})
+		}
+	}
+	return shared, nil
+}
+
+func (r *filePermissionRepository) Delete(ctx context.Context, fileID, userID string) (bool, error) {
+	res := r.db.WithContext(ctx).Delete(&entity.FilePermission{}, "file_id = ? AND user_id = ?", fileID, userID)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *filePermissionRepository) DeleteByFileID(ctx context.Context, fileID string) error {
+	return r.db.WithContext(ctx).Delete(&entity.FilePermission{}, "file_id = ?", fileID).Error
+}
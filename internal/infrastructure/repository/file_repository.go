@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/filehash/internal/domain/entity"
 	"github.com/filehash/internal/domain/repository"
@@ -41,7 +42,187 @@ func (r *fileRepository) FindByUserID(ctx context.Context, userID string) ([]ent
 	return assets, nil
 }
 
+var fileSortColumns = map[string]string{
+	repository.FileSortDate: "created_at",
+	repository.FileSortName: "original_name",
+	repository.FileSortSize: "size_bytes",
+}
+
+func (r *fileRepository) List(ctx context.Context, filter repository.FileFilter, page repository.FilePage) ([]entity.FileAsset, error) {
+	column, ok := fileSortColumns[page.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", page.Sort)
+	}
+	dir, cmp := "ASC", ">"
+	if page.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	query := filterFiles(r.db.WithContext(ctx), filter)
+	if page.After != nil {
+		// Row values keep ties on the sort key in ID order, so no file is
+		// skipped or repeated between pages.
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, cmp), page.After.Value, page.After.ID)
+	}
+
+	var assets []entity.FileAsset
+	err := query.
+		Order(fmt.Sprintf("%s %s, id %s", column, dir, dir)).
+		Limit(page.Limit).
+		Find(&assets).Error
+	return assets, err
+}
+
+func (r *fileRepository) Count(ctx context.Context, filter repository.FileFilter) (int64, error) {
+	var count int64
+	err := filterFiles(r.db.WithContext(ctx).Model(&entity.FileAsset{}), filter).Count(&count).Error
+	return count, err
+}
+
+func filterFiles(query *gorm.DB, filter repository.FileFilter) *gorm.DB {
+	query = query.Where("user_id = ?", filter.UserID)
+	if filter.ByFolder {
+		query = inFolder(query, "folder_id", filter.FolderID)
+	}
+	for _, tag := range filter.Tags {
+		query = query.Where("EXISTS (SELECT 1 FROM file_tags WHERE file_tags.file_id = file_assets.id AND file_tags.tag = ?)", tag)
+	}
+	for key, value := range filter.Metadata {
+		query = query.Where("EXISTS (SELECT 1 FROM file_metadata WHERE file_metadata.file_id = file_assets.id AND file_metadata.key = ? AND file_metadata.value = ?)", key, value)
+	}
+	if filter.ContentType != "" {
+		query = query.Where("content_type = ?", filter.ContentType)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", filter.CreatedAfter.UTC())
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", filter.CreatedBefore.UTC())
+	}
+	if filter.MinSize != nil {
+		query = query.Where("size_bytes >= ?", *filter.MinSize)
+	}
+	if filter.MaxSize != nil {
+		query = query.Where("size_bytes <= ?", *filter.MaxSize)
+	}
+	if filter.NamePrefix != "" {
+		query = query.Where("original_name LIKE ? ESCAPE '\\'", escapeLike(filter.NamePrefix)+"%")
+	}
+	return query
+}
+
+func (r *fileRepository) FindByFolderIDs(ctx context.Context, folderIDs []string) ([]entity.FileAsset, error) {
+	if len(folderIDs) == 0 {
+		return nil, nil
+	}
+	var assets []entity.FileAsset
+	err := r.db.WithContext(ctx).Where("folder_id IN ?", folderIDs).Find(&assets).Error
+	return assets, err
+}
+
+func (r *fileRepository) CountInFolder(ctx context.Context, folderID string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entity.FileAsset{}).Where("folder_id = ?", folderID).Count(&count).Error
+	return count, err
+}
+
+func (r *fileRepository) UpdateFolder(ctx context.Context, id string, folderID *string) error {
+	return r.db.WithContext(ctx).Model(&entity.FileAsset{}).
+		Where("id = ?", id).
+		Update("folder_id", folderID).Error
+}
+
+func (r *fileRepository) UpdateWrappedKey(ctx context.Context, id string, wrappedKey []byte, keyID string) error {
+	return r.db.WithContext(ctx).Model(&entity.FileAsset{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"wrapped_key": wrappedKey, "key_id": keyID}).Error
+}
+
+func (r *fileRepository) ListByStaleKey(ctx context.Context, activeKeyID, afterID string, limit int) ([]entity.FileAsset, error) {
+	var assets []entity.FileAsset
+	err := r.db.WithContext(ctx).
+		Where("wrapped_key IS NOT NULL AND key_id <> ? AND id > ?", activeKeyID, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&assets).Error
+	if err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+func (r *fileRepository) CountByKeyID(ctx context.Context) (map[string]int64, error) {
+	return countByKeyID(r.db.WithContext(ctx).Model(&entity.FileAsset{}).Where("wrapped_key IS NOT NULL"))
+}
+
+func (r *fileRepository) CountWithoutKey(ctx context.Context) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&entity.FileAsset{}).Where("wrapped_key IS NULL").Count(&n).Error
+	return n, err
+}
+
+func (r *fileRepository) ListOutsideBackend(ctx context.Context, backend, afterID string, limit int) ([]entity.FileAsset, error) {
+	var assets []entity.FileAsset
+	err := r.db.WithContext(ctx).
+		Where("blob_id IS NULL AND storage_backend <> ? AND id > ?", backend, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&assets).Error
+	if err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+func (r *fileRepository) UpdateStorageBackend(ctx context.Context, id, from, to string) (bool, error) {
+	return updateStorageBackend(r.db.WithContext(ctx).Model(&entity.FileAsset{}), id, from, to)
+}
+
+func (r *fileRepository) BackfillStorageBackend(ctx context.Context, backend string) (int64, error) {
+	return backfillStorageBackend(r.db.WithContext(ctx).Model(&entity.FileAsset{}).Where("blob_id IS NULL"), backend)
+}
+
 func (r *fileRepository) Delete(ctx context.Context, id string) error {
 	return r.db.WithContext(ctx).Delete(&entity.FileAsset{}, "id = ?", id).Error
 }
 
+func (r *fileRepository) Stats(ctx context.Context) (*repository.FileStats, error) {
+	stats := &repository.FileStats{}
+	db := r.db.WithContext(ctx).Model(&entity.FileAsset{})
+	err := db.Session(&gorm.Session{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size_bytes), 0) AS bytes").
+		Scan(&stats.Total).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Session(&gorm.Session{}).Where("user_id IS NULL").Count(&stats.Anonymous).Error; err != nil {
+		return nil, err
+	}
+	stats.ByBackend, err = usageByBackend(db.Session(&gorm.Session{}).Where("blob_id IS NULL"))
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// usageByBackend sums size_bytes of the rows selected by query per
+// storage_backend.
+func usageByBackend(query *gorm.DB) (map[string]repository.StorageUsage, error) {
+	var rows []struct {
+		StorageBackend string
+		Count          int64
+		Bytes          int64
+	}
+	err := query.
+		Select("storage_backend, COUNT(*) AS count, COALESCE(SUM(size_bytes), 0) AS bytes").
+		Group("storage_backend").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	usage := make(map[string]repository.StorageUsage, len(rows))
+	for _, row := range rows {
+		usage[row.StorageBackend] = repository.StorageUsage{Count: row.Count, Bytes: row.Bytes}
+	}
+	return usage, nil
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/internal/infrastructure/database"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on&_busy_timeout=5000"), &gorm.Config{
+		NowFunc: func() time.Time { return time.Now().UTC() },
+		Logger:  logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := database.Migrate(db, zap.NewNop()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func createAsset(t *testing.T, db *gorm.DB, userID, name string, size int64, created time.Time) entity.FileAsset {
+	t.Helper()
+	asset := entity.FileAsset{
+		OriginalName: name,
+		StoredPath:   "encrypted/" + name,
+		UserID:       &userID,
+		ContentType:  "image/png",
+		SizeBytes:    size,
+		CreatedAt:    created,
+	}
+	if err := db.Create(&asset).Error; err != nil {
+		t.Fatalf("create asset: %v", err)
+	}
+	return asset
+}
+
+func cursorOf(asset entity.FileAsset, sort string) *repository.FileCursor {
+	switch sort {
+	case repository.FileSortName:
+		return &repository.FileCursor{Value: asset.OriginalName, ID: asset.ID}
+	case repository.FileSortSize:
+		return &repository.FileCursor{Value: asset.SizeBytes, ID: asset.ID}
+	default:
+		return &repository.FileCursor{Value: asset.CreatedAt, ID: asset.ID}
+	}
+}
+
+func TestFileListKeysetPages(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewFileRepository(db)
+
+	// Sort keys repeat, so ties are broken by ID across page boundaries.
+	// Timestamps mix whole seconds and fractions, which SQLite compares
+	// as text.
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var all []entity.FileAsset
+	for i := range 23 {
+		created := base.Add(time.Duration(i/3) * time.Second)
+		if i%2 == 1 {
+			created = created.Add(time.Duration(i) * 10 * time.Millisecond)
+		}
+		all = append(all, createAsset(t, db, "alice", fmt.Sprintf("file-%d.png", i%5), int64(i%4)*100, created))
+	}
+	createAsset(t, db, "bob", "file-0.png", 0, base)
+
+	less := map[string]func(a, b entity.FileAsset) int{
+		repository.FileSortDate: func(a, b entity.FileAsset) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		repository.FileSortName: func(a, b entity.FileAsset) int { return strings.Compare(a.OriginalName, b.OriginalName) },
+		repository.FileSortSize: func(a, b entity.FileAsset) int { return int(a.SizeBytes - b.SizeBytes) },
+	}
+
+	for sort, cmp := range less {
+		for _, desc := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s desc=%v", sort, desc), func(t *testing.T) {
+				want := slices.Clone(all)
+				slices.SortFunc(want, func(a, b entity.FileAsset) int {
+					c := cmp(a, b)
+					if c == 0 {
+						c = strings.Compare(a.ID, b.ID)
+					}
+					if desc {
+						c = -c
+					}
+					return c
+				})
+
+				var got []string
+				page := repository.FilePage{Sort: sort, Desc: desc, Limit: 4}
+				for {
+					assets, err := repo.List(ctx, repository.FileFilter{UserID: "alice"}, page)
+					if err != nil {
+						t.Fatalf("List: %v", err)
+					}
+					for _, a := range assets {
+						got = append(got, a.ID)
+					}
+					if len(assets) < page.Limit {
+						break
+					}
+					page.After = cursorOf(assets[len(assets)-1], sort)
+				}
+
+				wantIDs := make([]string, len(want))
+				for i, a := range want {
+					wantIDs[i] = a.ID
+				}
+				if !slices.Equal(got, wantIDs) {
+					t.Fatalf("pages returned %d files in another order than %d expected:\n got %v\nwant %v", len(got), len(wantIDs), got, wantIDs)
+				}
+			})
+		}
+	}
+}
+
+func TestFileListCursorStableUnderInserts(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewFileRepository(db)
+
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 6 {
+		createAsset(t, db, "alice", fmt.Sprintf("f%d.png", i), 1, base.Add(time.Duration(i)*time.Minute))
+	}
+	page := repository.FilePage{Sort: repository.FileSortDate, Desc: true, Limit: 3}
+	first, err := repo.List(ctx, repository.FileFilter{UserID: "alice"}, page)
+	if err != nil || len(first) != 3 {
+		t.Fatalf("first page = %d files, %v", len(first), err)
+	}
+
+	// New uploads land on the first page of a newest-first listing; the
+	// next page must neither repeat nor skip a file because of them.
+	for i := range 3 {
+		createAsset(t, db, "alice", fmt.Sprintf("new%d.png", i), 1, base.Add(time.Hour+time.Duration(i)*time.Minute))
+	}
+	page.After = cursorOf(first[2], repository.FileSortDate)
+	second, err := repo.List(ctx, repository.FileFilter{UserID: "alice"}, page)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var names []string
+	for _, a := range second {
+		names = append(names, a.OriginalName)
+	}
+	if want := []string{"f2.png", "f1.png", "f0.png"}; !slices.Equal(names, want) {
+		t.Fatalf("second page = %v, want %v", names, want)
+	}
+
+	if n, err := repo.Count(ctx, repository.FileFilter{UserID: "alice"}); err != nil || n != 9 {
+		t.Fatalf("Count = %d, %v", n, err)
+	}
+}
+
+func TestFileListFilters(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewFileRepository(db)
+
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	createAsset(t, db, "alice", "report_1.png", 10, base)
+	createAsset(t, db, "alice", "report%2.png", 20, base.Add(time.Hour))
+	createAsset(t, db, "alice", "reportX3.png", 30, base.Add(2*time.Hour))
+
+	after, minSize := base.Add(time.Hour), int64(15)
+	for _, tt := range []struct {
+		name   string
+		filter repository.FileFilter
+		want   []string
+	}{
+		// LIKE wildcards in the prefix match themselves only.
+		{"prefix with underscore", repository.FileFilter{NamePrefix: "report_"}, []string{"report_1.png"}},
+		{"prefix with percent", repository.FileFilter{NamePrefix: "report%"}, []string{"report%2.png"}},
+		{"created after", repository.FileFilter{CreatedAfter: &after}, []string{"report%2.png", "reportX3.png"}},
+		{"min size", repository.FileFilter{MinSize: &minSize}, []string{"report%2.png", "reportX3.png"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.UserID = "alice"
+			assets, err := repo.List(ctx, tt.filter, repository.FilePage{Sort: repository.FileSortName, Limit: 10})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var names []string
+			for _, a := range assets {
+				names = append(names, a.OriginalName)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Fatalf("List = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"gorm.io/gorm"
+)
+
+type folderRepository struct {
+	db *gorm.DB
+}
+
+func NewFolderRepository(db *gorm.DB) repository.FolderRepository {
+	return &folderRepository{db: db}
+}
+
+func (r *folderRepository) Create(ctx context.Context, folder *entity.Folder) error {
+	return r.db.WithContext(ctx).Create(folder).Error
+}
+
+func (r *folderRepository) FindByID(ctx context.Context, id string) (*entity.Folder, error) {
+	var folder entity.Folder
+	if err := r.db.WithContext(ctx).First(&folder, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &folder, nil
+}
+
+func (r *folderRepository) ListChildren(ctx context.Context, userID string, parentID *string) ([]entity.Folder, error) {
+	var folders []entity.Folder
+	err := inFolder(r.db.WithContext(ctx).Where("user_id = ?", userID), "parent_id", parentID).
+		Order("name, id").
+		Find(&folders).Error
+	return folders, err
+}
+
+func (r *folderRepository) ListChildrenOf(ctx context.Context, parentIDs []string) ([]entity.Folder, error) {
+	if len(parentIDs) == 0 {
+		return nil, nil
+	}
+	var folders []entity.Folder
+	err := r.db.WithContext(ctx).Where("parent_id IN ?", parentIDs).Find(&folders).Error
+	return folders, err
+}
+
+func (r *folderRepository) NameTaken(ctx context.Context, userID string, parentID *string, name, excludeID string) (bool, error) {
+	var count int64
+	query := r.db.WithContext(ctx).Model(&entity.Folder{}).
+		Where("user_id = ? AND name = ? AND id <> ?", userID, name, excludeID)
+	err := inFolder(query, "parent_id", parentID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *folderRepository) Update(ctx context.Context, folder *entity.Folder) error {
+	return r.db.WithContext(ctx).Model(folder).
+		Select("name", "parent_id", "updated_at").
+		Updates(folder).Error
+}
+
+func (r *folderRepository) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Delete(&entity.Folder{}, "id IN ?", ids).Error
+}
+
+// inFolder restricts query to rows whose column refers to folderID, or is
+// NULL when folderID is nil.
+func inFolder(query *gorm.DB, column string, folderID *string) *gorm.DB {
+	if folderID == nil {
+		return query.Where(column + " IS NULL")
+	}
+	return query.Where(column+" = ?", *folderID)
+}
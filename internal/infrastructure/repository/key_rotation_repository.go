@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"gorm.io/gorm"
+)
+
+type keyRotationRepository struct {
+	db *gorm.DB
+}
+
+func NewKeyRotationRepository(db *gorm.DB) repository.KeyRotationRepository {
+	return &keyRotationRepository{db: db}
+}
+
+func (r *keyRotationRepository) Create(ctx context.Context, rotation *entity.KeyRotation) error {
+	return r.db.WithContext(ctx).Create(rotation).Error
+}
+
+func (r *keyRotationRepository) Update(ctx context.Context, rotation *entity.KeyRotation) error {
+	return r.db.WithContext(ctx).Save(rotation).Error
+}
+
+func (r *keyRotationRepository) FindLatest(ctx context.Context) (*entity.KeyRotation, error) {
+	var rotation entity.KeyRotation
+	if err := r.db.WithContext(ctx).Order("started_at DESC").First(&rotation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &rotation, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type loginThrottleRepository struct {
+	db *gorm.DB
+}
+
+func NewLoginThrottleRepository(db *gorm.DB) repository.LoginThrottleRepository {
+	return &loginThrottleRepository{db: db}
+}
+
+func (r *loginThrottleRepository) Find(ctx context.Context, email string) (*entity.LoginThrottle, error) {
+	var throttle entity.LoginThrottle
+	if err := r.db.WithContext(ctx).First(&throttle, "email = ?", email).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// RecordFailure increments in a single upsert so that concurrent failures
+// are all counted.
+func (r *loginThrottleRepository) RecordFailure(ctx context.Context, email string, now, resetBefore time.Time) (int, error) {
+	var failures int
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "email"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"failures":        gorm.Expr("CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END", resetBefore),
+				"last_failure_at": now,
+			}),
+		}).Create(&entity.LoginThrottle{Email: email, Failures: 1, LastFailureAt: now}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&entity.LoginThrottle{}).
+			Where("email = ?", email).
+			Pluck("failures", &failures).Error
+	})
+	return failures, err
+}
+
+func (r *loginThrottleRepository) Lock(ctx context.Context, email string, until time.Time) error {
+	return r.db.WithContext(ctx).Model(&entity.LoginThrottle{}).
+		Where("email = ?", email).
+		Update("locked_until", until).Error
+}
+
+func (r *loginThrottleRepository) Clear(ctx context.Context, email string) (bool, error) {
+	res := r.db.WithContext(ctx).Where("email = ?", email).Delete(&entity.LoginThrottle{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *loginThrottleRepository) DeleteStale(ctx context.Context, before, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, now).
+		Delete(&entity.LoginThrottle{})
+	return res.RowsAffected, res.Error
+}
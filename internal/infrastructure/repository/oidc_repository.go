@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"gorm.io/gorm"
+)
+
+type oidcRepository struct {
+	db *gorm.DB
+}
+
+func NewOIDCRepository(db *gorm.DB) repository.OIDCRepository {
+	return &oidcRepository{db: db}
+}
+
+func (r *oidcRepository) CreateState(ctx context.Context, state *entity.OIDCState) error {
+	return r.db.WithContext(ctx).Create(state).Error
+}
+
+// ConsumeState reads the state and deletes it; only the caller whose delete
+// removed the row gets it, so concurrent callbacks cannot both redeem it.
+func (r *oidcRepository) ConsumeState(ctx context.Context, id string) (*entity.OIDCState, error) {
+	var state entity.OIDCState
+	if err := r.db.WithContext(ctx).First(&state, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	res := r.db.WithContext(ctx).Where("id = ?", id).Delete(&entity.OIDCState{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, utils.ErrRecordNotFound
+	}
+	return &state, nil
+}
+
+func (r *oidcRepository) DeleteExpiredStates(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&entity.OIDCState{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *oidcRepository) FindIdentity(ctx context.Context, issuer, subject string) (*entity.UserIdentity, error) {
+	var identity entity.UserIdentity
+	if err := r.db.WithContext(ctx).First(&identity, "issuer = ? AND subject = ?", issuer, subject).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *oidcRepository) CreateIdentity(ctx context.Context, identity *entity.UserIdentity) error {
+	return r.db.WithContext(ctx).Create(identity).Error
+}
+
+func (r *oidcRepository) CreateUserWithIdentity(ctx context.Context, user *entity.User, identity *entity.UserIdentity) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
+
+func (r *oidcRepository) TouchIdentity(ctx context.Context, id, email string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&entity.UserIdentity{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"email": email, "last_login_at": at}).Error
+}
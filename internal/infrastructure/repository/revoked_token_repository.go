@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type revokedTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewRevokedTokenRepository(db *gorm.DB) repository.RevokedTokenRepository {
+	return &revokedTokenRepository{db: db}
+}
+
+// Revoke inserts the entry unless it exists. Only the call whose insert
+// added the row gets true, so concurrent callers cannot both consume a
+// single-use token.
+func (r *revokedTokenRepository) Revoke(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entity.RevokedToken{JTI: jti, ExpiresAt: expiresAt})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *revokedTokenRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entity.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *revokedTokenRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&entity.RevokedToken{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRevokeReportsFirstInsert(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRevokedTokenRepository(newTestDB(t))
+	expires := time.Now().Add(time.Hour)
+
+	added, err := repo.Revoke(ctx, "jti-1", expires)
+	if err != nil || !added {
+		t.Fatalf("first Revoke = %v, %v; want true", added, err)
+	}
+	added, err = repo.Revoke(ctx, "jti-1", expires)
+	if err != nil || added {
+		t.Fatalf("second Revoke = %v, %v; want false", added, err)
+	}
+	if revoked, err := repo.IsRevoked(ctx, "jti-1"); err != nil || !revoked {
+		t.Fatalf("IsRevoked = %v, %v", revoked, err)
+	}
+
+	// Of concurrent callers exactly one is told it added the entry.
+	results := make(chan bool, 8)
+	for range cap(results) {
+		go func() {
+			added, err := repo.Revoke(ctx, "jti-2", expires)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- added
+		}()
+	}
+	n := 0
+	for range cap(results) {
+		if <-results {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Fatalf("%d concurrent Revoke calls reported the insert, want 1", n)
+	}
+}
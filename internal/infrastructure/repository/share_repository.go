@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"gorm.io/gorm"
+)
+
+type shareRepository struct {
+	db *gorm.DB
+}
+
+func NewShareRepository(db *gorm.DB) repository.ShareRepository {
+	return &shareRepository{db: db}
+}
+
+func (r *shareRepository) Create(ctx context.Context, share *entity.Share) error {
+	return r.db.WithContext(ctx).Create(share).Error
+}
+
+func (r *shareRepository) FindBySlug(ctx context.Context, slug string) (*entity.Share, error) {
+	var share entity.Share
+	if err := r.db.WithContext(ctx).First(&share, "slug = ?", slug).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &share, nil
+}
+
+func (r *shareRepository) ListByUser(ctx context.Context, userID, fileID string) ([]entity.Share, error) {
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID)
+	if fileID != "" {
+		query = query.Where("file_id = ?", fileID)
+	}
+	var shares []entity.Share
+	err := query.Order("created_at DESC").Find(&shares).Error
+	return shares, err
+}
+
+func (r *shareRepository) Revoke(ctx context.Context, id, userID string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&entity.Share{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now().UTC())
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *shareRepository) CountDownload(ctx context.Context, id string, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&entity.Share{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, now).
+		Where("max_downloads IS NULL OR downloads < max_downloads").
+		Updates(map[string]any{
+			"downloads":        gorm.Expr("downloads + 1"),
+			"last_download_at": now,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *shareRepository) DeleteByFileID(ctx context.Context, fileID string) error {
+	return r.db.WithContext(ctx).Delete(&entity.Share{}, "file_id = ?", fileID).Error
+}
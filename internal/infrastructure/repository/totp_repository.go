@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type totpRepository struct {
+	db *gorm.DB
+}
+
+func NewTOTPRepository(db *gorm.DB) repository.TOTPRepository {
+	return &totpRepository{db: db}
+}
+
+func (r *totpRepository) Save(ctx context.Context, cred *entity.TOTPCredential) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(cred).Error
+}
+
+func (r *totpRepository) FindByUserID(ctx context.Context, userID string) (*entity.TOTPCredential, error) {
+	var cred entity.TOTPCredential
+	if err := r.db.WithContext(ctx).First(&cred, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &cred, nil
+}
+
+func (r *totpRepository) Enable(ctx context.Context, userID string, step int64, codeHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.TOTPCredential{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]any{"enabled_at": time.Now().UTC(), "last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func (r *totpRepository) AdvanceStep(ctx context.Context, userID string, step int64) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&entity.TOTPCredential{}).
+		Where("user_id = ? AND last_step < ?", userID, step).
+		Update("last_step", step)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *totpRepository) Delete(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&entity.TOTPCredential{}).Error
+	})
+}
+
+func (r *totpRepository) ListUnusedRecoveryCodes(ctx context.Context, userID string) ([]entity.RecoveryCode, error) {
+	var codes []entity.RecoveryCode
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Find(&codes).Error
+	return codes, err
+}
+
+func (r *totpRepository) UseRecoveryCode(ctx context.Context, id string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&entity.RecoveryCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now().UTC())
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *totpRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID string, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]entity.RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = entity.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+func (r *totpRepository) ListByStaleKey(ctx context.Context, activeKeyID, afterUserID string, limit int) ([]entity.TOTPCredential, error) {
+	var creds []entity.TOTPCredential
+	err := r.db.WithContext(ctx).
+		Where("key_id <> ? AND user_id > ?", activeKeyID, afterUserID).
+		Order("user_id").
+		Limit(limit).
+		Find(&creds).Error
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func (r *totpRepository) UpdateWrappedSecret(ctx context.Context, userID string, wrapped []byte, keyID string) error {
+	return r.db.WithContext(ctx).Model(&entity.TOTPCredential{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]any{"wrapped_secret": wrapped, "key_id": keyID}).Error
+}
+
+func (r *totpRepository) CountByKeyID(ctx context.Context) (map[string]int64, error) {
+	return countByKeyID(r.db.WithContext(ctx).Model(&entity.TOTPCredential{}))
+}
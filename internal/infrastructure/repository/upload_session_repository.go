@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"gorm.io/gorm"
+)
+
+type uploadSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadSessionRepository(db *gorm.DB) repository.UploadSessionRepository {
+	return &uploadSessionRepository{db: db}
+}
+
+func (r *uploadSessionRepository) Create(ctx context.Context, session *entity.UploadSession) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *uploadSessionRepository) FindByID(ctx context.Context, id string) (*entity.UploadSession, error) {
+	var session entity.UploadSession
+	if err := r.db.WithContext(ctx).First(&session, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *uploadSessionRepository) Advance(ctx context.Context, id string, from, to int64, partOffset *int64, expiresAt time.Time) (bool, error) {
+	updates := map[string]any{"upload_offset": to, "expires_at": expiresAt}
+	if partOffset != nil {
+		part := strconv.FormatInt(*partOffset, 10)
+		updates["parts"] = gorm.Expr("CASE WHEN parts IS NULL OR parts = '' THEN ? ELSE parts || ',' || ? END", part, part)
+	}
+	res := r.db.WithContext(ctx).Model(&entity.UploadSession{}).
+		Where("id = ? AND upload_offset = ? AND file_id IS NULL", id, from).
+		Updates(updates)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *uploadSessionRepository) CountByKeyID(ctx context.Context) (map[string]int64, error) {
+	return countByKeyID(r.db.WithContext(ctx).Model(&entity.UploadSession{}).Where("file_id IS NULL"))
+}
+
+func (r *uploadSessionRepository) MarkCompleted(ctx context.Context, id, fileID string) error {
+	res := r.db.WithContext(ctx).Model(&entity.UploadSession{}).
+		Where("id = ? AND file_id IS NULL", id).
+		Updates(map[string]any{"file_id": fileID, "parts": ""})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return utils.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *uploadSessionRepository) Delete(ctx context.Context, id string) error {
+	res := r.db.WithContext(ctx).Delete(&entity.UploadSession{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return utils.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *uploadSessionRepository) ListExpired(ctx context.Context, now time.Time, afterID string, limit int) ([]*entity.UploadSession, error) {
+	var sessions []*entity.UploadSession
+	err := r.db.WithContext(ctx).
+		Where("expires_at < ? AND id > ?", now, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *uploadSessionRepository) ListByUserID(ctx context.Context, userID string) ([]*entity.UploadSession, error) {
+	var sessions []*entity.UploadSession
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Find(&sessions).Error
+	return sessions, err
+}
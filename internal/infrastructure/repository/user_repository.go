@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/filehash/internal/domain/entity"
 	"github.com/filehash/internal/domain/repository"
@@ -44,3 +46,114 @@ func (r *userRepository) FindByID(ctx context.Context, id string) (*entity.User,
 	return &user, nil
 }
 
+func (r *userRepository) UpdatePassword(ctx context.Context, id, hashedPassword string) error {
+	return r.db.WithContext(ctx).Model(&entity.User{}).
+		Where("id = ?", id).
+		Update("password", hashedPassword).Error
+}
+
+func (r *userRepository) ReplacePasswordHash(ctx context.Context, id, oldHash, newHash string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&entity.User{}).
+		Where("id = ? AND password = ?", id, oldHash).
+		Update("password", newHash)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// MarkEmailVerified keeps the first verification time.
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&entity.User{}).
+		Where("id = ? AND email_verified_at IS NULL", id).
+		Update("email_verified_at", at).Error
+}
+
+func (r *userRepository) List(ctx context.Context, emailPrefix string, offset, limit int) ([]entity.User, int64, error) {
+	query := r.db.WithContext(ctx).Model(&entity.User{})
+	if emailPrefix != "" {
+		query = query.Where("email LIKE ? ESCAPE '\\'", escapeLike(emailPrefix)+"%")
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []entity.User
+	err := query.Order("created_at, id").Offset(offset).Limit(limit).Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *userRepository) UpdateRole(ctx context.Context, id, role string) error {
+	return r.db.WithContext(ctx).Model(&entity.User{}).
+		Where("id = ?", id).
+		Update("role", role).Error
+}
+
+func (r *userRepository) SetDisabled(ctx context.Context, id string, at *time.Time) error {
+	return r.db.WithContext(ctx).Model(&entity.User{}).
+		Where("id = ?", id).
+		Update("disabled_at", at).Error
+}
+
+func (r *userRepository) CountEnabled(ctx context.Context, role string) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&entity.User{}).
+		Where("role = ? AND disabled_at IS NULL", role).
+		Count(&n).Error
+	return n, err
+}
+
+func (r *userRepository) Stats(ctx context.Context) (*repository.UserStats, error) {
+	stats := &repository.UserStats{ByRole: make(map[string]int64)}
+	db := r.db.WithContext(ctx).Model(&entity.User{})
+	if err := db.Session(&gorm.Session{}).Count(&stats.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Session(&gorm.Session{}).Where("email_verified_at IS NOT NULL").Count(&stats.Verified).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Session(&gorm.Session{}).Where("disabled_at IS NOT NULL").Count(&stats.Disabled).Error; err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Role  string
+		Count int64
+	}
+	if err := db.Session(&gorm.Session{}).Select("role, COUNT(*) AS count").Group("role").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		stats.ByRole[row.Role] = row.Count
+	}
+	return stats, nil
+}
+
+func (r *userRepository) Delete(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{
+			&entity.Session{},
+			&entity.APIKey{},
+			&entity.RecoveryCode{},
+			&entity.TOTPCredential{},
+			&entity.UserIdentity{},
+			&entity.Share{},
+			&entity.FilePermission{},
+			&entity.Folder{},
+		} {
+			if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		// Unscoped: a soft-deleted row would keep the email taken.
+		return tx.Unscoped().Delete(&entity.User{}, "id = ?", id).Error
+	})
+}
+
+// escapeLike escapes the LIKE wildcards in s; "_" is common in emails
+// and file names.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
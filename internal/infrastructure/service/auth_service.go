@@ -1,87 +1,236 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/filehash/internal/domain/service"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
+)
+
+// Audiences keep user tokens and file tokens from being accepted in place of
+// each other, even where both keyrings are trusted.
+const (
+	userTokenAudience = "filehash:user"
+	fileTokenAudience = "filehash:file"
+	mfaTokenAudience  = "filehash:mfa"
+	// Action tokens use "filehash:" followed by their purpose.
+	actionTokenAudiencePrefix = "filehash:"
+)
+
+// Authentication methods (RFC 8176) recorded in the amr claim.
+const (
+	amrPassword = "pwd"
+	amrOTP      = "otp"
 )
 
 type authService struct {
-	secret []byte
+	keys   *SigningKeyring
 	ttl    time.Duration
+	hasher service.PasswordHasher
 }
 
-func NewAuthService(secret string, ttl time.Duration) (service.AuthService, error) {
-	if secret == "" {
-		return nil, errors.New("jwt secret required")
+func NewAuthService(keys *SigningKeyring, ttl time.Duration, hasher service.PasswordHasher) (service.AuthService, error) {
+	if keys == nil {
+		return nil, errors.New("signing keyring required")
 	}
 	if ttl <= 0 {
 		return nil, errors.New("ttl must be positive")
 	}
+	if hasher == nil {
+		return nil, errors.New("password hasher required")
+	}
 	return &authService{
-		secret: []byte(secret),
+		keys:   keys,
 		ttl:    ttl,
+		hasher: hasher,
 	}, nil
 }
 
 var _ service.AuthService = (*authService)(nil)
 
 func (a *authService) HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := a.hasher.Hash(password)
 	if err != nil {
 		return "", fmt.Errorf("hash password: %w", err)
 	}
-	return string(hash), nil
+	return hash, nil
 }
 
 func (a *authService) ComparePassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	return a.hasher.Verify(hashedPassword, password)
+}
+
+func (a *authService) PasswordNeedsRehash(hashedPassword string) bool {
+	return a.hasher.NeedsRehash(hashedPassword)
 }
 
 type authClaims struct {
-	UserID string `json:"user_id"`
+	UserID    string   `json:"user_id"`
+	SessionID string   `json:"sid"`
+	AMR       []string `json:"amr,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func (a *authService) GenerateAuthToken(userID string) (string, error) {
+func (a *authService) GenerateAuthToken(userID, sessionID string, mfa bool) (string, error) {
 	if userID == "" {
 		return "", errors.New("userID is required")
 	}
+	if sessionID == "" {
+		return "", errors.New("sessionID is required")
+	}
 
 	now := time.Now().UTC()
+	amr := []string{amrPassword}
+	if mfa {
+		amr = append(amr, amrOTP)
+	}
 	claims := authClaims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
+		AMR:       amr,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Audience:  jwt.ClaimStrings{userTokenAudience},
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(a.ttl)),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString(a.secret)
+	return a.keys.sign(claims)
+}
+
+func (a *authService) ValidateAuthToken(tokenStr string) (*service.AuthTokenClaims, error) {
+	token, err := a.keys.parse(tokenStr, &authClaims{}, userTokenAudience)
 	if err != nil {
-		return "", fmt.Errorf("sign token: %w", err)
+		return nil, fmt.Errorf("parse token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*authClaims)
+	if !ok || !token.Valid || claims.SessionID == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("invalid token claims")
 	}
-	return signed, nil
+	return &service.AuthTokenClaims{
+		UserID:    claims.UserID,
+		SessionID: claims.SessionID,
+		TokenID:   claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+		MFA:       slices.Contains(claims.AMR, amrOTP),
+	}, nil
+}
+
+// mfaClaims carry no session: the challenge only proves the password.
+type mfaClaims struct {
+	UserID string `json:"user_id"`
+	jwt.RegisteredClaims
 }
 
-func (a *authService) ValidateAuthToken(tokenStr string) (string, error) {
-	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
-	token, err := parser.ParseWithClaims(tokenStr, &authClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return a.secret, nil
-	})
+func (a *authService) GenerateMFAToken(userID string, ttl time.Duration) (string, error) {
+	if userID == "" {
+		return "", errors.New("userID is required")
+	}
+
+	now := time.Now().UTC()
+	claims := mfaClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Audience:  jwt.ClaimStrings{mfaTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return a.keys.sign(claims)
+}
+
+func (a *authService) ValidateMFAToken(tokenStr string) (*service.MFATokenClaims, error) {
+	token, err := a.keys.parse(tokenStr, &mfaClaims{}, mfaTokenAudience)
 	if err != nil {
-		return "", fmt.Errorf("parse token: %w", err)
+		return nil, fmt.Errorf("parse token: %w", err)
 	}
 
-	claims, ok := token.Claims.(*authClaims)
-	if !ok || !token.Valid {
-		return "", errors.New("invalid token claims")
+	claims, ok := token.Claims.(*mfaClaims)
+	if !ok || !token.Valid || claims.UserID == "" || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("invalid token claims")
 	}
-	return claims.UserID, nil
+	return &service.MFATokenClaims{
+		UserID:    claims.UserID,
+		TokenID:   claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+// actionClaims carry no session either; the audience names the purpose.
+type actionClaims struct {
+	UserID  string `json:"user_id"`
+	Binding string `json:"bnd,omitempty"`
+	jwt.RegisteredClaims
 }
 
+func (a *authService) GenerateActionToken(purpose, userID, binding string, ttl time.Duration) (string, error) {
+	if purpose == "" {
+		return "", errors.New("purpose is required")
+	}
+	if userID == "" {
+		return "", errors.New("userID is required")
+	}
+
+	now := time.Now().UTC()
+	claims := actionClaims{
+		UserID:  userID,
+		Binding: binding,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Audience:  jwt.ClaimStrings{actionTokenAudiencePrefix + purpose},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return a.keys.sign(claims)
+}
+
+func (a *authService) ValidateActionToken(purpose, tokenStr string) (*service.ActionTokenClaims, error) {
+	token, err := a.keys.parse(tokenStr, &actionClaims{}, actionTokenAudiencePrefix+purpose)
+	if err != nil {
+		return nil, fmt.Errorf("parse token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*actionClaims)
+	if !ok || !token.Valid || claims.UserID == "" || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("invalid token claims")
+	}
+	return &service.ActionTokenClaims{
+		UserID:    claims.UserID,
+		Binding:   claims.Binding,
+		TokenID:   claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+func (a *authService) NewRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, a.HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hex SHA-256 of token. Refresh tokens carry
+// 256 bits of entropy, so a fast unsalted hash is enough to keep the
+// stored values useless to a database reader.
+func (a *authService) HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *authService) PublicKeys() []service.JWK {
+	return a.keys.PublicKeys()
+}
@@ -70,3 +70,22 @@ func (c *cryptoService) DecryptAESGCM(key, nonce, ciphertext []byte) ([]byte, er
 	return plaintext, nil
 }
 
+func (c *cryptoService) NewEncryptWriter(key []byte, dst io.Writer) (io.WriteCloser, error) {
+	return crypto.NewWriter(dst, key, crypto.StreamChunkSize)
+}
+
+// NewDecryptReader accepts both chunked containers and legacy single-message
+// blobs.
+func (c *cryptoService) NewDecryptReader(key []byte, src io.Reader) (io.Reader, error) {
+	plain, _, err := crypto.NewReader(src, key)
+	if err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
+
+// NewDecryptSeeker decrypts only the chunks covering the ranges read from
+// it, which keeps partial downloads of large files cheap.
+func (c *cryptoService) NewDecryptSeeker(key []byte, src io.ReadSeeker) (io.ReadSeeker, int64, error) {
+	return crypto.NewSeekReader(src, key)
+}
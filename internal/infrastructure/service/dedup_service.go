@@ -0,0 +1,35 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"hash"
+
+	"github.com/filehash/internal/domain/service"
+)
+
+type dedupService struct {
+	macKey []byte
+}
+
+func NewDedupService(secret string) (service.DedupService, error) {
+	if secret == "" {
+		return nil, errors.New("dedup secret required")
+	}
+	return &dedupService{
+		macKey: deriveKey(secret, "filehash-dedup-mac"),
+	}, nil
+}
+
+var _ service.DedupService = (*dedupService)(nil)
+
+func (d *dedupService) NewMAC() hash.Hash {
+	return hmac.New(sha256.New, d.macKey)
+}
+
+func deriveKey(secret, label string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filehash/internal/domain/service"
+	"github.com/filehash/pkg/crypto"
+)
+
+// keyringFile is the on-disk layout of a local KEK keyfile.
+type keyringFile struct {
+	Active string       `json:"active"`
+	Keys   []keyringKey `json:"keys"`
+}
+
+type keyringKey struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type keyService struct {
+	mu     sync.RWMutex
+	active string
+	keks   map[string]cipher.AEAD
+	// keyFile is set for keyring-backed services so KEKs added by a
+	// rotation in another process can be picked up without a restart.
+	keyFile string
+	// loaded describes keyFile as it was when last read.
+	loaded os.FileInfo
+}
+
+// NewKeyService builds a key service from base64-encoded KEKs given in
+// config, keyed by ID, with activeID used for new wraps. Without configured
+// KEKs the keyring at keyFile is used instead; a missing keyfile is created
+// with a freshly generated KEK named activeID.
+func NewKeyService(activeID string, keks map[string]string, keyFile string) (service.KeyService, error) {
+	if len(keks) > 0 {
+		keys := make(map[string][]byte, len(keks))
+		for id, encoded := range keks {
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("decode kek %q: %w", id, err)
+			}
+			keys[id] = key
+		}
+		return newKeyService(activeID, keys)
+	}
+
+	if keyFile == "" {
+		return nil, errors.New("kek or keyfile required")
+	}
+	if _, err := os.Stat(keyFile); errors.Is(err, os.ErrNotExist) {
+		if _, err := createKeyring(keyFile, activeID); err != nil {
+			return nil, err
+		}
+	}
+	ks := &keyService{keyFile: keyFile}
+	if err := ks.reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func keyServiceFromRing(ring *keyringFile) (*keyService, error) {
+	keys := make(map[string][]byte, len(ring.Keys))
+	for _, k := range ring.Keys {
+		key, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("decode kek %q: %w", k.ID, err)
+		}
+		keys[k.ID] = key
+	}
+	return newKeyService(ring.Active, keys)
+}
+
+func newKeyService(active string, keys map[string][]byte) (*keyService, error) {
+	ks := &keyService{active: active, keks: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if len(key) != crypto.AESKeySize {
+			return nil, fmt.Errorf("kek %q must be %d bytes", id, crypto.AESKeySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("kek %q: %w", id, err)
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("kek %q: %w", id, err)
+		}
+		ks.keks[id] = gcm
+	}
+	if _, ok := ks.keks[active]; !ok {
+		return nil, fmt.Errorf("active kek %q not found", active)
+	}
+	return ks, nil
+}
+
+var _ service.KeyService = (*keyService)(nil)
+
+func (k *keyService) ActiveKeyID() string {
+	// On failure the loaded keys stay in use; WrapKey reports the error.
+	_ = k.refresh()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+func (k *keyService) KeyIDs() []string {
+	_ = k.refresh()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ids := make([]string, 0, len(k.keks))
+	for id := range k.keks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// WrapKey seals dataKey under the active KEK. The KEK ID is bound as
+// associated data so a wrapped key cannot be replayed under another KEK.
+// A keyring-backed service first checks its keyfile, so wraps switch to a
+// KEK made active by "keys rotate" in another process.
+func (k *keyService) WrapKey(dataKey []byte) ([]byte, string, error) {
+	if len(dataKey) != crypto.AESKeySize {
+		return nil, "", errors.New("data key must be 32 bytes")
+	}
+	if err := k.refresh(); err != nil {
+		return nil, "", err
+	}
+	k.mu.RLock()
+	active, gcm := k.active, k.keks[k.active]
+	k.mu.RUnlock()
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, "", fmt.Errorf("nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, dataKey, []byte(active)), active, nil
+}
+
+func (k *keyService) UnwrapKey(wrapped []byte, kekID string) ([]byte, error) {
+	gcm, err := k.kek(kekID)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	nonce, ciphertext := wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():]
+	key, err := gcm.Open(nil, nonce, ciphertext, []byte(kekID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap key: %w", err)
+	}
+	return key, nil
+}
+
+// kek returns the AEAD for kekID. An unknown ID makes a keyring-backed
+// service check its keyfile, adopting any KEK rotated in since start.
+func (k *keyService) kek(kekID string) (cipher.AEAD, error) {
+	k.mu.RLock()
+	gcm, ok := k.keks[kekID]
+	k.mu.RUnlock()
+	if ok {
+		return gcm, nil
+	}
+	if k.keyFile != "" {
+		if err := k.refresh(); err != nil {
+			return nil, err
+		}
+		k.mu.RLock()
+		gcm, ok = k.keks[kekID]
+		k.mu.RUnlock()
+		if ok {
+			return gcm, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown kek %q", kekID)
+}
+
+// refresh reloads the keyfile when it differs from the one last read. The
+// check is a stat, cheap next to the upload a wrap belongs to; the keyfile
+// is replaced by rename, so a new file is noticed even where modification
+// times are coarse.
+func (k *keyService) refresh() error {
+	if k.keyFile == "" {
+		return nil
+	}
+	info, err := os.Stat(k.keyFile)
+	if err != nil {
+		return fmt.Errorf("reload keyfile: %w", err)
+	}
+	k.mu.RLock()
+	loaded := k.loaded
+	k.mu.RUnlock()
+	if os.SameFile(info, loaded) && info.ModTime().Equal(loaded.ModTime()) && info.Size() == loaded.Size() {
+		return nil
+	}
+	if err := k.reload(); err != nil {
+		return fmt.Errorf("reload keyfile: %w", err)
+	}
+	return nil
+}
+
+// reload reads the keyfile. It is stat'ed first, so a write that lands
+// while reading is seen by the next refresh.
+func (k *keyService) reload() error {
+	info, err := os.Stat(k.keyFile)
+	if err != nil {
+		return err
+	}
+	ring, err := loadKeyring(k.keyFile)
+	if err != nil {
+		return err
+	}
+	fresh, err := keyServiceFromRing(ring)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	k.active, k.keks, k.loaded = fresh.active, fresh.keks, info
+	k.mu.Unlock()
+	return nil
+}
+
+// AddKeyringKey generates a new KEK with the given ID in the keyfile at path
+// and marks it active. Existing KEKs stay available for unwrapping.
+func AddKeyringKey(path, id string) error {
+	if id == "" {
+		return errors.New("kek id required")
+	}
+	ring, err := loadKeyring(path)
+	if err != nil {
+		return err
+	}
+	for _, k := range ring.Keys {
+		if k.ID == id {
+			return fmt.Errorf("kek %q already exists", id)
+		}
+	}
+	key := make([]byte, crypto.AESKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("generate kek: %w", err)
+	}
+	ring.Keys = append(ring.Keys, keyringKey{
+		ID:        id,
+		Key:       base64.StdEncoding.EncodeToString(key),
+		CreatedAt: time.Now().UTC(),
+	})
+	ring.Active = id
+	return writeKeyring(path, ring)
+}
+
+// RemoveKeyringKey deletes a retired KEK from the keyfile at path. The
+// active KEK cannot be removed.
+func RemoveKeyringKey(path, id string) error {
+	ring, err := loadKeyring(path)
+	if err != nil {
+		return err
+	}
+	if ring.Active == id {
+		return fmt.Errorf("kek %q is active", id)
+	}
+	keys := ring.Keys[:0]
+	for _, k := range ring.Keys {
+		if k.ID != id {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == len(ring.Keys) {
+		return fmt.Errorf("kek %q not found", id)
+	}
+	ring.Keys = keys
+	return writeKeyring(path, ring)
+}
+
+func loadKeyring(path string) (*keyringFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ring keyringFile
+	if err := json.Unmarshal(data, &ring); err != nil {
+		return nil, fmt.Errorf("parse keyfile: %w", err)
+	}
+	if len(ring.Keys) == 0 {
+		return nil, errors.New("keyfile contains no keys")
+	}
+	return &ring, nil
+}
+
+func createKeyring(path, kekID string) (*keyringFile, error) {
+	if kekID == "" {
+		return nil, errors.New("kek id required")
+	}
+	key := make([]byte, crypto.AESKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate kek: %w", err)
+	}
+	ring := &keyringFile{
+		Active: kekID,
+		Keys: []keyringKey{{
+			ID:        kekID,
+			Key:       base64.StdEncoding.EncodeToString(key),
+			CreatedAt: time.Now().UTC(),
+		}},
+	}
+	if err := writeKeyring(path, ring); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+func writeKeyring(path string, ring *keyringFile) error {
+	data, err := json.MarshalIndent(ring, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode keyfile: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("create keyfile dir: %w", err)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write keyfile: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write keyfile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyServicePicksUpRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kek.json")
+	ks, err := NewKeyService("kek-1", nil, path)
+	if err != nil {
+		t.Fatalf("NewKeyService: %v", err)
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		t.Fatal(err)
+	}
+
+	before, kid, err := ks.WrapKey(dataKey)
+	if err != nil || kid != "kek-1" {
+		t.Fatalf("WrapKey = %q, %v; want kek-1", kid, err)
+	}
+
+	// What "keys rotate kek-2" does to the keyfile of a running server.
+	if err := AddKeyringKey(path, "kek-2"); err != nil {
+		t.Fatalf("AddKeyringKey: %v", err)
+	}
+	if got := ks.ActiveKeyID(); got != "kek-2" {
+		t.Fatalf("ActiveKeyID = %q, want kek-2", got)
+	}
+	after, kid, err := ks.WrapKey(dataKey)
+	if err != nil || kid != "kek-2" {
+		t.Fatalf("WrapKey after rotation = %q, %v; want kek-2", kid, err)
+	}
+
+	for _, w := range []struct {
+		wrapped []byte
+		kid     string
+	}{{before, "kek-1"}, {after, "kek-2"}} {
+		got, err := ks.UnwrapKey(w.wrapped, w.kid)
+		if err != nil || !bytes.Equal(got, dataKey) {
+			t.Fatalf("UnwrapKey(%s) = %v", w.kid, err)
+		}
+	}
+	if _, err := ks.UnwrapKey(after, "kek-1"); err == nil {
+		t.Fatal("key wrapped under kek-2 unwrapped under kek-1")
+	}
+
+	// Retiring the old KEK shows up as well.
+	if err := RemoveKeyringKey(path, "kek-1"); err != nil {
+		t.Fatalf("RemoveKeyringKey: %v", err)
+	}
+	if ids := ks.KeyIDs(); len(ids) != 1 || ids[0] != "kek-2" {
+		t.Fatalf("KeyIDs = %v, want [kek-2]", ids)
+	}
+}
+
+func TestKeyServiceUnknownKEKWithoutKeyfile(t *testing.T) {
+	ks, err := NewKeyService("a", map[string]string{"a": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}, "")
+	if err != nil {
+		t.Fatalf("NewKeyService: %v", err)
+	}
+	if _, err := ks.UnwrapKey(make([]byte, 40), "b"); err == nil {
+		t.Fatal("UnwrapKey accepted an unknown kek")
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/service"
+	"go.uber.org/zap"
+)
+
+const (
+	MailBackendLog  = "log"
+	MailBackendFile = "file"
+	MailBackendSMTP = "smtp"
+)
+
+// MailOptions carries the settings of every mail backend; each one reads
+// only the fields it needs.
+type MailOptions struct {
+	From      string
+	OutboxDir string
+	SMTP      SMTPOptions
+}
+
+// NewMailer builds the mail backend named by backend.
+func NewMailer(backend string, opts MailOptions, log *zap.Logger) (service.Mailer, error) {
+	from, err := mail.ParseAddress(opts.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", opts.From, err)
+	}
+	switch backend {
+	case MailBackendLog:
+		return &logMailer{log: log}, nil
+	case MailBackendFile:
+		return newFileMailer(from, opts.OutboxDir)
+	case MailBackendSMTP:
+		return newSMTPMailer(from, opts.SMTP)
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q (must be %s, %s or %s)", backend, MailBackendLog, MailBackendFile, MailBackendSMTP)
+	}
+}
+
+// logMailer writes messages to the log instead of sending them. It is meant
+// for development: the log then holds live tokens.
+type logMailer struct {
+	log *zap.Logger
+}
+
+func (m *logMailer) Send(_ context.Context, msg service.MailMessage) error {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+	m.log.Info("mail not sent (log outbox)",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body))
+	return nil
+}
+
+// fileMailer stores every message as an .eml file in a directory, where it
+// can be opened with any mail client.
+type fileMailer struct {
+	from *mail.Address
+	dir  string
+}
+
+func newFileMailer(from *mail.Address, dir string) (*fileMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("outbox directory required")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create outbox dir: %w", err)
+	}
+	return &fileMailer{from: from, dir: dir}, nil
+}
+
+func (m *fileMailer) Send(_ context.Context, msg service.MailMessage) error {
+	now := time.Now().UTC()
+	data, err := formatMessage(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("name message: %w", err)
+	}
+	name := now.Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix) + ".eml"
+	if err := os.WriteFile(filepath.Join(m.dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+	return nil
+}
+
+// formatMessage renders msg as an RFC 5322 message with a quoted-printable
+// UTF-8 body. The recipient must parse as a single address, which also
+// keeps header injection out.
+func formatMessage(from *mail.Address, msg service.MailMessage, now time.Time) ([]byte, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("invalid subject")
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("generate message id: %w", err)
+	}
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, fmt.Errorf("encode body: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("encode body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
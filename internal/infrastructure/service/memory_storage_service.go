@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/filehash/internal/domain/service"
+)
+
+// memoryStorageService keeps blobs in process memory. It is meant for
+// development and tests; everything is lost on restart.
+type memoryStorageService struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+func NewMemoryStorageService() service.StorageService {
+	return &memoryStorageService{objects: make(map[string][]byte)}
+}
+
+var _ service.StorageService = (*memoryStorageService)(nil)
+
+func (s *memoryStorageService) SaveEncrypted(ctx context.Context, originalName string, reader io.Reader) (string, error) {
+	if reader == nil {
+		return "", errors.New("reader cannot be nil")
+	}
+	p := newEncryptedPath(originalName, time.Now().UTC())
+	if err := s.put(ctx, p, reader); err != nil {
+		return "", fmt.Errorf("write ciphertext: %w", err)
+	}
+	return p, nil
+}
+
+func (s *memoryStorageService) LoadEncrypted(ctx context.Context, relativePath string) (io.ReadSeekCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err := cleanStoragePath(relativePath)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	data, ok := s.objects[p]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("open: %w", fs.ErrNotExist)
+	}
+	return nopReadSeekCloser{bytes.NewReader(data)}, nil
+}
+
+func (s *memoryStorageService) SaveExcel(ctx context.Context, reader io.Reader) (string, error) {
+	p := newExcelPath(time.Now().UTC())
+	if err := s.put(ctx, p, reader); err != nil {
+		return "", fmt.Errorf("write excel: %w", err)
+	}
+	return p, nil
+}
+
+func (s *memoryStorageService) Delete(ctx context.Context, relativePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p, err := cleanStoragePath(relativePath)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[p]; !ok {
+		return fmt.Errorf("remove: %w", fs.ErrNotExist)
+	}
+	delete(s.objects, p)
+	return nil
+}
+
+func (s *memoryStorageService) Import(ctx context.Context, relativePath string, reader io.Reader) error {
+	p, err := cleanStoragePath(relativePath)
+	if err != nil {
+		return err
+	}
+	return s.put(ctx, p, reader)
+}
+
+func (s *memoryStorageService) put(ctx context.Context, p string, reader io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.objects[p] = data
+	s.mu.Unlock()
+	return nil
+}
+
+type nopReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopReadSeekCloser) Close() error { return nil }
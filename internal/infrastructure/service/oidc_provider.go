@@ -0,0 +1,424 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filehash/internal/domain/service"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcHTTPTimeout = 10 * time.Second
+	// oidcMetadataTTL is how long discovery results and keys are cached.
+	oidcMetadataTTL = time.Hour
+	// oidcKeyRefetchInterval limits how often an unknown kid makes the key
+	// set be fetched again, which is how provider key rotation is noticed.
+	oidcKeyRefetchInterval = time.Minute
+	oidcMaxResponseBytes   = 1 << 20
+	oidcClockSkew          = time.Minute
+)
+
+// oidcSigningMethods are the ID token algorithms accepted. HS256 is left
+// out on purpose: it would make the client secret a verification key.
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// mfaMethods are amr values (RFC 8176) that show a second factor.
+var mfaMethods = []string{"mfa", "otp", "hwk", "swk", "sms", "fpt", "face", "iris", "retina", "vbm"}
+
+// OIDCOptions configure the client registration at the provider.
+type OIDCOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for a public client
+	RedirectURL  string
+	Scopes       []string
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider discovers the provider lazily, so the service starts while
+// the provider is down, and caches its metadata and keys.
+type oidcProvider struct {
+	opts   OIDCOptions
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *oidcMetadata
+	metaFetched time.Time
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// NewOIDCProvider returns a provider client for opts.Issuer. The issuer must
+// use https, except on loopback addresses so a local mock provider works.
+func NewOIDCProvider(opts OIDCOptions) (service.OIDCProvider, error) {
+	opts.Issuer = strings.TrimRight(opts.Issuer, "/")
+	if err := checkOIDCURL(opts.Issuer); err != nil {
+		return nil, fmt.Errorf("issuer: %w", err)
+	}
+	if opts.ClientID == "" {
+		return nil, errors.New("client id required")
+	}
+	if _, err := url.ParseRequestURI(opts.RedirectURL); err != nil {
+		return nil, fmt.Errorf("invalid redirect url: %w", err)
+	}
+	if !slices.Contains(opts.Scopes, "openid") {
+		opts.Scopes = append([]string{"openid"}, opts.Scopes...)
+	}
+	return &oidcProvider{
+		opts:   opts,
+		client: &http.Client{Timeout: oidcHTTPTimeout},
+	}, nil
+}
+
+var _ service.OIDCProvider = (*oidcProvider)(nil)
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc discovery: invalid authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.opts.ClientID)
+	q.Set("redirect_uri", p.opts.RedirectURL)
+	q.Set("scope", strings.Join(p.opts.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*service.OIDCIdentity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.opts.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.opts.ClientSecret == "" {
+		form.Set("client_id", p.opts.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.opts.ClientSecret != "" {
+		// RFC 6749 section 2.3.1: the credentials are form-encoded first.
+		req.SetBasicAuth(url.QueryEscape(p.opts.ClientID), url.QueryEscape(p.opts.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("token request: status %d: %w", resp.StatusCode, err)
+	}
+	if body.Error != "" {
+		return nil, fmt.Errorf("authorization failed: %s: %s", body.Error, body.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request: status %d", resp.StatusCode)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("invalid id token: none in token response")
+	}
+	return p.verifyIDToken(ctx, meta, body.IDToken, nonce)
+}
+
+type idTokenClaims struct {
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified any      `json:"email_verified"` // some providers send a string
+	AMR           []string `json:"amr"`
+	AZP           string   `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+func (p *oidcProvider) verifyIDToken(ctx context.Context, meta *oidcMetadata, raw, nonce string) (*service.OIDCIdentity, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	},
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.opts.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(oidcClockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id token: no subject")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+	if len(claims.Audience) > 1 && claims.AZP != p.opts.ClientID {
+		return nil, errors.New("invalid id token: issued to another party")
+	}
+
+	verified := false
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+	mfa := slices.ContainsFunc(claims.AMR, func(m string) bool { return slices.Contains(mfaMethods, m) })
+	return &service.OIDCIdentity{
+		Issuer:        meta.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		MFA:           mfa,
+	}, nil
+}
+
+// metadata returns the discovery document, fetching it when missing or
+// stale. A stale copy is kept if refreshing it fails.
+func (p *oidcProvider) metadata(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil && time.Since(p.metaFetched) < oidcMetadataTTL {
+		return p.meta, nil
+	}
+
+	var meta oidcMetadata
+	err := p.getJSON(ctx, p.opts.Issuer+"/.well-known/openid-configuration", &meta)
+	if err == nil {
+		err = meta.validate(p.opts.Issuer)
+	}
+	if err != nil {
+		if p.meta != nil {
+			return p.meta, nil
+		}
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	p.meta = &meta
+	p.metaFetched = time.Now()
+	return p.meta, nil
+}
+
+func (m *oidcMetadata) validate(issuer string) error {
+	// OpenID Connect Discovery section 4.3: the issuer must be the one the
+	// document was fetched for.
+	if m.Issuer != issuer {
+		return fmt.Errorf("issuer mismatch: %q", m.Issuer)
+	}
+	for name, endpoint := range map[string]string{
+		"authorization_endpoint": m.AuthorizationEndpoint,
+		"token_endpoint":         m.TokenEndpoint,
+		"jwks_uri":               m.JWKSURI,
+	} {
+		if err := checkOIDCURL(endpoint); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// key returns the provider key with kid, fetching the key set when it is
+// stale or does not have kid. Without a kid the only key is used.
+func (p *oidcProvider) key(ctx context.Context, meta *oidcMetadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k, ok := p.lookupKey(kid)
+	if ok && time.Since(p.keysFetched) < oidcMetadataTTL {
+		return k, nil
+	}
+	if p.keys == nil || time.Since(p.keysFetched) >= oidcKeyRefetchInterval {
+		keys, err := p.fetchKeys(ctx, meta.JWKSURI)
+		switch {
+		case err == nil:
+			p.keys = keys
+			p.keysFetched = time.Now()
+		case !ok:
+			return nil, err
+		}
+	}
+	if k, ok := p.lookupKey(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *oidcProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+type providerJWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchKeys reads the provider's JWKS. Encryption keys and keys of unknown
+// types are skipped.
+func (p *oidcProvider) fetchKeys(ctx context.Context, jwksURI string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []providerJWK `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use == "enc" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k *providerJWK) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("rsa key too short")
+		}
+		return key, nil
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.New("invalid ec point")
+		}
+		// crypto/ecdh rejects points that are not on the curve.
+		if _, err := ecdhCurve.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid okp key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(v)
+}
+
+// checkOIDCURL requires an absolute https URL, or http on a loopback host.
+func checkOIDCURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid url %q", raw)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("url %q must use https", raw)
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const mockOIDCClientID = "filehash-test"
+
+// mockOIDC is an OpenID provider serving discovery, JWKS and a token
+// endpoint that enforces PKCE. Codes are issued by authorize, which stands
+// in for the browser round trip.
+type mockOIDC struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+	kid    string
+	// issuer is what discovery reports; it defaults to the server URL.
+	issuer string
+
+	mu    sync.Mutex
+	codes map[string]mockOIDCCode
+}
+
+type mockOIDCCode struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDC{t: t, key: key, kid: "mock-1", codes: make(map[string]mockOIDCCode)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("GET /jwks", m.jwks)
+	mux.HandleFunc("POST /token", m.token)
+	m.server = httptest.NewServer(mux)
+	m.issuer = m.server.URL
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockOIDC) provider(t *testing.T) *oidcProvider {
+	t.Helper()
+	p, err := NewOIDCProvider(OIDCOptions{
+		Issuer:      m.server.URL,
+		ClientID:    mockOIDCClientID,
+		RedirectURL: "http://localhost:8080/auth/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	return p.(*oidcProvider)
+}
+
+func (m *mockOIDC) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 m.issuer,
+		"authorization_endpoint": m.server.URL + "/authorize",
+		"token_endpoint":         m.server.URL + "/token",
+		"jwks_uri":               m.server.URL + "/jwks",
+	})
+}
+
+func (m *mockOIDC) jwks(w http.ResponseWriter, r *http.Request) {
+	coord := func(n interface{ FillBytes([]byte) []byte }) string {
+		return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, 32)))
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "EC", "use": "sig", "kid": m.kid, "crv": "P-256",
+			"x": coord(m.key.X), "y": coord(m.key.Y),
+		}},
+	})
+}
+
+// authorize plays the user's login at the authorization URL and returns
+// the code the provider redirects back with.
+func (m *mockOIDC) authorize(authURL string) string {
+	m.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatalf("parse auth url: %v", err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("response_type") != "code" || q.Get("client_id") != mockOIDCClientID ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" ||
+		!strings.Contains(" "+q.Get("scope")+" ", " openid ") {
+		m.t.Fatalf("bad authorization request %s", authURL)
+	}
+	code := rand.Text()
+	m.mu.Lock()
+	m.codes[code] = mockOIDCCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), redirectURI: q.Get("redirect_uri")}
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockOIDC) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.tokenError(w, "invalid_request")
+		return
+	}
+	m.mu.Lock()
+	code, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != mockOIDCClientID:
+		m.tokenError(w, "invalid_request")
+	case !ok || r.PostForm.Get("redirect_uri") != code.redirectURI:
+		m.tokenError(w, "invalid_grant")
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge:
+		// RFC 7636 section 4.6.
+		m.tokenError(w, "invalid_grant")
+	default:
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "opaque",
+			"token_type":   "Bearer",
+			"id_token":     m.idToken(jwt.MapClaims{"nonce": code.nonce}),
+		})
+	}
+}
+
+func (m *mockOIDC) tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": "rejected by mock"})
+}
+
+// idToken signs the default claims of the test user, overridden by extra.
+func (m *mockOIDC) idToken(extra jwt.MapClaims) string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"sub":            "user-42",
+		"aud":            mockOIDCClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"email":          "Alice@Example.com",
+		"email_verified": true,
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	tok.Header["kid"] = m.kid
+	raw, err := tok.SignedString(m.key)
+	if err != nil {
+		m.t.Fatalf("sign id token: %v", err)
+	}
+	return raw
+}
+
+func pkcePair() (verifier, challenge string) {
+	verifier = rand.Text() + rand.Text()
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestOIDCProviderCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	mock := newMockOIDC(t)
+	p := mock.provider(t)
+	verifier, challenge := pkcePair()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if got := mustQuery(t, authURL).Get("state"); got != "state-1" {
+		t.Errorf("state = %q", got)
+	}
+	code := mock.authorize(authURL)
+
+	identity, err := p.Exchange(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Issuer != mock.server.URL || identity.Subject != "user-42" || identity.Email != "Alice@Example.com" ||
+		!identity.EmailVerified || identity.MFA {
+		t.Fatalf("identity = %+v", identity)
+	}
+
+	// Codes are single-use at the provider.
+	if _, err := p.Exchange(ctx, code, verifier, "nonce-1"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("second Exchange: err = %v, want invalid_grant", err)
+	}
+}
+
+func TestOIDCProviderPKCE(t *testing.T) {
+	ctx := context.Background()
+	mock := newMockOIDC(t)
+	p := mock.provider(t)
+	_, challenge := pkcePair()
+	otherVerifier, _ := pkcePair()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	_, err = p.Exchange(ctx, mock.authorize(authURL), otherVerifier, "nonce")
+	if err == nil || !strings.Contains(err.Error(), "authorization failed: invalid_grant") {
+		t.Fatalf("Exchange with the wrong verifier: err = %v, want invalid_grant", err)
+	}
+}
+
+func TestOIDCProviderIDTokenChecks(t *testing.T) {
+	ctx := context.Background()
+	mock := newMockOIDC(t)
+	p := mock.provider(t)
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		nonce   string
+		wantErr string
+		check   func(t *testing.T, verified, mfa bool)
+	}{
+		{
+			name:  "valid",
+			token: func() string { return mock.idToken(jwt.MapClaims{"nonce": "n"}) },
+			nonce: "n",
+		},
+		{
+			name:    "nonce mismatch",
+			token:   func() string { return mock.idToken(jwt.MapClaims{"nonce": "n"}) },
+			nonce:   "other",
+			wantErr: "nonce mismatch",
+		},
+		{
+			name:    "no nonce",
+			token:   func() string { return mock.idToken(nil) },
+			nonce:   "n",
+			wantErr: "nonce mismatch",
+		},
+		{
+			name:    "other audience",
+			token:   func() string { return mock.idToken(jwt.MapClaims{"nonce": "n", "aud": "someone-else"}) },
+			nonce:   "n",
+			wantErr: "audience",
+		},
+		{
+			name: "several audiences without azp",
+			token: func() string {
+				return mock.idToken(jwt.MapClaims{"nonce": "n", "aud": []string{mockOIDCClientID, "someone-else"}})
+			},
+			nonce:   "n",
+			wantErr: "issued to another party",
+		},
+		{
+			name: "several audiences with a foreign azp",
+			token: func() string {
+				return mock.idToken(jwt.MapClaims{"nonce": "n", "aud": []string{mockOIDCClientID, "someone-else"}, "azp": "someone-else"})
+			},
+			nonce:   "n",
+			wantErr: "issued to another party",
+		},
+		{
+			name: "several audiences with our azp",
+			token: func() string {
+				return mock.idToken(jwt.MapClaims{"nonce": "n", "aud": []string{mockOIDCClientID, "someone-else"}, "azp": mockOIDCClientID})
+			},
+			nonce: "n",
+		},
+		{
+			name:    "issuer mismatch",
+			token:   func() string { return mock.idToken(jwt.MapClaims{"nonce": "n", "iss": "https://evil.example"}) },
+			nonce:   "n",
+			wantErr: "issuer",
+		},
+		{
+			name: "expired",
+			token: func() string {
+				return mock.idToken(jwt.MapClaims{"nonce": "n", "exp": time.Now().Add(-time.Hour).Unix()})
+			},
+			nonce:   "n",
+			wantErr: "expired",
+		},
+		{
+			name:    "no subject",
+			token:   func() string { return mock.idToken(jwt.MapClaims{"nonce": "n", "sub": ""}) },
+			nonce:   "n",
+			wantErr: "no subject",
+		},
+		{
+			name: "foreign signature",
+			token: func() string {
+				tok := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+					"iss": mock.server.URL, "sub": "user-42", "aud": mockOIDCClientID, "nonce": "n",
+					"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+				})
+				tok.Header["kid"] = mock.kid
+				raw, _ := tok.SignedString(otherKey)
+				return raw
+			},
+			nonce:   "n",
+			wantErr: "signature is invalid",
+		},
+		{
+			name: "string email_verified and otp",
+			token: func() string {
+				return mock.idToken(jwt.MapClaims{"nonce": "n", "email_verified": "false", "amr": []string{"pwd", "otp"}})
+			},
+			nonce: "n",
+			check: func(t *testing.T, verified, mfa bool) {
+				if verified || !mfa {
+					t.Errorf("verified = %v, mfa = %v; want false, true", verified, mfa)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := p.verifyIDToken(ctx, meta, tt.token(), tt.nonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyIDToken: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, identity.EmailVerified, identity.MFA)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderDiscoveryIssuerMismatch(t *testing.T) {
+	mock := newMockOIDC(t)
+	mock.issuer = "https://evil.example"
+	_, challenge := pkcePair()
+
+	_, err := mock.provider(t).AuthCodeURL(context.Background(), "state", "nonce", challenge)
+	if err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Fatalf("AuthCodeURL: err = %v, want issuer mismatch", err)
+	}
+}
+
+func mustQuery(t *testing.T, raw string) url.Values {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
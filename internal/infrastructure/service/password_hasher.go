@@ -0,0 +1,175 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/filehash/internal/domain/service"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltBytes = 16
+	argon2KeyBytes  = 32
+	// argon2MaxMemory bounds the memory a stored hash can make Verify use
+	// (4 GiB, in KiB).
+	argon2MaxMemory = 4 << 20
+)
+
+var errPasswordMismatch = errors.New("password does not match")
+
+// Argon2Params are the argon2id cost parameters (RFC 9106).
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// PasswordHashOptions select the algorithm of new hashes and its cost.
+type PasswordHashOptions struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+// passwordHasher writes argon2id hashes as PHC strings
+// ($argon2id$v=19$m=...,t=...,p=...$salt$hash) and bcrypt hashes in their
+// usual $2b$ form. It verifies both whatever the configured algorithm, so
+// switching algorithms only affects new hashes.
+type passwordHasher struct {
+	opts PasswordHashOptions
+}
+
+// NewPasswordHasher returns a hasher that hashes with opts.Algorithm.
+func NewPasswordHasher(opts PasswordHashOptions) (service.PasswordHasher, error) {
+	switch opts.Algorithm {
+	case PasswordHashArgon2id:
+		p := opts.Argon2
+		if p.Iterations < 1 || p.Parallelism < 1 {
+			return nil, errors.New("argon2id iterations and parallelism must be at least 1")
+		}
+		if p.Memory < 8*uint32(p.Parallelism) || p.Memory > argon2MaxMemory {
+			return nil, fmt.Errorf("argon2id memory must be between %d and %d KiB", 8*uint32(p.Parallelism), argon2MaxMemory)
+		}
+	case PasswordHashBcrypt:
+		if opts.BcryptCost < bcrypt.MinCost || opts.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q (must be %s or %s)", opts.Algorithm, PasswordHashArgon2id, PasswordHashBcrypt)
+	}
+	return &passwordHasher{opts: opts}, nil
+}
+
+var _ service.PasswordHasher = (*passwordHasher)(nil)
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+	if h.opts.Algorithm == PasswordHashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.opts.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("bcrypt: %w", err)
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+	p := h.opts.Argon2
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyBytes)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *passwordHasher) Verify(hash, password string) error {
+	if isBcryptHash(hash) {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			return errPasswordMismatch
+		}
+		return nil
+	}
+
+	parsed, err := parseArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+	p := parsed.params
+	key := argon2.IDKey([]byte(password), parsed.salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(parsed.key)))
+	if subtle.ConstantTimeCompare(key, parsed.key) != 1 {
+		return errPasswordMismatch
+	}
+	return nil
+}
+
+func (h *passwordHasher) NeedsRehash(hash string) bool {
+	if isBcryptHash(hash) {
+		if h.opts.Algorithm != PasswordHashBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.opts.BcryptCost
+	}
+
+	parsed, err := parseArgon2Hash(hash)
+	if err != nil || h.opts.Algorithm != PasswordHashArgon2id {
+		return true
+	}
+	return parsed.params != h.opts.Argon2 ||
+		len(parsed.salt) != argon2SaltBytes ||
+		len(parsed.key) != argon2KeyBytes
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+type argon2Hash struct {
+	params Argon2Params
+	salt   []byte
+	key    []byte
+}
+
+// parseArgon2Hash reads an argon2id PHC string. Only version 19, the one
+// the argon2 package implements, is accepted.
+func parseArgon2Hash(hash string) (*argon2Hash, error) {
+	fields := strings.Split(hash, "$")
+	if len(fields) != 6 || fields[0] != "" || fields[1] != PasswordHashArgon2id {
+		return nil, errors.New("unsupported password hash format")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %q", fields[2])
+	}
+
+	var p Argon2Params
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters %q", fields[3])
+	}
+	if p.Iterations < 1 || p.Parallelism < 1 || p.Memory < 8*uint32(p.Parallelism) || p.Memory > argon2MaxMemory {
+		return nil, fmt.Errorf("invalid argon2 parameters %q", fields[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil || len(salt) < 8 {
+		return nil, errors.New("invalid argon2 salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(key) < 16 {
+		return nil, errors.New("invalid argon2 hash")
+	}
+	return &argon2Hash{params: p, salt: salt, key: key}, nil
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeS3 is an in-process, path-style S3 endpoint holding objects in
+// memory. It verifies the SigV4 signature of every request with its own
+// implementation of the algorithm, so it does not trust s3_signer.go.
+type fakeS3 struct {
+	bucket  string
+	region  string
+	keyID   string
+	secret  string
+	server  *httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	// rejected counts requests refused for a bad signature.
+	rejected int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	t.Helper()
+	f := &fakeS3{
+		bucket:  "test-bucket",
+		region:  "eu-test-1",
+		keyID:   "AKIDTEST",
+		secret:  "secret/key+value",
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// options returns S3Options that address the fake with valid credentials.
+func (f *fakeS3) options() S3Options {
+	return S3Options{
+		Endpoint:        f.server.URL,
+		Region:          f.region,
+		Bucket:          f.bucket,
+		AccessKeyID:     f.keyID,
+		SecretAccessKey: f.secret,
+		Prefix:          "blobs",
+		ForcePathStyle:  true,
+	}
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := f.verify(r, body); err != nil {
+		f.mu.Lock()
+		f.rejected++
+		f.mu.Unlock()
+		writeFakeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok || key == "" {
+		writeFakeS3Error(w, http.StatusBadRequest, "InvalidRequest", "path-style object URL expected")
+		return
+	}
+	query := r.URL.Query()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := uuid.NewString()
+		f.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if !ok || err != nil {
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchUpload", "")
+			return
+		}
+		parts[number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchUpload", "")
+			return
+		}
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil || len(complete.Parts) != len(parts) {
+			writeFakeS3Error(w, http.StatusBadRequest, "InvalidPart", "")
+			return
+		}
+		var object []byte
+		for i, part := range complete.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"part-%d"`, i+1) {
+				writeFakeS3Error(w, http.StatusBadRequest, "InvalidPartOrder", "")
+				return
+			}
+			object = append(object, parts[part.PartNumber]...)
+		}
+		f.objects[key] = object
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+		w.Header().Set("ETag", `"object"`)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodHead, r.Method == http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchKey", "")
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(object))
+	default:
+		writeFakeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "")
+	}
+}
+
+// verify recomputes the SigV4 signature of r.
+func (f *fakeS3) verify(r *http.Request, body []byte) error {
+	fields, ok := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return fmt.Errorf("missing SigV4 authorization")
+	}
+	auth := make(map[string]string)
+	for _, field := range strings.Split(fields, ", ") {
+		name, value, _ := strings.Cut(field, "=")
+		auth[name] = value
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != len("20060102T150405Z") {
+		return fmt.Errorf("bad X-Amz-Date %q", amzDate)
+	}
+	scope := amzDate[:8] + "/" + f.region + "/s3/aws4_request"
+	if auth["Credential"] != f.keyID+"/"+scope {
+		return fmt.Errorf("bad credential %q", auth["Credential"])
+	}
+
+	sum := sha256.Sum256(body)
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != hex.EncodeToString(sum[:]) {
+		return fmt.Errorf("payload hash %q does not match the body", got)
+	}
+
+	signed := strings.Split(auth["SignedHeaders"], ";")
+	for _, required := range []string{"host", "x-amz-date", "x-amz-content-sha256"} {
+		if !slices.Contains(signed, required) {
+			return fmt.Errorf("%s is not signed", required)
+		}
+	}
+	if r.Header.Get("Range") != "" && !slices.Contains(signed, "range") {
+		return fmt.Errorf("range is not signed")
+	}
+	var headers strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	query := r.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, fakeS3Escape(name)+"="+fakeS3Escape(value))
+		}
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.Join(pairs, "&"),
+		headers.String(),
+		auth["SignedHeaders"],
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	canonicalSum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalSum[:])
+
+	key := []byte("AWS4" + f.secret)
+	for _, part := range []string{amzDate[:8], f.region, "s3", "aws4_request"} {
+		key = fakeS3HMAC(key, part)
+	}
+	want := hex.EncodeToString(fakeS3HMAC(key, toSign))
+	if !hmac.Equal([]byte(want), []byte(auth["Signature"])) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects["blobs/"+key]
+	return data, ok
+}
+
+func fakeS3Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func fakeS3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func writeFakeS3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/service"
+)
+
+const (
+	// s3PartSize is the upload buffer per request. Objects that fit in one
+	// part are sent with a single PUT, larger ones as a multipart upload.
+	s3PartSize = 8 << 20
+	// s3SkipLimit is how far a reader discards forward on an open response
+	// instead of issuing a new ranged GET.
+	s3SkipLimit = 256 << 10
+
+	contentTypeBinary = "application/octet-stream"
+	contentTypeXLSX   = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// S3Options configures the S3-compatible storage backend.
+type S3Options struct {
+	// Endpoint is the service URL, e.g. http://localhost:9000 for MinIO.
+	// When empty the AWS endpoint for Region is used.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Prefix is prepended to every object key.
+	Prefix string
+	// ForcePathStyle addresses objects as endpoint/bucket/key instead of
+	// bucket.endpoint/key.
+	ForcePathStyle bool
+	HTTPClient     *http.Client
+}
+
+type s3StorageService struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3StorageService stores blobs in an S3-compatible bucket, speaking
+// the REST API directly with SigV4-signed requests.
+func NewS3StorageService(opts S3Options) (service.StorageService, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	if opts.AccessKeyID == "" || opts.SecretAccessKey == "" {
+		return nil, errors.New("s3 credentials are required")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", opts.Region)
+	}
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", opts.Endpoint)
+	}
+	opts.Prefix = strings.Trim(opts.Prefix, "/")
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &s3StorageService{opts: opts, endpoint: endpoint, client: client}, nil
+}
+
+var _ service.StorageService = (*s3StorageService)(nil)
+
+func (s *s3StorageService) SaveEncrypted(ctx context.Context, originalName string, reader io.Reader) (string, error) {
+	if reader == nil {
+		return "", errors.New("reader cannot be nil")
+	}
+	p := newEncryptedPath(originalName, time.Now().UTC())
+	if err := s.put(ctx, p, reader, contentTypeBinary); err != nil {
+		return "", fmt.Errorf("write ciphertext: %w", err)
+	}
+	return p, nil
+}
+
+// LoadEncrypted returns a reader that fetches the object with ranged GETs,
+// so seeking only downloads the bytes that are actually read.
+func (s *s3StorageService) LoadEncrypted(ctx context.Context, relativePath string) (io.ReadSeekCloser, error) {
+	p, err := cleanStoragePath(relativePath)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, p, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return nil, errors.New("open: object size unknown")
+	}
+	return &s3Object{ctx: ctx, storage: s, key: p, size: resp.ContentLength}, nil
+}
+
+func (s *s3StorageService) SaveExcel(ctx context.Context, reader io.Reader) (string, error) {
+	p := newExcelPath(time.Now().UTC())
+	if err := s.put(ctx, p, reader, contentTypeXLSX); err != nil {
+		return "", fmt.Errorf("write excel: %w", err)
+	}
+	return p, nil
+}
+
+func (s *s3StorageService) Delete(ctx context.Context, relativePath string) error {
+	p, err := cleanStoragePath(relativePath)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, p, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("remove: %w", err)
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3StorageService) Import(ctx context.Context, relativePath string, reader io.Reader) error {
+	p, err := cleanStoragePath(relativePath)
+	if err != nil {
+		return err
+	}
+	contentType := contentTypeBinary
+	if strings.HasSuffix(p, ".xlsx") {
+		contentType = contentTypeXLSX
+	}
+	return s.put(ctx, p, reader, contentType)
+}
+
+// put uploads reader to key holding at most one part in memory.
+func (s *s3StorageService) put(ctx context.Context, key string, reader io.Reader, contentType string) error {
+	buf := make([]byte, s3PartSize)
+	n, err := io.ReadFull(reader, buf)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		header := http.Header{"Content-Type": {contentType}}
+		resp, err := s.do(ctx, http.MethodPut, key, nil, header, buf[:n])
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	case err != nil:
+		return err
+	}
+	return s.putMultipart(ctx, key, buf, reader, contentType)
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *s3StorageService) putMultipart(ctx context.Context, key string, first []byte, reader io.Reader, contentType string) (err error) {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, http.Header{"Content-Type": {contentType}}, nil)
+	if err != nil {
+		return fmt.Errorf("create multipart upload: %w", err)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	_ = resp.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("create multipart upload: invalid response: %v", err)
+	}
+	uploadID := initiated.UploadID
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Abort even when ctx is done so no orphaned parts are billed.
+		abortCtx := context.WithoutCancel(ctx)
+		if resp, abortErr := s.do(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil); abortErr == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+
+	var parts []s3CompletedPart
+	part := first
+	for number := 1; ; number++ {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, http.MethodPut, key, query, nil, part)
+		if err != nil {
+			return fmt.Errorf("upload part %d: %w", number, err)
+		}
+		_ = resp.Body.Close()
+		parts = append(parts, s3CompletedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		n, err := io.ReadFull(reader, first[:cap(first)])
+		if n == 0 && err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		part = first[:n]
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	resp, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, http.Header{"Content-Type": {"application/xml"}}, body)
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	defer resp.Body.Close()
+	// S3 may report a failed completion inside a 200 response.
+	result, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	if bytes.Contains(result, []byte("<Error>")) {
+		return fmt.Errorf("complete multipart upload: %w", parseS3Error(resp.StatusCode, result))
+	}
+	return nil
+}
+
+// objectURL returns the URL of key, with every path segment escaped the way
+// SigV4 expects it in the canonical request.
+func (s *s3StorageService) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	objectKey := key
+	if s.opts.Prefix != "" {
+		objectKey = s.opts.Prefix + "/" + key
+	}
+	rawPath := strings.TrimSuffix(u.Path, "/")
+	if s.opts.ForcePathStyle {
+		rawPath += "/" + s.opts.Bucket
+	} else {
+		u.Host = s.opts.Bucket + "." + u.Host
+	}
+	rawPath += "/" + s3Escape(objectKey, false)
+	u.RawPath = rawPath
+	u.Path, _ = url.PathUnescape(rawPath)
+	return &u
+}
+
+func (s *s3StorageService) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.ContentLength = int64(len(body))
+	}
+
+	sum := sha256.Sum256(body)
+	signS3Request(req, hex.EncodeToString(sum[:]), s.opts, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, parseS3Error(resp.StatusCode, data)
+	}
+	return resp, nil
+}
+
+func parseS3Error(status int, body []byte) error {
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	_ = xml.Unmarshal(body, &s3Err)
+	if s3Err.Code == "" {
+		s3Err.Code = http.StatusText(status)
+	}
+	err := fmt.Errorf("s3: %d %s %s", status, s3Err.Code, s3Err.Message)
+	if status == http.StatusNotFound {
+		return fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
+	return err
+}
+
+// s3Object is a seekable view of a remote object. Sequential reads share a
+// single open response; a seek elsewhere opens a new ranged GET.
+type s3Object struct {
+	ctx     context.Context
+	storage *s3StorageService
+	key     string
+	size    int64
+	pos     int64
+
+	body    io.ReadCloser
+	bodyPos int64
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.pos >= o.size {
+		return 0, io.EOF
+	}
+	if o.body != nil && o.pos > o.bodyPos && o.pos-o.bodyPos <= s3SkipLimit {
+		n, err := io.CopyN(io.Discard, o.body, o.pos-o.bodyPos)
+		o.bodyPos += n
+		if err != nil {
+			o.closeBody()
+		}
+	}
+	if o.body == nil || o.bodyPos != o.pos {
+		o.closeBody()
+		header := http.Header{"Range": {fmt.Sprintf("bytes=%d-", o.pos)}}
+		resp, err := o.storage.do(o.ctx, http.MethodGet, o.key, nil, header, nil)
+		if err != nil {
+			return 0, fmt.Errorf("read object: %w", err)
+		}
+		if resp.StatusCode != http.StatusPartialContent && o.pos != 0 {
+			_ = resp.Body.Close()
+			return 0, errors.New("read object: range not honoured")
+		}
+		o.body = resp.Body
+		o.bodyPos = o.pos
+	}
+
+	n, err := o.body.Read(p)
+	o.pos += int64(n)
+	o.bodyPos += int64(n)
+	if err == io.EOF {
+		o.closeBody()
+		if o.pos < o.size {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.pos + offset
+	case io.SeekEnd:
+		abs = o.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	o.pos = abs
+	return abs, nil
+}
+
+func (o *s3Object) Close() error {
+	o.closeBody()
+	return nil
+}
+
+func (o *s3Object) closeBody() {
+	if o.body != nil {
+		_ = o.body.Close()
+		o.body = nil
+	}
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/filehash/internal/domain/service"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported token signing algorithms.
+const (
+	SigningAlgEdDSA = "EdDSA"
+	SigningAlgES256 = "ES256"
+)
+
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private any // nil for verification-only keys
+	public  any
+	jwk     service.JWK
+}
+
+// SigningKeyring signs tokens with its first key and verifies tokens signed
+// with any of its keys, so a retired key keeps verifying until the tokens
+// it signed have expired. Key IDs are RFC 7638 thumbprints, which makes
+// them identical on every replica that loads the same files.
+type SigningKeyring struct {
+	signing *signingKey
+	keys    map[string]*signingKey
+	order   []*signingKey
+}
+
+// LoadSigningKeyring reads PEM keys from paths. The first file must hold a
+// private key and signs new tokens; the others may hold private or public
+// keys and are used for verification only.
+func LoadSigningKeyring(paths []string) (*SigningKeyring, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+	ring := &SigningKeyring{keys: make(map[string]*signingKey, len(paths))}
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read signing key: %w", err)
+		}
+		key, err := parseSigningKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", path, err)
+		}
+		if i == 0 && key.private == nil {
+			return nil, fmt.Errorf("signing key %s: the first key must be a private key", path)
+		}
+		if err := ring.add(key); err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", path, err)
+		}
+	}
+	return ring, nil
+}
+
+// NewEphemeralSigningKeyring returns a keyring with a fresh Ed25519 key that
+// lives only as long as the process.
+func NewEphemeralSigningKeyring() (*SigningKeyring, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate signing key: %w", err)
+	}
+	key, err := newSigningKey(private)
+	if err != nil {
+		return nil, err
+	}
+	ring := &SigningKeyring{keys: make(map[string]*signingKey, 1)}
+	if err := ring.add(key); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// GenerateSigningKey writes a new private key for alg to path as PKCS #8
+// PEM and returns its key ID. An existing file is never overwritten.
+func GenerateSigningKey(alg, path string) (string, error) {
+	var private any
+	var err error
+	switch alg {
+	case SigningAlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case SigningAlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return "", fmt.Errorf("unsupported signing algorithm %q (must be %s or %s)", alg, SigningAlgEdDSA, SigningAlgES256)
+	}
+	if err != nil {
+		return "", fmt.Errorf("generate signing key: %w", err)
+	}
+	key, err := newSigningKey(private)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", fmt.Errorf("encode signing key: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return "", fmt.Errorf("create key dir: %w", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("create key file: %w", err)
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("write key file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("write key file: %w", err)
+	}
+	return key.id, nil
+}
+
+func (r *SigningKeyring) add(key *signingKey) error {
+	if _, dup := r.keys[key.id]; dup {
+		return fmt.Errorf("duplicate key %s", key.id)
+	}
+	if r.signing == nil {
+		r.signing = key
+	}
+	r.keys[key.id] = key
+	r.order = append(r.order, key)
+	return nil
+}
+
+// KeyIDs returns the IDs of all keys, the signing key first.
+func (r *SigningKeyring) KeyIDs() []string {
+	ids := make([]string, len(r.order))
+	for i, key := range r.order {
+		ids[i] = key.id
+	}
+	return ids
+}
+
+// SharesKeys reports whether both keyrings hold a common key.
+func (r *SigningKeyring) SharesKeys(other *SigningKeyring) bool {
+	for id := range r.keys {
+		if _, ok := other.keys[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicKeys returns the keys in JWK form, the signing key first.
+func (r *SigningKeyring) PublicKeys() []service.JWK {
+	jwks := make([]service.JWK, len(r.order))
+	for i, key := range r.order {
+		jwks[i] = key.jwk
+	}
+	return jwks
+}
+
+// sign signs claims with the signing key and names it in the kid header.
+func (r *SigningKeyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.signing.method, claims)
+	token.Header["kid"] = r.signing.id
+	signed, err := token.SignedString(r.signing.private)
+	if err != nil {
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+	return signed, nil
+}
+
+// parse verifies tokenStr against the key named by its kid header and
+// checks that it was issued for audience.
+func (r *SigningKeyring) parse(tokenStr string, claims jwt.Claims, audience string) (*jwt.Token, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{SigningAlgEdDSA, SigningAlgES256}),
+		jwt.WithAudience(audience),
+	)
+	return parser.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := r.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// The algorithm is bound to the key, never taken from the token.
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("algorithm %s does not match key %s", token.Method.Alg(), kid)
+		}
+		return key.public, nil
+	})
+}
+
+func parseSigningKey(data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key: %w", err)
+		}
+		return newSigningKey(key)
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key: %w", err)
+		}
+		return newSigningKey(key)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse public key: %w", err)
+		}
+		return newVerificationKey(key)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+func newSigningKey(private any) (*signingKey, error) {
+	var public any
+	switch k := private.(type) {
+	case ed25519.PrivateKey:
+		public = k.Public()
+	case *ecdsa.PrivateKey:
+		public = &k.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T (must be Ed25519 or ECDSA P-256)", private)
+	}
+	key, err := newVerificationKey(public)
+	if err != nil {
+		return nil, err
+	}
+	key.private = private
+	return key, nil
+}
+
+func newVerificationKey(public any) (*signingKey, error) {
+	var method jwt.SigningMethod
+	var jwk service.JWK
+	switch k := public.(type) {
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+		jwk = service.JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("unsupported ECDSA curve (must be P-256)")
+		}
+		point, err := k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("encode public key: %w", err)
+		}
+		// Uncompressed point: 0x04 || X || Y, 32 bytes each.
+		raw := point.Bytes()
+		method = jwt.SigningMethodES256
+		jwk = service.JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(raw[1:33]),
+			Y:   base64.RawURLEncoding.EncodeToString(raw[33:]),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T (must be Ed25519 or ECDSA P-256)", public)
+	}
+
+	jwk.Kid = jwkThumbprint(jwk)
+	jwk.Alg = method.Alg()
+	jwk.Use = "sig"
+	return &signingKey{id: jwk.Kid, method: method, public: public, jwk: jwk}, nil
+}
+
+// jwkThumbprint computes the RFC 7638 thumbprint: the SHA-256 of the
+// required members in lexicographic order without whitespace.
+func jwkThumbprint(jwk service.JWK) string {
+	var canonical string
+	if jwk.Kty == "EC" {
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)
+	} else {
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Crv, jwk.Kty, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
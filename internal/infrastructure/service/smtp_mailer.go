@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+
+	"github.com/filehash/internal/domain/service"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// SMTPOptions configures delivery through an SMTP relay.
+type SMTPOptions struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// RequireTLS refuses to send when the server does not offer STARTTLS.
+	// Local sinks usually lack it.
+	RequireTLS bool
+}
+
+type smtpMailer struct {
+	from *mail.Address
+	opts SMTPOptions
+}
+
+func newSMTPMailer(from *mail.Address, opts SMTPOptions) (*smtpMailer, error) {
+	if opts.Host == "" || opts.Port == "" {
+		return nil, fmt.Errorf("smtp host and port required")
+	}
+	return &smtpMailer{from: from, opts: opts}, nil
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg service.MailMessage) error {
+	data, err := formatMessage(m.from, msg, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	to, _ := mail.ParseAddress(msg.To)
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.opts.Host, m.opts.Port))
+	if err != nil {
+		return fmt.Errorf("smtp dial: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.opts.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.opts.Host, MinVersion: tls.VersionTLS12}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	} else if m.opts.RequireTLS {
+		return fmt.Errorf("smtp server does not offer STARTTLS")
+	}
+	if m.opts.Username != "" {
+		// PlainAuth itself refuses to send credentials without TLS except
+		// to localhost.
+		auth := smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.from.Address); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("smtp rcpt to: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/filehash/internal/domain/service"
+)
+
+// smtpSink is a minimal SMTP server on a loopback port that records every
+// message it accepts. It offers no STARTTLS, like the local sinks the
+// RequireTLS option is documented for.
+type smtpSink struct {
+	listener net.Listener
+	auth     bool // advertise AUTH PLAIN
+
+	mu       sync.Mutex
+	messages []sinkMessage
+}
+
+type sinkMessage struct {
+	from string
+	rcpt []string
+	auth string // decoded AUTH PLAIN response
+	data string
+}
+
+func newSMTPSink(t *testing.T, auth bool) *smtpSink {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &smtpSink{listener: l, auth: auth}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) options() SMTPOptions {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return SMTPOptions{Host: host, Port: port}
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 sink ESMTP")
+	var msg sinkMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if s.auth {
+				reply("250-sink")
+				reply("250 AUTH PLAIN")
+			} else {
+				reply("250 sink")
+			}
+		case "AUTH":
+			mech, resp, _ := strings.Cut(arg, " ")
+			decoded, err := base64.StdEncoding.DecodeString(resp)
+			if mech != "PLAIN" || err != nil {
+				reply("504 unsupported")
+				continue
+			}
+			msg.auth = string(decoded)
+			reply("235 ok")
+		case "MAIL":
+			msg.from = strings.TrimPrefix(arg, "FROM:")
+			reply("250 ok")
+		case "RCPT":
+			msg.rcpt = append(msg.rcpt, strings.TrimPrefix(arg, "TO:"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				// RFC 5321 section 4.5.2: undo dot-stuffing.
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			msg.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = sinkMessage{}
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpSink) received() []sinkMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sinkMessage(nil), s.messages...)
+}
+
+func TestSMTPMailerAccountMails(t *testing.T) {
+	// A token as long as a real one, so the body needs soft line breaks.
+	token := strings.Repeat("eyJhbGciOiJFZERTQSJ9.", 12)
+
+	tests := []struct {
+		name     string
+		msg      service.MailMessage
+		wantBody string
+	}{
+		{
+			name: "password reset",
+			msg: service.MailMessage{
+				To:      "Alice <alice@example.com>",
+				Subject: "Reset your FileHash password",
+				Body: "To choose a new password, send this token with the new password to https://files.example/auth/password/reset:\n\n" +
+					token + "\n\nThe token works once and expires in 30 minutes.\n",
+			},
+			wantBody: "\r\n\r\n" + token + "\r\n\r\n",
+		},
+		{
+			name: "email verification",
+			msg: service.MailMessage{
+				To:      "alice@example.com",
+				Subject: "Confirm your FileHash email address",
+				Body:    "Open this link:\n\nhttps://files.example/auth/verify-email?token=" + token + "\n\n.\nThe link works once and expires in 24 hours.\n",
+			},
+			wantBody: "https://files.example/auth/verify-email?token=" + token + "\r\n\r\n.\r\n",
+		},
+		{
+			name: "non-ASCII subject",
+			msg: service.MailMessage{
+				To:      "alice@example.com",
+				Subject: "Сброс пароля",
+				Body:    "Токен: " + token + "\n",
+			},
+			wantBody: "Токен: " + token,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newSMTPSink(t, false)
+			mailer, err := NewMailer(MailBackendSMTP, MailOptions{From: "FileHash <no-reply@files.example>", SMTP: sink.options()}, nil)
+			if err != nil {
+				t.Fatalf("NewMailer: %v", err)
+			}
+			if err := mailer.Send(context.Background(), tt.msg); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			got := sink.received()
+			if len(got) != 1 {
+				t.Fatalf("sink received %d messages, want 1", len(got))
+			}
+			to, _ := mail.ParseAddress(tt.msg.To)
+			if got[0].from != "<no-reply@files.example>" || len(got[0].rcpt) != 1 || got[0].rcpt[0] != "<"+to.Address+">" {
+				t.Fatalf("envelope from %s to %v", got[0].from, got[0].rcpt)
+			}
+
+			m, err := mail.ReadMessage(strings.NewReader(got[0].data))
+			if err != nil {
+				t.Fatalf("parse message: %v", err)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+			if err != nil || subject != tt.msg.Subject {
+				t.Errorf("Subject = %q, %v", subject, err)
+			}
+			if from, err := m.Header.AddressList("From"); err != nil || from[0].Address != "no-reply@files.example" || from[0].Name != "FileHash" {
+				t.Errorf("From = %q", m.Header.Get("From"))
+			}
+			if rcpt, err := m.Header.AddressList("To"); err != nil || rcpt[0].Address != to.Address {
+				t.Errorf("To = %q", m.Header.Get("To"))
+			}
+			if date, err := m.Header.Date(); err != nil || time.Since(date) > time.Minute {
+				t.Errorf("Date = %q", m.Header.Get("Date"))
+			}
+			if id := m.Header.Get("Message-Id"); !strings.HasSuffix(id, "@files.example>") {
+				t.Errorf("Message-ID = %q", id)
+			}
+			if m.Header.Get("Content-Type") != "text/plain; charset=utf-8" || m.Header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+				t.Errorf("content headers = %q, %q", m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"))
+			}
+
+			raw, _ := io.ReadAll(m.Body)
+			for _, line := range strings.Split(string(raw), "\r\n") {
+				if len(line) > 76 {
+					t.Fatalf("encoded line of %d characters", len(line))
+				}
+			}
+			body, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(string(raw))))
+			if err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Fatalf("body %q does not contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSMTPMailerAuth(t *testing.T) {
+	sink := newSMTPSink(t, true)
+	opts := sink.options()
+	opts.Username, opts.Password = "mailer", "s3cret"
+	mailer, err := newSMTPMailer(&mail.Address{Address: "no-reply@files.example"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mailer.Send(context.Background(), service.MailMessage{To: "alice@example.com", Subject: "s", Body: "b"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := sink.received(); len(got) != 1 || got[0].auth != "\x00mailer\x00s3cret" {
+		t.Fatalf("received %+v", got)
+	}
+}
+
+func TestSMTPMailerRequireTLS(t *testing.T) {
+	sink := newSMTPSink(t, false)
+	opts := sink.options()
+	opts.RequireTLS = true
+	mailer, err := newSMTPMailer(&mail.Address{Address: "no-reply@files.example"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mailer.Send(context.Background(), service.MailMessage{To: "alice@example.com", Subject: "s", Body: "b"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Send: err = %v, want a STARTTLS error", err)
+	}
+	if len(sink.received()) != 0 {
+		t.Fatal("message was sent without TLS")
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	sink := newSMTPSink(t, false)
+	mailer, err := newSMTPMailer(&mail.Address{Address: "no-reply@files.example"}, sink.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []service.MailMessage{
+		{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "s"},
+		{To: "alice@example.com", Subject: "s\r\nBcc: eve@example.com"},
+	} {
+		if err := mailer.Send(context.Background(), msg); err == nil {
+			t.Errorf("Send(%q, %q) succeeded", msg.To, msg.Subject)
+		}
+	}
+	if len(sink.received()) != 0 {
+		t.Fatal("a message was sent")
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/filehash/internal/domain/service"
+)
+
+const (
+	StorageBackendLocal  = "local"
+	StorageBackendS3     = "s3"
+	StorageBackendMemory = "memory"
+)
+
+// StorageOptions carries the settings of every storage backend; each
+// factory reads only the fields it needs.
+type StorageOptions struct {
+	BaseDir string
+	S3      S3Options
+}
+
+// StorageFactory builds a storage backend from options.
+type StorageFactory func(opts StorageOptions) (service.StorageService, error)
+
+var (
+	storageMu       sync.RWMutex
+	storageBackends = map[string]StorageFactory{
+		StorageBackendLocal: func(opts StorageOptions) (service.StorageService, error) {
+			return NewLocalStorageService(opts.BaseDir)
+		},
+		StorageBackendS3: func(opts StorageOptions) (service.StorageService, error) {
+			return NewS3StorageService(opts.S3)
+		},
+		StorageBackendMemory: func(StorageOptions) (service.StorageService, error) {
+			return NewMemoryStorageService(), nil
+		},
+	}
+)
+
+// RegisterStorageBackend makes a storage backend available under name,
+// replacing any backend previously registered with that name.
+func RegisterStorageBackend(name string, factory StorageFactory) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	storageBackends[name] = factory
+}
+
+// NewStorageService builds the storage backend registered under name.
+func NewStorageService(name string, opts StorageOptions) (service.StorageService, error) {
+	storageMu.RLock()
+	factory, ok := storageBackends[name]
+	storageMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q (available: %s)", name, strings.Join(StorageBackends(), ", "))
+	}
+	return factory(opts)
+}
+
+type storageResolver struct {
+	opts        StorageOptions
+	primaryName string
+	primary     service.StorageService
+
+	mu       sync.Mutex
+	backends map[string]service.StorageService
+}
+
+// NewStorageResolver builds the primary backend and resolves any other
+// registered backend on first use with the same options, so blobs recorded
+// on a previous backend stay readable.
+func NewStorageResolver(primary string, opts StorageOptions) (service.StorageResolver, error) {
+	storage, err := NewStorageService(primary, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &storageResolver{
+		opts:        opts,
+		primaryName: primary,
+		primary:     storage,
+		backends:    map[string]service.StorageService{primary: storage},
+	}, nil
+}
+
+func (r *storageResolver) Primary() (string, service.StorageService) {
+	return r.primaryName, r.primary
+}
+
+func (r *storageResolver) Backend(name string) (service.StorageService, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if storage, ok := r.backends[name]; ok {
+		return storage, nil
+	}
+	storage, err := NewStorageService(name, r.opts)
+	if err != nil {
+		return nil, fmt.Errorf("storage backend %q: %w", name, err)
+	}
+	r.backends[name] = storage
+	return storage, nil
+}
+
+// StorageBackends returns the names of all registered backends.
+func StorageBackends() []string {
+	storageMu.RLock()
+	defer storageMu.RUnlock()
+	names := make([]string, 0, len(storageBackends))
+	for name := range storageBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -6,12 +6,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/filehash/internal/domain/service"
-	"github.com/filehash/pkg/crypto"
 	"github.com/google/uuid"
 )
 
@@ -20,11 +20,42 @@ const (
 	excelDir     = "excel"
 )
 
+// newEncryptedPath returns the storage path for a new encrypted blob. All
+// backends share this layout so stored paths stay valid across backends.
+func newEncryptedPath(originalName string, now time.Time) string {
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if ext == "" {
+		ext = ".bin"
+	}
+	return path.Join(encryptedDir, now.Format("2006"), now.Format("01"), now.Format("02"),
+		fmt.Sprintf("%s%s.enc", uuid.NewString(), ext))
+}
+
+// newExcelPath returns the storage path for a new Excel export.
+func newExcelPath(now time.Time) string {
+	return path.Join(excelDir, now.Format("2006"), now.Format("01"), now.Format("02"),
+		fmt.Sprintf("excel_%d.xlsx", now.UnixNano()))
+}
+
+// cleanStoragePath validates a stored path for backends that address blobs
+// by key rather than by file.
+func cleanStoragePath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("path cannot be empty")
+	}
+	clean := path.Clean("/" + p)[1:]
+	if clean == "" || clean != p {
+		return "", errors.New("invalid path traversal attempt")
+	}
+	return clean, nil
+}
+
 type storageService struct {
 	baseDir string
 }
 
-func NewStorageService(baseDir string) (service.StorageService, error) {
+// NewLocalStorageService stores blobs as files under baseDir.
+func NewLocalStorageService(baseDir string) (service.StorageService, error) {
 	if baseDir == "" {
 		return nil, errors.New("baseDir is required")
 	}
@@ -33,79 +64,45 @@ func NewStorageService(baseDir string) (service.StorageService, error) {
 
 var _ service.StorageService = (*storageService)(nil)
 
-func (s *storageService) SaveEncrypted(ctx context.Context, originalName string, nonce, data []byte) (string, error) {
+func (s *storageService) SaveEncrypted(ctx context.Context, originalName string, reader io.Reader) (string, error) {
 	select {
 	case <-ctx.Done():
 		return "", ctx.Err()
 	default:
 	}
 
-	if len(nonce) == 0 {
-		return "", errors.New("nonce cannot be empty")
-	}
-	if len(data) == 0 {
-		return "", errors.New("ciphertext cannot be empty")
-	}
-
-	now := time.Now().UTC()
-	ext := strings.ToLower(filepath.Ext(originalName))
-	if ext == "" {
-		ext = ".bin"
+	if reader == nil {
+		return "", errors.New("reader cannot be nil")
 	}
 
-	dir := filepath.Join(s.baseDir, encryptedDir, now.Format("2006"), now.Format("01"), now.Format("02"))
-	if err := os.MkdirAll(dir, 0o750); err != nil {
+	relPath := newEncryptedPath(originalName, time.Now().UTC())
+	fullPath := filepath.Join(s.baseDir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o750); err != nil {
 		return "", fmt.Errorf("mkdir: %w", err)
 	}
-	filename := fmt.Sprintf("%s%s.enc", uuid.NewString(), ext)
-	fullPath := filepath.Join(dir, filename)
 
-	file, err := os.OpenFile(fullPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
-	if err != nil {
-		return "", fmt.Errorf("open file: %w", err)
-	}
-	defer file.Close()
-
-	if _, err := file.Write(nonce); err != nil {
-		return "", fmt.Errorf("write nonce: %w", err)
-	}
-	if _, err := file.Write(data); err != nil {
+	if err := writeFile(fullPath, reader); err != nil {
 		return "", fmt.Errorf("write ciphertext: %w", err)
 	}
-
-	relPath, err := filepath.Rel(s.baseDir, fullPath)
-	if err != nil {
-		return "", fmt.Errorf("relative path: %w", err)
-	}
-	return filepath.ToSlash(relPath), nil
+	return relPath, nil
 }
 
-func (s *storageService) LoadEncrypted(ctx context.Context, relativePath string) (nonce, data []byte, err error) {
+func (s *storageService) LoadEncrypted(ctx context.Context, relativePath string) (io.ReadSeekCloser, error) {
 	select {
 	case <-ctx.Done():
-		return nil, nil, ctx.Err()
+		return nil, ctx.Err()
 	default:
 	}
 
 	fullPath, err := s.safeJoin(relativePath)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	file, err := os.Open(fullPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("open: %w", err)
-	}
-	defer file.Close()
-
-	nonce = make([]byte, crypto.GCMNonceSize)
-	if _, err := io.ReadFull(file, nonce); err != nil {
-		return nil, nil, fmt.Errorf("read nonce: %w", err)
+		return nil, fmt.Errorf("open: %w", err)
 	}
-	data, err = io.ReadAll(file)
-	if err != nil {
-		return nil, nil, fmt.Errorf("read ciphertext: %w", err)
-	}
-	return nonce, data, nil
+	return file, nil
 }
 
 func (s *storageService) SaveExcel(ctx context.Context, reader io.Reader) (string, error) {
@@ -115,29 +112,16 @@ func (s *storageService) SaveExcel(ctx context.Context, reader io.Reader) (strin
 	default:
 	}
 
-	now := time.Now().UTC()
-	dir := filepath.Join(s.baseDir, excelDir, now.Format("2006"), now.Format("01"), now.Format("02"))
-	if err := os.MkdirAll(dir, 0o750); err != nil {
+	relPath := newExcelPath(time.Now().UTC())
+	fullPath := filepath.Join(s.baseDir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o750); err != nil {
 		return "", fmt.Errorf("mkdir: %w", err)
 	}
 
-	filename := fmt.Sprintf("excel_%d.xlsx", now.UnixNano())
-	fullPath := filepath.Join(dir, filename)
-	file, err := os.OpenFile(fullPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
-	if err != nil {
-		return "", fmt.Errorf("open file: %w", err)
-	}
-	defer file.Close()
-
-	if _, err := io.Copy(file, reader); err != nil {
+	if err := writeFile(fullPath, reader); err != nil {
 		return "", fmt.Errorf("write excel: %w", err)
 	}
-
-	relPath, err := filepath.Rel(s.baseDir, fullPath)
-	if err != nil {
-		return "", fmt.Errorf("relative path: %w", err)
-	}
-	return filepath.ToSlash(relPath), nil
+	return relPath, nil
 }
 
 func (s *storageService) Delete(ctx context.Context, relativePath string) error {
@@ -154,6 +138,30 @@ func (s *storageService) Delete(ctx context.Context, relativePath string) error
 	return os.Remove(fullPath)
 }
 
+func (s *storageService) Import(ctx context.Context, relativePath string, reader io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fullPath, err := s.safeJoin(relativePath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o750); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+	// Write beside the target and rename so a reader never sees a partial
+	// copy and a crashed import leaves the original untouched.
+	tmpPath := fullPath + ".import"
+	if err := writeFile(tmpPath, reader); err != nil {
+		return fmt.Errorf("write import: %w", err)
+	}
+	if err := os.Rename(tmpPath, fullPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("write import: %w", err)
+	}
+	return nil
+}
+
 func (s *storageService) safeJoin(relativePath string) (string, error) {
 	if relativePath == "" {
 		return "", errors.New("path cannot be empty")
@@ -166,3 +174,21 @@ func (s *storageService) safeJoin(relativePath string) (string, error) {
 	return full, nil
 }
 
+// writeFile streams reader into a new file at fullPath, removing the partial
+// file if the copy fails.
+func writeFile(fullPath string, reader io.Reader) error {
+	file, err := os.OpenFile(fullPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		_ = file.Close()
+		_ = os.Remove(fullPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(fullPath)
+		return fmt.Errorf("close file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/filehash/internal/domain/service"
+)
+
+// TestStorageBackendParity runs the same operations against every built-in
+// backend; S3 talks to an in-process fake that checks SigV4 signatures.
+func TestStorageBackendParity(t *testing.T) {
+	small := randomBytes(t, 100<<10)
+	// Larger than s3PartSize, so S3 goes through a multipart upload.
+	large := randomBytes(t, s3PartSize+s3PartSize/2)
+
+	backends := []struct {
+		name string
+		new  func(t *testing.T) service.StorageService
+	}{
+		{StorageBackendLocal, func(t *testing.T) service.StorageService {
+			return mustStorage(t, StorageBackendLocal, StorageOptions{BaseDir: t.TempDir()})
+		}},
+		{StorageBackendMemory, func(t *testing.T) service.StorageService {
+			return mustStorage(t, StorageBackendMemory, StorageOptions{})
+		}},
+		{StorageBackendS3, func(t *testing.T) service.StorageService {
+			return mustStorage(t, StorageBackendS3, StorageOptions{S3: newFakeS3(t).options()})
+		}},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := backend.new(t)
+
+			for _, tc := range []struct {
+				name string
+				data []byte
+			}{
+				{"empty", nil},
+				{"small", small},
+				{"multipart", large},
+			} {
+				t.Run("SaveEncrypted/"+tc.name, func(t *testing.T) {
+					p, err := storage.SaveEncrypted(ctx, "photo.PNG", bytes.NewReader(tc.data))
+					if err != nil {
+						t.Fatalf("SaveEncrypted: %v", err)
+					}
+					if !strings.HasPrefix(p, "encrypted/") || !strings.HasSuffix(p, ".png.enc") {
+						t.Errorf("path = %q, want encrypted/.../*.png.enc", p)
+					}
+					if got := readAll(t, storage, p); !bytes.Equal(got, tc.data) {
+						t.Fatalf("LoadEncrypted returned %d bytes, want %d", len(got), len(tc.data))
+					}
+					if len(tc.data) > 0 {
+						checkSeek(t, storage, p, tc.data)
+					}
+
+					if err := storage.Delete(ctx, p); err != nil {
+						t.Fatalf("Delete: %v", err)
+					}
+					if _, err := storage.LoadEncrypted(ctx, p); !errors.Is(err, fs.ErrNotExist) {
+						t.Fatalf("LoadEncrypted after Delete: err = %v, want fs.ErrNotExist", err)
+					}
+				})
+			}
+
+			t.Run("SaveExcel", func(t *testing.T) {
+				p, err := storage.SaveExcel(ctx, bytes.NewReader(small))
+				if err != nil {
+					t.Fatalf("SaveExcel: %v", err)
+				}
+				if !strings.HasPrefix(p, "excel/") || !strings.HasSuffix(p, ".xlsx") {
+					t.Errorf("path = %q, want excel/.../*.xlsx", p)
+				}
+				if got := readAll(t, storage, p); !bytes.Equal(got, small) {
+					t.Fatal("excel content differs")
+				}
+				if err := storage.Delete(ctx, p); err != nil {
+					t.Fatalf("Delete: %v", err)
+				}
+			})
+
+			t.Run("PathTraversal", func(t *testing.T) {
+				if _, err := storage.LoadEncrypted(ctx, "../outside.enc"); err == nil {
+					t.Fatal("LoadEncrypted accepted a path outside the storage root")
+				}
+				if err := storage.Delete(ctx, "encrypted/../../outside.enc"); err == nil {
+					t.Fatal("Delete accepted a path outside the storage root")
+				}
+			})
+		})
+	}
+}
+
+func TestS3StorageRejectedSignature(t *testing.T) {
+	fake := newFakeS3(t)
+	opts := fake.options()
+	opts.SecretAccessKey = "wrong"
+	storage := mustStorage(t, StorageBackendS3, StorageOptions{S3: opts})
+
+	_, err := storage.SaveEncrypted(context.Background(), "a.png", strings.NewReader("data"))
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("SaveEncrypted with a wrong secret: err = %v, want SignatureDoesNotMatch", err)
+	}
+	if fake.rejected == 0 {
+		t.Fatal("fake S3 did not reject the request")
+	}
+}
+
+func TestS3StorageObjectLayout(t *testing.T) {
+	fake := newFakeS3(t)
+	storage := mustStorage(t, StorageBackendS3, StorageOptions{S3: fake.options()})
+
+	p, err := storage.SaveEncrypted(context.Background(), "a.png", strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("SaveEncrypted: %v", err)
+	}
+	// Objects keep the shared path layout under the configured prefix, so
+	// stored paths stay valid when blobs move between backends.
+	if data, ok := fake.object(p); !ok || string(data) != "data" {
+		t.Fatalf("object blobs/%s = %q, %v", p, data, ok)
+	}
+}
+
+func mustStorage(t *testing.T, name string, opts StorageOptions) service.StorageService {
+	t.Helper()
+	storage, err := NewStorageService(name, opts)
+	if err != nil {
+		t.Fatalf("NewStorageService(%s): %v", name, err)
+	}
+	return storage
+}
+
+func readAll(t *testing.T, storage service.StorageService, p string) []byte {
+	t.Helper()
+	r, err := storage.LoadEncrypted(context.Background(), p)
+	if err != nil {
+		t.Fatalf("LoadEncrypted: %v", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return data
+}
+
+// checkSeek reads a window from the middle and the tail of p, the access
+// pattern of ranged downloads.
+func checkSeek(t *testing.T, storage service.StorageService, p string, want []byte) {
+	t.Helper()
+	r, err := storage.LoadEncrypted(context.Background(), p)
+	if err != nil {
+		t.Fatalf("LoadEncrypted: %v", err)
+	}
+	defer r.Close()
+
+	mid := int64(len(want) / 2)
+	if _, err := r.Seek(mid, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	window := make([]byte, min(4096, len(want)-int(mid)))
+	if _, err := io.ReadFull(r, window); err != nil {
+		t.Fatalf("read after Seek: %v", err)
+	}
+	if !bytes.Equal(window, want[mid:mid+int64(len(window))]) {
+		t.Fatal("content after Seek differs")
+	}
+
+	if _, err := r.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatalf("Seek from end: %v", err)
+	}
+	tail, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read tail: %v", err)
+	}
+	if !bytes.Equal(tail, want[len(want)-10:]) {
+		t.Fatal("tail differs")
+	}
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
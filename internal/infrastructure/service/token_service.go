@@ -9,23 +9,24 @@ import (
 	"github.com/filehash/internal/domain/service"
 	"github.com/filehash/pkg/crypto"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type tokenService struct {
-	secret []byte
-	ttl    time.Duration
+	keys *SigningKeyring
+	ttl  time.Duration
 }
 
-func NewTokenService(secret string, ttl time.Duration) (service.TokenService, error) {
-	if secret == "" {
-		return nil, errors.New("jwt secret required")
+func NewTokenService(keys *SigningKeyring, ttl time.Duration) (service.TokenService, error) {
+	if keys == nil {
+		return nil, errors.New("signing keyring required")
 	}
 	if ttl <= 0 {
 		return nil, errors.New("ttl must be positive")
 	}
 	return &tokenService{
-		secret: []byte(secret),
-		ttl:    ttl,
+		keys: keys,
+		ttl:  ttl,
 	}, nil
 }
 
@@ -36,48 +37,73 @@ type jwtClaims struct {
 	jwt.RegisteredClaims
 }
 
-func (t *tokenService) Generate(fileID string, aesKey []byte, userID *string) (string, error) {
+func (t *tokenService) Generate(fileID string, userID *string) (string, error) {
 	if fileID == "" {
 		return "", errors.New("fileID is required")
 	}
-	if len(aesKey) != crypto.AESKeySize {
-		return "", errors.New("aes key must be 32 bytes")
-	}
 
 	now := time.Now().UTC()
 	claims := jwtClaims{
 		FileTokenClaims: service.FileTokenClaims{
 			FileID: fileID,
-			Key:    base64.StdEncoding.EncodeToString(aesKey),
 			UserID: userID,
 		},
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Audience:  jwt.ClaimStrings{fileTokenAudience},
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(t.ttl)),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString(t.secret)
-	if err != nil {
-		return "", fmt.Errorf("sign token: %w", err)
-	}
-	return signed, nil
+	return t.keys.sign(claims)
 }
 
 func (t *tokenService) Validate(tokenStr string) (*service.FileTokenClaims, error) {
-	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
-	token, err := parser.ParseWithClaims(tokenStr, &jwtClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return t.secret, nil
-	})
+	token, err := t.keys.parse(tokenStr, &jwtClaims{}, fileTokenAudience)
 	if err != nil {
 		return nil, fmt.Errorf("parse token: %w", err)
 	}
 
 	claims, ok := token.Claims.(*jwtClaims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || claims.RegisteredClaims.ExpiresAt == nil {
 		return nil, errors.New("invalid token claims")
 	}
+	claims.FileTokenClaims.TokenID = claims.RegisteredClaims.ID
+	claims.FileTokenClaims.ExpiresAt = claims.RegisteredClaims.ExpiresAt.Time
 	return &claims.FileTokenClaims, nil
 }
 
+func (t *tokenService) PublicKeys() []service.JWK {
+	return t.keys.PublicKeys()
+}
+
+// legacyTokenClaims are the claims of file tokens issued before data keys
+// were stored server-side; those tokens carried the key of the file.
+type legacyTokenClaims struct {
+	FileID string `json:"file_id"`
+	Key    string `json:"key"`
+	jwt.RegisteredClaims
+}
+
+// ParseLegacyFileToken returns the file ID and data key carried by a file
+// token from before keys were stored server-side. Neither signature nor
+// expiry is checked: the HS256 secret that signed such tokens is no longer
+// configured, so the caller must prove the key by decrypting the file.
+func ParseLegacyFileToken(tokenStr string) (string, []byte, error) {
+	var claims legacyTokenClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenStr, &claims); err != nil {
+		return "", nil, fmt.Errorf("parse token: %w", err)
+	}
+	if claims.FileID == "" || claims.Key == "" {
+		return "", nil, errors.New("not a legacy file token")
+	}
+	key, err := base64.StdEncoding.DecodeString(claims.Key)
+	if err != nil {
+		return "", nil, fmt.Errorf("decode key: %w", err)
+	}
+	if len(key) != crypto.AESKeySize {
+		return "", nil, errors.New("invalid key size")
+	}
+	return claims.FileID, key, nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseLegacyFileToken(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	// legacy signs claims the way file tokens were issued before keys were
+	// stored server-side, with a secret this service never sees.
+	legacy := func(claims jwt.MapClaims) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("old jwt secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	// Expired tokens still carry a usable key.
+	fileID, got, err := ParseLegacyFileToken(legacy(jwt.MapClaims{
+		"file_id": "file-1",
+		"key":     base64.StdEncoding.EncodeToString(key),
+		"exp":     1700000000,
+	}))
+	if err != nil || fileID != "file-1" || !bytes.Equal(got, key) {
+		t.Fatalf("ParseLegacyFileToken = %q, %x, %v; want file-1 and the key", fileID, got, err)
+	}
+
+	for _, tt := range []struct {
+		name, token, want string
+	}{
+		{"not a jwt", "not-a-token", "parse token"},
+		{"no key", legacy(jwt.MapClaims{"file_id": "file-1"}), "not a legacy file token"},
+		{"key not base64", legacy(jwt.MapClaims{"file_id": "file-1", "key": "%%%"}), "decode key"},
+		{"short key", legacy(jwt.MapClaims{"file_id": "file-1", "key": base64.StdEncoding.EncodeToString(key[:16])}), "invalid key size"},
+	} {
+		if _, _, err := ParseLegacyFileToken(tt.token); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
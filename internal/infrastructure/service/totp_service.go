@@ -0,0 +1,92 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/filehash/internal/domain/service"
+)
+
+// Codes use the parameters every authenticator app supports: HMAC-SHA1,
+// six digits and 30-second steps.
+const (
+	totpPeriod      = 30
+	totpDigits      = 6
+	totpSkew        = 1
+	totpSecretBytes = 32
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type totpService struct {
+	issuer string
+}
+
+// NewTOTPService returns a TOTP service whose provisioning URIs name issuer.
+func NewTOTPService(issuer string) service.TOTPService {
+	return &totpService{issuer: issuer}
+}
+
+var _ service.TOTPService = (*totpService)(nil)
+
+func (t *totpService) GenerateSecret() ([]byte, error) {
+	secret := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate totp secret: %w", err)
+	}
+	return secret, nil
+}
+
+func (t *totpService) EncodeSecret(secret []byte) string {
+	return totpEncoding.EncodeToString(secret)
+}
+
+func (t *totpService) ProvisioningURI(secret []byte, account string) string {
+	query := url.Values{}
+	query.Set("secret", t.EncodeSecret(secret))
+	query.Set("issuer", t.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(totpPeriod))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + t.issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+func (t *totpService) Verify(secret []byte, code string, now time.Time) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// hotp computes the RFC 4226 code of secret for counter.
+func hotp(secret []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
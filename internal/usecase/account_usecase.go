@@ -0,0 +1,249 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/internal/domain/service"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	passwordResetTTL = 30 * time.Minute
+	emailVerifyTTL   = 24 * time.Hour
+	// mailSendTimeout bounds a delivery that runs after the request that
+	// triggered it has returned.
+	mailSendTimeout = time.Minute
+)
+
+// AccountUseCase runs the flows that prove control of an email address:
+// password reset and address verification. Both send a signed, expiring
+// token by mail that can be used once.
+type AccountUseCase struct {
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	revokedRepo repository.RevokedTokenRepository
+	authSvc     service.AuthService
+	mailer      service.Mailer
+	publicURL   string
+	log         *zap.Logger
+}
+
+func NewAccountUseCase(
+	userRepo repository.UserRepository,
+	sessionRepo repository.SessionRepository,
+	revokedRepo repository.RevokedTokenRepository,
+	authSvc service.AuthService,
+	mailer service.Mailer,
+	publicURL string,
+	log *zap.Logger,
+) *AccountUseCase {
+	return &AccountUseCase{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		revokedRepo: revokedRepo,
+		authSvc:     authSvc,
+		mailer:      mailer,
+		publicURL:   strings.TrimRight(publicURL, "/"),
+		log:         log,
+	}
+}
+
+// RequestPasswordReset mails a reset token if email belongs to a user. It
+// succeeds either way, and mail goes out in the background, so the answer
+// does not reveal whether the account exists.
+func (uc *AccountUseCase) RequestPasswordReset(ctx context.Context, email string) error {
+	email = strings.TrimSpace(strings.ToLower(email))
+	if email == "" {
+		return fmt.Errorf("email is required")
+	}
+
+	user, err := uc.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil
+		}
+		return fmt.Errorf("find user: %w", err)
+	}
+
+	token, err := uc.authSvc.GenerateActionToken(service.ActionPasswordReset, user.ID, passwordBinding(user), passwordResetTTL)
+	if err != nil {
+		return fmt.Errorf("generate token: %w", err)
+	}
+	uc.send(user, service.MailMessage{
+		To:      user.Email,
+		Subject: "Reset your FileHash password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your FileHash account.\n\n"+
+			"To choose a new password, send this token with the new password to %s/auth/password/reset:\n\n%s\n\n"+
+			"The token works once and expires in %d minutes. If you did not ask for this, ignore this email.\n",
+			uc.publicURL, token, int(passwordResetTTL.Minutes())),
+	})
+	return nil
+}
+
+type ResetPasswordRequest struct {
+	Token    string
+	Password string
+}
+
+// ResetPassword sets a new password with a reset token and ends every
+// session of the user. The token also proves the address, so it is marked
+// verified.
+func (uc *AccountUseCase) ResetPassword(ctx context.Context, req ResetPasswordRequest) error {
+	if req.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if len(req.Password) < 8 {
+		return fmt.Errorf("password must be at least 8 characters")
+	}
+
+	claims, err := uc.authSvc.ValidateActionToken(service.ActionPasswordReset, req.Token)
+	if err != nil {
+		return fmt.Errorf("invalid token")
+	}
+	user, err := uc.userRepo.FindByID(ctx, claims.UserID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return fmt.Errorf("invalid token")
+		}
+		return fmt.Errorf("find user: %w", err)
+	}
+	// A changed password voids every reset token issued before.
+	if claims.Binding != passwordBinding(user) {
+		return fmt.Errorf("invalid token")
+	}
+	if err := uc.consume(ctx, claims); err != nil {
+		return err
+	}
+
+	hashedPassword, err := uc.authSvc.HashPassword(req.Password)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	if err := uc.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	if err := uc.sessionRepo.RevokeUser(ctx, user.ID); err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	if err := uc.userRepo.MarkEmailVerified(ctx, user.ID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("mark email verified: %w", err)
+	}
+	uc.log.Info("password reset", zap.String("user_id", user.ID))
+	return nil
+}
+
+// SendVerification mails an address verification token to the user.
+func (uc *AccountUseCase) SendVerification(ctx context.Context, userID string) error {
+	user, err := uc.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("find user: %w", err)
+	}
+	if user.EmailVerifiedAt != nil {
+		return fmt.Errorf("email already verified")
+	}
+	return uc.sendVerification(user)
+}
+
+func (uc *AccountUseCase) sendVerification(user *entity.User) error {
+	token, err := uc.authSvc.GenerateActionToken(service.ActionVerifyEmail, user.ID, user.Email, emailVerifyTTL)
+	if err != nil {
+		return fmt.Errorf("generate token: %w", err)
+	}
+	uc.send(user, service.MailMessage{
+		To:      user.Email,
+		Subject: "Confirm your FileHash email address",
+		Body: fmt.Sprintf("Open this link to confirm that this address belongs to your FileHash account:\n\n"+
+			"%s/auth/verify-email?token=%s\n\n"+
+			"The link works once and expires in %d hours.\n",
+			uc.publicURL, token, int(emailVerifyTTL.Hours())),
+	})
+	return nil
+}
+
+// sendAccountExists tells the owner of an address that someone tried to
+// register it again.
+func (uc *AccountUseCase) sendAccountExists(user *entity.User) {
+	uc.send(user, service.MailMessage{
+		To:      user.Email,
+		Subject: "Your FileHash account",
+		Body: "Someone tried to create a FileHash account with this address, which already has one.\n\n" +
+			"If it was you, sign in instead, or reset your password with " + uc.publicURL + "/auth/password/forgot.\n" +
+			"If it was not, you can ignore this email.\n",
+	})
+}
+
+// VerifyEmail marks the address in a verification token as verified.
+func (uc *AccountUseCase) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return fmt.Errorf("token is required")
+	}
+	claims, err := uc.authSvc.ValidateActionToken(service.ActionVerifyEmail, token)
+	if err != nil {
+		return fmt.Errorf("invalid token")
+	}
+	user, err := uc.userRepo.FindByID(ctx, claims.UserID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return fmt.Errorf("invalid token")
+		}
+		return fmt.Errorf("find user: %w", err)
+	}
+	if claims.Binding != user.Email {
+		return fmt.Errorf("invalid token")
+	}
+	if err := uc.consume(ctx, claims); err != nil {
+		return err
+	}
+	if err := uc.userRepo.MarkEmailVerified(ctx, user.ID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("mark email verified: %w", err)
+	}
+	return nil
+}
+
+// EmailVerified reports whether the user has verified their address.
+func (uc *AccountUseCase) EmailVerified(ctx context.Context, userID string) (bool, error) {
+	user, err := uc.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("find user: %w", err)
+	}
+	return user.EmailVerifiedAt != nil, nil
+}
+
+// consume puts the token on the denylist, failing if it already is. The
+// insert itself decides, so of concurrent requests only one succeeds.
+func (uc *AccountUseCase) consume(ctx context.Context, claims *service.ActionTokenClaims) error {
+	added, err := uc.revokedRepo.Revoke(ctx, claims.TokenID, claims.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+	if !added {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
+
+// send delivers msg in the background; failures are logged.
+func (uc *AccountUseCase) send(user *entity.User, msg service.MailMessage) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := uc.mailer.Send(ctx, msg); err != nil {
+			uc.log.Warn("send mail failed", zap.String("user_id", user.ID), zap.String("subject", msg.Subject), zap.Error(err))
+		}
+	}()
+}
+
+// passwordBinding ties reset tokens to the current password hash without
+// putting the hash in the token.
+func passwordBinding(user *entity.User) string {
+	sum := sha256.Sum256([]byte(user.Password))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,264 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filehash/internal/domain/service"
+)
+
+func TestPasswordResetToken(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+
+	if err := env.account.RequestPasswordReset(ctx, " Alice@Example.com "); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	msg := env.mailer.next(t)
+	if msg.To != "alice@example.com" || !strings.Contains(msg.Body, "https://files.example/auth/password/reset") {
+		t.Fatalf("reset mail = %+v", msg)
+	}
+	token := mailToken(t, msg, "")
+
+	if err := env.account.ResetPassword(ctx, ResetPasswordRequest{Token: token, Password: "a new password"}); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	updated, err := env.auth.userRepo.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.authSvc.ComparePassword(updated.Password, "a new password") != nil || updated.EmailVerifiedAt == nil {
+		t.Fatal("password was not changed or the address not marked verified")
+	}
+
+	// Used once; a second use fails even though the token is unexpired.
+	err = env.account.ResetPassword(ctx, ResetPasswordRequest{Token: token, Password: "another password"})
+	if err == nil || err.Error() != "invalid token" {
+		t.Fatalf("reused reset token: err = %v, want invalid token", err)
+	}
+}
+
+func TestPasswordResetTokenBoundToPassword(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	registerUser(t, env, "alice@example.com")
+
+	for range 2 {
+		if err := env.account.RequestPasswordReset(ctx, "alice@example.com"); err != nil {
+			t.Fatalf("RequestPasswordReset: %v", err)
+		}
+	}
+	first, second := mailToken(t, env.mailer.next(t), ""), mailToken(t, env.mailer.next(t), "")
+
+	if err := env.account.ResetPassword(ctx, ResetPasswordRequest{Token: first, Password: "a new password"}); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	// The password changed, so the other outstanding token is void too.
+	err := env.account.ResetPassword(ctx, ResetPasswordRequest{Token: second, Password: "another password"})
+	if err == nil || err.Error() != "invalid token" {
+		t.Fatalf("token issued before the change: err = %v, want invalid token", err)
+	}
+}
+
+func TestPasswordBinding(t *testing.T) {
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+	binding := passwordBinding(user)
+
+	if len(binding) != 32 || strings.Contains(binding, user.Password) {
+		t.Fatalf("binding = %q", binding)
+	}
+	if passwordBinding(user) != binding {
+		t.Fatal("binding is not stable")
+	}
+	user.Password += "x"
+	if passwordBinding(user) == binding {
+		t.Fatal("binding did not change with the password hash")
+	}
+}
+
+func TestEmailVerificationToken(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+
+	if err := env.account.SendVerification(ctx, user.ID); err != nil {
+		t.Fatalf("SendVerification: %v", err)
+	}
+	token := mailToken(t, env.mailer.next(t), "https://files.example/auth/verify-email?token=")
+
+	if err := env.account.VerifyEmail(ctx, token); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if verified, err := env.account.EmailVerified(ctx, user.ID); err != nil || !verified {
+		t.Fatalf("EmailVerified = %v, %v", verified, err)
+	}
+	if err := env.account.VerifyEmail(ctx, token); err == nil || err.Error() != "invalid token" {
+		t.Fatalf("reused verification token: err = %v, want invalid token", err)
+	}
+	if err := env.account.SendVerification(ctx, user.ID); err == nil || err.Error() != "email already verified" {
+		t.Fatalf("SendVerification: err = %v, want email already verified", err)
+	}
+}
+
+func TestAccountTokensRejected(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+
+	token := func(purpose, binding string, ttl time.Duration) string {
+		t.Helper()
+		tok, err := env.authSvc.GenerateActionToken(purpose, user.ID, binding, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	reset := func(tok string) error {
+		return env.account.ResetPassword(ctx, ResetPasswordRequest{Token: tok, Password: "a new password"})
+	}
+
+	tests := []struct {
+		name string
+		use  func() error
+	}{
+		{"expired reset token", func() error {
+			return reset(token(service.ActionPasswordReset, passwordBinding(user), -time.Hour))
+		}},
+		{"expired verification token", func() error {
+			return env.account.VerifyEmail(ctx, token(service.ActionVerifyEmail, user.Email, -time.Hour))
+		}},
+		{"verification token used for a reset", func() error {
+			return reset(token(service.ActionVerifyEmail, passwordBinding(user), time.Hour))
+		}},
+		{"reset token used for verification", func() error {
+			return env.account.VerifyEmail(ctx, token(service.ActionPasswordReset, user.Email, time.Hour))
+		}},
+		{"verification of a previous address", func() error {
+			return env.account.VerifyEmail(ctx, token(service.ActionVerifyEmail, "old@example.com", time.Hour))
+		}},
+		{"malformed token", func() error {
+			return reset("not-a-token")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.use(); err == nil || err.Error() != "invalid token" {
+				t.Fatalf("err = %v, want invalid token", err)
+			}
+		})
+	}
+
+	if verified, _ := env.account.EmailVerified(ctx, user.ID); verified {
+		t.Fatal("a rejected token verified the address")
+	}
+}
+
+func TestConsumeOnce(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	claims := &service.ActionTokenClaims{UserID: "u", TokenID: "token-1", ExpiresAt: time.Now().Add(time.Hour)}
+
+	if err := env.account.consume(ctx, claims); err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+	if err := env.account.consume(ctx, claims); err == nil || err.Error() != "invalid token" {
+		t.Fatalf("second consume: err = %v, want invalid token", err)
+	}
+
+	// Concurrent requests with one token: exactly one gets through.
+	claims.TokenID = "token-2"
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() { errs <- env.account.consume(ctx, claims) }()
+	}
+	consumed := 0
+	for range cap(errs) {
+		switch err := <-errs; {
+		case err == nil:
+			consumed++
+		case err.Error() != "invalid token":
+			t.Fatalf("concurrent consume: %v", err)
+		}
+	}
+	if consumed != 1 {
+		t.Fatalf("token consumed %d times concurrently, want once", consumed)
+	}
+}
+
+func TestPasswordResetConcurrent(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+	if err := env.account.RequestPasswordReset(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	token := mailToken(t, env.mailer.next(t), "")
+
+	type result struct {
+		password string
+		err      error
+	}
+	results := make(chan result, 8)
+	for i := range cap(results) {
+		password := fmt.Sprintf("new password %d", i)
+		go func() {
+			results <- result{password, env.account.ResetPassword(ctx, ResetPasswordRequest{Token: token, Password: password})}
+		}()
+	}
+	var winner string
+	for range cap(results) {
+		r := <-results
+		switch {
+		case r.err == nil && winner != "":
+			t.Fatalf("reset token used twice: %q and %q", winner, r.password)
+		case r.err == nil:
+			winner = r.password
+		case r.err.Error() != "invalid token":
+			t.Fatalf("ResetPassword: %v", r.err)
+		}
+	}
+	if winner == "" {
+		t.Fatal("no reset succeeded")
+	}
+	updated, err := env.auth.userRepo.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.authSvc.ComparePassword(updated.Password, winner) != nil {
+		t.Fatal("stored password is not the one of the successful reset")
+	}
+}
+
+func TestPasswordResetUnknownEmail(t *testing.T) {
+	env := newTestEnv(t)
+	if err := env.account.RequestPasswordReset(context.Background(), "nobody@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	select {
+	case msg := <-env.mailer.sent:
+		t.Fatalf("mail sent to an unknown address: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// mailToken returns the token in an account mail: the text after prefix on
+// its line, or the first line that looks like a JWT.
+func mailToken(t *testing.T, msg service.MailMessage, prefix string) string {
+	t.Helper()
+	for _, line := range strings.Split(msg.Body, "\n") {
+		if prefix != "" {
+			if tok, ok := strings.CutPrefix(line, prefix); ok {
+				return tok
+			}
+		} else if strings.Count(line, ".") == 2 && !strings.Contains(line, " ") {
+			return line
+		}
+	}
+	t.Fatalf("no token in mail %q", msg.Body)
+	return ""
+}
@@ -0,0 +1,316 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// AdminUseCase carries out operational tasks across users. Every method
+// takes the acting user and checks their permission with the policy first.
+type AdminUseCase struct {
+	userRepo    repository.UserRepository
+	fileRepo    repository.FileRepository
+	blobRepo    repository.BlobRepository
+	sessionRepo repository.SessionRepository
+	policy      *Policy
+	files       *FileUseCase
+	uploads     *UploadUseCase
+	guard       *LoginGuard
+	log         *zap.Logger
+}
+
+func NewAdminUseCase(
+	userRepo repository.UserRepository,
+	fileRepo repository.FileRepository,
+	blobRepo repository.BlobRepository,
+	sessionRepo repository.SessionRepository,
+	policy *Policy,
+	files *FileUseCase,
+	uploads *UploadUseCase,
+	guard *LoginGuard,
+	log *zap.Logger,
+) *AdminUseCase {
+	return &AdminUseCase{
+		userRepo:    userRepo,
+		fileRepo:    fileRepo,
+		blobRepo:    blobRepo,
+		sessionRepo: sessionRepo,
+		policy:      policy,
+		files:       files,
+		uploads:     uploads,
+		guard:       guard,
+		log:         log,
+	}
+}
+
+type ListUsersRequest struct {
+	EmailPrefix string
+	Offset      int
+	Limit       int
+}
+
+type ListUsersResponse struct {
+	Users []entity.User
+	Total int64
+}
+
+func (uc *AdminUseCase) ListUsers(ctx context.Context, actorID string, req ListUsersRequest) (*ListUsersResponse, error) {
+	if _, err := uc.policy.Authorize(ctx, actorID, entity.PermManageUsers); err != nil {
+		return nil, err
+	}
+	if req.Offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative")
+	}
+	limit := req.Limit
+	switch {
+	case limit <= 0:
+		limit = defaultUserPageSize
+	case limit > maxUserPageSize:
+		limit = maxUserPageSize
+	}
+
+	users, total, err := uc.userRepo.List(ctx, req.EmailPrefix, req.Offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return &ListUsersResponse{Users: users, Total: total}, nil
+}
+
+func (uc *AdminUseCase) GetUser(ctx context.Context, actorID, userID string) (*entity.User, error) {
+	if _, err := uc.policy.Authorize(ctx, actorID, entity.PermManageUsers); err != nil {
+		return nil, err
+	}
+	return uc.findUser(ctx, userID)
+}
+
+// SetRole changes the role of a user. The last enabled admin cannot lose
+// the role, so the service never ends up without one.
+func (uc *AdminUseCase) SetRole(ctx context.Context, actorID, userID, role string) (*entity.User, error) {
+	if _, err := uc.policy.Authorize(ctx, actorID, entity.PermManageUsers); err != nil {
+		return nil, err
+	}
+	if !entity.ValidRole(role) {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+	user, err := uc.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == role {
+		return user, nil
+	}
+	if user.Role == entity.RoleAdmin && user.DisabledAt == nil {
+		if err := uc.keepAnAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := uc.userRepo.UpdateRole(ctx, user.ID, role); err != nil {
+		return nil, fmt.Errorf("update role: %w", err)
+	}
+	uc.log.Info("user role changed",
+		zap.String("actor_id", actorID),
+		zap.String("user_id", user.ID),
+		zap.String("from", user.Role),
+		zap.String("to", role))
+	user.Role = role
+	return user, nil
+}
+
+// DisableUser locks a user out: their sessions end at once, and neither
+// their tokens nor their API keys are accepted until they are enabled
+// again.
+func (uc *AdminUseCase) DisableUser(ctx context.Context, actorID, userID string) (*entity.User, error) {
+	if _, err := uc.policy.Authorize(ctx, actorID, entity.PermManageUsers); err != nil {
+		return nil, err
+	}
+	if userID == actorID {
+		return nil, fmt.Errorf("cannot disable yourself")
+	}
+	user, err := uc.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt == nil {
+		now := time.Now().UTC()
+		if err := uc.userRepo.SetDisabled(ctx, user.ID, &now); err != nil {
+			return nil, fmt.Errorf("disable user: %w", err)
+		}
+		user.DisabledAt = &now
+		uc.log.Info("user disabled", zap.String("actor_id", actorID), zap.String("user_id", user.ID))
+	}
+	if err := uc.sessionRepo.RevokeUser(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("revoke sessions: %w", err)
+	}
+	return user, nil
+}
+
+func (uc *AdminUseCase) EnableUser(ctx context.Context, actorID, userID string) (*entity.User, error) {
+	if _, err := uc.policy.Authorize(ctx, actorID, entity.PermManageUsers); err != nil {
+		return nil, err
+	}
+	user, err := uc.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		if err := uc.userRepo.SetDisabled(ctx, user.ID, nil); err != nil {
+			return nil, fmt.Errorf("enable user: %w", err)
+		}
+		user.DisabledAt = nil
+		uc.log.Info("user enabled", zap.String("actor_id", actorID), zap.String("user_id", user.ID))
+	}
+	return user, nil
+}
+
+type DeleteUserResponse struct {
+	Files   int
+	Uploads int
+}
+
+// DeleteUser removes a user for good, with their files, unfinished uploads
+// and credentials. Files are deleted before the account, so a failure
+// midway can be resumed by deleting again.
+func (uc *AdminUseCase) DeleteUser(ctx context.Context, actorID, userID string) (*DeleteUserResponse, error) {
+	if _, err := uc.policy.Authorize(ctx, actorID, entity.PermManageUsers); err != nil {
+		return nil, err
+	}
+	if userID == actorID {
+		return nil, fmt.Errorf("cannot delete yourself")
+	}
+	user, err := uc.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Disable first, so the user cannot upload while their files go.
+	if user.DisabledAt == nil {
+		now := time.Now().UTC()
+		if err := uc.userRepo.SetDisabled(ctx, user.ID, &now); err != nil {
+			return nil, fmt.Errorf("disable user: %w", err)
+		}
+	}
+
+	resp := &DeleteUserResponse{}
+	if resp.Uploads, err = uc.uploads.DiscardUserUploads(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("discard uploads: %w", err)
+	}
+	if resp.Files, err = uc.files.DeleteUserFiles(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("delete files: %w", err)
+	}
+	if err := uc.userRepo.Delete(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("delete user: %w", err)
+	}
+	uc.log.Info("user deleted",
+		zap.String("actor_id", actorID),
+		zap.String("user_id", user.ID),
+		zap.Int("files", resp.Files),
+		zap.Int("uploads", resp.Uploads))
+	return resp, nil
+}
+
+func (uc *AdminUseCase) ListUserFiles(ctx context.Context, actorID, userID string) ([]entity.FileAsset, error) {
+	if _, err := uc.policy.Authorize(ctx, actorID, entity.PermReadAllFiles); err != nil {
+		return nil, err
+	}
+	if _, err := uc.findUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	assets, err := uc.fileRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("find files: %w", err)
+	}
+	return assets, nil
+}
+
+// UnlockUser lifts a login lockout of the user, reporting whether there
+// was anything to lift.
+func (uc *AdminUseCase) UnlockUser(ctx context.Context, actorID, userID string) (bool, error) {
+	if _, err := uc.policy.Authorize(ctx, actorID, entity.PermManageUsers); err != nil {
+		return false, err
+	}
+	user, err := uc.findUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return uc.guard.Unlock(ctx, user.Email)
+}
+
+type SystemStats struct {
+	Users repository.UserStats
+	Files repository.FileStats
+	// Dedup covers the shared blobs of deduplicated files.
+	Dedup repository.StorageUsage
+	// Storage is what each backend holds: files stored on their own plus
+	// shared blobs.
+	Storage map[string]repository.StorageUsage
+}
+
+func (uc *AdminUseCase) Stats(ctx context.Context, actorID string) (*SystemStats, error) {
+	if _, err := uc.policy.Authorize(ctx, actorID, entity.PermViewStats); err != nil {
+		return nil, err
+	}
+	users, err := uc.userRepo.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("user stats: %w", err)
+	}
+	files, err := uc.fileRepo.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("file stats: %w", err)
+	}
+	blobs, err := uc.blobRepo.UsageByBackend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("blob stats: %w", err)
+	}
+
+	stats := &SystemStats{
+		Users:   *users,
+		Files:   *files,
+		Storage: make(map[string]repository.StorageUsage),
+	}
+	for backend, usage := range files.ByBackend {
+		stats.Storage[backend] = usage
+	}
+	for backend, usage := range blobs {
+		stats.Dedup.Count += usage.Count
+		stats.Dedup.Bytes += usage.Bytes
+		total := stats.Storage[backend]
+		total.Count += usage.Count
+		total.Bytes += usage.Bytes
+		stats.Storage[backend] = total
+	}
+	return stats, nil
+}
+
+func (uc *AdminUseCase) findUser(ctx context.Context, userID string) (*entity.User, error) {
+	user, err := uc.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	return user, nil
+}
+
+// keepAnAdmin fails when at most one enabled admin is left.
+func (uc *AdminUseCase) keepAnAdmin(ctx context.Context) error {
+	admins, err := uc.userRepo.CountEnabled(ctx, entity.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("count admins: %w", err)
+	}
+	if admins <= 1 {
+		return fmt.Errorf("cannot remove the last admin")
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// API keys look like fh_<prefix>_<secret>: the hex prefix finds the stored
+// key, the base64url secret carries the entropy.
+const (
+	apiKeyMarker      = "fh_"
+	apiKeyPrefixBytes = 6
+	apiKeySecretBytes = 32
+	maxAPIKeyName     = 100
+	// apiKeyTouchInterval limits how often last_used_at is written for a
+	// key that is used continuously.
+	apiKeyTouchInterval = time.Minute
+)
+
+type APIKeyUseCase struct {
+	keyRepo  repository.APIKeyRepository
+	userRepo repository.UserRepository
+	log      *zap.Logger
+}
+
+func NewAPIKeyUseCase(
+	keyRepo repository.APIKeyRepository,
+	userRepo repository.UserRepository,
+	log *zap.Logger,
+) *APIKeyUseCase {
+	return &APIKeyUseCase{
+		keyRepo:  keyRepo,
+		userRepo: userRepo,
+		log:      log,
+	}
+}
+
+// IsAPIKey reports whether token has the form of an API key rather than a
+// JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyMarker)
+}
+
+type CreateAPIKeyRequest struct {
+	UserID    string
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+type CreateAPIKeyResponse struct {
+	Key    string // shown once; only its hash is stored
+	APIKey *entity.APIKey
+}
+
+func (uc *APIKeyUseCase) CreateAPIKey(ctx context.Context, req CreateAPIKeyRequest) (*CreateAPIKeyResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if len(name) > maxAPIKeyName {
+		return nil, fmt.Errorf("name must be at most %d characters", maxAPIKeyName)
+	}
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	// Scopes are stored in canonical order without duplicates.
+	var scopes []string
+	for _, scope := range entity.APIKeyScopes {
+		if slices.Contains(req.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(entity.APIKeyScopes, scope) {
+			return nil, fmt.Errorf("invalid scope %q (must be one of %s)", scope, strings.Join(entity.APIKeyScopes, ", "))
+		}
+	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		t := req.ExpiresAt.UTC()
+		if !t.After(time.Now()) {
+			return nil, fmt.Errorf("expires_at must be in the future")
+		}
+		expiresAt = &t
+	}
+
+	prefix := make([]byte, apiKeyPrefixBytes)
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("generate api key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate api key: %w", err)
+	}
+	apiKey := &entity.APIKey{
+		UserID:    req.UserID,
+		Name:      name,
+		Prefix:    hex.EncodeToString(prefix),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	key := apiKeyMarker + apiKey.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	apiKey.SecretHash = hashAPIKey(key)
+
+	if err := uc.keyRepo.Create(ctx, apiKey); err != nil {
+		return nil, fmt.Errorf("create api key: %w", err)
+	}
+	return &CreateAPIKeyResponse{Key: key, APIKey: apiKey}, nil
+}
+
+// ListAPIKeys returns the keys of userID, optionally only those whose prefix
+// starts with prefix (with or without the fh_ marker).
+func (uc *APIKeyUseCase) ListAPIKeys(ctx context.Context, userID, prefix string) ([]entity.APIKey, error) {
+	prefix = strings.ToLower(strings.TrimPrefix(prefix, apiKeyMarker))
+	if len(prefix) > 2*apiKeyPrefixBytes || strings.Trim(prefix, "0123456789abcdef") != "" {
+		return nil, fmt.Errorf("invalid prefix")
+	}
+	keys, err := uc.keyRepo.ListByUser(ctx, userID, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (uc *APIKeyUseCase) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	revoked, err := uc.keyRepo.Revoke(ctx, id, userID)
+	if err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	if !revoked {
+		return fmt.Errorf("api key not found")
+	}
+	return nil
+}
+
+// Authenticate resolves an API key to its stored record. Errors for keys
+// that cannot be used start with "invalid token", like those of user
+// tokens.
+func (uc *APIKeyUseCase) Authenticate(ctx context.Context, key string) (*entity.APIKey, error) {
+	rest, ok := strings.CutPrefix(key, apiKeyMarker)
+	if !ok {
+		return nil, fmt.Errorf("invalid token: not an api key")
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 2*apiKeyPrefixBytes {
+		return nil, fmt.Errorf("invalid token: malformed api key")
+	}
+
+	apiKey, err := uc.keyRepo.FindByPrefix(ctx, prefix)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("invalid token: unknown api key")
+		}
+		return nil, fmt.Errorf("find api key: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(key)), []byte(apiKey.SecretHash)) != 1 {
+		return nil, fmt.Errorf("invalid token: unknown api key")
+	}
+	now := time.Now().UTC()
+	if !apiKey.Active(now) {
+		return nil, fmt.Errorf("invalid token: api key revoked or expired")
+	}
+
+	user, err := uc.userRepo.FindByID(ctx, apiKey.UserID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("invalid token: user not found")
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	if user.DisabledAt != nil {
+		return nil, fmt.Errorf("invalid token: user disabled")
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		if err := uc.keyRepo.TouchLastUsed(ctx, apiKey.ID, now); err != nil {
+			uc.log.Warn("api key last use update failed", zap.String("api_key_id", apiKey.ID), zap.Error(err))
+		}
+	}
+	return apiKey, nil
+}
+
+// hashAPIKey returns the hex SHA-256 of key; the secret part makes it too
+// long to guess, so no salt or stretching is needed.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
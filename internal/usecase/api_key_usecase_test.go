@@ -0,0 +1,119 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	infrarepo "github.com/filehash/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+func newAPIKeyUseCase(env *testEnv) *APIKeyUseCase {
+	return NewAPIKeyUseCase(infrarepo.NewAPIKeyRepository(env.db), infrarepo.NewUserRepository(env.db), zap.NewNop())
+}
+
+func TestCreateAPIKeyScopes(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	keys := newAPIKeyUseCase(env)
+	user := registerUser(t, env, "alice@example.com")
+	past := time.Now().Add(-time.Minute)
+
+	for _, tt := range []struct {
+		name      string
+		scopes    []string
+		expiresAt *time.Time
+		want      string
+	}{
+		{"no scopes", nil, nil, "at least one scope is required"},
+		{"unknown scope", []string{entity.ScopeFilesRead, "files:admin"}, nil, `invalid scope "files:admin" (must be one of files:read, files:write, excel:write)`},
+		{"past expiry", []string{entity.ScopeFilesRead}, &past, "expires_at must be in the future"},
+	} {
+		_, err := keys.CreateAPIKey(ctx, CreateAPIKeyRequest{UserID: user.ID, Scopes: tt.scopes, ExpiresAt: tt.expiresAt})
+		wantErr(t, tt.name, err, tt.want)
+	}
+
+	// Scopes are kept once each, in the order of entity.APIKeyScopes.
+	resp, err := keys.CreateAPIKey(ctx, CreateAPIKeyRequest{
+		UserID: user.ID,
+		Name:   "  backup  ",
+		Scopes: []string{entity.ScopeExcelWrite, entity.ScopeFilesRead, entity.ScopeExcelWrite},
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if got, want := resp.APIKey.ScopeList(), []string{entity.ScopeFilesRead, entity.ScopeExcelWrite}; !slices.Equal(got, want) {
+		t.Fatalf("scopes = %v, want %v", got, want)
+	}
+	if resp.APIKey.Name != "backup" || !IsAPIKey(resp.Key) || resp.APIKey.SecretHash != hashAPIKey(resp.Key) {
+		t.Fatalf("CreateAPIKey = %+v", resp.APIKey)
+	}
+	stored, err := keys.Authenticate(ctx, resp.Key)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if stored.ID != resp.APIKey.ID || stored.Scopes != resp.APIKey.Scopes {
+		t.Fatalf("Authenticate = %+v, want %+v", stored, resp.APIKey)
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	keys := newAPIKeyUseCase(env)
+	user := registerUser(t, env, "alice@example.com")
+	create := func() string {
+		t.Helper()
+		resp, err := keys.CreateAPIKey(ctx, CreateAPIKeyRequest{UserID: user.ID, Scopes: []string{entity.ScopeFilesRead}})
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		return resp.Key
+	}
+	key := create()
+	prefix, _, _ := strings.Cut(strings.TrimPrefix(key, "fh_"), "_")
+
+	for _, tt := range []struct {
+		name, key, want string
+	}{
+		{"jwt", "eyJhbGciOiJIUzI1NiJ9.e30.sig", "invalid token: not an api key"},
+		{"no secret", "fh_" + prefix, "invalid token: malformed api key"},
+		{"short prefix", "fh_abc_secret", "invalid token: malformed api key"},
+		{"unknown prefix", "fh_000000000000_secret", "invalid token: unknown api key"},
+		{"wrong secret", "fh_" + prefix + "_secret", "invalid token: unknown api key"},
+	} {
+		_, err := keys.Authenticate(ctx, tt.key)
+		wantErr(t, tt.name, err, tt.want)
+	}
+
+	stored, err := keys.Authenticate(ctx, key)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if err := keys.RevokeAPIKey(ctx, "someone-else", stored.ID); err == nil || err.Error() != "api key not found" {
+		t.Fatalf("RevokeAPIKey by another user: err = %v, want api key not found", err)
+	}
+	if err := keys.RevokeAPIKey(ctx, user.ID, stored.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	_, err = keys.Authenticate(ctx, key)
+	wantErr(t, "revoked key", err, "invalid token: api key revoked or expired")
+
+	expiring := create()
+	if err := env.db.Model(&entity.APIKey{}).Where("revoked_at IS NULL").Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, err = keys.Authenticate(ctx, expiring)
+	wantErr(t, "expired key", err, "invalid token: api key revoked or expired")
+
+	live := create()
+	if err := env.db.Model(&entity.User{}).Where("id = ?", user.ID).Update("disabled_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, err = keys.Authenticate(ctx, live)
+	wantErr(t, "key of a disabled user", err, "invalid token: user disabled")
+}
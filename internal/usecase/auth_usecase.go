@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/filehash/internal/domain/entity"
 	"github.com/filehash/internal/domain/repository"
@@ -12,21 +14,52 @@ import (
 	"go.uber.org/zap"
 )
 
+// mfaChallengeTTL is how long the second login step may take.
+const mfaChallengeTTL = 5 * time.Minute
+
+// dummyPassword is hashed once so that logins for unknown emails spend as
+// long checking a password as logins for real ones.
+const dummyPassword = "filehash-no-such-user"
+
 type AuthUseCase struct {
-	userRepo  repository.UserRepository
-	authSvc   service.AuthService
-	log       *zap.Logger
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	revokedRepo repository.RevokedTokenRepository
+	authSvc     service.AuthService
+	tokenSvc    service.TokenService
+	mfa         *MFAUseCase
+	account     *AccountUseCase
+	guard       *LoginGuard
+	refreshTTL  time.Duration
+	log         *zap.Logger
+
+	dummyOnce sync.Once
+	dummyHash string
 }
 
 func NewAuthUseCase(
 	userRepo repository.UserRepository,
+	sessionRepo repository.SessionRepository,
+	revokedRepo repository.RevokedTokenRepository,
 	authSvc service.AuthService,
+	tokenSvc service.TokenService,
+	mfa *MFAUseCase,
+	account *AccountUseCase,
+	guard *LoginGuard,
+	refreshTTL time.Duration,
 	log *zap.Logger,
 ) *AuthUseCase {
 	return &AuthUseCase{
-		userRepo: userRepo,
-		authSvc:  authSvc,
-		log:      log,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		revokedRepo: revokedRepo,
+		authSvc:     authSvc,
+		tokenSvc:    tokenSvc,
+		mfa:         mfa,
+		account:     account,
+		guard:       guard,
+		refreshTTL:  refreshTTL,
+		log:         log,
 	}
 }
 
@@ -35,34 +68,35 @@ type RegisterRequest struct {
 	Password string
 }
 
-type RegisterResponse struct {
-	UserID string
-	Token  string
-}
-
-func (uc *AuthUseCase) Register(ctx context.Context, req RegisterRequest) (*RegisterResponse, error) {
+// Register creates an account and mails a verification link. It answers
+// the same way when the email is already taken, so it cannot be used to
+// find accounts; the owner of the address is told by mail instead. The new
+// user signs in with Login.
+func (uc *AuthUseCase) Register(ctx context.Context, req RegisterRequest) error {
 	email := strings.TrimSpace(strings.ToLower(req.Email))
 	if email == "" {
-		return nil, fmt.Errorf("email is required")
+		return fmt.Errorf("email is required")
 	}
 	if !strings.Contains(email, "@") || !strings.Contains(email, ".") {
-		return nil, fmt.Errorf("invalid email format")
+		return fmt.Errorf("invalid email format")
 	}
 	if len(req.Password) < 8 {
-		return nil, fmt.Errorf("password must be at least 8 characters")
+		return fmt.Errorf("password must be at least 8 characters")
+	}
+
+	// The hash is computed either way to keep both paths equally slow.
+	hashedPassword, err := uc.authSvc.HashPassword(req.Password)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
 	}
 
-	_, err := uc.userRepo.FindByEmail(ctx, email)
+	existing, err := uc.userRepo.FindByEmail(ctx, email)
 	if err == nil {
-		return nil, fmt.Errorf("email already exists")
+		uc.account.sendAccountExists(existing)
+		return nil
 	}
 	if err != utils.ErrRecordNotFound {
-		return nil, fmt.Errorf("check email: %w", err)
-	}
-
-	hashedPassword, err := uc.authSvc.HashPassword(req.Password)
-	if err != nil {
-		return nil, fmt.Errorf("hash password: %w", err)
+		return fmt.Errorf("check email: %w", err)
 	}
 
 	user := &entity.User{
@@ -71,18 +105,18 @@ func (uc *AuthUseCase) Register(ctx context.Context, req RegisterRequest) (*Regi
 	}
 
 	if err := uc.userRepo.Create(ctx, user); err != nil {
-		return nil, fmt.Errorf("create user: %w", err)
+		// A concurrent registration may have taken the address.
+		if existing, findErr := uc.userRepo.FindByEmail(ctx, email); findErr == nil {
+			uc.account.sendAccountExists(existing)
+			return nil
+		}
+		return fmt.Errorf("create user: %w", err)
 	}
 
-	token, err := uc.authSvc.GenerateAuthToken(user.ID)
-	if err != nil {
-		return nil, fmt.Errorf("generate token: %w", err)
+	if err := uc.account.sendVerification(user); err != nil {
+		uc.log.Warn("verification mail failed", zap.String("user_id", user.ID), zap.Error(err))
 	}
-
-	return &RegisterResponse{
-		UserID: user.ID,
-		Token:  token,
-	}, nil
+	return nil
 }
 
 type LoginRequest struct {
@@ -91,8 +125,14 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	UserID string
-	Token  string
+	UserID       string
+	Token        string
+	RefreshToken string
+	// MFARequired is set instead of the tokens when the user has two-factor
+	// authentication enabled; MFAToken is then exchanged via LoginMFA.
+	MFARequired  bool
+	MFAToken     string
+	MFAExpiresIn time.Duration
 }
 
 func (uc *AuthUseCase) Login(ctx context.Context, req LoginRequest) (*LoginResponse, error) {
@@ -106,27 +146,397 @@ func (uc *AuthUseCase) Login(ctx context.Context, req LoginRequest) (*LoginRespo
 	if req.Password == "" {
 		return nil, fmt.Errorf("password is required")
 	}
+	if err := uc.guard.Check(ctx, email); err != nil {
+		return nil, err
+	}
 
 	user, err := uc.userRepo.FindByEmail(ctx, email)
 	if err != nil {
 		if err == utils.ErrRecordNotFound {
-			return nil, fmt.Errorf("invalid credentials")
+			_ = uc.authSvc.ComparePassword(uc.dummyPasswordHash(), req.Password)
+			return nil, uc.loginFailed(ctx, email, fmt.Errorf("invalid credentials"))
 		}
 		return nil, fmt.Errorf("find user: %w", err)
 	}
 
 	if err := uc.authSvc.ComparePassword(user.Password, req.Password); err != nil {
-		return nil, fmt.Errorf("invalid credentials")
+		return nil, uc.loginFailed(ctx, email, fmt.Errorf("invalid credentials"))
+	}
+	uc.upgradePasswordHash(ctx, user, req.Password)
+
+	return uc.completeLogin(ctx, user, false)
+}
+
+// completeLogin finishes a login whose first factor has been checked.
+// Disabled users are turned away. A user with two-factor authentication
+// gets an MFA challenge unless mfa says a second factor was already passed;
+// everyone else gets a session.
+func (uc *AuthUseCase) completeLogin(ctx context.Context, user *entity.User, mfa bool) (*LoginResponse, error) {
+	if user.DisabledAt != nil {
+		return nil, fmt.Errorf("account disabled")
+	}
+	if !mfa {
+		mfaEnabled, err := uc.mfa.Enabled(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if mfaEnabled {
+			mfaToken, err := uc.authSvc.GenerateMFAToken(user.ID, mfaChallengeTTL)
+			if err != nil {
+				return nil, fmt.Errorf("generate token: %w", err)
+			}
+			return &LoginResponse{
+				UserID:       user.ID,
+				MFARequired:  true,
+				MFAToken:     mfaToken,
+				MFAExpiresIn: mfaChallengeTTL,
+			}, nil
+		}
 	}
 
-	token, err := uc.authSvc.GenerateAuthToken(user.ID)
+	uc.guard.Succeeded(ctx, user.Email)
+	token, refreshToken, err := uc.startSession(ctx, user.ID, mfa)
 	if err != nil {
-		return nil, fmt.Errorf("generate token: %w", err)
+		return nil, err
 	}
 
 	return &LoginResponse{
-		UserID: user.ID,
-		Token:  token,
+		UserID:       user.ID,
+		Token:        token,
+		RefreshToken: refreshToken,
 	}, nil
 }
 
+// upgradePasswordHash re-hashes a password that just verified when its
+// stored hash uses an outdated algorithm or parameters. The swap only
+// happens if the hash was not changed meanwhile, so a concurrent password
+// reset wins; a failure just leaves the upgrade to the next login.
+func (uc *AuthUseCase) upgradePasswordHash(ctx context.Context, user *entity.User, password string) {
+	if !uc.authSvc.PasswordNeedsRehash(user.Password) {
+		return
+	}
+	hash, err := uc.authSvc.HashPassword(password)
+	if err != nil {
+		uc.log.Warn("rehash password failed", zap.String("user_id", user.ID), zap.Error(err))
+		return
+	}
+	replaced, err := uc.userRepo.ReplacePasswordHash(ctx, user.ID, user.Password, hash)
+	if err != nil {
+		uc.log.Warn("store rehashed password failed", zap.String("user_id", user.ID), zap.Error(err))
+		return
+	}
+	if replaced {
+		uc.log.Info("password hash upgraded", zap.String("user_id", user.ID))
+	}
+}
+
+type LoginMFARequest struct {
+	MFAToken string
+	Code     string // TOTP or recovery code
+}
+
+// LoginMFA completes a login that returned MFARequired. The challenge token
+// works once, whether or not the code is right, so each guess costs a
+// password check, and wrong codes count as failed logins of the account.
+func (uc *AuthUseCase) LoginMFA(ctx context.Context, req LoginMFARequest) (*LoginResponse, error) {
+	if req.MFAToken == "" {
+		return nil, fmt.Errorf("mfa token is required")
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		return nil, fmt.Errorf("code is required")
+	}
+
+	claims, err := uc.authSvc.ValidateMFAToken(req.MFAToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mfa token")
+	}
+	// Only the request whose insert denies the challenge may use it, so
+	// parallel requests cannot spend one challenge on several guesses.
+	consumed, err := uc.revokedRepo.Revoke(ctx, claims.TokenID, claims.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("revoke token: %w", err)
+	}
+	if !consumed {
+		return nil, fmt.Errorf("invalid mfa token")
+	}
+
+	user, err := uc.userRepo.FindByID(ctx, claims.UserID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("invalid mfa token")
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	if user.DisabledAt != nil {
+		return nil, fmt.Errorf("account disabled")
+	}
+	if err := uc.guard.Check(ctx, user.Email); err != nil {
+		return nil, err
+	}
+	if err := uc.mfa.CheckCode(ctx, claims.UserID, req.Code); err != nil {
+		if strings.Contains(err.Error(), "invalid code") {
+			return nil, uc.loginFailed(ctx, user.Email, err)
+		}
+		return nil, err
+	}
+	uc.guard.Succeeded(ctx, user.Email)
+
+	token, refreshToken, err := uc.startSession(ctx, claims.UserID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		UserID:       claims.UserID,
+		Token:        token,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+
+// loginFailed records a failed attempt and returns cause, or the error of
+// recording it.
+func (uc *AuthUseCase) loginFailed(ctx context.Context, email string, cause error) error {
+	if err := uc.guard.Failed(ctx, email); err != nil {
+		return err
+	}
+	return cause
+}
+
+func (uc *AuthUseCase) dummyPasswordHash() string {
+	uc.dummyOnce.Do(func() {
+		hash, err := uc.authSvc.HashPassword(dummyPassword)
+		if err != nil {
+			uc.log.Warn("hash dummy password failed", zap.Error(err))
+			return
+		}
+		uc.dummyHash = hash
+	})
+	return uc.dummyHash
+}
+
+// startSession opens a new refresh token family for userID and returns an
+// access token bound to it along with the refresh token. mfa records that
+// the login passed a second factor.
+func (uc *AuthUseCase) startSession(ctx context.Context, userID string, mfa bool) (string, string, error) {
+	refreshToken, hash, err := uc.authSvc.NewRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	session := &entity.Session{
+		UserID:    userID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().UTC().Add(uc.refreshTTL),
+		MFA:       mfa,
+	}
+	if err := uc.sessionRepo.Create(ctx, session); err != nil {
+		return "", "", fmt.Errorf("create session: %w", err)
+	}
+
+	token, err := uc.authSvc.GenerateAuthToken(userID, session.FamilyID, mfa)
+	if err != nil {
+		return "", "", fmt.Errorf("generate token: %w", err)
+	}
+	return token, refreshToken, nil
+}
+
+type RefreshResponse struct {
+	UserID       string
+	Token        string
+	RefreshToken string
+}
+
+// Refresh exchanges a refresh token for a new access token and a new
+// refresh token. The presented token is used up; presenting it again is
+// treated as theft and ends the whole session family.
+func (uc *AuthUseCase) Refresh(ctx context.Context, refreshToken string) (*RefreshResponse, error) {
+	if refreshToken == "" {
+		return nil, fmt.Errorf("refresh token is required")
+	}
+
+	session, err := uc.sessionRepo.FindByTokenHash(ctx, uc.authSvc.HashRefreshToken(refreshToken))
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("invalid refresh token")
+		}
+		return nil, fmt.Errorf("find session: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+	if session.RotatedAt != nil {
+		return nil, uc.reuseDetected(ctx, session)
+	}
+
+	next, hash, err := uc.authSvc.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := uc.sessionRepo.Rotate(ctx, session.ID, &entity.Session{
+		UserID:    session.UserID,
+		FamilyID:  session.FamilyID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(uc.refreshTTL),
+		MFA:       session.MFA,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rotate session: %w", err)
+	}
+	if !rotated {
+		// Another request used the same token first.
+		return nil, uc.reuseDetected(ctx, session)
+	}
+
+	token, err := uc.authSvc.GenerateAuthToken(session.UserID, session.FamilyID, session.MFA)
+	if err != nil {
+		return nil, fmt.Errorf("generate token: %w", err)
+	}
+	return &RefreshResponse{
+		UserID:       session.UserID,
+		Token:        token,
+		RefreshToken: next,
+	}, nil
+}
+
+func (uc *AuthUseCase) reuseDetected(ctx context.Context, session *entity.Session) error {
+	uc.log.Warn("refresh token reuse detected",
+		zap.String("user_id", session.UserID),
+		zap.String("family_id", session.FamilyID),
+	)
+	if err := uc.sessionRepo.RevokeFamily(ctx, session.FamilyID); err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	return fmt.Errorf("invalid refresh token: reuse detected")
+}
+
+type LogoutRequest struct {
+	RefreshToken string
+	UserID       string // set when authenticated with a user token
+	SessionID    string // session family of that token
+	All          bool   // end every session of the user
+}
+
+// Logout ends the session family named by the refresh token or the access
+// token, or every session of the user when All is set. Access tokens of
+// ended sessions stop working immediately.
+func (uc *AuthUseCase) Logout(ctx context.Context, req LogoutRequest) error {
+	userID, familyID := req.UserID, req.SessionID
+	if req.RefreshToken != "" {
+		session, err := uc.sessionRepo.FindByTokenHash(ctx, uc.authSvc.HashRefreshToken(req.RefreshToken))
+		if err != nil {
+			if err == utils.ErrRecordNotFound {
+				return fmt.Errorf("invalid refresh token")
+			}
+			return fmt.Errorf("find session: %w", err)
+		}
+		if userID != "" && session.UserID != userID {
+			return fmt.Errorf("invalid refresh token")
+		}
+		userID, familyID = session.UserID, session.FamilyID
+	}
+	if userID == "" {
+		return fmt.Errorf("refresh token is required")
+	}
+
+	if req.All {
+		if err := uc.sessionRepo.RevokeUser(ctx, userID); err != nil {
+			return fmt.Errorf("revoke sessions: %w", err)
+		}
+		return nil
+	}
+	if err := uc.sessionRepo.RevokeFamily(ctx, familyID); err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	return nil
+}
+
+// Revoke invalidates a refresh token, user token or file token, in the
+// manner of RFC 7009: holding a token is enough to revoke it, and tokens
+// that are unknown or already invalid are silently accepted.
+func (uc *AuthUseCase) Revoke(ctx context.Context, token string) error {
+	if token == "" {
+		return fmt.Errorf("token is required")
+	}
+
+	session, err := uc.sessionRepo.FindByTokenHash(ctx, uc.authSvc.HashRefreshToken(token))
+	switch {
+	case err == nil:
+		if err := uc.sessionRepo.RevokeFamily(ctx, session.FamilyID); err != nil {
+			return fmt.Errorf("revoke session: %w", err)
+		}
+		return nil
+	case err != utils.ErrRecordNotFound:
+		return fmt.Errorf("find session: %w", err)
+	}
+
+	if claims, err := uc.authSvc.ValidateAuthToken(token); err == nil {
+		if err := uc.sessionRepo.RevokeFamily(ctx, claims.SessionID); err != nil {
+			return fmt.Errorf("revoke session: %w", err)
+		}
+		return nil
+	}
+
+	if claims, err := uc.tokenSvc.Validate(token); err == nil && claims.TokenID != "" {
+		if _, err := uc.revokedRepo.Revoke(ctx, claims.TokenID, claims.ExpiresAt); err != nil {
+			return fmt.Errorf("revoke token: %w", err)
+		}
+	}
+	return nil
+}
+
+// PurgeExpired deletes sessions and denylist entries that can no longer
+// match a valid token, and failed login records that have run out.
+func (uc *AuthUseCase) PurgeExpired(ctx context.Context) (int64, error) {
+	now := time.Now().UTC()
+	sessions, err := uc.sessionRepo.DeleteExpired(ctx, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	revoked, err := uc.revokedRepo.DeleteExpired(ctx, now)
+	if err != nil {
+		return sessions, fmt.Errorf("delete expired revocations: %w", err)
+	}
+	throttles, err := uc.guard.PurgeStale(ctx)
+	if err != nil {
+		return sessions + revoked, err
+	}
+	return sessions + revoked + throttles, nil
+}
+
+
+// Authenticate resolves a user token to the claims of an existing user
+// whose session has not ended.
+func (uc *AuthUseCase) Authenticate(ctx context.Context, token string) (*service.AuthTokenClaims, error) {
+	claims, err := uc.authSvc.ValidateAuthToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	active, err := uc.sessionRepo.FamilyActive(ctx, claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("check session: %w", err)
+	}
+	if !active {
+		return nil, fmt.Errorf("invalid token: session revoked")
+	}
+
+	user, err := uc.userRepo.FindByID(ctx, claims.UserID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("invalid token: user not found")
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	if user.DisabledAt != nil {
+		return nil, fmt.Errorf("invalid token: user disabled")
+	}
+	return claims, nil
+}
+
+// PublicKeys returns the keys that verify user and file tokens, for
+// publication as a JWKS.
+func (uc *AuthUseCase) PublicKeys() []service.JWK {
+	return append(uc.authSvc.PublicKeys(), uc.tokenSvc.PublicKeys()...)
+}
@@ -0,0 +1,172 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+func login(t *testing.T, env *testEnv, email string) *LoginResponse {
+	t.Helper()
+	resp, err := env.auth.Login(context.Background(), LoginRequest{Email: email, Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatalf("Login = %+v, want tokens", resp)
+	}
+	return resp
+}
+
+func TestRefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+	session := login(t, env, user.Email)
+
+	refresh := session.RefreshToken
+	for i := range 3 {
+		next, err := env.auth.Refresh(ctx, refresh)
+		if err != nil {
+			t.Fatalf("Refresh %d: %v", i, err)
+		}
+		if next.UserID != user.ID || next.RefreshToken == refresh {
+			t.Fatalf("Refresh %d = %+v, want a new refresh token for %s", i, next, user.ID)
+		}
+		claims, err := env.auth.Authenticate(ctx, next.Token)
+		if err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+		original, err := env.auth.Authenticate(ctx, session.Token)
+		if err != nil {
+			t.Fatalf("Authenticate(first access token): %v", err)
+		}
+		if claims.SessionID != original.SessionID {
+			t.Fatal("rotation started a new session family")
+		}
+		refresh = next.RefreshToken
+	}
+
+	for _, tt := range []struct {
+		name, token, want string
+	}{
+		{"empty", "", "refresh token is required"},
+		{"unknown", "not-a-refresh-token", "invalid refresh token"},
+		{"access token", session.Token, "invalid refresh token"},
+	} {
+		if _, err := env.auth.Refresh(ctx, tt.token); err == nil || err.Error() != tt.want {
+			t.Errorf("Refresh(%s): err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+	stolen := login(t, env, user.Email)
+	other := login(t, env, user.Email)
+
+	first, err := env.auth.Refresh(ctx, stolen.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	second, err := env.auth.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// Presenting a used token ends the family, including the tokens the
+	// legitimate holder got since.
+	_, err = env.auth.Refresh(ctx, stolen.RefreshToken)
+	if err == nil || !strings.Contains(err.Error(), "reuse detected") {
+		t.Fatalf("reused refresh token: err = %v, want reuse detected", err)
+	}
+	if _, err := env.auth.Refresh(ctx, second.RefreshToken); err == nil || err.Error() != "invalid refresh token" {
+		t.Fatalf("latest refresh token of a revoked family: err = %v, want invalid refresh token", err)
+	}
+	for _, token := range []string{stolen.Token, first.Token, second.Token} {
+		if _, err := env.auth.Authenticate(ctx, token); err == nil || !strings.Contains(err.Error(), "session revoked") {
+			t.Fatalf("access token of a revoked family: err = %v, want session revoked", err)
+		}
+	}
+	var live int64
+	err = env.db.Model(&entity.Session{}).Where("family_id = ? AND revoked_at IS NULL", mustSessionID(t, env, stolen.Token)).Count(&live).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live != 0 {
+		t.Fatalf("%d sessions of the family are still active", live)
+	}
+
+	// Other sessions of the user are not affected.
+	if _, err := env.auth.Authenticate(ctx, other.Token); err != nil {
+		t.Fatalf("Authenticate(other session): %v", err)
+	}
+	if _, err := env.auth.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Fatalf("Refresh(other session): %v", err)
+	}
+}
+
+func TestRefreshConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+	session := login(t, env, user.Email)
+
+	// Racing requests with one token cannot both rotate it: one wins, the
+	// others count as reuse and end the family, the winner's tokens too.
+	type result struct {
+		resp *RefreshResponse
+		err  error
+	}
+	results := make(chan result, 6)
+	for range cap(results) {
+		go func() {
+			resp, err := env.auth.Refresh(ctx, session.RefreshToken)
+			results <- result{resp, err}
+		}()
+	}
+	var winners []*RefreshResponse
+	for range cap(results) {
+		r := <-results
+		switch {
+		case r.err == nil:
+			winners = append(winners, r.resp)
+		case !strings.Contains(r.err.Error(), "invalid refresh token"):
+			t.Fatalf("Refresh: %v", r.err)
+		}
+	}
+	if len(winners) != 1 {
+		t.Fatalf("refresh token rotated %d times, want once", len(winners))
+	}
+	if _, err := env.auth.Refresh(ctx, winners[0].RefreshToken); err == nil {
+		t.Fatal("family still usable after concurrent reuse")
+	}
+}
+
+func TestRefreshExpiredSession(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+	session := login(t, env, user.Email)
+
+	if err := env.db.Model(&entity.Session{}).Where("user_id = ?", user.ID).Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.auth.Refresh(ctx, session.RefreshToken); err == nil || err.Error() != "invalid refresh token" {
+		t.Fatalf("expired refresh token: err = %v, want invalid refresh token", err)
+	}
+}
+
+func mustSessionID(t *testing.T, env *testEnv, token string) string {
+	t.Helper()
+	claims, err := env.authSvc.ValidateAuthToken(token)
+	if err != nil {
+		t.Fatalf("ValidateAuthToken: %v", err)
+	}
+	return claims.SessionID
+}
@@ -0,0 +1,138 @@
+package usecase
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filehash/internal/domain/service"
+	"github.com/filehash/internal/infrastructure/database"
+	infrarepo "github.com/filehash/internal/infrastructure/repository"
+	infraservice "github.com/filehash/internal/infrastructure/service"
+	"github.com/filehash/pkg/crypto"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testEnv wires the use cases to a fresh SQLite database and in-memory
+// storage, the way app.New does, with a mailer that keeps what it is given.
+type testEnv struct {
+	db      *gorm.DB
+	authSvc service.AuthService
+	hasher  service.PasswordHasher
+	mailer  *recordingMailer
+	account *AccountUseCase
+	auth    *AuthUseCase
+	mfa     *MFAUseCase
+	guard   *LoginGuard
+	files   *FileUseCase
+	folders *FolderUseCase
+	perms   *FilePermissionUseCase
+	shares  *ShareUseCase
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on&_busy_timeout=5000"), &gorm.Config{
+		NowFunc: func() time.Time { return time.Now().UTC() },
+		Logger:  logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	log := zap.NewNop()
+	if err := database.Migrate(db, log); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	userKeys, err := infraservice.NewEphemeralSigningKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileKeys, err := infraservice.NewEphemeralSigningKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher, err := infraservice.NewPasswordHasher(infraservice.PasswordHashOptions{
+		Algorithm:  infraservice.PasswordHashBcrypt,
+		BcryptCost: bcrypt.MinCost,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSvc, err := infraservice.NewAuthService(userKeys, time.Hour, hasher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenSvc, err := infraservice.NewTokenService(fileKeys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySvc, err := infraservice.NewKeyService("kek-1", nil, filepath.Join(t.TempDir(), "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userRepo := infrarepo.NewUserRepository(db)
+	sessionRepo := infrarepo.NewSessionRepository(db)
+	revokedRepo := infrarepo.NewRevokedTokenRepository(db)
+	mailer := &recordingMailer{sent: make(chan service.MailMessage, 10)}
+	mfa := NewMFAUseCase(userRepo, infrarepo.NewTOTPRepository(db), authSvc, infraservice.NewTOTPService("FileHash"), keySvc, log)
+	account := NewAccountUseCase(userRepo, sessionRepo, revokedRepo, authSvc, mailer, "https://files.example", log)
+	guard := NewLoginGuard(infrarepo.NewLoginThrottleRepository(db), LoginPolicy{FreeAttempts: 5, MaxLockout: time.Minute}, log)
+
+	storage, err := infraservice.NewStorageResolver(infraservice.StorageBackendMemory, infraservice.StorageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileRepo := infrarepo.NewFileRepository(db)
+	shareRepo := infrarepo.NewShareRepository(db)
+	files := NewFileUseCase(fileRepo, infrarepo.NewFilePermissionRepository(db), infrarepo.NewFileAttributeRepository(db),
+		shareRepo, infrarepo.NewBlobRepository(db), storage, infraservice.NewCryptoService(), tokenSvc, revokedRepo, keySvc, nil,
+		[]string{crypto.HashSHA256}, log)
+	return &testEnv{
+		db:      db,
+		authSvc: authSvc,
+		hasher:  hasher,
+		mailer:  mailer,
+		account: account,
+		auth:    NewAuthUseCase(userRepo, sessionRepo, revokedRepo, authSvc, tokenSvc, mfa, account, guard, 24*time.Hour, log),
+		mfa:     mfa,
+		guard:   guard,
+		files:   files,
+		folders: NewFolderUseCase(infrarepo.NewFolderRepository(db), fileRepo, files, log),
+		perms:   NewFilePermissionUseCase(infrarepo.NewFilePermissionRepository(db), userRepo, files, log),
+		shares:  NewShareUseCase(shareRepo, userRepo, files, hasher, guard, log),
+	}
+}
+
+// recordingMailer hands sent messages to the test. Account mail goes out in
+// the background, so tests wait on the channel.
+type recordingMailer struct {
+	sent chan service.MailMessage
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg service.MailMessage) error {
+	m.sent <- msg
+	return nil
+}
+
+func (m *recordingMailer) next(t *testing.T) service.MailMessage {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail was sent")
+		return service.MailMessage{}
+	}
+}
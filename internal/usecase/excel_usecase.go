@@ -13,20 +13,23 @@ import (
 )
 
 type ExcelUseCase struct {
-	excelRepo  repository.ExcelRepository
-	storageSvc service.StorageService
-	log        *zap.Logger
+	excelRepo   repository.ExcelRepository
+	storageSvc  service.StorageService
+	storageName string
+	log         *zap.Logger
 }
 
 func NewExcelUseCase(
 	excelRepo repository.ExcelRepository,
-	storageSvc service.StorageService,
+	storage service.StorageResolver,
 	log *zap.Logger,
 ) *ExcelUseCase {
+	storageName, storageSvc := storage.Primary()
 	return &ExcelUseCase{
-		excelRepo:  excelRepo,
-		storageSvc: storageSvc,
-		log:        log,
+		excelRepo:   excelRepo,
+		storageSvc:  storageSvc,
+		storageName: storageName,
+		log:         log,
 	}
 }
 
@@ -52,7 +55,8 @@ func (uc *ExcelUseCase) GenerateExcel(ctx context.Context, req GenerateExcelRequ
 	}
 
 	export := &entity.ExcelExport{
-		StoredPath: path,
+		StoredPath:     path,
+		StorageBackend: uc.storageName,
 	}
 
 	if err := uc.excelRepo.Create(ctx, export); err != nil {
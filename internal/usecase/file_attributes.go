@@ -0,0 +1,144 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/filehash/internal/domain/entity"
+	"go.uber.org/zap"
+)
+
+const (
+	maxFileTags      = 32
+	maxTagLength     = 64
+	maxMetadataKeys  = 64
+	maxMetadataValue = 1024
+	maxMetadataKey   = 64
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+type UpdateAttributesRequest struct {
+	UserID string
+	FileID string
+	Tags   *[]string // nil keeps the tags, otherwise replaces them
+	// Metadata is merged into the existing metadata; a nil value removes
+	// the key.
+	Metadata map[string]*string
+}
+
+// UpdateAttributes changes the tags and metadata of a file. Editors of the
+// file may change them.
+func (uc *FileUseCase) UpdateAttributes(ctx context.Context, req UpdateAttributesRequest) (*entity.FileAsset, error) {
+	var tags []string
+	if req.Tags != nil {
+		var err error
+		if tags, err = normalizeTags(*req.Tags); err != nil {
+			return nil, err
+		}
+		if tags == nil {
+			tags = []string{}
+		}
+	}
+	set := make(map[string]string)
+	var unset []string
+	for key, value := range req.Metadata {
+		if value == nil {
+			unset = append(unset, key)
+			continue
+		}
+		set[key] = *value
+	}
+	if err := validateMetadata(set); err != nil {
+		return nil, err
+	}
+
+	asset, err := uc.AuthorizeUser(ctx, req.FileID, req.UserID, entity.FileRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.loadAttributes(ctx, asset); err != nil {
+		return nil, err
+	}
+	keys := len(set)
+	for key := range asset.Metadata {
+		if _, ok := set[key]; !ok && !slices.Contains(unset, key) {
+			keys++
+		}
+	}
+	if keys > maxMetadataKeys {
+		return nil, fmt.Errorf("invalid metadata: at most %d keys per file", maxMetadataKeys)
+	}
+
+	if err := uc.attrRepo.Update(ctx, asset.ID, tags, set, unset); err != nil {
+		return nil, fmt.Errorf("update attributes: %w", err)
+	}
+	uc.log.Info("file attributes updated",
+		zap.String("file_id", asset.ID),
+		zap.String("user_id", req.UserID))
+	if err := uc.loadAttributes(ctx, asset); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// loadAttributes fills in the tags and metadata of assets.
+func (uc *FileUseCase) loadAttributes(ctx context.Context, assets ...*entity.FileAsset) error {
+	ids := make([]string, len(assets))
+	for i, asset := range assets {
+		ids[i] = asset.ID
+	}
+	attrs, err := uc.attrRepo.Find(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("find attributes: %w", err)
+	}
+	for _, asset := range assets {
+		asset.Tags = attrs[asset.ID].Tags
+		asset.Metadata = attrs[asset.ID].Metadata
+	}
+	return nil
+}
+
+// normalizeTags trims and lower-cases tags and drops duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case tag == "":
+			return nil, fmt.Errorf("invalid tags: empty tag")
+		case utf8.RuneCountInString(tag) > maxTagLength:
+			return nil, fmt.Errorf("invalid tags: %q is longer than %d characters", tag, maxTagLength)
+		case strings.ContainsRune(tag, ','),
+			strings.ContainsFunc(tag, unicode.IsControl):
+			return nil, fmt.Errorf("invalid tags: %q contains a comma or control characters", tag)
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxFileTags {
+		return nil, fmt.Errorf("invalid tags: at most %d tags per file", maxFileTags)
+	}
+	return normalized, nil
+}
+
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataKeys {
+		return fmt.Errorf("invalid metadata: at most %d keys per file", maxMetadataKeys)
+	}
+	for key, value := range metadata {
+		if len(key) > maxMetadataKey || !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid metadata: key %q must be 1-%d letters, digits, '_', '.' or '-'", key, maxMetadataKey)
+		}
+		if len(value) > maxMetadataValue || !utf8.ValidString(value) {
+			return fmt.Errorf("invalid metadata: value of %q must be UTF-8 of at most %d bytes", key, maxMetadataValue)
+		}
+	}
+	return nil
+}
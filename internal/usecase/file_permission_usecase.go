@@ -0,0 +1,142 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// FilePermissionUseCase lets owners share files with other registered
+// users. FileUseCase consults the grants when it authorizes a user.
+type FilePermissionUseCase struct {
+	permRepo repository.FilePermissionRepository
+	userRepo repository.UserRepository
+	files    *FileUseCase
+	log      *zap.Logger
+}
+
+func NewFilePermissionUseCase(
+	permRepo repository.FilePermissionRepository,
+	userRepo repository.UserRepository,
+	files *FileUseCase,
+	log *zap.Logger,
+) *FilePermissionUseCase {
+	return &FilePermissionUseCase{
+		permRepo: permRepo,
+		userRepo: userRepo,
+		files:    files,
+		log:      log,
+	}
+}
+
+type GrantFileRequest struct {
+	ActorID string
+	FileID  string
+	// The grantee is given by ID or, failing that, by email.
+	UserID string
+	Email  string
+	Role   string
+}
+
+// Grant gives a user a role on a file, replacing the role they had. Only
+// owners may grant.
+func (uc *FilePermissionUseCase) Grant(ctx context.Context, req GrantFileRequest) (*repository.FileGrant, error) {
+	if !entity.ValidFileRole(req.Role) {
+		return nil, fmt.Errorf("invalid role %q (must be one of %s)", req.Role, strings.Join(entity.FileRoles, ", "))
+	}
+	if req.UserID == "" && strings.TrimSpace(req.Email) == "" {
+		return nil, fmt.Errorf("email or user_id is required")
+	}
+	asset, err := uc.files.AuthorizeUser(ctx, req.FileID, req.ActorID, entity.FileRoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	var grantee *entity.User
+	if req.UserID != "" {
+		grantee, err = uc.userRepo.FindByID(ctx, req.UserID)
+	} else {
+		grantee, err = uc.userRepo.FindByEmail(ctx, strings.TrimSpace(strings.ToLower(req.Email)))
+	}
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	if asset.UserID != nil && *asset.UserID == grantee.ID {
+		return nil, fmt.Errorf("cannot change the access of the uploader")
+	}
+	if grantee.ID == req.ActorID {
+		return nil, fmt.Errorf("cannot change your own access")
+	}
+
+	perm := &entity.FilePermission{
+		FileID:    asset.ID,
+		UserID:    grantee.ID,
+		Role:      req.Role,
+		GrantedBy: req.ActorID,
+	}
+	if err := uc.permRepo.Upsert(ctx, perm); err != nil {
+		return nil, fmt.Errorf("grant permission: %w", err)
+	}
+	// Re-read: on an update the stored row keeps its original ID.
+	stored, err := uc.permRepo.Find(ctx, asset.ID, grantee.ID)
+	if err != nil {
+		return nil, fmt.Errorf("find permission: %w", err)
+	}
+	uc.log.Info("file permission granted",
+		zap.String("file_id", asset.ID),
+		zap.String("user_id", grantee.ID),
+		zap.String("role", req.Role),
+		zap.String("granted_by", req.ActorID))
+	return &repository.FileGrant{FilePermission: *stored, Email: grantee.Email}, nil
+}
+
+// Revoke removes the grant of userID on a file. Owners may revoke anyone's
+// grant; other users only their own.
+func (uc *FilePermissionUseCase) Revoke(ctx context.Context, actorID, fileID, userID string) error {
+	if userID != actorID {
+		if _, err := uc.files.AuthorizeUser(ctx, fileID, actorID, entity.FileRoleOwner); err != nil {
+			return err
+		}
+	}
+	deleted, err := uc.permRepo.Delete(ctx, fileID, userID)
+	if err != nil {
+		return fmt.Errorf("revoke permission: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("permission not found")
+	}
+	uc.log.Info("file permission revoked",
+		zap.String("file_id", fileID),
+		zap.String("user_id", userID),
+		zap.String("revoked_by", actorID))
+	return nil
+}
+
+// List returns the grants on a file. Only owners may list them.
+func (uc *FilePermissionUseCase) List(ctx context.Context, actorID, fileID string) ([]repository.FileGrant, error) {
+	if _, err := uc.files.AuthorizeUser(ctx, fileID, actorID, entity.FileRoleOwner); err != nil {
+		return nil, err
+	}
+	grants, err := uc.permRepo.ListByFile(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("list permissions: %w", err)
+	}
+	return grants, nil
+}
+
+// SharedWith returns the files other users have granted userID access to.
+func (uc *FilePermissionUseCase) SharedWith(ctx context.Context, userID string) ([]repository.SharedFile, error) {
+	shared, err := uc.permRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list shared files: %w", err)
+	}
+	return shared, nil
+}
@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/filehash/internal/domain/entity"
+)
+
+// uploadFile stores content as a file of userID and returns its ID.
+func uploadFile(t *testing.T, env *testEnv, userID, name, content string) string {
+	t.Helper()
+	resp, err := env.files.UploadFile(context.Background(), UploadFileRequest{
+		Filename:    name,
+		Content:     strings.NewReader(content),
+		ContentType: "image/png",
+		UserID:      &userID,
+	})
+	if err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+	return resp.FileID
+}
+
+// grant gives userID role on fileID as the uploader ownerID.
+func grant(t *testing.T, env *testEnv, ownerID, fileID, userID, role string) {
+	t.Helper()
+	if _, err := env.perms.Grant(context.Background(), GrantFileRequest{ActorID: ownerID, FileID: fileID, UserID: userID, Role: role}); err != nil {
+		t.Fatalf("Grant(%s): %v", role, err)
+	}
+}
+
+func wantErr(t *testing.T, what string, err error, want string) {
+	t.Helper()
+	if err == nil || err.Error() != want {
+		t.Errorf("%s: err = %v, want %q", what, err, want)
+	}
+}
+
+func TestFileRoles(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	alice := registerUser(t, env, "alice@example.com")
+	viewer := registerUser(t, env, "viewer@example.com")
+	editor := registerUser(t, env, "editor@example.com")
+	fileID := uploadFile(t, env, alice.ID, "photo.png", "image bytes")
+	grant(t, env, alice.ID, fileID, viewer.ID, entity.FileRoleViewer)
+	grant(t, env, alice.ID, fileID, editor.ID, entity.FileRoleEditor)
+	folder, err := env.folders.CreateFolder(ctx, alice.ID, "Photos", "")
+	if err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	tags := []string{"holiday"}
+
+	t.Run("viewer", func(t *testing.T) {
+		resp, err := env.files.GetFile(ctx, GetFileRequest{FileID: fileID, UserID: viewer.ID})
+		if err != nil {
+			t.Fatalf("GetFile: %v", err)
+		}
+		content, _ := io.ReadAll(resp.Content)
+		resp.Content.Close()
+		if string(content) != "image bytes" {
+			t.Fatalf("content = %q", content)
+		}
+		if _, err := env.files.GetFileMetadata(ctx, GetFileMetadataRequest{FileID: fileID, UserID: viewer.ID}); err != nil {
+			t.Fatalf("GetFileMetadata: %v", err)
+		}
+
+		_, err = env.files.UpdateAttributes(ctx, UpdateAttributesRequest{UserID: viewer.ID, FileID: fileID, Tags: &tags})
+		wantErr(t, "UpdateAttributes", err, "permission denied: editor role required")
+		_, err = env.folders.MoveFile(ctx, viewer.ID, fileID, folder.ID)
+		wantErr(t, "MoveFile", err, "permission denied: editor role required")
+		err = env.files.DeleteFile(ctx, DeleteFileRequest{FileID: fileID, UserID: viewer.ID})
+		wantErr(t, "DeleteFile", err, "permission denied: owner role required")
+		_, err = env.shares.CreateShare(ctx, CreateShareRequest{UserID: viewer.ID, FileID: fileID})
+		wantErr(t, "CreateShare", err, "permission denied: owner role required")
+	})
+
+	t.Run("editor", func(t *testing.T) {
+		if _, err := env.files.UpdateAttributes(ctx, UpdateAttributesRequest{UserID: editor.ID, FileID: fileID, Tags: &tags}); err != nil {
+			t.Fatalf("UpdateAttributes: %v", err)
+		}
+		// Editors move the file among the uploader's folders, not their own.
+		if _, err := env.folders.MoveFile(ctx, editor.ID, fileID, folder.ID); err != nil {
+			t.Fatalf("MoveFile: %v", err)
+		}
+		own, err := env.folders.CreateFolder(ctx, editor.ID, "Mine", "")
+		if err != nil {
+			t.Fatalf("CreateFolder: %v", err)
+		}
+		if _, err := env.folders.MoveFile(ctx, editor.ID, fileID, own.ID); err == nil {
+			t.Error("editor moved the file into a folder of their own")
+		}
+
+		_, err = env.perms.Grant(ctx, GrantFileRequest{ActorID: editor.ID, FileID: fileID, UserID: viewer.ID, Role: entity.FileRoleEditor})
+		wantErr(t, "Grant", err, "permission denied: owner role required")
+		_, err = env.perms.List(ctx, editor.ID, fileID)
+		wantErr(t, "List", err, "permission denied: owner role required")
+		err = env.perms.Revoke(ctx, editor.ID, fileID, viewer.ID)
+		wantErr(t, "Revoke of another grant", err, "permission denied: owner role required")
+		err = env.files.DeleteFile(ctx, DeleteFileRequest{FileID: fileID, UserID: editor.ID})
+		wantErr(t, "DeleteFile", err, "permission denied: owner role required")
+	})
+
+	t.Run("granted owner", func(t *testing.T) {
+		coOwner := registerUser(t, env, "co-owner@example.com")
+		grant(t, env, alice.ID, fileID, coOwner.ID, entity.FileRoleOwner)
+		grant(t, env, coOwner.ID, fileID, viewer.ID, entity.FileRoleEditor)
+		_, err := env.perms.Grant(ctx, GrantFileRequest{ActorID: coOwner.ID, FileID: fileID, UserID: alice.ID, Role: entity.FileRoleViewer})
+		wantErr(t, "Grant to the uploader", err, "cannot change the access of the uploader")
+		_, err = env.perms.Grant(ctx, GrantFileRequest{ActorID: coOwner.ID, FileID: fileID, UserID: coOwner.ID, Role: entity.FileRoleViewer})
+		wantErr(t, "Grant to oneself", err, "cannot change your own access")
+		// Regranting replaced the role.
+		if _, err := env.files.UpdateAttributes(ctx, UpdateAttributesRequest{UserID: viewer.ID, FileID: fileID, Tags: &tags}); err != nil {
+			t.Fatalf("UpdateAttributes after the upgrade: %v", err)
+		}
+		grant(t, env, coOwner.ID, fileID, viewer.ID, entity.FileRoleViewer)
+	})
+}
+
+func TestFileOfAnotherUserNotFound(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	alice := registerUser(t, env, "alice@example.com")
+	mallory := registerUser(t, env, "mallory@example.com")
+	fileID := uploadFile(t, env, alice.ID, "photo.png", "image bytes")
+	tags := []string{"x"}
+
+	// Another user's file and a file that does not exist look the same.
+	for _, id := range []string{fileID, "00000000-0000-0000-0000-000000000000"} {
+		_, err := env.files.GetFile(ctx, GetFileRequest{FileID: id, UserID: mallory.ID})
+		wantErr(t, "GetFile", err, "file not found")
+		_, err = env.files.GetFileMetadata(ctx, GetFileMetadataRequest{FileID: id, UserID: mallory.ID})
+		wantErr(t, "GetFileMetadata", err, "file not found")
+		_, err = env.files.UpdateAttributes(ctx, UpdateAttributesRequest{UserID: mallory.ID, FileID: id, Tags: &tags})
+		wantErr(t, "UpdateAttributes", err, "file not found")
+		_, err = env.folders.MoveFile(ctx, mallory.ID, id, "")
+		wantErr(t, "MoveFile", err, "file not found")
+		err = env.files.DeleteFile(ctx, DeleteFileRequest{FileID: id, UserID: mallory.ID})
+		wantErr(t, "DeleteFile", err, "file not found")
+		_, err = env.perms.Grant(ctx, GrantFileRequest{ActorID: mallory.ID, FileID: id, UserID: mallory.ID, Role: entity.FileRoleOwner})
+		wantErr(t, "Grant", err, "file not found")
+		_, err = env.perms.List(ctx, mallory.ID, id)
+		wantErr(t, "List", err, "file not found")
+		_, err = env.shares.CreateShare(ctx, CreateShareRequest{UserID: mallory.ID, FileID: id})
+		wantErr(t, "CreateShare", err, "file not found")
+	}
+}
+
+func TestRevokeFileGrant(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	alice := registerUser(t, env, "alice@example.com")
+	bob := registerUser(t, env, "bob@example.com")
+	carol := registerUser(t, env, "carol@example.com")
+	fileID := uploadFile(t, env, alice.ID, "photo.png", "image bytes")
+
+	_, err := env.perms.Grant(ctx, GrantFileRequest{ActorID: alice.ID, FileID: fileID, Email: " Bob@Example.com ", Role: "admin"})
+	wantErr(t, "Grant with an unknown role", err, `invalid role "admin" (must be one of viewer, editor, owner)`)
+	_, err = env.perms.Grant(ctx, GrantFileRequest{ActorID: alice.ID, FileID: fileID, Email: "nobody@example.com", Role: entity.FileRoleViewer})
+	wantErr(t, "Grant to an unknown user", err, "user not found")
+	if _, err := env.perms.Grant(ctx, GrantFileRequest{ActorID: alice.ID, FileID: fileID, Email: " Bob@Example.com ", Role: entity.FileRoleViewer}); err != nil {
+		t.Fatalf("Grant by email: %v", err)
+	}
+	grant(t, env, alice.ID, fileID, carol.ID, entity.FileRoleViewer)
+
+	shared, err := env.perms.SharedWith(ctx, bob.ID)
+	if err != nil || len(shared) != 1 {
+		t.Fatalf("SharedWith = %v, %v; want the file", shared, err)
+	}
+
+	// Grantees may drop their own access; the owner anyone's.
+	if err := env.perms.Revoke(ctx, bob.ID, fileID, bob.ID); err != nil {
+		t.Fatalf("Revoke own grant: %v", err)
+	}
+	_, err = env.files.GetFileMetadata(ctx, GetFileMetadataRequest{FileID: fileID, UserID: bob.ID})
+	wantErr(t, "GetFileMetadata after Revoke", err, "file not found")
+	if err := env.perms.Revoke(ctx, alice.ID, fileID, carol.ID); err != nil {
+		t.Fatalf("Revoke by the owner: %v", err)
+	}
+	err = env.perms.Revoke(ctx, alice.ID, fileID, carol.ID)
+	wantErr(t, "second Revoke", err, "permission not found")
+}
@@ -2,85 +2,179 @@ package usecase
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/filehash/internal/domain/entity"
 	"github.com/filehash/internal/domain/repository"
 	"github.com/filehash/internal/domain/service"
+	"github.com/filehash/pkg/crypto"
 	"github.com/filehash/pkg/utils"
 	"go.uber.org/zap"
 )
 
+// fileTokenExpiresIn is the lifetime reported for issued file tokens.
+const fileTokenExpiresIn = 900 // 15 minutes in seconds
+
 type FileUseCase struct {
-	fileRepo   repository.FileRepository
-	storageSvc service.StorageService
-	cryptoSvc  service.CryptoService
-	tokenSvc   service.TokenService
-	log        *zap.Logger
+	fileRepo    repository.FileRepository
+	permRepo    repository.FilePermissionRepository
+	attrRepo    repository.FileAttributeRepository
+	shareRepo   repository.ShareRepository
+	blobRepo    repository.BlobRepository
+	storage     service.StorageResolver
+	storageSvc  service.StorageService // primary backend for new blobs
+	storageName string
+	cryptoSvc   service.CryptoService
+	tokenSvc    service.TokenService
+	revokedRepo repository.RevokedTokenRepository
+	keySvc      service.KeyService
+	dedupSvc    service.DedupService
+	hashAlgs    []string
+	log         *zap.Logger
 }
 
+// NewFileUseCase builds the file use case. dedupSvc may be nil, in which
+// case every upload gets its own blob.
 func NewFileUseCase(
 	fileRepo repository.FileRepository,
-	storageSvc service.StorageService,
+	permRepo repository.FilePermissionRepository,
+	attrRepo repository.FileAttributeRepository,
+	shareRepo repository.ShareRepository,
+	blobRepo repository.BlobRepository,
+	storage service.StorageResolver,
 	cryptoSvc service.CryptoService,
 	tokenSvc service.TokenService,
+	revokedRepo repository.RevokedTokenRepository,
+	keySvc service.KeyService,
+	dedupSvc service.DedupService,
+	hashAlgs []string,
 	log *zap.Logger,
 ) *FileUseCase {
+	storageName, storageSvc := storage.Primary()
 	return &FileUseCase{
-		fileRepo:   fileRepo,
-		storageSvc: storageSvc,
-		cryptoSvc:  cryptoSvc,
-		tokenSvc:   tokenSvc,
-		log:        log,
+		fileRepo:    fileRepo,
+		permRepo:    permRepo,
+		attrRepo:    attrRepo,
+		shareRepo:   shareRepo,
+		blobRepo:    blobRepo,
+		storage:     storage,
+		storageSvc:  storageSvc,
+		storageName: storageName,
+		cryptoSvc:   cryptoSvc,
+		tokenSvc:    tokenSvc,
+		revokedRepo: revokedRepo,
+		keySvc:      keySvc,
+		dedupSvc:    dedupSvc,
+		hashAlgs:    hashAlgs,
+		log:         log,
 	}
 }
 
 type UploadFileRequest struct {
 	Filename    string
-	Content     []byte
+	Content     io.Reader
 	ContentType string
 	UserID      *string
+	Tags        []string
+	Metadata    map[string]string
 }
 
 type UploadFileResponse struct {
 	FileID    string
 	Token     string
 	ExpiresIn int
+	SizeBytes int64
+	Hashes    map[string]string
 }
 
 func (uc *FileUseCase) UploadFile(ctx context.Context, req UploadFileRequest) (*UploadFileResponse, error) {
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMetadata(req.Metadata); err != nil {
+		return nil, err
+	}
+
 	aesKey, err := uc.cryptoSvc.GenerateAESKey()
 	if err != nil {
 		return nil, fmt.Errorf("generate key: %w", err)
 	}
 
-	ciphertext, nonce, err := uc.cryptoSvc.EncryptAESGCM(aesKey, req.Content)
+	digests, err := crypto.NewMultiHash(uc.hashAlgs...)
 	if err != nil {
-		return nil, fmt.Errorf("encrypt: %w", err)
+		return nil, fmt.Errorf("init hashes: %w", err)
+	}
+
+	sink := io.Writer(digests)
+	var mac hash.Hash
+	if uc.dedupSvc != nil {
+		mac = uc.dedupSvc.NewMAC()
+		sink = io.MultiWriter(digests, mac)
 	}
 
-	storagePath, err := uc.storageSvc.SaveEncrypted(ctx, req.Filename, nonce, ciphertext)
+	storagePath, size, err := uc.saveEncrypted(ctx, req.Filename, aesKey, io.TeeReader(req.Content, sink))
 	if err != nil {
-		return nil, fmt.Errorf("save encrypted: %w", err)
+		return nil, err
 	}
 
 	asset := &entity.FileAsset{
 		OriginalName:      req.Filename,
 		StoredPath:        storagePath,
+		StorageBackend:    uc.storageName,
 		UserID:            req.UserID,
 		ContentType:       req.ContentType,
-		SizeBytes:         int64(len(req.Content)),
-		EncryptionAlg:     "AES-256",
-		AuthenticationAlg: "GCM",
+		SizeBytes:         size,
+		EncryptionAlg:     crypto.EncryptionAES256,
+		AuthenticationAlg: crypto.AuthenticationGCMStream,
+	}
+	asset.SetHashes(digests.Sums())
+
+	if mac != nil {
+		blob, blobKey, err := uc.acquireBlob(ctx, hex.EncodeToString(mac.Sum(nil)), storagePath, size, aesKey)
+		if err != nil {
+			return nil, err
+		}
+		aesKey = blobKey
+		asset.StoredPath = blob.StoredPath
+		asset.StorageBackend = ""
+		asset.BlobID = &blob.ID
+	}
+
+	asset.WrappedKey, asset.KeyID, err = uc.keySvc.WrapKey(aesKey)
+	if err != nil {
+		if relErr := uc.releaseStorage(ctx, asset); relErr != nil {
+			uc.log.Warn("storage release failed", zap.Error(relErr))
+		}
+		return nil, fmt.Errorf("wrap key: %w", err)
 	}
 
 	if err := uc.fileRepo.Create(ctx, asset); err != nil {
-		_ = uc.storageSvc.Delete(ctx, storagePath)
+		if relErr := uc.releaseStorage(ctx, asset); relErr != nil {
+			uc.log.Warn("storage release failed", zap.Error(relErr))
+		}
 		return nil, fmt.Errorf("create record: %w", err)
 	}
+	if len(tags) > 0 || len(req.Metadata) > 0 {
+		if err := uc.attrRepo.Update(ctx, asset.ID, tags, req.Metadata, nil); err != nil {
+			if rmErr := uc.remove(ctx, asset); rmErr != nil {
+				uc.log.Warn("remove file failed", zap.String("file_id", asset.ID), zap.Error(rmErr))
+			}
+			return nil, fmt.Errorf("save attributes: %w", err)
+		}
+	}
 
-	token, err := uc.tokenSvc.Generate(asset.ID, aesKey, req.UserID)
+	token, err := uc.tokenSvc.Generate(asset.ID, req.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("generate token: %w", err)
 	}
@@ -88,140 +182,636 @@ func (uc *FileUseCase) UploadFile(ctx context.Context, req UploadFileRequest) (*
 	return &UploadFileResponse{
 		FileID:    asset.ID,
 		Token:     token,
-		ExpiresIn: 900, // 15 minutes in seconds
+		ExpiresIn: fileTokenExpiresIn,
+		SizeBytes: size,
+		Hashes:    asset.Hashes(),
 	}, nil
 }
 
+// saveEncrypted pipes content through the stream encryptor into storage so
+// that no more than a single chunk of plaintext is held in memory.
+func (uc *FileUseCase) saveEncrypted(ctx context.Context, filename string, key []byte, content io.Reader) (string, int64, error) {
+	counter := &countingReader{r: content}
+	pr, pw := io.Pipe()
+	encErr := make(chan error, 1)
+	go func() {
+		err := uc.encryptTo(pw, key, counter)
+		_ = pw.CloseWithError(err)
+		encErr <- err
+	}()
+
+	storagePath, saveErr := uc.storageSvc.SaveEncrypted(ctx, filename, pr)
+	_ = pr.Close()
+	if err := <-encErr; err != nil {
+		if saveErr == nil {
+			_ = uc.storageSvc.Delete(ctx, storagePath)
+		}
+		return "", 0, fmt.Errorf("encrypt: %w", err)
+	}
+	if saveErr != nil {
+		return "", 0, fmt.Errorf("save encrypted: %w", saveErr)
+	}
+	if counter.n == 0 {
+		_ = uc.storageSvc.Delete(ctx, storagePath)
+		return "", 0, fmt.Errorf("file is empty")
+	}
+	return storagePath, counter.n, nil
+}
+
+// acquireBlob registers a freshly written blob under its content address.
+// When an identical blob is already stored, the new copy is discarded and
+// the data key of the existing blob is returned in place of key.
+func (uc *FileUseCase) acquireBlob(ctx context.Context, id, storagePath string, size int64, key []byte) (*entity.Blob, []byte, error) {
+	wrapped, kekID, err := uc.keySvc.WrapKey(key)
+	if err != nil {
+		_ = uc.storageSvc.Delete(ctx, storagePath)
+		return nil, nil, fmt.Errorf("wrap blob key: %w", err)
+	}
+
+	blob, created, err := uc.blobRepo.Acquire(ctx, &entity.Blob{
+		ID:             id,
+		StoredPath:     storagePath,
+		StorageBackend: uc.storageName,
+		SizeBytes:      size,
+		WrappedKey:     wrapped,
+		KeyID:          kekID,
+	})
+	if err != nil {
+		_ = uc.storageSvc.Delete(ctx, storagePath)
+		return nil, nil, fmt.Errorf("acquire blob: %w", err)
+	}
+	if created {
+		return blob, key, nil
+	}
+
+	if err := uc.storageSvc.Delete(ctx, storagePath); err != nil {
+		uc.log.Warn("duplicate blob delete failed", zap.Error(err))
+	}
+	blobKey, err := uc.keySvc.UnwrapKey(blob.WrappedKey, blob.KeyID)
+	if err != nil {
+		if _, relErr := uc.blobRepo.Release(ctx, blob.ID); relErr != nil {
+			uc.log.Warn("blob release failed", zap.Error(relErr))
+		}
+		return nil, nil, fmt.Errorf("unwrap blob key: %w", err)
+	}
+	return blob, blobKey, nil
+}
+
+// releaseStorage drops the hold of asset on its encrypted blob. Shared blobs
+// are only removed from storage once the last referencing asset is gone.
+func (uc *FileUseCase) releaseStorage(ctx context.Context, asset *entity.FileAsset) error {
+	if asset.BlobID == nil {
+		storage, err := uc.storageFor(asset.StorageBackend)
+		if err != nil {
+			return err
+		}
+		return storage.Delete(ctx, asset.StoredPath)
+	}
+	blob, err := uc.blobRepo.Release(ctx, *asset.BlobID)
+	if err != nil {
+		return fmt.Errorf("release blob: %w", err)
+	}
+	if blob == nil {
+		return nil
+	}
+	storage, err := uc.storageFor(blob.StorageBackend)
+	if err != nil {
+		return err
+	}
+	return storage.Delete(ctx, blob.StoredPath)
+}
+
+// loadEncrypted opens the ciphertext of asset on the backend holding it.
+func (uc *FileUseCase) loadEncrypted(ctx context.Context, asset *entity.FileAsset) (io.ReadSeekCloser, error) {
+	backend := asset.StorageBackend
+	if asset.BlobID != nil {
+		blob, err := uc.blobRepo.FindByID(ctx, *asset.BlobID)
+		if err != nil {
+			return nil, fmt.Errorf("find blob: %w", err)
+		}
+		backend = blob.StorageBackend
+	}
+	storage, err := uc.storageFor(backend)
+	if err != nil {
+		return nil, err
+	}
+	return storage.LoadEncrypted(ctx, asset.StoredPath)
+}
+
+// storageFor returns the backend recorded as name. Rows without one predate
+// backend tracking and live on the primary backend.
+func (uc *FileUseCase) storageFor(name string) (service.StorageService, error) {
+	if name == "" {
+		return uc.storageSvc, nil
+	}
+	return uc.storage.Backend(name)
+}
+
+func (uc *FileUseCase) encryptTo(dst io.Writer, key []byte, src io.Reader) error {
+	enc, err := uc.cryptoSvc.NewEncryptWriter(key, dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(enc, src); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
 type GetFileRequest struct {
 	FileID string
 	Token  string
+	UserID string // set when authenticated with a user token
 }
 
 type GetFileResponse struct {
-	Content     []byte
+	FileID      string
+	Content     io.ReadSeekCloser
 	ContentType string
 	Filename    string
+	SizeBytes   int64
+	ModTime     time.Time
 }
 
 func (uc *FileUseCase) GetFile(ctx context.Context, req GetFileRequest) (*GetFileResponse, error) {
-	claims, err := uc.tokenSvc.Validate(req.Token)
+	asset, err := uc.authorize(ctx, req.FileID, req.Token, req.UserID, entity.FileRoleViewer)
 	if err != nil {
-		return nil, fmt.Errorf("validate token: %w", err)
+		return nil, err
+	}
+
+	key, err := uc.dataKey(asset)
+	if err != nil {
+		return nil, err
 	}
 
-	if claims.FileID != req.FileID {
+	content, size, err := uc.openDecrypted(ctx, asset, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetFileResponse{
+		FileID:      asset.ID,
+		Content:     content,
+		ContentType: asset.ContentType,
+		Filename:    asset.OriginalName,
+		SizeBytes:   size,
+		ModTime:     asset.CreatedAt,
+	}, nil
+}
+
+// authorize loads the file a request refers to. A request authenticated
+// with a user token may access the files that user owns or holds a grant of
+// at least role need on; otherwise token must be a file token issued for
+// the file.
+func (uc *FileUseCase) authorize(ctx context.Context, fileID, token, userID, need string) (*entity.FileAsset, error) {
+	if userID != "" {
+		return uc.AuthorizeUser(ctx, fileID, userID, need)
+	}
+
+	claims, err := uc.tokenSvc.Validate(token)
+	if err != nil {
+		return nil, fmt.Errorf("validate token: %w", err)
+	}
+	if claims.FileID != fileID {
 		return nil, fmt.Errorf("token file_id mismatch")
 	}
+	if claims.TokenID != "" {
+		revoked, err := uc.revokedRepo.IsRevoked(ctx, claims.TokenID)
+		if err != nil {
+			return nil, fmt.Errorf("check revocation: %w", err)
+		}
+		if revoked {
+			return nil, fmt.Errorf("validate token: token revoked")
+		}
+	}
 
-	asset, err := uc.fileRepo.FindByID(ctx, req.FileID)
+	asset, err := uc.fileRepo.FindByID(ctx, fileID)
 	if err != nil {
 		if err == utils.ErrRecordNotFound {
 			return nil, fmt.Errorf("file not found")
 		}
 		return nil, fmt.Errorf("find file: %w", err)
 	}
+	return asset, nil
+}
 
-	key, err := decodeKey(claims.Key)
+// AuthorizeUser loads a file for userID if they own it or hold a grant of
+// at least role need on it.
+func (uc *FileUseCase) AuthorizeUser(ctx context.Context, fileID, userID, need string) (*entity.FileAsset, error) {
+	asset, err := uc.fileRepo.FindByID(ctx, fileID)
 	if err != nil {
-		return nil, fmt.Errorf("decode key: %w", err)
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("file not found")
+		}
+		return nil, fmt.Errorf("find file: %w", err)
+	}
+	if asset.UserID != nil && *asset.UserID == userID {
+		return asset, nil
 	}
 
-	nonce, ciphertext, err := uc.storageSvc.LoadEncrypted(ctx, asset.StoredPath)
+	perm, err := uc.permRepo.Find(ctx, fileID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("load encrypted: %w", err)
+		if err == utils.ErrRecordNotFound {
+			// Files of other users are reported as missing, not forbidden,
+			// so their IDs cannot be probed.
+			return nil, fmt.Errorf("file not found")
+		}
+		return nil, fmt.Errorf("find permission: %w", err)
 	}
+	if !entity.FileRoleAllows(perm.Role, need) {
+		return nil, fmt.Errorf("permission denied: %s role required", need)
+	}
+	return asset, nil
+}
 
-	plaintext, err := uc.cryptoSvc.DecryptAESGCM(key, nonce, ciphertext)
+// openDecrypted returns a seekable view of the plaintext of asset and its
+// size. Chunks are decrypted on demand as the view is read.
+func (uc *FileUseCase) openDecrypted(ctx context.Context, asset *entity.FileAsset, key []byte) (io.ReadSeekCloser, int64, error) {
+	blob, err := uc.loadEncrypted(ctx, asset)
 	if err != nil {
-		return nil, fmt.Errorf("decrypt: %w", err)
+		return nil, 0, fmt.Errorf("load encrypted: %w", err)
 	}
 
-	return &GetFileResponse{
-		Content:     plaintext,
-		ContentType: asset.ContentType,
-		Filename:    asset.OriginalName,
-	}, nil
+	plain, size, err := uc.cryptoSvc.NewDecryptSeeker(key, blob)
+	if err != nil {
+		_ = blob.Close()
+		return nil, 0, fmt.Errorf("decrypt: %w", err)
+	}
+	return readSeekCloser{ReadSeeker: plain, Closer: blob}, size, nil
 }
 
 type GetFileMetadataRequest struct {
 	FileID string
 	Token  string
+	UserID string // set when authenticated with a user token
 }
 
 func (uc *FileUseCase) GetFileMetadata(ctx context.Context, req GetFileMetadataRequest) (*entity.FileAsset, error) {
-	claims, err := uc.tokenSvc.Validate(req.Token)
+	asset, err := uc.authorize(ctx, req.FileID, req.Token, req.UserID, entity.FileRoleViewer)
 	if err != nil {
-		return nil, fmt.Errorf("validate token: %w", err)
+		return nil, err
+	}
+	if err := uc.loadAttributes(ctx, asset); err != nil {
+		return nil, err
 	}
 
-	if claims.FileID != req.FileID {
-		return nil, fmt.Errorf("token file_id mismatch")
+	return asset, nil
+}
+
+type DeleteFileRequest struct {
+	FileID string
+	Token  string
+	UserID string // set when authenticated with a user token
+}
+
+func (uc *FileUseCase) DeleteFile(ctx context.Context, req DeleteFileRequest) error {
+	asset, err := uc.authorize(ctx, req.FileID, req.Token, req.UserID, entity.FileRoleOwner)
+	if err != nil {
+		return err
 	}
 
-	asset, err := uc.fileRepo.FindByID(ctx, req.FileID)
+	return uc.remove(ctx, asset)
+}
+
+// DeleteUserFiles deletes every file owned by userID and returns how many
+// there were.
+func (uc *FileUseCase) DeleteUserFiles(ctx context.Context, userID string) (int, error) {
+	assets, err := uc.fileRepo.FindByUserID(ctx, userID)
 	if err != nil {
-		if err == utils.ErrRecordNotFound {
-			return nil, fmt.Errorf("file not found")
+		return 0, fmt.Errorf("find files: %w", err)
+	}
+	for i := range assets {
+		if err := uc.remove(ctx, &assets[i]); err != nil {
+			return i, err
 		}
-		return nil, fmt.Errorf("find file: %w", err)
 	}
+	return len(assets), nil
+}
 
-	return asset, nil
+// remove deletes the record of asset, then its stored object; a failure to
+// delete the object only leaves garbage behind.
+func (uc *FileUseCase) remove(ctx context.Context, asset *entity.FileAsset) error {
+	if err := uc.fileRepo.Delete(ctx, asset.ID); err != nil {
+		return fmt.Errorf("delete record: %w", err)
+	}
+	if err := uc.permRepo.DeleteByFileID(ctx, asset.ID); err != nil {
+		uc.log.Warn("delete file permissions failed", zap.String("file_id", asset.ID), zap.Error(err))
+	}
+	if err := uc.attrRepo.DeleteByFileID(ctx, asset.ID); err != nil {
+		uc.log.Warn("delete file attributes failed", zap.String("file_id", asset.ID), zap.Error(err))
+	}
+	if err := uc.shareRepo.DeleteByFileID(ctx, asset.ID); err != nil {
+		uc.log.Warn("delete file shares failed", zap.String("file_id", asset.ID), zap.Error(err))
+	}
+
+	if err := uc.releaseStorage(ctx, asset); err != nil {
+		uc.log.Warn("storage delete failed", zap.Error(err))
+	}
+
+	return nil
 }
 
-type DeleteFileRequest struct {
+type VerifyFileRequest struct {
 	FileID string
 	Token  string
+	UserID string // set when authenticated with a user token
 }
 
-func (uc *FileUseCase) DeleteFile(ctx context.Context, req DeleteFileRequest) error {
-	claims, err := uc.tokenSvc.Validate(req.Token)
+type VerifyFileResponse struct {
+	Valid    bool
+	Reason   string
+	Expected map[string]string
+	Actual   map[string]string
+}
+
+// VerifyFile re-reads and decrypts the stored blob and compares the digests
+// of the plaintext with the ones recorded at upload time.
+func (uc *FileUseCase) VerifyFile(ctx context.Context, req VerifyFileRequest) (*VerifyFileResponse, error) {
+	asset, err := uc.authorize(ctx, req.FileID, req.Token, req.UserID, entity.FileRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(asset.Hashes()) == 0 {
+		return nil, fmt.Errorf("no stored digest for file")
+	}
+
+	key, err := uc.dataKey(asset)
+	if err != nil {
+		return nil, err
+	}
+	return uc.checkContent(ctx, asset, key)
+}
+
+// checkContent decrypts the stored blob of asset with key and compares the
+// plaintext with the size and digests recorded at upload time.
+func (uc *FileUseCase) checkContent(ctx context.Context, asset *entity.FileAsset, key []byte) (*VerifyFileResponse, error) {
+	expected := asset.Hashes()
+	algs := make([]string, 0, len(expected))
+	for alg := range expected {
+		algs = append(algs, alg)
+	}
+	digests, err := crypto.NewMultiHash(algs...)
+	if err != nil {
+		return nil, fmt.Errorf("init hashes: %w", err)
+	}
+
+	blob, err := uc.loadEncrypted(ctx, asset)
+	if err != nil {
+		return nil, fmt.Errorf("load encrypted: %w", err)
+	}
+	defer blob.Close()
+
+	resp := &VerifyFileResponse{Expected: expected}
+
+	// Authentication failures mean the stored ciphertext was altered; they
+	// are a verification result rather than a server error.
+	plain, err := uc.cryptoSvc.NewDecryptReader(key, blob)
+	if err != nil {
+		resp.Reason = err.Error()
+		return resp, nil
+	}
+	size, err := io.Copy(digests, plain)
 	if err != nil {
-		return fmt.Errorf("validate token: %w", err)
+		resp.Reason = err.Error()
+		return resp, nil
 	}
 
-	if claims.FileID != req.FileID {
-		return fmt.Errorf("token file_id mismatch")
+	resp.Actual = digests.Sums()
+	resp.Valid = size == asset.SizeBytes
+	for alg, sum := range expected {
+		if subtle.ConstantTimeCompare([]byte(sum), []byte(resp.Actual[alg])) != 1 {
+			resp.Valid = false
+		}
+	}
+	if !resp.Valid {
+		resp.Reason = "digest mismatch"
 	}
+	return resp, nil
+}
 
-	asset, err := uc.fileRepo.FindByID(ctx, req.FileID)
+// ImportLegacyKey stores key as the data key of fileID. It is the way back
+// for files uploaded before data keys were kept server-side, whose key only
+// exists in the upload token. The key is accepted only if it decrypts the
+// stored file to the size and digests recorded at upload.
+func (uc *FileUseCase) ImportLegacyKey(ctx context.Context, fileID string, key []byte) error {
+	asset, err := uc.fileRepo.FindByID(ctx, fileID)
 	if err != nil {
 		if err == utils.ErrRecordNotFound {
 			return fmt.Errorf("file not found")
 		}
 		return fmt.Errorf("find file: %w", err)
 	}
-
-	if err := uc.storageSvc.Delete(ctx, asset.StoredPath); err != nil {
-		uc.log.Warn("storage delete failed", zap.Error(err))
+	if len(asset.WrappedKey) > 0 {
+		return fmt.Errorf("file already has a data key")
 	}
 
-	if err := uc.fileRepo.Delete(ctx, req.FileID); err != nil {
-		return fmt.Errorf("delete record: %w", err)
+	check, err := uc.checkContent(ctx, asset, key)
+	if err != nil {
+		return err
+	}
+	if !check.Valid {
+		return fmt.Errorf("key does not match the file: %s", check.Reason)
 	}
 
+	wrapped, kekID, err := uc.keySvc.WrapKey(key)
+	if err != nil {
+		return fmt.Errorf("wrap key: %w", err)
+	}
+	if err := uc.fileRepo.UpdateWrappedKey(ctx, asset.ID, wrapped, kekID); err != nil {
+		return fmt.Errorf("store key: %w", err)
+	}
 	return nil
 }
 
+const (
+	defaultFilePageSize = 50
+	maxFilePageSize     = 200
+)
+
 type ListFilesRequest struct {
 	UserID string
+	// FolderID, unless nil, keeps the files directly inside that folder,
+	// or at the top level when it is empty.
+	FolderID *string
+	Tags     []string          // files with all of these tags
+	Metadata map[string]string // files with all of these metadata values
+
+	ContentType   string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MinSize       *int64
+	MaxSize       *int64
+	NamePrefix    string
+
+	Sort   string // date (default), name or size
+	Order  string // asc or desc; newest first and A-Z by default
+	Cursor string // next_cursor of the previous page
+	Limit  int
 }
 
-func (uc *FileUseCase) ListFiles(ctx context.Context, req ListFilesRequest) ([]entity.FileAsset, error) {
-	assets, err := uc.fileRepo.FindByUserID(ctx, req.UserID)
+type ListFilesResponse struct {
+	Files      []entity.FileAsset
+	Total      int64  // files matching the filters, on all pages
+	NextCursor string // empty on the last page
+}
+
+// ListFiles returns a page of the files of req.UserID with their tags and
+// metadata.
+func (uc *FileUseCase) ListFiles(ctx context.Context, req ListFilesRequest) (*ListFilesResponse, error) {
+	page := repository.FilePage{Sort: req.Sort, Limit: req.Limit}
+	if page.Sort == "" {
+		page.Sort = repository.FileSortDate
+	}
+	if !slices.Contains([]string{repository.FileSortDate, repository.FileSortName, repository.FileSortSize}, page.Sort) {
+		return nil, fmt.Errorf("invalid sort %q (must be date, name or size)", req.Sort)
+	}
+	switch req.Order {
+	case "":
+		page.Desc = page.Sort == repository.FileSortDate
+	case "asc", "desc":
+		page.Desc = req.Order == "desc"
+	default:
+		return nil, fmt.Errorf("invalid order %q (must be asc or desc)", req.Order)
+	}
+	switch {
+	case page.Limit <= 0:
+		page.Limit = defaultFilePageSize
+	case page.Limit > maxFilePageSize:
+		page.Limit = maxFilePageSize
+	}
+	if req.Cursor != "" {
+		after, err := decodeFileCursor(req.Cursor, page)
+		if err != nil {
+			return nil, err
+		}
+		page.After = after
+	}
+
+	filter := repository.FileFilter{
+		UserID:        req.UserID,
+		ByFolder:      req.FolderID != nil,
+		Metadata:      req.Metadata,
+		ContentType:   req.ContentType,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		MinSize:       req.MinSize,
+		MaxSize:       req.MaxSize,
+		NamePrefix:    req.NamePrefix,
+	}
+	if req.FolderID != nil && *req.FolderID != "" {
+		filter.FolderID = req.FolderID
+	}
+	for _, tag := range req.Tags {
+		filter.Tags = append(filter.Tags, strings.ToLower(strings.TrimSpace(tag)))
+	}
+
+	total, err := uc.fileRepo.Count(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("count files: %w", err)
+	}
+	// One extra file tells whether there is a next page.
+	limit := page.Limit
+	page.Limit++
+	assets, err := uc.fileRepo.List(ctx, filter, page)
 	if err != nil {
 		return nil, fmt.Errorf("find files: %w", err)
 	}
-	return assets, nil
+	resp := &ListFilesResponse{Files: assets, Total: total}
+	if len(assets) > limit {
+		resp.Files = assets[:limit]
+		resp.NextCursor = encodeFileCursor(&resp.Files[limit-1], page)
+	}
+
+	refs := make([]*entity.FileAsset, len(resp.Files))
+	for i := range resp.Files {
+		refs[i] = &resp.Files[i]
+	}
+	if err := uc.loadAttributes(ctx, refs...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// fileCursor is the opaque next_cursor of file listings. It records the
+// sort it was issued for, so it cannot be replayed against another.
+type fileCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
 }
 
-func decodeKey(keyStr string) ([]byte, error) {
-	key, err := base64.StdEncoding.DecodeString(keyStr)
+func encodeFileCursor(asset *entity.FileAsset, page repository.FilePage) string {
+	cursor := fileCursor{Sort: page.Sort, Desc: page.Desc, ID: asset.ID}
+	switch page.Sort {
+	case repository.FileSortName:
+		cursor.Value = asset.OriginalName
+	case repository.FileSortSize:
+		cursor.Value = strconv.FormatInt(asset.SizeBytes, 10)
+	default:
+		cursor.Value = asset.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeFileCursor(s string, page repository.FilePage) (*repository.FileCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor fileCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if cursor.Sort != page.Sort || cursor.Desc != page.Desc {
+		return nil, fmt.Errorf("invalid cursor: issued for another sort order")
+	}
+
+	after := &repository.FileCursor{ID: cursor.ID}
+	switch page.Sort {
+	case repository.FileSortName:
+		after.Value = cursor.Value
+	case repository.FileSortSize:
+		after.Value, err = strconv.ParseInt(cursor.Value, 10, 64)
+	default:
+		var t time.Time
+		t, err = time.Parse(time.RFC3339Nano, cursor.Value)
+		after.Value = t.UTC()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("decode key: %w", err)
+		return nil, fmt.Errorf("invalid cursor")
 	}
-	if len(key) != 32 {
-		return nil, fmt.Errorf("invalid key size")
+	return after, nil
+}
+
+// dataKey unwraps the data key stored with asset. Assets without one were
+// uploaded before keys were kept server-side and cannot be decrypted until
+// their key is imported; see ImportLegacyKey.
+func (uc *FileUseCase) dataKey(asset *entity.FileAsset) ([]byte, error) {
+	if len(asset.WrappedKey) == 0 {
+		return nil, fmt.Errorf("no data key stored for file")
+	}
+	key, err := uc.keySvc.UnwrapKey(asset.WrappedKey, asset.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap key: %w", err)
 	}
 	return key, nil
 }
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type readSeekCloser struct {
+	io.ReadSeeker
+	io.Closer
+}
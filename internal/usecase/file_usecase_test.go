@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+)
+
+func TestFileCursorRoundTrip(t *testing.T) {
+	asset := &entity.FileAsset{
+		ID:           "7d0f6a52-3c39-4f0e-9d8b-1f1f6c1e2a10",
+		OriginalName: "отчёт 2026.png",
+		SizeBytes:    1 << 40,
+		CreatedAt:    time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.FixedZone("MSK", 3*60*60)),
+	}
+	for _, tt := range []struct {
+		sort string
+		want any
+	}{
+		{repository.FileSortDate, asset.CreatedAt.UTC()},
+		{repository.FileSortName, asset.OriginalName},
+		{repository.FileSortSize, asset.SizeBytes},
+	} {
+		for _, desc := range []bool{false, true} {
+			page := repository.FilePage{Sort: tt.sort, Desc: desc}
+			s := encodeFileCursor(asset, page)
+			if strings.ContainsAny(s, "+/=") {
+				t.Errorf("%s: cursor %q is not URL-safe", tt.sort, s)
+			}
+			after, err := decodeFileCursor(s, page)
+			if err != nil {
+				t.Fatalf("%s desc=%v: decode: %v", tt.sort, desc, err)
+			}
+			if after.ID != asset.ID || after.Value != tt.want {
+				t.Errorf("%s desc=%v: decoded (%v, %s), want (%v, %s)", tt.sort, desc, after.Value, after.ID, tt.want, asset.ID)
+			}
+		}
+	}
+}
+
+func TestFileCursorRejected(t *testing.T) {
+	asset := &entity.FileAsset{ID: "id-1", OriginalName: "a.png", SizeBytes: 10, CreatedAt: time.Now()}
+	byName := repository.FilePage{Sort: repository.FileSortName}
+	cursor := encodeFileCursor(asset, byName)
+	raw := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+
+	for _, tt := range []struct {
+		name   string
+		cursor string
+		page   repository.FilePage
+		want   string
+	}{
+		{"not base64", "!!!", byName, "invalid cursor"},
+		{"padded base64", cursor + "==", byName, "invalid cursor"},
+		{"not JSON", raw("cursor"), byName, "invalid cursor"},
+		{"truncated", cursor[:len(cursor)-4], byName, "invalid cursor"},
+		{"no ID", raw(`{"s":"name","v":"a.png"}`), byName, "invalid cursor"},
+		{"size not a number", raw(`{"s":"size","v":"ten","id":"id-1"}`), repository.FilePage{Sort: repository.FileSortSize}, "invalid cursor"},
+		{"date not RFC 3339", raw(`{"s":"date","v":"yesterday","id":"id-1"}`), repository.FilePage{Sort: repository.FileSortDate}, "invalid cursor"},
+		{"other sort", cursor, repository.FilePage{Sort: repository.FileSortSize}, "issued for another sort order"},
+		{"other order", cursor, repository.FilePage{Sort: repository.FileSortName, Desc: true}, "issued for another sort order"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeFileCursor(tt.cursor, tt.page)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("decodeFileCursor = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportLegacyKey(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	alice := registerUser(t, env, "alice@example.com")
+	fileID := uploadFile(t, env, alice.ID, "photo.png", "image bytes")
+
+	// Make the file look like one uploaded before keys were stored: its key
+	// only survives in the upload token.
+	var asset entity.FileAsset
+	if err := env.db.First(&asset, "id = ?", fileID).Error; err != nil {
+		t.Fatal(err)
+	}
+	key, err := env.files.keySvc.UnwrapKey(asset.WrappedKey, asset.KeyID)
+	if err != nil {
+		t.Fatalf("UnwrapKey: %v", err)
+	}
+	if err := env.db.Model(&asset).Updates(map[string]any{"wrapped_key": nil, "key_id": ""}).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.files.GetFile(ctx, GetFileRequest{FileID: fileID, UserID: alice.ID})
+	wantErr(t, "GetFile without a key", err, "no data key stored for file")
+
+	wrong := make([]byte, len(key))
+	if _, err := rand.Read(wrong); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.files.ImportLegacyKey(ctx, fileID, wrong); err == nil || !strings.HasPrefix(err.Error(), "key does not match the file") {
+		t.Fatalf("ImportLegacyKey(wrong key): err = %v, want key does not match the file", err)
+	}
+	err = env.files.ImportLegacyKey(ctx, "00000000-0000-0000-0000-000000000000", key)
+	wantErr(t, "ImportLegacyKey(unknown file)", err, "file not found")
+
+	if err := env.files.ImportLegacyKey(ctx, fileID, key); err != nil {
+		t.Fatalf("ImportLegacyKey: %v", err)
+	}
+	resp, err := env.files.GetFile(ctx, GetFileRequest{FileID: fileID, UserID: alice.ID})
+	if err != nil {
+		t.Fatalf("GetFile after the import: %v", err)
+	}
+	content, _ := io.ReadAll(resp.Content)
+	resp.Content.Close()
+	if string(content) != "image bytes" {
+		t.Fatalf("content = %q", content)
+	}
+	err = env.files.ImportLegacyKey(ctx, fileID, key)
+	wantErr(t, "second ImportLegacyKey", err, "file already has a data key")
+}
@@ -0,0 +1,336 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	maxFolderName = 255
+	// maxFolderDepth bounds nesting, and with it every walk up or down the
+	// tree.
+	maxFolderDepth = 32
+)
+
+// FolderUseCase organises the files of a user into folders. Folders are
+// private to their user; files keep their stored objects when they move.
+type FolderUseCase struct {
+	folderRepo repository.FolderRepository
+	fileRepo   repository.FileRepository
+	files      *FileUseCase
+	log        *zap.Logger
+}
+
+func NewFolderUseCase(
+	folderRepo repository.FolderRepository,
+	fileRepo repository.FileRepository,
+	files *FileUseCase,
+	log *zap.Logger,
+) *FolderUseCase {
+	return &FolderUseCase{
+		folderRepo: folderRepo,
+		fileRepo:   fileRepo,
+		files:      files,
+		log:        log,
+	}
+}
+
+// CreateFolder creates a folder inside parentID, or at the top level when
+// parentID is empty.
+func (uc *FolderUseCase) CreateFolder(ctx context.Context, userID, name, parentID string) (*entity.Folder, error) {
+	name, err := validateFolderName(name)
+	if err != nil {
+		return nil, err
+	}
+	folder := &entity.Folder{UserID: userID, Name: name}
+	if parentID != "" {
+		path, err := uc.Path(ctx, userID, parentID)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) >= maxFolderDepth {
+			return nil, fmt.Errorf("folders nest at most %d deep", maxFolderDepth)
+		}
+		folder.ParentID = &parentID
+	}
+	if err := uc.checkNameFree(ctx, folder); err != nil {
+		return nil, err
+	}
+
+	if err := uc.folderRepo.Create(ctx, folder); err != nil {
+		return nil, fmt.Errorf("create folder: %w", err)
+	}
+	return folder, nil
+}
+
+func (uc *FolderUseCase) GetFolder(ctx context.Context, userID, id string) (*entity.Folder, error) {
+	return uc.ownFolder(ctx, userID, id)
+}
+
+// ListFolders returns the folders inside parentID, or at the top level when
+// parentID is empty.
+func (uc *FolderUseCase) ListFolders(ctx context.Context, userID, parentID string) ([]entity.Folder, error) {
+	parent, err := uc.folderRef(ctx, userID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := uc.folderRepo.ListChildren(ctx, userID, parent)
+	if err != nil {
+		return nil, fmt.Errorf("list folders: %w", err)
+	}
+	return folders, nil
+}
+
+// ListFiles is FileUseCase.ListFiles after checking that req.FolderID is a
+// folder of the user.
+func (uc *FolderUseCase) ListFiles(ctx context.Context, req ListFilesRequest) (*ListFilesResponse, error) {
+	if req.FolderID != nil {
+		if _, err := uc.folderRef(ctx, req.UserID, *req.FolderID); err != nil {
+			return nil, err
+		}
+	}
+	return uc.files.ListFiles(ctx, req)
+}
+
+type UpdateFolderRequest struct {
+	UserID   string
+	FolderID string
+	Name     *string // nil keeps the name
+	ParentID *string // nil keeps the parent; "" moves to the top level
+}
+
+// UpdateFolder renames and/or moves a folder with everything inside it.
+func (uc *FolderUseCase) UpdateFolder(ctx context.Context, req UpdateFolderRequest) (*entity.Folder, error) {
+	folder, err := uc.ownFolder(ctx, req.UserID, req.FolderID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		if folder.Name, err = validateFolderName(*req.Name); err != nil {
+			return nil, err
+		}
+	}
+	if req.ParentID != nil {
+		if err := uc.checkMove(ctx, folder, *req.ParentID); err != nil {
+			return nil, err
+		}
+		folder.ParentID = nil
+		if *req.ParentID != "" {
+			folder.ParentID = req.ParentID
+		}
+	}
+	if err := uc.checkNameFree(ctx, folder); err != nil {
+		return nil, err
+	}
+
+	if err := uc.folderRepo.Update(ctx, folder); err != nil {
+		return nil, fmt.Errorf("update folder: %w", err)
+	}
+	return folder, nil
+}
+
+// checkMove refuses to move folder into parentID when that would put it
+// inside itself or nest the tree too deep.
+func (uc *FolderUseCase) checkMove(ctx context.Context, folder *entity.Folder, parentID string) error {
+	depth := 0
+	if parentID != "" {
+		path, err := uc.Path(ctx, folder.UserID, parentID)
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(path, func(f entity.Folder) bool { return f.ID == folder.ID }) {
+			return fmt.Errorf("cannot move a folder into itself or one of its subfolders")
+		}
+		depth = len(path)
+	}
+	levels, err := uc.subtree(ctx, folder.ID)
+	if err != nil {
+		return err
+	}
+	if depth+len(levels) > maxFolderDepth {
+		return fmt.Errorf("folders nest at most %d deep", maxFolderDepth)
+	}
+	return nil
+}
+
+type DeleteFolderResponse struct {
+	Folders int
+	Files   int
+}
+
+// DeleteFolder deletes a folder. Unless recursive is set it must be empty;
+// otherwise its subfolders and all files in them are deleted with it.
+func (uc *FolderUseCase) DeleteFolder(ctx context.Context, userID, id string, recursive bool) (*DeleteFolderResponse, error) {
+	folder, err := uc.ownFolder(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := uc.subtree(ctx, folder.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids := slices.Concat(levels...)
+
+	if !recursive {
+		files, err := uc.fileRepo.CountInFolder(ctx, folder.ID)
+		if err != nil {
+			return nil, fmt.Errorf("count files: %w", err)
+		}
+		if len(ids) > 1 || files > 0 {
+			return nil, fmt.Errorf("folder not empty")
+		}
+	}
+
+	assets, err := uc.fileRepo.FindByFolderIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("find files: %w", err)
+	}
+	for i := range assets {
+		if err := uc.files.remove(ctx, &assets[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := uc.folderRepo.Delete(ctx, ids); err != nil {
+		return nil, fmt.Errorf("delete folders: %w", err)
+	}
+	uc.log.Info("folder deleted",
+		zap.String("folder_id", folder.ID),
+		zap.Int("folders", len(ids)),
+		zap.Int("files", len(assets)))
+	return &DeleteFolderResponse{Folders: len(ids), Files: len(assets)}, nil
+}
+
+// Path returns the breadcrumbs of a folder: its ancestors from the top
+// level down, ending with the folder itself.
+func (uc *FolderUseCase) Path(ctx context.Context, userID, id string) ([]entity.Folder, error) {
+	folder, err := uc.ownFolder(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	path := []entity.Folder{*folder}
+	for folder.ParentID != nil {
+		if len(path) > maxFolderDepth {
+			return nil, fmt.Errorf("folder %s: path too deep", id)
+		}
+		if folder, err = uc.ownFolder(ctx, userID, *folder.ParentID); err != nil {
+			return nil, fmt.Errorf("folder %s: broken path: %w", id, err)
+		}
+		path = append(path, *folder)
+	}
+	slices.Reverse(path)
+	return path, nil
+}
+
+// MoveFile puts a file into folderID, or at the top level when folderID is
+// empty. Editors of the file may move it, but only among the folders of
+// the user who uploaded it.
+func (uc *FolderUseCase) MoveFile(ctx context.Context, actorID, fileID, folderID string) (*entity.FileAsset, error) {
+	asset, err := uc.files.AuthorizeUser(ctx, fileID, actorID, entity.FileRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	var target *string
+	if folderID != "" {
+		owner := ""
+		if asset.UserID != nil {
+			owner = *asset.UserID
+		}
+		folder, err := uc.ownFolder(ctx, owner, folderID)
+		if err != nil {
+			return nil, err
+		}
+		target = &folder.ID
+	}
+
+	if err := uc.fileRepo.UpdateFolder(ctx, asset.ID, target); err != nil {
+		return nil, fmt.Errorf("move file: %w", err)
+	}
+	asset.FolderID = target
+	return asset, nil
+}
+
+// subtree returns the IDs of folder id and all folders below it, level by
+// level, starting with id itself.
+func (uc *FolderUseCase) subtree(ctx context.Context, id string) ([][]string, error) {
+	levels := [][]string{{id}}
+	for {
+		children, err := uc.folderRepo.ListChildrenOf(ctx, levels[len(levels)-1])
+		if err != nil {
+			return nil, fmt.Errorf("list subfolders: %w", err)
+		}
+		if len(children) == 0 {
+			return levels, nil
+		}
+		if len(levels) > maxFolderDepth {
+			return nil, fmt.Errorf("folder %s: tree too deep", id)
+		}
+		level := make([]string, len(children))
+		for i, child := range children {
+			level[i] = child.ID
+		}
+		levels = append(levels, level)
+	}
+}
+
+func (uc *FolderUseCase) checkNameFree(ctx context.Context, folder *entity.Folder) error {
+	taken, err := uc.folderRepo.NameTaken(ctx, folder.UserID, folder.ParentID, folder.Name, folder.ID)
+	if err != nil {
+		return fmt.Errorf("check folder name: %w", err)
+	}
+	if taken {
+		return fmt.Errorf("a folder named %q already exists there", folder.Name)
+	}
+	return nil
+}
+
+// ownFolder loads folder id of userID. Folders of other users are reported
+// as missing.
+func (uc *FolderUseCase) ownFolder(ctx context.Context, userID, id string) (*entity.Folder, error) {
+	folder, err := uc.folderRepo.FindByID(ctx, id)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("folder not found")
+		}
+		return nil, fmt.Errorf("find folder: %w", err)
+	}
+	if folder.UserID != userID {
+		return nil, fmt.Errorf("folder not found")
+	}
+	return folder, nil
+}
+
+// folderRef checks that id is a folder of userID and returns it as a
+// reference, nil for the top level.
+func (uc *FolderUseCase) folderRef(ctx context.Context, userID, id string) (*string, error) {
+	if id == "" {
+		return nil, nil
+	}
+	folder, err := uc.ownFolder(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &folder.ID, nil
+}
+
+func validateFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", fmt.Errorf("folder name is required")
+	case len(name) > maxFolderName:
+		return "", fmt.Errorf("folder name must be at most %d bytes", maxFolderName)
+	case name == "." || name == "..",
+		strings.ContainsAny(name, `/\`),
+		strings.ContainsFunc(name, unicode.IsControl):
+		return "", fmt.Errorf("folder name must not be . or .. or contain slashes or control characters")
+	}
+	return name, nil
+}
@@ -0,0 +1,309 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/internal/domain/service"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const rewrapBatchSize = 100
+
+// ErrRotationInProgress is returned when a re-wrap is started while another
+// one is still running in this process.
+var ErrRotationInProgress = errors.New("key rotation already in progress")
+
+type KeyUseCase struct {
+	fileRepo     repository.FileRepository
+	blobRepo     repository.BlobRepository
+	rotationRepo repository.KeyRotationRepository
+	uploadRepo   repository.UploadSessionRepository
+	totpRepo     repository.TOTPRepository
+	keySvc       service.KeyService
+	log          *zap.Logger
+
+	running sync.Mutex
+}
+
+func NewKeyUseCase(
+	fileRepo repository.FileRepository,
+	blobRepo repository.BlobRepository,
+	rotationRepo repository.KeyRotationRepository,
+	uploadRepo repository.UploadSessionRepository,
+	totpRepo repository.TOTPRepository,
+	keySvc service.KeyService,
+	log *zap.Logger,
+) *KeyUseCase {
+	return &KeyUseCase{
+		fileRepo:     fileRepo,
+		blobRepo:     blobRepo,
+		rotationRepo: rotationRepo,
+		uploadRepo:   uploadRepo,
+		totpRepo:     totpRepo,
+		keySvc:       keySvc,
+		log:          log,
+	}
+}
+
+type KeyStatusResponse struct {
+	ActiveKeyID string
+	KeyIDs      []string
+	FileKeys    map[string]int64
+	BlobKeys    map[string]int64
+	TOTPKeys    map[string]int64
+	Stale       int64
+	// Unkeyed counts files without a stored data key: uploads from before
+	// keys were kept server-side, which can no longer be decrypted.
+	Unkeyed      int64
+	LastRotation *entity.KeyRotation
+}
+
+// Status reports how many data keys and TOTP secrets are wrapped under each
+// KEK.
+func (uc *KeyUseCase) Status(ctx context.Context) (*KeyStatusResponse, error) {
+	fileKeys, err := uc.fileRepo.CountByKeyID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("count file keys: %w", err)
+	}
+	unkeyed, err := uc.fileRepo.CountWithoutKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("count files without key: %w", err)
+	}
+	blobKeys, err := uc.blobRepo.CountByKeyID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("count blob keys: %w", err)
+	}
+	totpKeys, err := uc.totpRepo.CountByKeyID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("count totp keys: %w", err)
+	}
+
+	active := uc.keySvc.ActiveKeyID()
+	resp := &KeyStatusResponse{
+		ActiveKeyID: active,
+		KeyIDs:      uc.keySvc.KeyIDs(),
+		FileKeys:    fileKeys,
+		BlobKeys:    blobKeys,
+		TOTPKeys:    totpKeys,
+		Unkeyed:     unkeyed,
+	}
+	for _, counts := range []map[string]int64{fileKeys, blobKeys, totpKeys} {
+		for id, n := range counts {
+			if id != active {
+				resp.Stale += n
+			}
+		}
+	}
+
+	last, err := uc.rotationRepo.FindLatest(ctx)
+	if err != nil && !errors.Is(err, utils.ErrRecordNotFound) {
+		return nil, fmt.Errorf("find last rotation: %w", err)
+	}
+	resp.LastRotation = last
+	return resp, nil
+}
+
+// Rewrap re-wraps every data key held under an inactive KEK with the active
+// KEK. Blob ciphertext is never touched. Progress is persisted in a
+// key_rotations row, which is returned once the run finishes. Keys that fail
+// to unwrap are counted and left in place so a later run can retry them.
+func (uc *KeyUseCase) Rewrap(ctx context.Context, trigger string) (*entity.KeyRotation, error) {
+	if !uc.running.TryLock() {
+		return nil, ErrRotationInProgress
+	}
+	defer uc.running.Unlock()
+
+	status, err := uc.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rotation := &entity.KeyRotation{
+		TargetKeyID: status.ActiveKeyID,
+		Trigger:     trigger,
+		Status:      entity.KeyRotationRunning,
+		Total:       status.Stale,
+		StartedAt:   time.Now().UTC(),
+	}
+	if err := uc.rotationRepo.Create(ctx, rotation); err != nil {
+		return nil, fmt.Errorf("create rotation: %w", err)
+	}
+	uc.log.Info("key rotation started",
+		zap.String("rotation_id", rotation.ID),
+		zap.String("target_kek", rotation.TargetKeyID),
+		zap.Int64("total", rotation.Total))
+
+	runErr := uc.rewrapFiles(ctx, rotation)
+	if runErr == nil {
+		runErr = uc.rewrapBlobs(ctx, rotation)
+	}
+	if runErr == nil {
+		runErr = uc.rewrapTOTP(ctx, rotation)
+	}
+
+	finished := time.Now().UTC()
+	rotation.FinishedAt = &finished
+	rotation.Status = entity.KeyRotationCompleted
+	if runErr != nil {
+		rotation.Status = entity.KeyRotationFailed
+		rotation.Error = runErr.Error()
+	} else if rotation.Failed > 0 {
+		rotation.Status = entity.KeyRotationFailed
+		rotation.Error = fmt.Sprintf("%d keys could not be re-wrapped", rotation.Failed)
+	}
+	// The run context may already be cancelled; the outcome is still recorded.
+	if err := uc.rotationRepo.Update(context.WithoutCancel(ctx), rotation); err != nil {
+		uc.log.Warn("rotation record update failed", zap.Error(err))
+	}
+
+	uc.log.Info("key rotation finished",
+		zap.String("rotation_id", rotation.ID),
+		zap.String("status", rotation.Status),
+		zap.Int64("rewrapped", rotation.Rewrapped),
+		zap.Int64("failed", rotation.Failed))
+
+	if runErr != nil {
+		return rotation, runErr
+	}
+	return rotation, nil
+}
+
+func (uc *KeyUseCase) rewrapFiles(ctx context.Context, rotation *entity.KeyRotation) error {
+	after := ""
+	for {
+		assets, err := uc.fileRepo.ListByStaleKey(ctx, rotation.TargetKeyID, after, rewrapBatchSize)
+		if err != nil {
+			return fmt.Errorf("list files: %w", err)
+		}
+		for _, asset := range assets {
+			after = asset.ID
+			wrapped, err := uc.rewrapKey(asset.WrappedKey, asset.KeyID, rotation.TargetKeyID)
+			if err == nil {
+				err = uc.fileRepo.UpdateWrappedKey(ctx, asset.ID, wrapped, rotation.TargetKeyID)
+			}
+			uc.recordRewrap(rotation, "file", asset.ID, err)
+		}
+		if err := uc.checkpoint(ctx, rotation); err != nil {
+			return err
+		}
+		if len(assets) < rewrapBatchSize {
+			return nil
+		}
+	}
+}
+
+func (uc *KeyUseCase) rewrapBlobs(ctx context.Context, rotation *entity.KeyRotation) error {
+	after := ""
+	for {
+		blobs, err := uc.blobRepo.ListByStaleKey(ctx, rotation.TargetKeyID, after, rewrapBatchSize)
+		if err != nil {
+			return fmt.Errorf("list blobs: %w", err)
+		}
+		for _, blob := range blobs {
+			after = blob.ID
+			wrapped, err := uc.rewrapKey(blob.WrappedKey, blob.KeyID, rotation.TargetKeyID)
+			if err == nil {
+				err = uc.blobRepo.UpdateWrappedKey(ctx, blob.ID, wrapped, rotation.TargetKeyID)
+			}
+			uc.recordRewrap(rotation, "blob", blob.ID, err)
+		}
+		if err := uc.checkpoint(ctx, rotation); err != nil {
+			return err
+		}
+		if len(blobs) < rewrapBatchSize {
+			return nil
+		}
+	}
+}
+
+func (uc *KeyUseCase) rewrapTOTP(ctx context.Context, rotation *entity.KeyRotation) error {
+	after := ""
+	for {
+		creds, err := uc.totpRepo.ListByStaleKey(ctx, rotation.TargetKeyID, after, rewrapBatchSize)
+		if err != nil {
+			return fmt.Errorf("list totp credentials: %w", err)
+		}
+		for _, cred := range creds {
+			after = cred.UserID
+			wrapped, err := uc.rewrapKey(cred.WrappedSecret, cred.KeyID, rotation.TargetKeyID)
+			if err == nil {
+				err = uc.totpRepo.UpdateWrappedSecret(ctx, cred.UserID, wrapped, rotation.TargetKeyID)
+			}
+			uc.recordRewrap(rotation, "totp", cred.UserID, err)
+		}
+		if err := uc.checkpoint(ctx, rotation); err != nil {
+			return err
+		}
+		if len(creds) < rewrapBatchSize {
+			return nil
+		}
+	}
+}
+
+func (uc *KeyUseCase) rewrapKey(wrapped []byte, kekID, target string) ([]byte, error) {
+	dataKey, err := uc.keySvc.UnwrapKey(wrapped, kekID)
+	if err != nil {
+		return nil, err
+	}
+	rewrapped, newKEK, err := uc.keySvc.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if newKEK != target {
+		return nil, fmt.Errorf("active kek changed to %q during rotation", newKEK)
+	}
+	return rewrapped, nil
+}
+
+func (uc *KeyUseCase) recordRewrap(rotation *entity.KeyRotation, kind, id string, err error) {
+	if err != nil {
+		rotation.Failed++
+		uc.log.Warn("rewrap failed", zap.String("kind", kind), zap.String("id", id), zap.Error(err))
+		return
+	}
+	rotation.Rewrapped++
+}
+
+// checkpoint persists progress after each batch and stops on cancellation.
+func (uc *KeyUseCase) checkpoint(ctx context.Context, rotation *entity.KeyRotation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := uc.rotationRepo.Update(ctx, rotation); err != nil {
+		return fmt.Errorf("update rotation: %w", err)
+	}
+	return nil
+}
+
+// CheckRetire returns an error unless kekID can be removed: it must not be
+// the active KEK and no file, blob or TOTP secret may still be wrapped under
+// it.
+func (uc *KeyUseCase) CheckRetire(ctx context.Context, kekID string) error {
+	if kekID == uc.keySvc.ActiveKeyID() {
+		return fmt.Errorf("kek %q is active", kekID)
+	}
+	status, err := uc.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if n := status.FileKeys[kekID] + status.BlobKeys[kekID] + status.TOTPKeys[kekID]; n > 0 {
+		return fmt.Errorf("kek %q still wraps %d keys", kekID, n)
+	}
+	// Staged upload parts are short-lived and not re-wrapped; the key must
+	// outlive the uploads that use it.
+	uploadKeys, err := uc.uploadRepo.CountByKeyID(ctx)
+	if err != nil {
+		return fmt.Errorf("count upload keys: %w", err)
+	}
+	if n := uploadKeys[kekID]; n > 0 {
+		return fmt.Errorf("kek %q is used by %d unfinished uploads", kekID, n)
+	}
+	return nil
+}
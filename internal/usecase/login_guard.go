@@ -0,0 +1,129 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// loginFailureWindow is how long a failed login is remembered when no
+	// other follows.
+	loginFailureWindow = 24 * time.Hour
+	loginBaseDelay     = time.Second
+)
+
+// LoginPolicy sets how failed logins slow down further attempts.
+type LoginPolicy struct {
+	// FreeAttempts failures are allowed before attempts are delayed.
+	FreeAttempts int
+	// MaxLockout caps the delay, which doubles with every further failure.
+	MaxLockout time.Duration
+}
+
+// LoginLockedError is returned while earlier failures keep logins to an
+// account refused.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts; retry in %d seconds", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// LoginGuard tracks failed logins per email address and refuses attempts
+// with exponential backoff. Addresses without an account are tracked the
+// same way, so the lockout reveals nothing about which ones exist.
+type LoginGuard struct {
+	repo   repository.LoginThrottleRepository
+	policy LoginPolicy
+	log    *zap.Logger
+	now    func() time.Time
+}
+
+func NewLoginGuard(repo repository.LoginThrottleRepository, policy LoginPolicy, log *zap.Logger) *LoginGuard {
+	return &LoginGuard{
+		repo:   repo,
+		policy: policy,
+		log:    log,
+		now:    time.Now,
+	}
+}
+
+// Check returns a *LoginLockedError while attempts for email are refused.
+func (g *LoginGuard) Check(ctx context.Context, email string) error {
+	throttle, err := g.repo.Find(ctx, email)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil
+		}
+		return fmt.Errorf("find login throttle: %w", err)
+	}
+	now := g.now().UTC()
+	if throttle.Locked(now) {
+		return &LoginLockedError{RetryAfter: throttle.LockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// Failed records a failed attempt and, past the free attempts, refuses the
+// next ones for a delay that doubles with each failure.
+func (g *LoginGuard) Failed(ctx context.Context, email string) error {
+	now := g.now().UTC()
+	failures, err := g.repo.RecordFailure(ctx, email, now, now.Add(-loginFailureWindow))
+	if err != nil {
+		return fmt.Errorf("record login failure: %w", err)
+	}
+	excess := failures - g.policy.FreeAttempts
+	if excess <= 0 {
+		return nil
+	}
+
+	delay := g.policy.MaxLockout
+	if excess <= 30 {
+		delay = min(loginBaseDelay<<(excess-1), g.policy.MaxLockout)
+	}
+	if err := g.repo.Lock(ctx, email, now.Add(delay)); err != nil {
+		return fmt.Errorf("lock login: %w", err)
+	}
+	if delay == g.policy.MaxLockout {
+		g.log.Warn("login locked after repeated failures",
+			zap.String("email", email),
+			zap.Int("failures", failures),
+			zap.Duration("lockout", delay))
+	}
+	return nil
+}
+
+// Succeeded forgets the failures of email.
+func (g *LoginGuard) Succeeded(ctx context.Context, email string) {
+	if _, err := g.repo.Clear(ctx, email); err != nil {
+		g.log.Warn("clear login throttle failed", zap.Error(err))
+	}
+}
+
+// Unlock lifts a lockout and forgets the failures of email, reporting
+// whether there were any.
+func (g *LoginGuard) Unlock(ctx context.Context, email string) (bool, error) {
+	cleared, err := g.repo.Clear(ctx, strings.TrimSpace(strings.ToLower(email)))
+	if err != nil {
+		return false, fmt.Errorf("clear login throttle: %w", err)
+	}
+	return cleared, nil
+}
+
+// PurgeStale deletes records that no longer affect any login.
+func (g *LoginGuard) PurgeStale(ctx context.Context) (int64, error) {
+	now := g.now().UTC()
+	n, err := g.repo.DeleteStale(ctx, now.Add(-loginFailureWindow), now)
+	if err != nil {
+		return 0, fmt.Errorf("delete stale login throttles: %w", err)
+	}
+	return n, nil
+}
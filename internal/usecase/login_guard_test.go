@@ -0,0 +1,202 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	infrarepo "github.com/filehash/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+// fixedClock is a settable time source for LoginGuard.
+type fixedClock struct{ t time.Time }
+
+func (c *fixedClock) now() time.Time          { return c.t }
+func (c *fixedClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newClockedGuard(env *testEnv, policy LoginPolicy) (*LoginGuard, *fixedClock) {
+	clock := &fixedClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	guard := NewLoginGuard(infrarepo.NewLoginThrottleRepository(env.db), policy, zap.NewNop())
+	guard.now = clock.now
+	return guard, clock
+}
+
+// retryAfter returns the delay of a lockout, or 0 when attempts are allowed.
+func retryAfter(t *testing.T, guard *LoginGuard, key string) time.Duration {
+	t.Helper()
+	err := guard.Check(context.Background(), key)
+	if err == nil {
+		return 0
+	}
+	var locked *LoginLockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("Check(%s): %v", key, err)
+	}
+	return locked.RetryAfter
+}
+
+func TestLoginGuardBackoff(t *testing.T) {
+	ctx := context.Background()
+	guard, clock := newClockedGuard(newTestEnv(t), LoginPolicy{FreeAttempts: 3, MaxLockout: 10 * time.Second})
+	const key = "alice@example.com"
+
+	for range 3 {
+		if err := guard.Failed(ctx, key); err != nil {
+			t.Fatalf("Failed: %v", err)
+		}
+		if d := retryAfter(t, guard, key); d != 0 {
+			t.Fatalf("locked for %v within the free attempts", d)
+		}
+	}
+
+	// Each further failure doubles the delay, up to MaxLockout.
+	for _, want := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		want *= time.Second
+		if err := guard.Failed(ctx, key); err != nil {
+			t.Fatalf("Failed: %v", err)
+		}
+		if d := retryAfter(t, guard, key); d != want {
+			t.Fatalf("lockout = %v, want %v", d, want)
+		}
+		clock.advance(want - time.Millisecond)
+		if d := retryAfter(t, guard, key); d != time.Millisecond {
+			t.Fatalf("lockout just before it ends = %v, want 1ms", d)
+		}
+		clock.advance(time.Millisecond)
+		if d := retryAfter(t, guard, key); d != 0 {
+			t.Fatalf("still locked for %v after the delay", d)
+		}
+	}
+	if err := (&LoginLockedError{RetryAfter: 1500 * time.Millisecond}).Error(); err != "too many failed attempts; retry in 2 seconds" {
+		t.Fatalf("LoginLockedError = %q", err)
+	}
+
+	// Failures are forgotten after a quiet day, and on success.
+	clock.advance(loginFailureWindow + time.Second)
+	if err := guard.Failed(ctx, key); err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+	if d := retryAfter(t, guard, key); d != 0 {
+		t.Fatalf("locked for %v after the failure window", d)
+	}
+	for range 4 {
+		_ = guard.Failed(ctx, key)
+	}
+	if retryAfter(t, guard, key) == 0 {
+		t.Fatal("not locked after exceeding the free attempts again")
+	}
+	guard.Succeeded(ctx, key)
+	if d := retryAfter(t, guard, key); d != 0 {
+		t.Fatalf("locked for %v after a success", d)
+	}
+}
+
+func TestLoginGuardUnlockAndPurge(t *testing.T) {
+	ctx := context.Background()
+	guard, clock := newClockedGuard(newTestEnv(t), LoginPolicy{FreeAttempts: 0, MaxLockout: time.Hour})
+
+	_ = guard.Failed(ctx, "alice@example.com")
+	_ = guard.Failed(ctx, "bob@example.com")
+	if cleared, err := guard.Unlock(ctx, " Alice@Example.com "); err != nil || !cleared {
+		t.Fatalf("Unlock = %v, %v", cleared, err)
+	}
+	if d := retryAfter(t, guard, "alice@example.com"); d != 0 {
+		t.Fatalf("locked for %v after Unlock", d)
+	}
+	if cleared, err := guard.Unlock(ctx, "alice@example.com"); err != nil || cleared {
+		t.Fatalf("second Unlock = %v, %v; want false", cleared, err)
+	}
+
+	// A record goes once it neither locks nor counts toward a lockout.
+	if n, err := guard.PurgeStale(ctx); err != nil || n != 0 {
+		t.Fatalf("PurgeStale of a live lockout = %d, %v", n, err)
+	}
+	clock.advance(loginFailureWindow + time.Second)
+	if n, err := guard.PurgeStale(ctx); err != nil || n != 1 {
+		t.Fatalf("PurgeStale = %d, %v; want 1", n, err)
+	}
+}
+
+func TestLoginLockoutUnknownEmail(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	registerUser(t, env, "alice@example.com")
+	clock := &fixedClock{t: time.Now()}
+	env.guard.now = clock.now
+
+	// An address without an account locks exactly like one with, so the
+	// responses do not tell them apart.
+	for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+		for i := range 6 {
+			_, err := env.auth.Login(ctx, LoginRequest{Email: email, Password: "wrong password"})
+			if err == nil || err.Error() != "invalid credentials" {
+				t.Fatalf("%s attempt %d: err = %v, want invalid credentials", email, i+1, err)
+			}
+		}
+		_, err := env.auth.Login(ctx, LoginRequest{Email: email, Password: "correct horse battery"})
+		var locked *LoginLockedError
+		if !errors.As(err, &locked) || locked.RetryAfter != time.Second {
+			t.Fatalf("%s after 6 failures: err = %v, want a 1s lockout", email, err)
+		}
+	}
+
+	// The lockout holds even for the right password, then lifts.
+	clock.advance(time.Second)
+	if _, err := env.auth.Login(ctx, LoginRequest{Email: "alice@example.com", Password: "correct horse battery"}); err != nil {
+		t.Fatalf("Login after the lockout: %v", err)
+	}
+}
+
+func TestShareLinkPasswordLockout(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	owner := registerUser(t, env, "alice@example.com")
+	guard, clock := newClockedGuard(env, LoginPolicy{FreeAttempts: 2, MaxLockout: time.Minute})
+	shares := NewShareUseCase(infrarepo.NewShareRepository(env.db), infrarepo.NewUserRepository(env.db), nil, env.hasher, guard, zap.NewNop())
+
+	hash, err := env.hasher.Hash("link password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newShare := func(slug string) *entity.Share {
+		share := &entity.Share{Slug: slug, FileID: "file-1", UserID: owner.ID, PasswordHash: hash, ExpiresAt: time.Now().Add(time.Hour)}
+		if err := env.db.Create(share).Error; err != nil {
+			t.Fatalf("create share: %v", err)
+		}
+		return share
+	}
+	share, other := newShare("slug-1"), newShare("slug-2")
+
+	for range 3 {
+		_, err := shares.OpenShare(ctx, OpenShareRequest{Slug: share.Slug, Password: "guess"})
+		if err == nil || err.Error() != "invalid share password" {
+			t.Fatalf("wrong password: err = %v, want invalid share password", err)
+		}
+	}
+	// The link is locked even for the right password; the throttle is
+	// keyed by the link, so the owner's logins and other links are not.
+	var locked *LoginLockedError
+	if _, err := shares.OpenShare(ctx, OpenShareRequest{Slug: share.Slug, Password: "link password"}); !errors.As(err, &locked) {
+		t.Fatalf("locked link: err = %v, want a lockout", err)
+	}
+	if d := retryAfter(t, guard, "share:"+share.ID); d != time.Second {
+		t.Fatalf("share lockout = %v, want 1s", d)
+	}
+	if d := retryAfter(t, guard, owner.Email); d != 0 {
+		t.Fatalf("owner's logins locked for %v by a link", d)
+	}
+	if _, err := shares.OpenShare(ctx, OpenShareRequest{Slug: other.Slug, Password: "guess"}); err == nil || err.Error() != "invalid share password" {
+		t.Fatalf("other link: err = %v, want invalid share password", err)
+	}
+
+	clock.advance(time.Second)
+	if _, err := shares.OpenShare(ctx, OpenShareRequest{Slug: share.Slug, Password: "guess"}); err == nil || err.Error() != "invalid share password" {
+		t.Fatalf("after the lockout: err = %v, want invalid share password", err)
+	}
+	if d := retryAfter(t, guard, "share:"+share.ID); d != 2*time.Second {
+		t.Fatalf("share lockout after another failure = %v, want 2s", d)
+	}
+}
@@ -0,0 +1,313 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/internal/domain/service"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	recoveryCodeCount = 10
+	// recoveryCodeLength characters of Crockford's base32 alphabet, which
+	// leaves out easily confused letters, give 50 bits.
+	recoveryCodeLength   = 10
+	recoveryCodeAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+)
+
+// MFAUseCase manages TOTP enrollment and checks second factors.
+type MFAUseCase struct {
+	userRepo repository.UserRepository
+	totpRepo repository.TOTPRepository
+	authSvc  service.AuthService
+	totpSvc  service.TOTPService
+	keySvc   service.KeyService
+	log      *zap.Logger
+	now      func() time.Time
+}
+
+func NewMFAUseCase(
+	userRepo repository.UserRepository,
+	totpRepo repository.TOTPRepository,
+	authSvc service.AuthService,
+	totpSvc service.TOTPService,
+	keySvc service.KeyService,
+	log *zap.Logger,
+) *MFAUseCase {
+	return &MFAUseCase{
+		userRepo: userRepo,
+		totpRepo: totpRepo,
+		authSvc:  authSvc,
+		totpSvc:  totpSvc,
+		keySvc:   keySvc,
+		log:      log,
+		now:      time.Now,
+	}
+}
+
+type EnrollTOTPResponse struct {
+	Secret string // base32, for manual entry
+	URI    string // otpauth:// provisioning URI, for a QR code
+}
+
+// EnrollTOTP starts enrollment with a new secret. A pending enrollment is
+// replaced; an enabled one must be disabled first.
+func (uc *MFAUseCase) EnrollTOTP(ctx context.Context, userID string) (*EnrollTOTPResponse, error) {
+	user, err := uc.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	cred, err := uc.totpRepo.FindByUserID(ctx, userID)
+	if err != nil && err != utils.ErrRecordNotFound {
+		return nil, fmt.Errorf("find totp: %w", err)
+	}
+	if cred != nil && cred.Enabled() {
+		return nil, fmt.Errorf("two-factor authentication already enabled")
+	}
+
+	secret, err := uc.totpSvc.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, keyID, err := uc.keySvc.WrapKey(secret)
+	if err != nil {
+		return nil, fmt.Errorf("wrap totp secret: %w", err)
+	}
+	err = uc.totpRepo.Save(ctx, &entity.TOTPCredential{
+		UserID:        userID,
+		WrappedSecret: wrapped,
+		KeyID:         keyID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("save totp: %w", err)
+	}
+
+	return &EnrollTOTPResponse{
+		Secret: uc.totpSvc.EncodeSecret(secret),
+		URI:    uc.totpSvc.ProvisioningURI(secret, user.Email),
+	}, nil
+}
+
+// EnableTOTP completes enrollment with a code from the authenticator and
+// returns the recovery codes, which are not shown again.
+func (uc *MFAUseCase) EnableTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	cred, err := uc.totpRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("no pending two-factor enrollment")
+		}
+		return nil, fmt.Errorf("find totp: %w", err)
+	}
+	if cred.Enabled() {
+		return nil, fmt.Errorf("two-factor authentication already enabled")
+	}
+
+	step, ok, err := uc.verifyTOTP(cred, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid code")
+	}
+
+	codes, hashes, err := uc.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.totpRepo.Enable(ctx, userID, step, hashes); err != nil {
+		return nil, fmt.Errorf("enable totp: %w", err)
+	}
+	uc.log.Info("two-factor authentication enabled", zap.String("user_id", userID))
+	return codes, nil
+}
+
+type DisableTOTPRequest struct {
+	UserID   string
+	Password string
+	Code     string // TOTP or recovery code
+}
+
+// DisableTOTP turns two-factor authentication off. It takes both the
+// password and a second factor, so a stolen session alone cannot do it.
+func (uc *MFAUseCase) DisableTOTP(ctx context.Context, req DisableTOTPRequest) error {
+	user, err := uc.userRepo.FindByID(ctx, req.UserID)
+	if err != nil {
+		return fmt.Errorf("find user: %w", err)
+	}
+	if err := uc.authSvc.ComparePassword(user.Password, req.Password); err != nil {
+		return fmt.Errorf("invalid credentials")
+	}
+	if err := uc.CheckCode(ctx, req.UserID, req.Code); err != nil {
+		return err
+	}
+	if err := uc.totpRepo.Delete(ctx, req.UserID); err != nil {
+		return fmt.Errorf("delete totp: %w", err)
+	}
+	uc.log.Info("two-factor authentication disabled", zap.String("user_id", req.UserID))
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a TOTP
+// code; a recovery code is not accepted here.
+func (uc *MFAUseCase) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	cred, err := uc.enabledCredential(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.useTOTP(ctx, cred, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := uc.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.totpRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("replace recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// Enabled reports whether the user has completed TOTP enrollment.
+func (uc *MFAUseCase) Enabled(ctx context.Context, userID string) (bool, error) {
+	cred, err := uc.totpRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("find totp: %w", err)
+	}
+	return cred.Enabled(), nil
+}
+
+// CheckCode accepts a current TOTP code or an unused recovery code of the
+// user. Either is consumed: a TOTP code cannot be replayed and a recovery
+// code works once.
+func (uc *MFAUseCase) CheckCode(ctx context.Context, userID, code string) error {
+	cred, err := uc.enabledCredential(ctx, userID)
+	if err != nil {
+		return err
+	}
+	code = strings.TrimSpace(code)
+	if isDigits(code) {
+		return uc.useTOTP(ctx, cred, code)
+	}
+	return uc.useRecoveryCode(ctx, userID, code)
+}
+
+func (uc *MFAUseCase) enabledCredential(ctx context.Context, userID string) (*entity.TOTPCredential, error) {
+	cred, err := uc.totpRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("two-factor authentication not enabled")
+		}
+		return nil, fmt.Errorf("find totp: %w", err)
+	}
+	if !cred.Enabled() {
+		return nil, fmt.Errorf("two-factor authentication not enabled")
+	}
+	return cred, nil
+}
+
+func (uc *MFAUseCase) useTOTP(ctx context.Context, cred *entity.TOTPCredential, code string) error {
+	step, ok, err := uc.verifyTOTP(cred, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("invalid code")
+	}
+	advanced, err := uc.totpRepo.AdvanceStep(ctx, cred.UserID, step)
+	if err != nil {
+		return fmt.Errorf("record totp step: %w", err)
+	}
+	if !advanced {
+		// The code, or a later one, was already used.
+		return fmt.Errorf("invalid code")
+	}
+	return nil
+}
+
+func (uc *MFAUseCase) verifyTOTP(cred *entity.TOTPCredential, code string) (int64, bool, error) {
+	secret, err := uc.keySvc.UnwrapKey(cred.WrappedSecret, cred.KeyID)
+	if err != nil {
+		return 0, false, fmt.Errorf("unwrap totp secret: %w", err)
+	}
+	step, ok := uc.totpSvc.Verify(secret, strings.TrimSpace(code), uc.now())
+	return step, ok, nil
+}
+
+func (uc *MFAUseCase) useRecoveryCode(ctx context.Context, userID, code string) error {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLength {
+		return fmt.Errorf("invalid code")
+	}
+	codes, err := uc.totpRepo.ListUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("list recovery codes: %w", err)
+	}
+	for _, rc := range codes {
+		if uc.authSvc.ComparePassword(rc.CodeHash, code) != nil {
+			continue
+		}
+		used, err := uc.totpRepo.UseRecoveryCode(ctx, rc.ID)
+		if err != nil {
+			return fmt.Errorf("use recovery code: %w", err)
+		}
+		if !used {
+			break
+		}
+		uc.log.Info("recovery code used", zap.String("user_id", userID), zap.Int("remaining", len(codes)-1))
+		return nil
+	}
+	return fmt.Errorf("invalid code")
+}
+
+// newRecoveryCodes returns fresh codes formatted as xxxxx-xxxxx and their
+// hashes.
+func (uc *MFAUseCase) newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	buf := make([]byte, recoveryCodeLength)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("generate recovery code: %w", err)
+		}
+		raw := make([]byte, recoveryCodeLength)
+		for j, b := range buf {
+			raw[j] = recoveryCodeAlphabet[b&31]
+		}
+		hash, err := uc.authSvc.HashPassword(string(raw))
+		if err != nil {
+			return nil, nil, fmt.Errorf("hash recovery code: %w", err)
+		}
+		half := recoveryCodeLength / 2
+		codes[i] = string(raw[:half]) + "-" + string(raw[half:])
+		hashes[i] = hash
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,226 @@
+package usecase
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// totpCode computes the RFC 6238 code of secret at t independently of the
+// TOTP service: HMAC-SHA1, six digits, 30-second steps.
+func totpCode(secret []byte, t time.Time) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(t.Unix()/30))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// enableTOTP enrolls userID at now and returns the secret and the recovery
+// codes. The enrollment code uses up the step of now.
+func enableTOTP(t *testing.T, env *testEnv, userID string, now time.Time) ([]byte, []string) {
+	t.Helper()
+	ctx := context.Background()
+	env.mfa.now = func() time.Time { return now }
+	enrollment, err := env.mfa.EnrollTOTP(ctx, userID)
+	if err != nil {
+		t.Fatalf("EnrollTOTP: %v", err)
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("decode secret %q: %v", enrollment.Secret, err)
+	}
+	if !strings.Contains(enrollment.URI, "secret="+enrollment.Secret) {
+		t.Fatalf("provisioning URI %q does not carry the secret", enrollment.URI)
+	}
+	if _, err := env.mfa.EnableTOTP(ctx, userID, "0000000"); err == nil {
+		t.Fatal("EnableTOTP accepted a malformed code")
+	}
+	codes, err := env.mfa.EnableTOTP(ctx, userID, totpCode(secret, now))
+	if err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	return secret, codes
+}
+
+// stepStart is the beginning of a 30-second step, so offsets of whole
+// steps from it never straddle a boundary.
+var stepStart = time.Unix(1_800_000_000/30*30, 0)
+
+func TestTOTPCodeOncePerStep(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+	now := stepStart
+	secret, _ := enableTOTP(t, env, user.ID, now)
+
+	// The enrollment code is spent; the same step cannot be used again.
+	if err := env.mfa.CheckCode(ctx, user.ID, totpCode(secret, now)); err == nil || err.Error() != "invalid code" {
+		t.Fatalf("enrollment code reused: err = %v, want invalid code", err)
+	}
+
+	now = now.Add(30 * time.Second)
+	env.mfa.now = func() time.Time { return now }
+	code := totpCode(secret, now)
+	if err := env.mfa.CheckCode(ctx, user.ID, " "+code+" "); err != nil {
+		t.Fatalf("CheckCode: %v", err)
+	}
+	if err := env.mfa.CheckCode(ctx, user.ID, code); err == nil || err.Error() != "invalid code" {
+		t.Fatalf("replayed code: err = %v, want invalid code", err)
+	}
+	// The previous step is still inside the skew window but older than the
+	// last used one.
+	if err := env.mfa.CheckCode(ctx, user.ID, totpCode(secret, now.Add(-30*time.Second))); err == nil {
+		t.Fatal("code of an earlier step accepted after a later one")
+	}
+
+	// Concurrent logins with one fresh code: only one advances the step.
+	now = now.Add(30 * time.Second)
+	code = totpCode(secret, now)
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() { errs <- env.mfa.CheckCode(ctx, user.ID, code) }()
+	}
+	accepted := 0
+	for range cap(errs) {
+		if err := <-errs; err == nil {
+			accepted++
+		} else if err.Error() != "invalid code" {
+			t.Fatalf("CheckCode: %v", err)
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("code accepted %d times concurrently, want once", accepted)
+	}
+}
+
+func TestTOTPSkewWindow(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+	secret, _ := enableTOTP(t, env, user.ID, stepStart)
+
+	for i, tt := range []struct {
+		steps  int
+		accept bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	} {
+		// Each case runs well after the last used step, so only the skew
+		// decides.
+		now := stepStart.Add(time.Duration(10*(i+1)) * 30 * time.Second)
+		env.mfa.now = func() time.Time { return now }
+		err := env.mfa.CheckCode(ctx, user.ID, totpCode(secret, now.Add(time.Duration(tt.steps)*30*time.Second)))
+		if tt.accept && err != nil {
+			t.Errorf("code %d steps off: %v", tt.steps, err)
+		}
+		if !tt.accept && (err == nil || err.Error() != "invalid code") {
+			t.Errorf("code %d steps off: err = %v, want invalid code", tt.steps, err)
+		}
+	}
+}
+
+func TestRecoveryCodeUsedOnce(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+	_, codes := enableTOTP(t, env, user.ID, stepStart)
+
+	// Case, spaces and the dash are not significant.
+	if err := env.mfa.CheckCode(ctx, user.ID, " "+strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))+" "); err != nil {
+		t.Fatalf("CheckCode(recovery code): %v", err)
+	}
+	if err := env.mfa.CheckCode(ctx, user.ID, codes[0]); err == nil || err.Error() != "invalid code" {
+		t.Fatalf("reused recovery code: err = %v, want invalid code", err)
+	}
+
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() { errs <- env.mfa.CheckCode(ctx, user.ID, codes[1]) }()
+	}
+	accepted := 0
+	for range cap(errs) {
+		if err := <-errs; err == nil {
+			accepted++
+		} else if err.Error() != "invalid code" {
+			t.Fatalf("CheckCode: %v", err)
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("recovery code accepted %d times concurrently, want once", accepted)
+	}
+
+	// The other codes are unaffected; regenerating them takes a TOTP code.
+	if err := env.mfa.CheckCode(ctx, user.ID, codes[2]); err != nil {
+		t.Fatalf("CheckCode(another recovery code): %v", err)
+	}
+	if _, err := env.mfa.RegenerateRecoveryCodes(ctx, user.ID, codes[3]); err == nil {
+		t.Fatal("RegenerateRecoveryCodes accepted a recovery code")
+	}
+}
+
+func TestLoginMFAChallengeUsedOnce(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := registerUser(t, env, "alice@example.com")
+	_, codes := enableTOTP(t, env, user.ID, stepStart)
+
+	login, err := env.auth.Login(ctx, LoginRequest{Email: user.Email, Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if !login.MFARequired || login.Token != "" {
+		t.Fatalf("Login = %+v, want an MFA challenge only", login)
+	}
+
+	// Every request brings a different valid recovery code, so only the
+	// challenge decides which one gets in.
+	errs := make(chan error, 6)
+	for i := range cap(errs) {
+		code := codes[i]
+		go func() {
+			_, err := env.auth.LoginMFA(ctx, LoginMFARequest{MFAToken: login.MFAToken, Code: code})
+			errs <- err
+		}()
+	}
+	accepted := 0
+	for range cap(errs) {
+		if err := <-errs; err == nil {
+			accepted++
+		} else if err.Error() != "invalid mfa token" {
+			t.Fatalf("LoginMFA: %v", err)
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("challenge used %d times concurrently, want once", accepted)
+	}
+
+	// A wrong code also spends the challenge.
+	login, err = env.auth.Login(ctx, LoginRequest{Email: user.Email, Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := env.auth.LoginMFA(ctx, LoginMFARequest{MFAToken: login.MFAToken, Code: "aaaaa-aaaaa"}); err == nil {
+		t.Fatal("LoginMFA accepted a wrong code")
+	}
+	_, err = env.auth.LoginMFA(ctx, LoginMFARequest{MFAToken: login.MFAToken, Code: codes[cap(errs)]})
+	if err == nil || err.Error() != "invalid mfa token" {
+		t.Fatalf("challenge reused after a wrong code: err = %v, want invalid mfa token", err)
+	}
+}
@@ -0,0 +1,208 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/internal/domain/service"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// oidcStateTTL is how long a user may take at the identity provider.
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCUseCase signs users in through an external OpenID Connect provider.
+// Accounts are found by the provider's issuer and subject and created on
+// first login; the session that follows is the same as after Login.
+type OIDCUseCase struct {
+	repo     repository.OIDCRepository
+	userRepo repository.UserRepository
+	provider service.OIDCProvider
+	auth     *AuthUseCase
+	log      *zap.Logger
+}
+
+func NewOIDCUseCase(
+	repo repository.OIDCRepository,
+	userRepo repository.UserRepository,
+	provider service.OIDCProvider,
+	auth *AuthUseCase,
+	log *zap.Logger,
+) *OIDCUseCase {
+	return &OIDCUseCase{
+		repo:     repo,
+		userRepo: userRepo,
+		provider: provider,
+		auth:     auth,
+		log:      log,
+	}
+}
+
+type OIDCStartResponse struct {
+	AuthURL   string
+	State     string
+	ExpiresIn time.Duration
+}
+
+// Start begins a login: it stores a fresh state with its PKCE verifier and
+// nonce and returns the provider URL to send the browser to.
+func (uc *OIDCUseCase) Start(ctx context.Context) (*OIDCStartResponse, error) {
+	state, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authURL, err := uc.provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return nil, err
+	}
+	err = uc.repo.CreateState(ctx, &entity.OIDCState{
+		ID:           state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().UTC().Add(oidcStateTTL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("save state: %w", err)
+	}
+	return &OIDCStartResponse{AuthURL: authURL, State: state, ExpiresIn: oidcStateTTL}, nil
+}
+
+type OIDCCallbackRequest struct {
+	State string
+	Code  string
+}
+
+// Callback finishes a login when the provider redirects back. The state is
+// redeemed first, so a callback can be tried only once.
+func (uc *OIDCUseCase) Callback(ctx context.Context, req OIDCCallbackRequest) (*LoginResponse, error) {
+	if req.State == "" {
+		return nil, fmt.Errorf("state is required")
+	}
+	if req.Code == "" {
+		return nil, fmt.Errorf("code is required")
+	}
+
+	state, err := uc.repo.ConsumeState(ctx, req.State)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("invalid state")
+		}
+		return nil, fmt.Errorf("consume state: %w", err)
+	}
+	if !time.Now().UTC().Before(state.ExpiresAt) {
+		return nil, fmt.Errorf("invalid state: expired")
+	}
+
+	identity, err := uc.provider.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	user, err := uc.provision(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	// A second factor at the provider counts; otherwise a user who set up
+	// TOTP here is asked for it as after a password login.
+	return uc.auth.completeLogin(ctx, user, identity.MFA)
+}
+
+// provision returns the user linked to identity. An unknown identity gets
+// a new user, or is linked to the user with its email when the provider
+// vouches for the address.
+func (uc *OIDCUseCase) provision(ctx context.Context, identity *service.OIDCIdentity) (*entity.User, error) {
+	email := strings.TrimSpace(strings.ToLower(identity.Email))
+	now := time.Now().UTC()
+
+	linked, err := uc.repo.FindIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		user, err := uc.userRepo.FindByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("find user: %w", err)
+		}
+		if err := uc.repo.TouchIdentity(ctx, linked.ID, email, now); err != nil {
+			uc.log.Warn("update identity failed", zap.String("identity_id", linked.ID), zap.Error(err))
+		}
+		return user, nil
+	}
+	if err != utils.ErrRecordNotFound {
+		return nil, fmt.Errorf("find identity: %w", err)
+	}
+
+	if email == "" || !strings.Contains(email, "@") {
+		return nil, fmt.Errorf("provider returned no email address")
+	}
+	link := &entity.UserIdentity{
+		Issuer:      identity.Issuer,
+		Subject:     identity.Subject,
+		Email:       email,
+		LastLoginAt: &now,
+	}
+
+	user, err := uc.userRepo.FindByEmail(ctx, email)
+	switch {
+	case err == nil:
+		// Linking on an unverified address would hand the account to
+		// whoever typed it in at the provider.
+		if !identity.EmailVerified {
+			return nil, fmt.Errorf("email already registered")
+		}
+		link.UserID = user.ID
+		if err := uc.repo.CreateIdentity(ctx, link); err != nil {
+			return nil, fmt.Errorf("link identity: %w", err)
+		}
+		uc.log.Info("oidc identity linked", zap.String("user_id", user.ID), zap.String("issuer", identity.Issuer))
+		return user, nil
+	case err != utils.ErrRecordNotFound:
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+
+	// The user has no password; they sign in through the provider, or set
+	// one with a password reset.
+	user = &entity.User{Email: email}
+	if identity.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+	if err := uc.repo.CreateUserWithIdentity(ctx, user, link); err != nil {
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+	uc.log.Info("oidc user provisioned", zap.String("user_id", user.ID), zap.String("issuer", identity.Issuer))
+	return user, nil
+}
+
+// PurgeExpired deletes logins that were started but not finished in time.
+func (uc *OIDCUseCase) PurgeExpired(ctx context.Context) (int64, error) {
+	n, err := uc.repo.DeleteExpiredStates(ctx, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired oidc states: %w", err)
+	}
+	return n, nil
+}
+
+// randomToken returns 32 random bytes, base64url-encoded: enough for a
+// state, a nonce or a PKCE verifier (RFC 7636 asks for 43 to 128
+// characters).
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,230 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/service"
+	infrarepo "github.com/filehash/internal/infrastructure/repository"
+)
+
+// fakeOIDCProvider checks what the use case hands it the way a provider
+// would: the verifier must match the challenge of the login and the nonce
+// must be the one sent with it.
+type fakeOIDCProvider struct {
+	challenge string
+	nonce     string
+	identity  service.OIDCIdentity
+}
+
+func (p *fakeOIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	p.challenge, p.nonce = codeChallenge, nonce
+	return "https://idp.example/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (p *fakeOIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*service.OIDCIdentity, error) {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+		return nil, fmt.Errorf("authorization failed: invalid_grant: pkce verifier mismatch")
+	}
+	if nonce != p.nonce {
+		return nil, fmt.Errorf("invalid id token: nonce mismatch")
+	}
+	identity := p.identity
+	return &identity, nil
+}
+
+func newOIDCTestUseCase(t *testing.T) (*OIDCUseCase, *fakeOIDCProvider, *testEnv) {
+	t.Helper()
+	env := newTestEnv(t)
+	provider := &fakeOIDCProvider{identity: service.OIDCIdentity{
+		Issuer:        "https://idp.example",
+		Subject:       "sub-1",
+		Email:         "Alice@Example.com",
+		EmailVerified: true,
+	}}
+	uc := NewOIDCUseCase(infrarepo.NewOIDCRepository(env.db), infrarepo.NewUserRepository(env.db), provider, env.auth, env.auth.log)
+	return uc, provider, env
+}
+
+func TestOIDCCallback(t *testing.T) {
+	ctx := context.Background()
+	uc, _, _ := newOIDCTestUseCase(t)
+
+	start, err := uc.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if len(start.State) < 43 || !strings.Contains(start.AuthURL, url.QueryEscape(start.State)) {
+		t.Fatalf("Start = %+v", start)
+	}
+
+	resp, err := uc.Callback(ctx, OIDCCallbackRequest{State: start.State, Code: "code"})
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" || resp.MFARequired {
+		t.Fatalf("Callback = %+v, want a session", resp)
+	}
+
+	// A state is redeemed once.
+	if _, err := uc.Callback(ctx, OIDCCallbackRequest{State: start.State, Code: "code"}); err == nil || err.Error() != "invalid state" {
+		t.Fatalf("replayed Callback: err = %v, want invalid state", err)
+	}
+}
+
+func TestOIDCCallbackExpiredState(t *testing.T) {
+	ctx := context.Background()
+	uc, _, env := newOIDCTestUseCase(t)
+
+	start, err := uc.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := env.db.Model(&entity.OIDCState{}).Where("id = ?", start.State).
+		Update("expires_at", time.Now().UTC().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uc.Callback(ctx, OIDCCallbackRequest{State: start.State, Code: "code"}); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("Callback: err = %v, want expired state", err)
+	}
+}
+
+func TestOIDCCallbackUsesStoredVerifierAndNonce(t *testing.T) {
+	ctx := context.Background()
+	uc, provider, _ := newOIDCTestUseCase(t)
+
+	first, err := uc.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	// A second login in between replaces what the provider saw, so the
+	// first callback now carries a verifier and nonce that do not match.
+	if _, err := uc.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	_, err = uc.Callback(ctx, OIDCCallbackRequest{State: first.State, Code: "code"})
+	if err == nil || !strings.Contains(err.Error(), "pkce verifier mismatch") {
+		t.Fatalf("Callback: err = %v, want a verifier mismatch", err)
+	}
+
+	start, err := uc.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	provider.nonce = "replayed"
+	_, err = uc.Callback(ctx, OIDCCallbackRequest{State: start.State, Code: "code"})
+	if err == nil || !strings.Contains(err.Error(), "nonce mismatch") {
+		t.Fatalf("Callback: err = %v, want a nonce mismatch", err)
+	}
+}
+
+func TestOIDCProvision(t *testing.T) {
+	ctx := context.Background()
+	identity := func(subject, email string, verified bool) *service.OIDCIdentity {
+		return &service.OIDCIdentity{Issuer: "https://idp.example", Subject: subject, Email: email, EmailVerified: verified}
+	}
+
+	t.Run("creates a user on first login", func(t *testing.T) {
+		uc, _, _ := newOIDCTestUseCase(t)
+		user, err := uc.provision(ctx, identity("sub-1", " Alice@Example.com", true))
+		if err != nil {
+			t.Fatalf("provision: %v", err)
+		}
+		if user.Email != "alice@example.com" || user.Password != "" || user.EmailVerifiedAt == nil {
+			t.Fatalf("user = %+v", user)
+		}
+	})
+
+	t.Run("unverified email is not marked verified", func(t *testing.T) {
+		uc, _, _ := newOIDCTestUseCase(t)
+		user, err := uc.provision(ctx, identity("sub-1", "alice@example.com", false))
+		if err != nil {
+			t.Fatalf("provision: %v", err)
+		}
+		if user.EmailVerifiedAt != nil {
+			t.Fatal("address from an unverified claim was marked verified")
+		}
+	})
+
+	t.Run("finds the user by issuer and subject", func(t *testing.T) {
+		uc, _, _ := newOIDCTestUseCase(t)
+		first, err := uc.provision(ctx, identity("sub-1", "alice@example.com", true))
+		if err != nil {
+			t.Fatalf("provision: %v", err)
+		}
+		// The address at the provider changed; the subject still decides.
+		again, err := uc.provision(ctx, identity("sub-1", "alice@new.example", false))
+		if err != nil {
+			t.Fatalf("provision: %v", err)
+		}
+		if again.ID != first.ID {
+			t.Fatalf("second login got user %s, want %s", again.ID, first.ID)
+		}
+		// Same subject at another issuer is someone else.
+		other := identity("sub-1", "bob@example.com", true)
+		other.Issuer = "https://other-idp.example"
+		user, err := uc.provision(ctx, other)
+		if err != nil {
+			t.Fatalf("provision: %v", err)
+		}
+		if user.ID == first.ID {
+			t.Fatal("identity of another issuer was linked to the same user")
+		}
+	})
+
+	t.Run("links an existing user by verified email", func(t *testing.T) {
+		uc, _, env := newOIDCTestUseCase(t)
+		existing := registerUser(t, env, "alice@example.com")
+		user, err := uc.provision(ctx, identity("sub-1", "ALICE@example.com", true))
+		if err != nil {
+			t.Fatalf("provision: %v", err)
+		}
+		if user.ID != existing.ID {
+			t.Fatalf("linked user %s, want %s", user.ID, existing.ID)
+		}
+		linked, err := uc.repo.FindIdentity(ctx, "https://idp.example", "sub-1")
+		if err != nil || linked.UserID != existing.ID {
+			t.Fatalf("FindIdentity = %+v, %v", linked, err)
+		}
+	})
+
+	t.Run("refuses to link an unverified email", func(t *testing.T) {
+		uc, _, env := newOIDCTestUseCase(t)
+		registerUser(t, env, "alice@example.com")
+		_, err := uc.provision(ctx, identity("sub-1", "alice@example.com", false))
+		if err == nil || err.Error() != "email already registered" {
+			t.Fatalf("provision: err = %v, want email already registered", err)
+		}
+		if _, err := uc.repo.FindIdentity(ctx, "https://idp.example", "sub-1"); err == nil {
+			t.Fatal("identity was linked")
+		}
+	})
+
+	t.Run("requires an email address", func(t *testing.T) {
+		uc, _, _ := newOIDCTestUseCase(t)
+		if _, err := uc.provision(ctx, identity("sub-1", "", true)); err == nil {
+			t.Fatal("provision accepted an identity without email")
+		}
+	})
+}
+
+func registerUser(t *testing.T, env *testEnv, email string) *entity.User {
+	t.Helper()
+	hash, err := env.authSvc.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &entity.User{Email: email, Password: hash}
+	if err := env.db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
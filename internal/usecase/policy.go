@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/pkg/utils"
+)
+
+// Policy decides whether a user may perform an operation beyond their own
+// files and account. Use cases call Authorize with the acting user before
+// doing anything on their behalf.
+type Policy struct {
+	userRepo repository.UserRepository
+}
+
+func NewPolicy(userRepo repository.UserRepository) *Policy {
+	return &Policy{userRepo: userRepo}
+}
+
+// Authorize returns the acting user if they hold perm, and a "permission
+// denied" error otherwise. The role is read from the database on every
+// call, so a change takes effect without a new login.
+func (p *Policy) Authorize(ctx context.Context, actorID string, perm entity.Permission) (*entity.User, error) {
+	if actorID == "" {
+		return nil, fmt.Errorf("permission denied")
+	}
+	actor, err := p.userRepo.FindByID(ctx, actorID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("permission denied")
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	if !actor.Can(perm) {
+		return nil, fmt.Errorf("permission denied: %s required", perm)
+	}
+	return actor, nil
+}
@@ -0,0 +1,206 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/internal/domain/service"
+	"github.com/filehash/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultShareTTL  = 7 * 24 * time.Hour
+	maxShareTTL      = 90 * 24 * time.Hour
+	shareSlugBytes   = 16
+	maxSharePassword = 256
+)
+
+// ShareUseCase manages public download links. A link stands in for its
+// creator: downloads go through FileUseCase.GetFile as that user, so a
+// link stops working as soon as the file is gone or their access ends.
+type ShareUseCase struct {
+	shareRepo repository.ShareRepository
+	userRepo  repository.UserRepository
+	files     *FileUseCase
+	hasher    service.PasswordHasher
+	guard     *LoginGuard
+	log       *zap.Logger
+}
+
+// NewShareUseCase builds the share use case. guard throttles wrong link
+// passwords the same way as failed logins.
+func NewShareUseCase(
+	shareRepo repository.ShareRepository,
+	userRepo repository.UserRepository,
+	files *FileUseCase,
+	hasher service.PasswordHasher,
+	guard *LoginGuard,
+	log *zap.Logger,
+) *ShareUseCase {
+	return &ShareUseCase{
+		shareRepo: shareRepo,
+		userRepo:  userRepo,
+		files:     files,
+		hasher:    hasher,
+		guard:     guard,
+		log:       log,
+	}
+}
+
+type CreateShareRequest struct {
+	UserID       string
+	FileID       string
+	ExpiresAt    *time.Time // defaults to a week from now
+	MaxDownloads *int64     // nil for no limit
+	Password     string     // empty for none
+}
+
+func (uc *ShareUseCase) CreateShare(ctx context.Context, req CreateShareRequest) (*entity.Share, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(defaultShareTTL)
+	if req.ExpiresAt != nil {
+		expiresAt = req.ExpiresAt.UTC()
+		if !expiresAt.After(now) {
+			return nil, fmt.Errorf("expires_at must be in the future")
+		}
+		if expiresAt.Sub(now) > maxShareTTL {
+			return nil, fmt.Errorf("expires_at must be at most %d days ahead", int(maxShareTTL.Hours()/24))
+		}
+	}
+	if req.MaxDownloads != nil && *req.MaxDownloads < 1 {
+		return nil, fmt.Errorf("max_downloads must be at least 1")
+	}
+	if len(req.Password) > maxSharePassword {
+		return nil, fmt.Errorf("password must be at most %d bytes", maxSharePassword)
+	}
+
+	if _, err := uc.files.AuthorizeUser(ctx, req.FileID, req.UserID, entity.FileRoleOwner); err != nil {
+		return nil, err
+	}
+
+	slug := make([]byte, shareSlugBytes)
+	if _, err := rand.Read(slug); err != nil {
+		return nil, fmt.Errorf("generate slug: %w", err)
+	}
+	share := &entity.Share{
+		Slug:         base64.RawURLEncoding.EncodeToString(slug),
+		FileID:       req.FileID,
+		UserID:       req.UserID,
+		MaxDownloads: req.MaxDownloads,
+		ExpiresAt:    expiresAt,
+	}
+	if req.Password != "" {
+		hash, err := uc.hasher.Hash(req.Password)
+		if err != nil {
+			return nil, fmt.Errorf("hash password: %w", err)
+		}
+		share.PasswordHash = hash
+	}
+
+	if err := uc.shareRepo.Create(ctx, share); err != nil {
+		return nil, fmt.Errorf("create share: %w", err)
+	}
+	uc.log.Info("share created",
+		zap.String("share_id", share.ID),
+		zap.String("file_id", share.FileID),
+		zap.String("user_id", share.UserID))
+	return share, nil
+}
+
+// ListShares returns the links of userID, optionally only those of fileID.
+func (uc *ShareUseCase) ListShares(ctx context.Context, userID, fileID string) ([]entity.Share, error) {
+	shares, err := uc.shareRepo.ListByUser(ctx, userID, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("list shares: %w", err)
+	}
+	return shares, nil
+}
+
+func (uc *ShareUseCase) RevokeShare(ctx context.Context, userID, id string) error {
+	revoked, err := uc.shareRepo.Revoke(ctx, id, userID)
+	if err != nil {
+		return fmt.Errorf("revoke share: %w", err)
+	}
+	if !revoked {
+		return fmt.Errorf("share not found")
+	}
+	return nil
+}
+
+type OpenShareRequest struct {
+	Slug     string
+	Password string
+}
+
+// OpenShareResponse is the file behind a link. Limited is set when the link
+// has a download limit.
+type OpenShareResponse struct {
+	*GetFileResponse
+	Limited bool
+}
+
+// OpenShare opens the file behind a link and counts the download. Wrong
+// passwords are throttled per link like failed logins.
+func (uc *ShareUseCase) OpenShare(ctx context.Context, req OpenShareRequest) (*OpenShareResponse, error) {
+	share, err := uc.shareRepo.FindBySlug(ctx, req.Slug)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("share not found")
+		}
+		return nil, fmt.Errorf("find share: %w", err)
+	}
+	now := time.Now().UTC()
+	if !share.Active(now) {
+		return nil, fmt.Errorf("share unavailable")
+	}
+
+	if share.PasswordHash != "" {
+		if req.Password == "" {
+			return nil, fmt.Errorf("share password required")
+		}
+		throttleKey := "share:" + share.ID
+		if err := uc.guard.Check(ctx, throttleKey); err != nil {
+			return nil, err
+		}
+		if err := uc.hasher.Verify(share.PasswordHash, req.Password); err != nil {
+			if err := uc.guard.Failed(ctx, throttleKey); err != nil {
+				uc.log.Warn("record share failure failed", zap.Error(err))
+			}
+			return nil, fmt.Errorf("invalid share password")
+		}
+		uc.guard.Succeeded(ctx, throttleKey)
+	}
+
+	owner, err := uc.userRepo.FindByID(ctx, share.UserID)
+	if err != nil {
+		if err == utils.ErrRecordNotFound {
+			return nil, fmt.Errorf("share unavailable")
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	if owner.DisabledAt != nil {
+		return nil, fmt.Errorf("share unavailable")
+	}
+
+	resp, err := uc.files.GetFile(ctx, GetFileRequest{FileID: share.FileID, UserID: share.UserID})
+	if err != nil {
+		return nil, err
+	}
+	// Counted only once the file opened, so a storage failure does not use
+	// up a download.
+	counted, err := uc.shareRepo.CountDownload(ctx, share.ID, now)
+	if err != nil || !counted {
+		_ = resp.Content.Close()
+		if err != nil {
+			return nil, fmt.Errorf("count download: %w", err)
+		}
+		return nil, fmt.Errorf("share unavailable")
+	}
+	return &OpenShareResponse{GetFileResponse: resp, Limited: share.MaxDownloads != nil}, nil
+}
@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDeletedFileDropsShares(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	alice := registerUser(t, env, "alice@example.com")
+
+	// share uploads a file with a link and returns both.
+	share := func(name string) (string, string) {
+		t.Helper()
+		fileID := uploadFile(t, env, alice.ID, name, "image bytes")
+		link, err := env.shares.CreateShare(ctx, CreateShareRequest{UserID: alice.ID, FileID: fileID})
+		if err != nil {
+			t.Fatalf("CreateShare: %v", err)
+		}
+		return fileID, link.Slug
+	}
+	// gone checks that fileID has no links left and slug no longer opens.
+	gone := func(how, fileID, slug string) {
+		t.Helper()
+		links, err := env.shares.ListShares(ctx, alice.ID, fileID)
+		if err != nil {
+			t.Fatalf("ListShares: %v", err)
+		}
+		if len(links) != 0 {
+			t.Errorf("%s: %d links left", how, len(links))
+		}
+		_, err = env.shares.OpenShare(ctx, OpenShareRequest{Slug: slug})
+		wantErr(t, how, err, "share not found")
+	}
+
+	fileID, slug := share("deleted.png")
+	if err := env.files.DeleteFile(ctx, DeleteFileRequest{FileID: fileID, UserID: alice.ID}); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	gone("DeleteFile", fileID, slug)
+
+	folder, err := env.folders.CreateFolder(ctx, alice.ID, "Photos", "")
+	if err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	fileID, slug = share("in-folder.png")
+	if _, err := env.folders.MoveFile(ctx, alice.ID, fileID, folder.ID); err != nil {
+		t.Fatalf("MoveFile: %v", err)
+	}
+	if _, err := env.folders.DeleteFolder(ctx, alice.ID, folder.ID, true); err != nil {
+		t.Fatalf("DeleteFolder: %v", err)
+	}
+	gone("DeleteFolder", fileID, slug)
+
+	fileID, slug = share("account.png")
+	if n, err := env.files.DeleteUserFiles(ctx, alice.ID); err != nil || n != 1 {
+		t.Fatalf("DeleteUserFiles = %d, %v", n, err)
+	}
+	gone("DeleteUserFiles", fileID, slug)
+}
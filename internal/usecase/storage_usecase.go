@@ -0,0 +1,226 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/internal/domain/service"
+	"go.uber.org/zap"
+)
+
+const storageMigrationBatchSize = 100
+
+// StorageUseCase moves stored blobs between storage backends.
+type StorageUseCase struct {
+	fileRepo  repository.FileRepository
+	blobRepo  repository.BlobRepository
+	excelRepo repository.ExcelRepository
+	storage   service.StorageResolver
+	log       *zap.Logger
+}
+
+func NewStorageUseCase(
+	fileRepo repository.FileRepository,
+	blobRepo repository.BlobRepository,
+	excelRepo repository.ExcelRepository,
+	storage service.StorageResolver,
+	log *zap.Logger,
+) *StorageUseCase {
+	return &StorageUseCase{
+		fileRepo:  fileRepo,
+		blobRepo:  blobRepo,
+		excelRepo: excelRepo,
+		storage:   storage,
+		log:       log,
+	}
+}
+
+// Backfill records the primary backend on rows written before backends were
+// tracked. It must run before the primary backend is changed.
+func (uc *StorageUseCase) Backfill(ctx context.Context) error {
+	primary, _ := uc.storage.Primary()
+	backfills := []struct {
+		kind string
+		run  func(context.Context, string) (int64, error)
+	}{
+		{"files", uc.fileRepo.BackfillStorageBackend},
+		{"blobs", uc.blobRepo.BackfillStorageBackend},
+		{"excels", uc.excelRepo.BackfillStorageBackend},
+	}
+	for _, b := range backfills {
+		n, err := b.run(ctx, primary)
+		if err != nil {
+			return fmt.Errorf("backfill %s: %w", b.kind, err)
+		}
+		if n > 0 {
+			uc.log.Info("storage backend backfilled", zap.String("kind", b.kind), zap.String("backend", primary), zap.Int64("rows", n))
+		}
+	}
+	return nil
+}
+
+type MigrateStorageRequest struct {
+	Target string
+	// DeleteSource removes each source copy once the row points at Target.
+	DeleteSource bool
+	// Progress, when set, is called after every batch.
+	Progress func(MigrateStorageProgress)
+}
+
+type MigrateStorageProgress struct {
+	Kind   string
+	Copied int64
+	Failed int64
+	Bytes  int64
+}
+
+// MigrateStorage copies every file, blob and Excel export that is not on
+// the target backend, verifies the copy by SHA-256 and then points the row
+// at the target. Rows keep pointing at their source until their copy is
+// verified, so reads continue throughout, and a rerun after a crash simply
+// picks up the rows that were not switched yet.
+func (uc *StorageUseCase) MigrateStorage(ctx context.Context, req MigrateStorageRequest) ([]MigrateStorageProgress, error) {
+	target, err := uc.storage.Backend(req.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	type item struct{ id, path, backend string }
+	kinds := []struct {
+		name   string
+		list   func(afterID string) ([]item, error)
+		update func(ctx context.Context, id, from, to string) (bool, error)
+	}{
+		{"files", func(afterID string) ([]item, error) {
+			assets, err := uc.fileRepo.ListOutsideBackend(ctx, req.Target, afterID, storageMigrationBatchSize)
+			items := make([]item, len(assets))
+			for i, a := range assets {
+				items[i] = item{a.ID, a.StoredPath, a.StorageBackend}
+			}
+			return items, err
+		}, uc.fileRepo.UpdateStorageBackend},
+		{"blobs", func(afterID string) ([]item, error) {
+			blobs, err := uc.blobRepo.ListOutsideBackend(ctx, req.Target, afterID, storageMigrationBatchSize)
+			items := make([]item, len(blobs))
+			for i, b := range blobs {
+				items[i] = item{b.ID, b.StoredPath, b.StorageBackend}
+			}
+			return items, err
+		}, uc.blobRepo.UpdateStorageBackend},
+		{"excels", func(afterID string) ([]item, error) {
+			exports, err := uc.excelRepo.ListOutsideBackend(ctx, req.Target, afterID, storageMigrationBatchSize)
+			items := make([]item, len(exports))
+			for i, e := range exports {
+				items[i] = item{e.ID, e.StoredPath, e.StorageBackend}
+			}
+			return items, err
+		}, uc.excelRepo.UpdateStorageBackend},
+	}
+
+	var report []MigrateStorageProgress
+	for _, kind := range kinds {
+		progress := MigrateStorageProgress{Kind: kind.name}
+		after := ""
+		for {
+			items, err := kind.list(after)
+			if err != nil {
+				return append(report, progress), fmt.Errorf("list %s: %w", kind.name, err)
+			}
+			for _, it := range items {
+				after = it.id
+				n, err := uc.migrateOne(ctx, target, req, it.id, it.path, it.backend, kind.update)
+				if err != nil {
+					if ctxErr := ctx.Err(); ctxErr != nil {
+						return append(report, progress), ctxErr
+					}
+					progress.Failed++
+					uc.log.Warn("storage migration failed",
+						zap.String("kind", kind.name), zap.String("id", it.id), zap.Error(err))
+					continue
+				}
+				progress.Copied++
+				progress.Bytes += n
+			}
+			if req.Progress != nil {
+				req.Progress(progress)
+			}
+			if len(items) < storageMigrationBatchSize {
+				break
+			}
+		}
+		report = append(report, progress)
+	}
+	return report, nil
+}
+
+func (uc *StorageUseCase) migrateOne(
+	ctx context.Context,
+	target service.StorageService,
+	req MigrateStorageRequest,
+	id, path, from string,
+	update func(ctx context.Context, id, from, to string) (bool, error),
+) (int64, error) {
+	source, err := uc.storage.Backend(from)
+	if err != nil {
+		return 0, err
+	}
+
+	src, err := source.LoadEncrypted(ctx, path)
+	if err != nil {
+		return 0, fmt.Errorf("open source: %w", err)
+	}
+	sourceHash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(src, sourceHash)}
+	err = target.Import(ctx, path, counter)
+	_ = src.Close()
+	if err != nil {
+		return 0, fmt.Errorf("copy: %w", err)
+	}
+
+	if err := verifyCopy(ctx, target, path, sourceHash.Sum(nil), counter.n); err != nil {
+		_ = target.Delete(ctx, path)
+		return 0, err
+	}
+
+	moved, err := update(ctx, id, from, req.Target)
+	if err != nil {
+		return 0, fmt.Errorf("update record: %w", err)
+	}
+	if !moved {
+		// The row was deleted or moved while copying; drop the orphan.
+		_ = target.Delete(ctx, path)
+		return counter.n, nil
+	}
+
+	if req.DeleteSource {
+		if err := source.Delete(ctx, path); err != nil {
+			uc.log.Warn("source delete failed", zap.String("backend", from), zap.String("path", path), zap.Error(err))
+		}
+	}
+	return counter.n, nil
+}
+
+// verifyCopy re-reads path from target and compares it with the checksum
+// and size of the source stream.
+func verifyCopy(ctx context.Context, target service.StorageService, path string, want []byte, size int64) error {
+	copied, err := target.LoadEncrypted(ctx, path)
+	if err != nil {
+		return fmt.Errorf("open copy: %w", err)
+	}
+	defer copied.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, copied)
+	if err != nil {
+		return fmt.Errorf("read copy: %w", err)
+	}
+	if n != size || !bytes.Equal(h.Sum(nil), want) {
+		return errors.New("checksum mismatch after copy")
+	}
+	return nil
+}
@@ -0,0 +1,562 @@
+package usecase
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	"github.com/filehash/internal/domain/service"
+	"github.com/filehash/pkg/utils"
+	"github.com/filehash/pkg/validator"
+	"go.uber.org/zap"
+)
+
+const uploadCleanupBatchSize = 100
+
+var (
+	ErrUploadNotFound        = errors.New("upload not found")
+	ErrUploadExpired         = errors.New("upload expired")
+	ErrUploadOffsetMismatch  = errors.New("upload offset mismatch")
+	ErrUploadLocked          = errors.New("upload is locked by another request")
+	ErrUploadTooLarge        = errors.New("upload exceeds its length")
+	ErrUploadUnsupportedType = errors.New("unsupported content type")
+)
+
+// UploadUseCase implements resumable uploads. Every received chunk is
+// encrypted under a per-upload data key and staged as a part on the storage
+// backend; once all bytes are in, the parts are streamed through
+// FileUseCase.UploadFile and removed.
+type UploadUseCase struct {
+	sessionRepo repository.UploadSessionRepository
+	fileUseCase *FileUseCase
+	storage     service.StorageResolver
+	cryptoSvc   service.CryptoService
+	keySvc      service.KeyService
+	tokenSvc    service.TokenService
+	maxSize     int64
+	expiry      time.Duration
+	log         *zap.Logger
+
+	locks sync.Map // upload ID -> *sync.Mutex
+}
+
+func NewUploadUseCase(
+	sessionRepo repository.UploadSessionRepository,
+	fileUseCase *FileUseCase,
+	storage service.StorageResolver,
+	cryptoSvc service.CryptoService,
+	keySvc service.KeyService,
+	tokenSvc service.TokenService,
+	maxSize int64,
+	expiry time.Duration,
+	log *zap.Logger,
+) *UploadUseCase {
+	return &UploadUseCase{
+		sessionRepo: sessionRepo,
+		fileUseCase: fileUseCase,
+		storage:     storage,
+		cryptoSvc:   cryptoSvc,
+		keySvc:      keySvc,
+		tokenSvc:    tokenSvc,
+		maxSize:     maxSize,
+		expiry:      expiry,
+		log:         log,
+	}
+}
+
+// MaxSize is the largest upload length accepted by CreateUpload.
+func (uc *UploadUseCase) MaxSize() int64 {
+	return uc.maxSize
+}
+
+type CreateUploadRequest struct {
+	Length   int64
+	Filename string
+	// Metadata is kept verbatim and returned with the upload state.
+	Metadata string
+	UserID   *string
+}
+
+func (uc *UploadUseCase) CreateUpload(ctx context.Context, req CreateUploadRequest) (*entity.UploadSession, error) {
+	if req.Length <= 0 {
+		return nil, fmt.Errorf("upload length must be positive")
+	}
+	if req.Length > uc.maxSize {
+		return nil, ErrUploadTooLarge
+	}
+	if !validator.ValidateFilename(req.Filename) {
+		return nil, fmt.Errorf("invalid filename")
+	}
+
+	key, err := uc.cryptoSvc.GenerateAESKey()
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	wrapped, kekID, err := uc.keySvc.WrapKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("wrap key: %w", err)
+	}
+
+	backend, _ := uc.storage.Primary()
+	session := &entity.UploadSession{
+		UserID:         req.UserID,
+		Filename:       req.Filename,
+		Metadata:       req.Metadata,
+		Length:         req.Length,
+		StorageBackend: backend,
+		WrappedKey:     wrapped,
+		KeyID:          kekID,
+		ExpiresAt:      time.Now().UTC().Add(uc.expiry),
+	}
+	if err := uc.sessionRepo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("create upload: %w", err)
+	}
+	return session, nil
+}
+
+// GetUpload returns the state of an unexpired upload. Uploads created by a
+// user are only visible to that user; anonymous uploads are reachable by
+// anyone who knows their ID.
+func (uc *UploadUseCase) GetUpload(ctx context.Context, id, userID string) (*entity.UploadSession, error) {
+	session, err := uc.sessionRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, utils.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("find upload: %w", err)
+	}
+	if session.UserID != nil && *session.UserID != userID {
+		return nil, ErrUploadNotFound
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	return session, nil
+}
+
+type AppendUploadRequest struct {
+	ID     string
+	UserID string
+	Offset int64
+	Body   io.Reader
+}
+
+type AppendUploadResponse struct {
+	Upload *entity.UploadSession
+	// File is set once the upload is complete and registered.
+	File        *UploadFileResponse
+	ContentType string
+}
+
+// AppendUpload stages the bytes of Body at Offset, which must equal the
+// current offset of the upload. Bytes received before the body broke off
+// are kept, so a client can resume from wherever the connection dropped.
+// When the last byte arrives the upload is handed to FileUseCase; repeating
+// an empty request at the final offset retries a failed hand-over or
+// reissues the file token.
+func (uc *UploadUseCase) AppendUpload(ctx context.Context, req AppendUploadRequest) (*AppendUploadResponse, error) {
+	lock := uc.lock(req.ID)
+	if !lock.TryLock() {
+		return nil, ErrUploadLocked
+	}
+	defer lock.Unlock()
+
+	// A client that drops the connection cancels the request context, but
+	// whatever arrived before that must still be written out, and a started
+	// hand-over is finished so a retry finds the file.
+	ctx = context.WithoutCancel(ctx)
+
+	session, err := uc.GetUpload(ctx, req.ID, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Offset != session.Offset {
+		return nil, ErrUploadOffsetMismatch
+	}
+	if session.Completed() {
+		if err := ensureEmpty(req.Body); err != nil {
+			return nil, err
+		}
+		return uc.completedResponse(session)
+	}
+
+	if remaining := session.Length - session.Offset; remaining > 0 {
+		if err := uc.appendPart(ctx, session, req.Body, remaining); err != nil {
+			return nil, err
+		}
+	} else if err := ensureEmpty(req.Body); err != nil {
+		return nil, err
+	}
+
+	if session.Offset < session.Length {
+		return &AppendUploadResponse{Upload: session}, nil
+	}
+	return uc.complete(ctx, session)
+}
+
+// appendPart stages one part and advances session past it.
+func (uc *UploadUseCase) appendPart(ctx context.Context, session *entity.UploadSession, body io.Reader, remaining int64) error {
+	storage, err := uc.storage.Backend(session.StorageBackend)
+	if err != nil {
+		return err
+	}
+	key, err := uc.keySvc.UnwrapKey(session.WrappedKey, session.KeyID)
+	if err != nil {
+		return fmt.Errorf("unwrap key: %w", err)
+	}
+
+	start := session.Offset
+	partPath := stagingPartPath(session.ID, start)
+	received := &partialReader{r: io.LimitReader(body, remaining)}
+	pr, pw := io.Pipe()
+	encErr := make(chan error, 1)
+	go func() {
+		err := uc.fileUseCase.encryptTo(pw, key, received)
+		if err == nil && received.err == nil {
+			// Every byte beyond the declared length is a protocol error.
+			err = ensureEmpty(body)
+		}
+		_ = pw.CloseWithError(err)
+		encErr <- err
+	}()
+	saveErr := storage.Import(ctx, partPath, pr)
+	_ = pr.Close()
+	if err := <-encErr; err != nil {
+		if saveErr == nil {
+			_ = storage.Delete(ctx, partPath)
+		}
+		if errors.Is(err, ErrUploadTooLarge) {
+			return err
+		}
+		return fmt.Errorf("encrypt part: %w", err)
+	}
+	if saveErr != nil {
+		return fmt.Errorf("stage part: %w", saveErr)
+	}
+	if received.n == 0 {
+		_ = storage.Delete(ctx, partPath)
+		return nil
+	}
+
+	expiresAt := time.Now().UTC().Add(uc.expiry)
+	ok, err := uc.sessionRepo.Advance(ctx, session.ID, start, start+received.n, &start, expiresAt)
+	if err != nil {
+		_ = storage.Delete(ctx, partPath)
+		return fmt.Errorf("advance upload: %w", err)
+	}
+	if !ok {
+		// Another replica advanced the upload meanwhile. Its part lives at
+		// the same path, so ours is left in place; the bounds check on
+		// completion catches a copy of the wrong length.
+		return ErrUploadOffsetMismatch
+	}
+	if received.err != nil {
+		uc.log.Info("upload chunk interrupted",
+			zap.String("upload_id", session.ID), zap.Int64("received", received.n), zap.Error(received.err))
+	}
+
+	session.Offset = start + received.n
+	session.ExpiresAt = expiresAt
+	if session.Parts == "" {
+		session.Parts = strconv.FormatInt(start, 10)
+	} else {
+		session.Parts += fmt.Sprintf(",%d", start)
+	}
+	return nil
+}
+
+// complete streams the staged parts into FileUseCase.UploadFile. Uploads of
+// a type that is not accepted are discarded.
+func (uc *UploadUseCase) complete(ctx context.Context, session *entity.UploadSession) (*AppendUploadResponse, error) {
+	staged, err := uc.openStaged(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	defer staged.Close()
+
+	content := bufio.NewReaderSize(staged, 512)
+	peek, err := content.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read staged upload: %w", err)
+	}
+	contentType := http.DetectContentType(peek)
+	if !validator.ValidateContentType(contentType) {
+		_ = staged.Close()
+		if err := uc.discard(ctx, session); err != nil {
+			uc.log.Warn("discard upload failed", zap.String("upload_id", session.ID), zap.Error(err))
+		}
+		return nil, ErrUploadUnsupportedType
+	}
+
+	file, err := uc.fileUseCase.UploadFile(ctx, UploadFileRequest{
+		Filename:    session.Filename,
+		Content:     content,
+		ContentType: contentType,
+		UserID:      session.UserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := uc.sessionRepo.MarkCompleted(ctx, session.ID, file.FileID); err != nil {
+		uc.log.Warn("mark upload completed failed", zap.String("upload_id", session.ID), zap.Error(err))
+	}
+	_ = staged.Close()
+	uc.deleteParts(ctx, session)
+	session.FileID = &file.FileID
+
+	return &AppendUploadResponse{Upload: session, File: file, ContentType: contentType}, nil
+}
+
+func (uc *UploadUseCase) completedResponse(session *entity.UploadSession) (*AppendUploadResponse, error) {
+	token, err := uc.tokenSvc.Generate(*session.FileID, session.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("generate token: %w", err)
+	}
+	return &AppendUploadResponse{
+		Upload: session,
+		File: &UploadFileResponse{
+			FileID:    *session.FileID,
+			Token:     token,
+			ExpiresIn: fileTokenExpiresIn,
+			SizeBytes: session.Length,
+		},
+	}, nil
+}
+
+// TerminateUpload discards an upload and its staged parts. The file of a
+// completed upload is kept.
+func (uc *UploadUseCase) TerminateUpload(ctx context.Context, id, userID string) error {
+	lock := uc.lock(id)
+	if !lock.TryLock() {
+		return ErrUploadLocked
+	}
+	defer lock.Unlock()
+
+	session, err := uc.GetUpload(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	return uc.discard(ctx, session)
+}
+
+// DiscardUserUploads removes every upload of userID and their staged parts.
+// Uploads in progress are waited for, so none completes afterwards.
+func (uc *UploadUseCase) DiscardUserUploads(ctx context.Context, userID string) (int, error) {
+	sessions, err := uc.sessionRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("list uploads: %w", err)
+	}
+	for i, session := range sessions {
+		lock := uc.lock(session.ID)
+		lock.Lock()
+		err := uc.discard(ctx, session)
+		lock.Unlock()
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(sessions), nil
+}
+
+// CleanupExpired removes expired uploads and their staged parts. Uploads
+// that cannot be removed are skipped and left for the next run.
+func (uc *UploadUseCase) CleanupExpired(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	removed := 0
+	after := ""
+	for {
+		sessions, err := uc.sessionRepo.ListExpired(ctx, now, after, uploadCleanupBatchSize)
+		if err != nil {
+			return removed, fmt.Errorf("list expired uploads: %w", err)
+		}
+		for _, session := range sessions {
+			after = session.ID
+			if err := uc.discard(ctx, session); err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return removed, ctxErr
+				}
+				uc.log.Warn("expired upload cleanup failed", zap.String("upload_id", session.ID), zap.Error(err))
+				continue
+			}
+			removed++
+		}
+		if len(sessions) < uploadCleanupBatchSize {
+			return removed, nil
+		}
+	}
+}
+
+func (uc *UploadUseCase) discard(ctx context.Context, session *entity.UploadSession) error {
+	if err := uc.sessionRepo.Delete(ctx, session.ID); err != nil && !errors.Is(err, utils.ErrRecordNotFound) {
+		return fmt.Errorf("delete upload: %w", err)
+	}
+	uc.deleteParts(ctx, session)
+	uc.locks.Delete(session.ID)
+	return nil
+}
+
+func (uc *UploadUseCase) deleteParts(ctx context.Context, session *entity.UploadSession) {
+	offsets := session.PartOffsets()
+	if len(offsets) == 0 {
+		return
+	}
+	storage, err := uc.storage.Backend(session.StorageBackend)
+	if err != nil {
+		uc.log.Warn("staged parts not deleted", zap.String("upload_id", session.ID), zap.Error(err))
+		return
+	}
+	for _, offset := range offsets {
+		if err := storage.Delete(ctx, stagingPartPath(session.ID, offset)); err != nil {
+			uc.log.Warn("staged part delete failed", zap.String("upload_id", session.ID), zap.Int64("offset", offset), zap.Error(err))
+		}
+	}
+}
+
+func (uc *UploadUseCase) lock(id string) *sync.Mutex {
+	lock, _ := uc.locks.LoadOrStore(id, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// openStaged returns the plaintext of all staged parts of session in order.
+func (uc *UploadUseCase) openStaged(ctx context.Context, session *entity.UploadSession) (io.ReadCloser, error) {
+	offsets := session.PartOffsets()
+	if len(offsets) == 0 || offsets[0] != 0 {
+		return nil, fmt.Errorf("staged parts of upload %s are incomplete", session.ID)
+	}
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] <= offsets[i-1] {
+			return nil, fmt.Errorf("staged parts of upload %s are out of order", session.ID)
+		}
+	}
+	storage, err := uc.storage.Backend(session.StorageBackend)
+	if err != nil {
+		return nil, err
+	}
+	key, err := uc.keySvc.UnwrapKey(session.WrappedKey, session.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap key: %w", err)
+	}
+	return &stagedReader{
+		ctx:     ctx,
+		storage: storage,
+		crypto:  uc.cryptoSvc,
+		key:     key,
+		id:      session.ID,
+		bounds:  append(offsets, session.Length),
+	}, nil
+}
+
+func stagingPartPath(uploadID string, offset int64) string {
+	return fmt.Sprintf("staging/%s-%020d.part", uploadID, offset)
+}
+
+// stagedReader concatenates the decrypted staged parts of an upload. Part i
+// must hold exactly the bytes from bounds[i] up to bounds[i+1].
+type stagedReader struct {
+	ctx     context.Context
+	storage service.StorageService
+	crypto  service.CryptoService
+	key     []byte
+	id      string
+	bounds  []int64
+
+	part      int
+	cur       io.Reader
+	closer    io.Closer
+	remaining int64
+}
+
+func (s *stagedReader) Read(p []byte) (int, error) {
+	for {
+		if s.cur == nil {
+			if s.part >= len(s.bounds)-1 {
+				return 0, io.EOF
+			}
+			if err := s.open(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := s.cur.Read(p)
+		s.remaining -= int64(n)
+		if err == io.EOF {
+			if s.remaining > 0 {
+				return n, fmt.Errorf("staged part at offset %d of upload %s is short", s.bounds[s.part], s.id)
+			}
+			_ = s.closer.Close()
+			s.cur, s.closer = nil, nil
+			s.part++
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (s *stagedReader) open() error {
+	start := s.bounds[s.part]
+	blob, err := s.storage.LoadEncrypted(s.ctx, stagingPartPath(s.id, start))
+	if err != nil {
+		return fmt.Errorf("open staged part: %w", err)
+	}
+	plain, err := s.crypto.NewDecryptReader(s.key, blob)
+	if err != nil {
+		_ = blob.Close()
+		return fmt.Errorf("decrypt staged part: %w", err)
+	}
+	s.remaining = s.bounds[s.part+1] - start
+	s.cur = io.LimitReader(plain, s.remaining)
+	s.closer = blob
+	return nil
+}
+
+func (s *stagedReader) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	err := s.closer.Close()
+	s.cur, s.closer = nil, nil
+	return err
+}
+
+// partialReader ends the stream at the first read error instead of
+// propagating it, keeping the error and the byte count for the caller.
+type partialReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (p *partialReader) Read(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, io.EOF
+	}
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if err != nil && err != io.EOF {
+		p.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// ensureEmpty reports ErrUploadTooLarge when r still has data. Read errors
+// only mean no more data arrives and are ignored.
+func ensureEmpty(r io.Reader) error {
+	var b [1]byte
+	if n, _ := io.ReadFull(r, b[:]); n > 0 {
+		return ErrUploadTooLarge
+	}
+	return nil
+}
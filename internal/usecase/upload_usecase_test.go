@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/filehash/internal/domain/entity"
+	"github.com/filehash/internal/domain/repository"
+	infrarepo "github.com/filehash/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+// stuckUploads fails to delete the uploads in stuck.
+type stuckUploads struct {
+	repository.UploadSessionRepository
+	stuck map[string]bool
+}
+
+func (r *stuckUploads) Delete(ctx context.Context, id string) error {
+	if r.stuck[id] {
+		return errors.New("database is locked")
+	}
+	return r.UploadSessionRepository.Delete(ctx, id)
+}
+
+func TestCleanupExpiredSkipsFailures(t *testing.T) {
+	env := newTestEnv(t)
+	repo := &stuckUploads{UploadSessionRepository: infrarepo.NewUploadSessionRepository(env.db), stuck: map[string]bool{}}
+	uploads := NewUploadUseCase(repo, env.files, nil, nil, nil, nil, 1<<20, time.Hour, zap.NewNop())
+
+	// More than a batch of uploads cannot be removed; the rest can.
+	const expired, stuck = uploadCleanupBatchSize + 50, uploadCleanupBatchSize + 10
+	for i := range expired + 1 {
+		session := &entity.UploadSession{Filename: "photo.png", Length: 1, StorageBackend: "memory", WrappedKey: []byte{1}, KeyID: "k1", ExpiresAt: time.Now().Add(-time.Minute)}
+		if i == expired {
+			session.ExpiresAt = time.Now().Add(time.Hour)
+		}
+		if err := env.db.Create(session).Error; err != nil {
+			t.Fatalf("create upload: %v", err)
+		}
+		if i < stuck {
+			repo.stuck[session.ID] = true
+		}
+	}
+
+	// The run ends instead of listing the stuck uploads over and over.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	removed, err := uploads.CleanupExpired(ctx)
+	if err != nil || removed != expired-stuck {
+		t.Fatalf("CleanupExpired = %d, %v; want %d", removed, err, expired-stuck)
+	}
+	var left int64
+	if err := env.db.Model(&entity.UploadSession{}).Count(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if left != stuck+1 {
+		t.Fatalf("%d uploads left, want %d", left, stuck+1)
+	}
+}
@@ -5,5 +5,15 @@ const (
 	AESKeySize = 32
 	// GCMNonceSize is the default nonce size for AES-GCM.
 	GCMNonceSize = 12
+	// StreamChunkSize is the plaintext size of a single encrypted chunk.
+	StreamChunkSize = 64 * 1024
 )
 
+const (
+	// EncryptionAES256 is the encryption algorithm recorded on file assets.
+	EncryptionAES256 = "AES-256"
+	// AuthenticationGCM marks blobs sealed as a single AES-GCM message.
+	AuthenticationGCM = "GCM"
+	// AuthenticationGCMStream marks blobs sealed as a chunked AES-GCM stream.
+	AuthenticationGCMStream = "GCM-STREAM"
+)
@@ -0,0 +1,373 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted container layout (all integers big-endian):
+//
+//	magic        6 bytes  "FHENC\x1a"
+//	version      1 byte
+//	algorithm    1 byte
+//	chunk size   4 bytes  plaintext bytes per chunk
+//	key id len   1 byte
+//	key id       n bytes
+//	nonce prefix 7 bytes
+//	chunks...             AEAD(chunk) with the whole header as associated data
+//
+// Chunk nonces are the nonce prefix followed by a 4-byte chunk counter and a
+// last-chunk flag (STREAM construction), so reordered, dropped or truncated
+// chunks fail authentication. Blobs without the magic are treated as the
+// legacy layout: a 12-byte nonce followed by a single AES-GCM message.
+
+// ContainerVersion is the container format version written by NewWriter.
+const ContainerVersion = 1
+
+// Algorithm identifies the AEAD used for the chunks of a container.
+type Algorithm uint8
+
+const (
+	// AlgorithmAES256GCM seals chunks with AES-256-GCM.
+	AlgorithmAES256GCM Algorithm = 1
+)
+
+const (
+	// StreamNoncePrefixSize is the random per-stream part of every chunk nonce.
+	StreamNoncePrefixSize = GCMNonceSize - 5
+	// MaxChunkSize bounds the chunk size accepted from a header.
+	MaxChunkSize = 16 << 20
+	maxKeyIDLen  = 255
+)
+
+var containerMagic = []byte("FHENC\x1a")
+
+var (
+	// ErrStreamTruncated is returned when a stream ends before its final chunk.
+	ErrStreamTruncated = errors.New("encrypted stream truncated")
+	// ErrKeyMismatch is returned when the key does not match the header key ID.
+	ErrKeyMismatch = errors.New("key does not match container key id")
+	// ErrUnsupportedContainer is returned for unknown versions or algorithms.
+	ErrUnsupportedContainer = errors.New("unsupported container format")
+)
+
+// Header describes an encrypted container.
+type Header struct {
+	Version     uint8
+	Algorithm   Algorithm
+	ChunkSize   uint32
+	KeyID       string
+	NoncePrefix []byte
+}
+
+// Legacy reports whether the header describes a blob in the pre-container
+// single-message layout.
+func (h *Header) Legacy() bool {
+	return h.Version == 0
+}
+
+// Size returns the encoded length of the header in bytes.
+func (h *Header) Size() int {
+	return len(containerMagic) + 1 + 1 + 4 + 1 + len(h.KeyID) + StreamNoncePrefixSize
+}
+
+// MarshalBinary encodes the header.
+func (h *Header) MarshalBinary() ([]byte, error) {
+	if len(h.KeyID) > maxKeyIDLen {
+		return nil, errors.New("key id too long")
+	}
+	if len(h.NoncePrefix) != StreamNoncePrefixSize {
+		return nil, errors.New("invalid nonce prefix size")
+	}
+	buf := make([]byte, 0, h.Size())
+	buf = append(buf, containerMagic...)
+	buf = append(buf, h.Version, byte(h.Algorithm))
+	buf = binary.BigEndian.AppendUint32(buf, h.ChunkSize)
+	buf = append(buf, byte(len(h.KeyID)))
+	buf = append(buf, h.KeyID...)
+	buf = append(buf, h.NoncePrefix...)
+	return buf, nil
+}
+
+// ReadHeader decodes a container header from r. It returns
+// ErrUnsupportedContainer when r does not start with the container magic.
+func ReadHeader(r io.Reader) (*Header, error) {
+	fixed := make([]byte, len(containerMagic)+1+1+4+1)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if !bytes.Equal(fixed[:len(containerMagic)], containerMagic) {
+		return nil, ErrUnsupportedContainer
+	}
+	rest := fixed[len(containerMagic):]
+	h := &Header{
+		Version:   rest[0],
+		Algorithm: Algorithm(rest[1]),
+		ChunkSize: binary.BigEndian.Uint32(rest[2:6]),
+	}
+	if h.Version != ContainerVersion || h.Algorithm != AlgorithmAES256GCM {
+		return nil, fmt.Errorf("%w: version %d, algorithm %d", ErrUnsupportedContainer, h.Version, h.Algorithm)
+	}
+	if h.ChunkSize == 0 || h.ChunkSize > MaxChunkSize {
+		return nil, fmt.Errorf("invalid chunk size %d", h.ChunkSize)
+	}
+	variable := make([]byte, int(rest[6])+StreamNoncePrefixSize)
+	if _, err := io.ReadFull(r, variable); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	h.KeyID = string(variable[:rest[6]])
+	h.NoncePrefix = variable[rest[6]:]
+	return h, nil
+}
+
+// KeyFingerprint returns the key ID recorded in containers sealed with key.
+// It identifies the key without revealing it.
+func KeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(append([]byte("filehash-key-id:"), key...))
+	return hex.EncodeToString(sum[:8])
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != AESKeySize {
+		return nil, errors.New("key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("new gcm: %w", err)
+	}
+	return gcm, nil
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, GCMNonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[StreamNoncePrefixSize:], counter)
+	if last {
+		nonce[GCMNonceSize-1] = 1
+	}
+	return nonce
+}
+
+type streamWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	buf     []byte
+	counter uint32
+	closed  bool
+}
+
+// NewWriter returns a writer that encrypts everything written to it into dst
+// as a container of independently authenticated AES-256-GCM chunks of
+// chunkSize plaintext bytes. Close must be called to emit the final chunk.
+func NewWriter(dst io.Writer, key []byte, chunkSize int) (io.WriteCloser, error) {
+	if chunkSize <= 0 || chunkSize > MaxChunkSize {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, StreamNoncePrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("nonce prefix: %w", err)
+	}
+	h := &Header{
+		Version:     ContainerVersion,
+		Algorithm:   AlgorithmAES256GCM,
+		ChunkSize:   uint32(chunkSize),
+		KeyID:       KeyFingerprint(key),
+		NoncePrefix: prefix,
+	}
+	header, err := h.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(header); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+	return &streamWriter{
+		dst:    dst,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed stream")
+	}
+	written := 0
+	for len(p) > 0 {
+		// A full buffer is only flushed once more data arrives, so the
+		// final chunk is always the one sealed by Close.
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *streamWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+func (w *streamWriter) flush(last bool) error {
+	if w.counter == ^uint32(0) {
+		return errors.New("stream too long")
+	}
+	sealed := w.aead.Seal(nil, chunkNonce(w.prefix, w.counter, last), w.buf, w.header)
+	if _, err := w.dst.Write(sealed); err != nil {
+		return fmt.Errorf("write chunk: %w", err)
+	}
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+type streamReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	record  []byte
+	plain   []byte
+	counter uint32
+	done    bool
+	err     error
+}
+
+// NewReader returns a reader over the plaintext of an encrypted blob along
+// with its header. Containers are decrypted chunk by chunk and plaintext is
+// only released once its chunk has been authenticated. Legacy blobs are
+// decrypted in one go and reported with a zero header version.
+func NewReader(src io.Reader, key []byte) (io.Reader, *Header, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(src)
+	magic, err := br.Peek(len(containerMagic))
+	if err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("read header: %w", err)
+	}
+	if !bytes.Equal(magic, containerMagic) {
+		plain, err := openLegacy(br, aead)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bytes.NewReader(plain), &Header{Algorithm: AlgorithmAES256GCM}, nil
+	}
+
+	h, err := ReadHeader(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.KeyID != KeyFingerprint(key) {
+		return nil, nil, ErrKeyMismatch
+	}
+	header, err := h.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &streamReader{
+		src:    br,
+		aead:   aead,
+		header: header,
+		prefix: h.NoncePrefix,
+		record: make([]byte, int(h.ChunkSize)+aead.Overhead()),
+	}, h, nil
+}
+
+func openLegacy(src io.Reader, aead cipher.AEAD) ([]byte, error) {
+	nonce := make([]byte, GCMNonceSize)
+	if _, err := io.ReadFull(src, nonce); err != nil {
+		return nil, fmt.Errorf("read nonce: %w", err)
+	}
+	ciphertext, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("read ciphertext: %w", err)
+	}
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+	return plain, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *streamReader) next() error {
+	n, err := io.ReadFull(r.src, r.record)
+	switch {
+	case err == io.EOF:
+		return ErrStreamTruncated
+	case err != nil && err != io.ErrUnexpectedEOF:
+		return fmt.Errorf("read chunk: %w", err)
+	}
+
+	// A short record can only be the final chunk; a full one is final when
+	// nothing follows it.
+	last := err == io.ErrUnexpectedEOF
+	if !last {
+		if _, peekErr := r.src.Peek(1); peekErr == io.EOF {
+			last = true
+		} else if peekErr != nil {
+			return fmt.Errorf("read chunk: %w", peekErr)
+		}
+	}
+
+	plain, err := r.aead.Open(r.record[:0], chunkNonce(r.prefix, r.counter, last), r.record[:n], r.header)
+	if err != nil {
+		if last {
+			// Either the final chunk was tampered with or the stream was
+			// cut exactly on a chunk boundary.
+			return fmt.Errorf("decrypt chunk %d: %w", r.counter, ErrStreamTruncated)
+		}
+		return fmt.Errorf("decrypt chunk %d: %w", r.counter, err)
+	}
+	r.counter++
+	r.plain = plain
+	r.done = last
+	return nil
+}
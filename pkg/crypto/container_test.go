@@ -0,0 +1,309 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+const testChunkSize = 64
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, AESKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func seal(t *testing.T, key, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, key, testChunkSize)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	// Odd-sized writes, so chunk boundaries fall inside writes.
+	for rest := plain; len(rest) > 0; {
+		n := min(len(rest), 37)
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func open(key, blob []byte) ([]byte, error) {
+	r, _, err := NewReader(bytes.NewReader(blob), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// recordSize is the ciphertext size of a full chunk.
+const recordSize = testChunkSize + 16
+
+func headerSize(t *testing.T, blob []byte) int {
+	t.Helper()
+	h, err := ReadHeader(bytes.NewReader(blob))
+	if err != nil {
+		t.Fatalf("ReadHeader: %v", err)
+	}
+	return h.Size()
+}
+
+func TestContainerRoundTrip(t *testing.T) {
+	key := testKey(t)
+	for _, tc := range []struct {
+		name   string
+		size   int
+		chunks int
+	}{
+		{"empty", 0, 1},
+		{"one byte", 1, 1},
+		{"exactly one chunk", testChunkSize, 1},
+		{"one chunk and a byte", testChunkSize + 1, 2},
+		{"exactly three chunks", 3 * testChunkSize, 3},
+		{"multi-chunk", 5*testChunkSize + 17, 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			plain := make([]byte, tc.size)
+			rand.Read(plain)
+			blob := seal(t, key, plain)
+
+			hs := headerSize(t, blob)
+			if want := hs + tc.size + tc.chunks*16; len(blob) != want {
+				t.Fatalf("blob is %d bytes, want %d (%d chunks)", len(blob), want, tc.chunks)
+			}
+
+			r, h, err := NewReader(bytes.NewReader(blob), key)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			if h.Legacy() || h.Version != ContainerVersion || h.ChunkSize != testChunkSize || h.KeyID != KeyFingerprint(key) {
+				t.Fatalf("header = %+v", h)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatal("plaintext differs")
+			}
+		})
+	}
+}
+
+func TestContainerTampering(t *testing.T) {
+	key := testKey(t)
+	plain := make([]byte, 3*testChunkSize+10)
+	rand.Read(plain)
+	blob := seal(t, key, plain)
+	hs := headerSize(t, blob)
+
+	edit := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), blob...))
+	}
+
+	tests := []struct {
+		name   string
+		blob   []byte
+		key    []byte
+		target error // nil: any error
+	}{
+		{
+			name:   "dropped last chunk",
+			blob:   blob[:hs+3*recordSize],
+			target: ErrStreamTruncated,
+		},
+		{
+			name:   "dropped last two chunks",
+			blob:   blob[:hs+2*recordSize],
+			target: ErrStreamTruncated,
+		},
+		{
+			name:   "header only",
+			blob:   blob[:hs],
+			target: ErrStreamTruncated,
+		},
+		{
+			name: "swapped chunks",
+			blob: edit(func(b []byte) []byte {
+				first := append([]byte(nil), b[hs:hs+recordSize]...)
+				copy(b[hs:], b[hs+recordSize:hs+2*recordSize])
+				copy(b[hs+recordSize:], first)
+				return b
+			}),
+		},
+		{
+			name: "dropped middle chunk",
+			blob: edit(func(b []byte) []byte {
+				return append(b[:hs+recordSize], b[hs+2*recordSize:]...)
+			}),
+		},
+		{
+			name: "flipped ciphertext bit",
+			blob: edit(func(b []byte) []byte {
+				b[hs+recordSize+5] ^= 1
+				return b
+			}),
+		},
+		{
+			name: "trailing data",
+			blob: append(append([]byte(nil), blob...), 0),
+		},
+		{
+			name: "tampered nonce prefix",
+			blob: edit(func(b []byte) []byte {
+				b[hs-1] ^= 1
+				return b
+			}),
+		},
+		{
+			// The chunk size is part of the associated data of every chunk.
+			name: "tampered chunk size",
+			blob: edit(func(b []byte) []byte {
+				b[len(containerMagic)+5]++
+				return b
+			}),
+		},
+		{
+			name: "tampered key id",
+			blob: edit(func(b []byte) []byte {
+				b[len(containerMagic)+7] ^= 1
+				return b
+			}),
+			target: ErrKeyMismatch,
+		},
+		{
+			name: "unknown version",
+			blob: edit(func(b []byte) []byte {
+				b[len(containerMagic)] = 2
+				return b
+			}),
+			target: ErrUnsupportedContainer,
+		},
+		{
+			name:   "wrong key",
+			blob:   blob,
+			key:    testKey(t),
+			target: ErrKeyMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := key
+			if tt.key != nil {
+				k = tt.key
+			}
+			_, err := open(k, tt.blob)
+			if err == nil {
+				t.Fatal("tampered container decrypted")
+			}
+			if tt.target != nil && !errors.Is(err, tt.target) {
+				t.Fatalf("err = %v, want %v", err, tt.target)
+			}
+		})
+	}
+}
+
+func TestContainerReleasesOnlyAuthenticatedChunks(t *testing.T) {
+	key := testKey(t)
+	plain := make([]byte, 3*testChunkSize)
+	rand.Read(plain)
+	blob := seal(t, key, plain)
+	hs := headerSize(t, blob)
+	blob[hs+2*recordSize+1] ^= 1 // last chunk
+
+	r, _, err := NewReader(bytes.NewReader(blob), key)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err == nil {
+		t.Fatal("tampered last chunk decrypted")
+	}
+	if !bytes.Equal(got, plain[:2*testChunkSize]) {
+		t.Fatalf("released %d bytes, want the %d of the intact chunks", len(got), 2*testChunkSize)
+	}
+}
+
+// legacyBlob seals plain in the pre-container layout: a nonce followed by
+// a single AES-GCM message without associated data.
+func legacyBlob(t *testing.T, key, plain []byte) []byte {
+	t.Helper()
+	aead, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, GCMNonceSize)
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plain, nil)
+}
+
+func TestContainerLegacyFormat(t *testing.T) {
+	key := testKey(t)
+	plain := []byte("written before the chunked container existed")
+	blob := legacyBlob(t, key, plain)
+
+	r, h, err := NewReader(bytes.NewReader(blob), key)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if !h.Legacy() {
+		t.Fatalf("header = %+v, want legacy", h)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("legacy read = %q, %v", got, err)
+	}
+
+	blob[len(blob)-1] ^= 1
+	if _, err := open(key, blob); err == nil {
+		t.Fatal("tampered legacy blob decrypted")
+	}
+	if _, err := open(key, blob[:5]); err == nil {
+		t.Fatal("short legacy blob decrypted")
+	}
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	h := &Header{
+		Version:     ContainerVersion,
+		Algorithm:   AlgorithmAES256GCM,
+		ChunkSize:   StreamChunkSize,
+		KeyID:       "kid",
+		NoncePrefix: bytes.Repeat([]byte{7}, StreamNoncePrefixSize),
+	}
+	raw, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	if len(raw) != h.Size() {
+		t.Fatalf("encoded %d bytes, Size says %d", len(raw), h.Size())
+	}
+	got, err := ReadHeader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadHeader: %v", err)
+	}
+	if got.ChunkSize != h.ChunkSize || got.KeyID != h.KeyID || !bytes.Equal(got.NoncePrefix, h.NoncePrefix) {
+		t.Fatalf("ReadHeader = %+v", got)
+	}
+
+	h.ChunkSize = MaxChunkSize + 1
+	raw, _ = h.MarshalBinary()
+	if _, err := ReadHeader(bytes.NewReader(raw)); err == nil {
+		t.Fatal("oversized chunk size accepted")
+	}
+	if _, err := ReadHeader(bytes.NewReader([]byte("not a container"))); !errors.Is(err, ErrUnsupportedContainer) {
+		t.Fatalf("ReadHeader of foreign data: err = %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+	HashBLAKE3 = "blake3"
+)
+
+// SupportedHash reports whether alg can be used with NewMultiHash.
+func SupportedHash(alg string) bool {
+	switch alg {
+	case HashSHA256, HashSHA512, HashBLAKE3:
+		return true
+	}
+	return false
+}
+
+func newHash(alg string) (hash.Hash, error) {
+	switch alg {
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashSHA512:
+		return sha512.New(), nil
+	case HashBLAKE3:
+		return blake3.New(32, nil), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", alg)
+}
+
+// MultiHash computes several digests over a single pass of data.
+type MultiHash struct {
+	algs   []string
+	hashes []hash.Hash
+	w      io.Writer
+}
+
+// NewMultiHash returns a MultiHash for the given algorithms.
+func NewMultiHash(algs ...string) (*MultiHash, error) {
+	m := &MultiHash{}
+	writers := make([]io.Writer, 0, len(algs))
+	for _, alg := range algs {
+		alg = strings.ToLower(strings.TrimSpace(alg))
+		h, err := newHash(alg)
+		if err != nil {
+			return nil, err
+		}
+		m.algs = append(m.algs, alg)
+		m.hashes = append(m.hashes, h)
+		writers = append(writers, h)
+	}
+	m.w = io.MultiWriter(writers...)
+	return m, nil
+}
+
+func (m *MultiHash) Write(p []byte) (int, error) {
+	return m.w.Write(p)
+}
+
+// Sums returns the hex-encoded digests keyed by algorithm.
+func (m *MultiHash) Sums() map[string]string {
+	sums := make(map[string]string, len(m.algs))
+	for i, alg := range m.algs {
+		sums[alg] = hex.EncodeToString(m.hashes[i].Sum(nil))
+	}
+	return sums
+}
@@ -0,0 +1,150 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type seekReader struct {
+	src       io.ReadSeeker
+	aead      cipher.AEAD
+	header    []byte
+	prefix    []byte
+	chunkSize int64
+	record    []byte
+	chunks    int64
+	size      int64
+	pos       int64
+
+	cached int64
+	plain  []byte
+}
+
+// NewSeekReader returns a seekable reader over the plaintext of an encrypted
+// blob together with the plaintext size. Containers are decrypted lazily:
+// only the chunks covering the bytes actually read are fetched and
+// authenticated. Legacy blobs are decrypted in full up front.
+func NewSeekReader(src io.ReadSeeker, key []byte) (io.ReadSeeker, int64, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, fmt.Errorf("seek: %w", err)
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, fmt.Errorf("seek: %w", err)
+	}
+
+	br := bufio.NewReader(src)
+	magic, err := br.Peek(len(containerMagic))
+	if err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("read header: %w", err)
+	}
+	if !bytes.Equal(magic, containerMagic) {
+		plain, err := openLegacy(br, aead)
+		if err != nil {
+			return nil, 0, err
+		}
+		return bytes.NewReader(plain), int64(len(plain)), nil
+	}
+
+	h, err := ReadHeader(br)
+	if err != nil {
+		return nil, 0, err
+	}
+	if h.KeyID != KeyFingerprint(key) {
+		return nil, 0, ErrKeyMismatch
+	}
+	header, err := h.MarshalBinary()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	recordSize := int64(h.ChunkSize) + int64(aead.Overhead())
+	body := total - int64(len(header))
+	if body < int64(aead.Overhead()) {
+		return nil, 0, ErrStreamTruncated
+	}
+	chunks := (body + recordSize - 1) / recordSize
+	size := body - chunks*int64(aead.Overhead())
+	if size < 0 {
+		return nil, 0, ErrStreamTruncated
+	}
+
+	return &seekReader{
+		src:       src,
+		aead:      aead,
+		header:    header,
+		prefix:    h.NoncePrefix,
+		chunkSize: int64(h.ChunkSize),
+		record:    make([]byte, recordSize),
+		chunks:    chunks,
+		size:      size,
+		cached:    -1,
+	}, size, nil
+}
+
+func (r *seekReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.pos + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = abs
+	return abs, nil
+}
+
+func (r *seekReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	index := r.pos / r.chunkSize
+	if err := r.load(index); err != nil {
+		return 0, err
+	}
+	n := copy(p, r.plain[r.pos-index*r.chunkSize:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// load decrypts chunk index into the single-chunk cache.
+func (r *seekReader) load(index int64) error {
+	if r.cached == index {
+		return nil
+	}
+	offset := int64(len(r.header)) + index*int64(len(r.record))
+	if _, err := r.src.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek chunk %d: %w", index, err)
+	}
+	// The cached plaintext aliases the record buffer.
+	r.cached = -1
+	n, err := io.ReadFull(r.src, r.record)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("read chunk %d: %w", index, err)
+	}
+
+	last := index == r.chunks-1
+	plain, err := r.aead.Open(r.record[:0], chunkNonce(r.prefix, uint32(index), last), r.record[:n], r.header)
+	if err != nil {
+		return fmt.Errorf("decrypt chunk %d: %w", index, err)
+	}
+	r.plain = plain
+	r.cached = index
+	return nil
+}
@@ -0,0 +1,142 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestSeekReader(t *testing.T) {
+	key := testKey(t)
+	for _, size := range []int{0, 1, testChunkSize, 3 * testChunkSize, 5*testChunkSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		blob := seal(t, key, plain)
+
+		r, n, err := NewSeekReader(bytes.NewReader(blob), key)
+		if err != nil {
+			t.Fatalf("size %d: NewSeekReader: %v", size, err)
+		}
+		if n != int64(size) {
+			t.Fatalf("size %d: reported size %d", size, n)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: full read differs: %v", size, err)
+		}
+
+		// Windows that start and end inside, on and across chunk boundaries.
+		for _, w := range [][2]int{{0, 1}, {testChunkSize - 1, 2}, {testChunkSize, testChunkSize}, {10, 2*testChunkSize + 5}, {size - 3, 3}} {
+			off, length := w[0], w[1]
+			if off < 0 || off+length > size {
+				continue
+			}
+			if _, err := r.Seek(int64(off), io.SeekStart); err != nil {
+				t.Fatalf("Seek: %v", err)
+			}
+			buf := make([]byte, length)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				t.Fatalf("size %d: read %d@%d: %v", size, length, off, err)
+			}
+			if !bytes.Equal(buf, plain[off:off+length]) {
+				t.Fatalf("size %d: window %d@%d differs", size, length, off)
+			}
+		}
+
+		if pos, err := r.Seek(-1, io.SeekEnd); size > 0 && (err != nil || pos != int64(size-1)) {
+			t.Fatalf("Seek from end = %d, %v", pos, err)
+		}
+		if _, err := r.Seek(int64(size)+10, io.SeekStart); err != nil {
+			t.Fatalf("Seek past end: %v", err)
+		}
+		if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("read past end: err = %v, want EOF", err)
+		}
+		if _, err := r.Seek(-1, io.SeekStart); err == nil {
+			t.Fatal("negative position accepted")
+		}
+	}
+}
+
+func TestSeekReaderTampering(t *testing.T) {
+	key := testKey(t)
+	plain := make([]byte, 3*testChunkSize+10)
+	rand.Read(plain)
+	blob := seal(t, key, plain)
+	hs := headerSize(t, blob)
+
+	t.Run("dropped last chunk", func(t *testing.T) {
+		r, n, err := NewSeekReader(bytes.NewReader(blob[:hs+3*recordSize]), key)
+		if err != nil {
+			t.Fatalf("NewSeekReader: %v", err)
+		}
+		// The size looks plausible, but the new last chunk was not sealed
+		// as final.
+		if _, err := r.Seek(n-1, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Read(make([]byte, 1)); err == nil {
+			t.Fatal("truncated container decrypted")
+		}
+	})
+
+	t.Run("swapped chunks", func(t *testing.T) {
+		b := append([]byte(nil), blob...)
+		first := append([]byte(nil), b[hs:hs+recordSize]...)
+		copy(b[hs:], b[hs+recordSize:hs+2*recordSize])
+		copy(b[hs+recordSize:], first)
+		r, _, err := NewSeekReader(bytes.NewReader(b), key)
+		if err != nil {
+			t.Fatalf("NewSeekReader: %v", err)
+		}
+		if _, err := r.Read(make([]byte, 1)); err == nil {
+			t.Fatal("chunk moved to another position decrypted")
+		}
+	})
+
+	t.Run("tampered header", func(t *testing.T) {
+		b := append([]byte(nil), blob...)
+		b[hs-1] ^= 1
+		r, _, err := NewSeekReader(bytes.NewReader(b), key)
+		if err != nil {
+			t.Fatalf("NewSeekReader: %v", err)
+		}
+		if _, err := r.Read(make([]byte, 1)); err == nil {
+			t.Fatal("chunk decrypted under a changed header")
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		if _, _, err := NewSeekReader(bytes.NewReader(blob), testKey(t)); !errors.Is(err, ErrKeyMismatch) {
+			t.Fatalf("err = %v, want ErrKeyMismatch", err)
+		}
+	})
+
+	t.Run("header only", func(t *testing.T) {
+		if _, _, err := NewSeekReader(bytes.NewReader(blob[:hs]), key); !errors.Is(err, ErrStreamTruncated) {
+			t.Fatalf("err = %v, want ErrStreamTruncated", err)
+		}
+	})
+}
+
+func TestSeekReaderLegacyFormat(t *testing.T) {
+	key := testKey(t)
+	plain := []byte("written before the chunked container existed")
+
+	r, n, err := NewSeekReader(bytes.NewReader(legacyBlob(t, key, plain)), key)
+	if err != nil {
+		t.Fatalf("NewSeekReader: %v", err)
+	}
+	if n != int64(len(plain)) {
+		t.Fatalf("size = %d, want %d", n, len(plain))
+	}
+	if _, err := r.Seek(8, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, plain[8:]) {
+		t.Fatalf("read after Seek = %q, %v", got, err)
+	}
+}